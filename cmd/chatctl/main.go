@@ -0,0 +1,140 @@
+package main
+
+import (
+	"cmp"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"log"
+	"os"
+	"strings"
+	"text/tabwriter"
+	"time"
+
+	"github.com/jennxsierra/dualnet-chat/internal/admin"
+)
+
+const usage = `Usage: chatctl [flags] <command> [arguments]
+
+Commands:
+  sessions                       list connected clients
+  kick <id|name> [reason]        disconnect a client
+  ban [--addr] <id|name>         ban a client's name (or IP address) and disconnect it
+  announce [--room r] <text>     send a server notice to everyone or one room
+  rooms                          list rooms and their members
+  history [--room r] [-n N]      show recent messages
+
+Flags:
+`
+
+func main() {
+	log.SetFlags(0)
+
+	addr := flag.String("addr", cmp.Or(os.Getenv("CHATCTL_ADDR"), "127.0.0.1:9200"), "Address of the server's admin API (or $CHATCTL_ADDR)") // --addr flag
+	token := flag.String("token", "", "Admin token, defaults to $CHAT_ADMIN_TOKEN")                                                          // --token flag
+	asJSON := flag.Bool("json", false, "Print raw JSON instead of tables")                                                                   // --json flag
+	flag.Usage = func() {
+		fmt.Fprint(flag.CommandLine.Output(), usage)
+		flag.PrintDefaults()
+	}
+	flag.Parse()
+
+	if flag.NArg() == 0 {
+		flag.Usage()
+		os.Exit(2)
+	}
+
+	client := &admin.Client{Addr: *addr, Token: cmp.Or(*token, os.Getenv("CHAT_ADMIN_TOKEN"))}
+	command, args := flag.Arg(0), flag.Args()[1:]
+
+	// show writes v as JSON or, unless --json was given, calls table instead
+	show := func(v any, table func(w *tabwriter.Writer)) {
+		if *asJSON {
+			encoder := json.NewEncoder(os.Stdout)
+			encoder.SetIndent("", "  ")
+			encoder.Encode(v)
+			return
+		}
+		w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+		table(w)
+		w.Flush()
+	}
+
+	switch command {
+	case "sessions":
+		sessions, err := client.Sessions()
+		check(err)
+		show(sessions, func(w *tabwriter.Writer) {
+			fmt.Fprintln(w, "ID\tNAME\tTRANSPORT\tADDR\tROOMS\tIDLE\tAWAY\tRATE")
+			for _, s := range sessions {
+				idle := (time.Duration(s.IdleSeconds) * time.Second).String()
+				rate := fmt.Sprintf("%.1f/%d at %g/s", s.RateTokens, s.RateBurst, s.RateLimit)
+				fmt.Fprintf(w, "%s\t%s\t%s\t%s\t%s\t%s\t%t\t%s\n", s.ID, s.Name, s.Transport, s.Addr, strings.Join(s.Rooms, ","), idle, s.Away, rate)
+			}
+		})
+
+	case "kick":
+		if len(args) == 0 {
+			log.Fatalln("[error] Usage: chatctl kick <id|name> [reason]")
+		}
+		check(client.Kick(args[0], strings.Join(args[1:], " ")))
+		fmt.Printf("Kicked %s.\n", args[0])
+
+	case "ban":
+		fs := flag.NewFlagSet("ban", flag.ExitOnError)
+		byAddr := fs.Bool("addr", false, "Ban the client's IP address instead of its name")
+		fs.Parse(args)
+		if fs.NArg() == 0 {
+			log.Fatalln("[error] Usage: chatctl ban [--addr] <id|name>")
+		}
+		entry, err := client.Ban(fs.Arg(0), *byAddr)
+		check(err)
+		fmt.Printf("Banned %s.\n", entry)
+
+	case "announce":
+		fs := flag.NewFlagSet("announce", flag.ExitOnError)
+		room := fs.String("room", "", "Only announce to this room")
+		fs.Parse(args)
+		if fs.NArg() == 0 {
+			log.Fatalln("[error] Usage: chatctl announce [--room r] <text>")
+		}
+		n, err := client.Announce(*room, strings.Join(fs.Args(), " "))
+		check(err)
+		fmt.Printf("Announced to %d client(s).\n", n)
+
+	case "rooms":
+		rooms, err := client.Rooms()
+		check(err)
+		show(rooms, func(w *tabwriter.Writer) {
+			fmt.Fprintln(w, "ROOM\tMEMBERS")
+			for _, r := range rooms {
+				fmt.Fprintf(w, "#%s\t%s\n", r.Name, strings.Join(r.Members, ", "))
+			}
+		})
+
+	case "history":
+		fs := flag.NewFlagSet("history", flag.ExitOnError)
+		room := fs.String("room", "", "Only show messages from this room")
+		limit := fs.Int("n", 20, "Number of messages to show")
+		fs.Parse(args)
+		messages, err := client.History(*room, *limit)
+		check(err)
+		show(messages, func(w *tabwriter.Writer) {
+			for _, m := range messages {
+				fmt.Fprintf(w, "%d\t%s\t#%s\t[%s]:\t%s\n", m.ID, m.Time.Local().Format(time.DateTime), m.Room, m.From, m.Text)
+			}
+		})
+
+	default:
+		log.Printf("[error] Unknown command %q.\n\n", command)
+		flag.Usage()
+		os.Exit(2)
+	}
+}
+
+// check exits with the error, if any.
+func check(err error) {
+	if err != nil {
+		log.Fatalf("[error] %v\n", err)
+	}
+}
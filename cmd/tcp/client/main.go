@@ -1,12 +1,32 @@
 package main
 
 import (
+	"crypto/tls"
+	"errors"
 	"flag"
 	"log"
 	"os"
+	"os/user"
+	"regexp"
+	"strings"
+	"time"
 
+	"github.com/fatih/color"
+	"github.com/jennxsierra/dualnet-chat/internal/commands"
+	"github.com/jennxsierra/dualnet-chat/internal/discovery"
 	"github.com/jennxsierra/dualnet-chat/internal/netutils"
 	"github.com/jennxsierra/dualnet-chat/internal/tcp/client"
+	"github.com/jennxsierra/dualnet-chat/internal/ui"
+)
+
+// how long --discover waits for servers to answer
+const discoverTimeout = 2 * time.Second
+
+// exit codes of scripts, besides 0 for success
+const (
+	exitFailed  = 1 // unable to connect, or disconnected before the end
+	exitUsage   = 2 // invalid flags
+	exitTimeout = 3 // the replies waited for did not arrive in time
 )
 
 func main() {
@@ -16,19 +36,153 @@ func main() {
 		log.Fatalln("[error] Failed to retrieve hostname:", err)
 	}
 
-	clientName := flag.String("name", hostname, "Name of the client")                            // --name flag
-	serverAddr := flag.String("server", "127.0.0.1:4000", "Address of the server to connect to") // --server flag
+	clientName := flag.String("name", hostname, "Name of the client")                                                       // --name flag
+	serverAddr := flag.String("server", "127.0.0.1:4000", "Address of the server to connect to, host:port or unix:///path") // --server flag
+	useTLS := flag.Bool("tls", false, "Connect to the server over TLS")                                                     // --tls flag
+	insecure := flag.Bool("insecure", false, "Skip TLS certificate verification (self-signed)")                             // --insecure flag
+	discover := flag.Bool("discover", false, "List the servers on the local network and pick one to connect to")            // --discover flag
+	fullScreen := flag.Bool("tui", false, "Use the full-screen interface instead of the prompt")                            // --tui flag
+
+	// scripting mode, for CI jobs and cron
+	scriptMode := flag.Bool("script", false, "Send the lines of standard input and print what arrives as JSON lines") // --script flag
+	message := flag.String("message", "", "Send this message like --script, instead of standard input")               // --message flag
+	replies := flag.Int("replies", 0, "In scripts, wait for this many messages after sending")                        // --replies flag
+	match := flag.String("match", "", "In scripts, wait for a message matching this regular expression")              // --match flag
+	timeout := flag.Duration("timeout", 10*time.Second, "In scripts, how long to wait for the server")                // --timeout flag
+	delay := flag.Duration("delay", time.Second, "In scripts, pause between messages to avoid the rate limit")        // --delay flag
+
+	// how lines look
+	noColor := flag.Bool("no-color", false, "Show everything without colors, like NO_COLOR")               // --no-color flag
+	timeFormat := flag.String("time-format", ui.DefaultTimeFormat, "Layout of timestamps, empty for none") // --time-format flag
+	keywords := flag.String("keywords", "", "Comma-separated words that count as mentions besides @name")  // --keywords flag
+	notify := flag.String("notify", "bell", "How to tell about mentions: off, bell, osc9 or osc777")       // --notify flag
+
+	// messages kept on this machine
+	logDir := flag.String("log-dir", "", "Log the messages of every room to a file in this directory") // --log-dir flag
+
+	// files other users send
+	downloadDir := flag.String("download-dir", "", "Save the files other users send in this directory, the current one by default") // --download-dir flag
 	flag.Parse()
 
+	// NO_COLOR is honored on its own
+	if *noColor {
+		color.NoColor = true
+	}
+
+	// mentions are notified in a way the terminal understands
+	notification, err := ui.ParseNotification(*notify)
+	if err != nil {
+		log.Printf("[error] Invalid --notify: %v\n", err)
+		os.Exit(exitUsage)
+	}
+
+	// in scripts, send --message or standard input without a prompt, printing
+	// what arrives as JSON lines
+	var script *ui.Script
+	if *scriptMode || *message != "" {
+		if *discover {
+			log.Println("[error] --discover needs a terminal to pick a server; use --server in scripts.")
+			os.Exit(exitUsage)
+		}
+		script = ui.NewScript(os.Stdout, os.Stderr)
+		if *message != "" {
+			script.Lines = strings.Split(*message, "\n")
+		} else {
+			script.Input = os.Stdin
+		}
+		if *match != "" {
+			if script.Match, err = regexp.Compile(*match); err != nil {
+				log.Printf("[error] --match is not a valid regular expression: %v\n", err)
+				os.Exit(exitUsage)
+			}
+		}
+		script.Replies, script.Timeout, script.Delay = *replies, *timeout, *delay
+	}
+
+	// find a server on the local network instead of using --server
+	if *discover {
+		servers, err := discovery.Discover(discoverTimeout)
+		if err != nil {
+			log.Fatalf("[error] Unable to look for servers: %v\n", err)
+		}
+		server, addr, err := discovery.Choose(servers, "tcp", os.Stdin, os.Stdout)
+		if err != nil {
+			log.Fatalf("[error] No server picked: %v\n", err)
+		}
+		*serverAddr = addr
+		if endpoint, _ := server.Endpoint("tcp"); endpoint.TLS {
+			*useTLS = true
+		}
+	}
+
 	// ensure server address is valid
-	if !netutils.IsValidTCPAddress(*serverAddr) {
+	addr, err := netutils.ParseAddress(*serverAddr)
+	if err != nil {
 		log.Fatalf("[error] Address %s is invalid.\n", *serverAddr)
 	}
 
+	// over a Unix socket the server only accepts the name of the local user
+	if addr.Network == "unix" && !flagSet("name") {
+		if current, err := user.Current(); err == nil {
+			*clientName = current.Username
+		}
+	}
+
+	var tlsConfig *tls.Config
+	if *useTLS || *insecure {
+		tlsConfig = &tls.Config{InsecureSkipVerify: *insecure}
+	}
+
 	// create client and start chat
-	client, err := client.NewClient(*serverAddr, *clientName)
+	client, err := client.NewClient(addr, *clientName, tlsConfig)
 	if err != nil {
 		log.Fatalf("[error] Unable to connect to server: %v\n", err)
 	}
+	client.TimeFormat = *timeFormat
+	client.Keywords = commands.SplitKeywords(*keywords)
+	client.Notification = notification
+	client.LogDir = *logDir
+	client.DownloadDir = *downloadDir
+
+	// scripts take precedence over --tui, and exit with a code telling how they
+	// went
+	if script != nil {
+		client.UI = script
+		client.Start()
+		os.Exit(exitCode(script.Err()))
+	}
+
+	// take over the terminal if asked to, falling back to the prompt
+	if *fullScreen {
+		if screen, err := ui.NewScreen(client.Name, "tcp", addr.String()); err != nil {
+			log.Printf("[info] %v, using the prompt instead.\n", err)
+		} else {
+			client.UI = screen
+		}
+	}
 	client.Start()
 }
+
+// exitCode logs why a script failed, if it did, and returns the code to exit
+// with.
+func exitCode(err error) int {
+	if err == nil {
+		return 0
+	}
+	log.Printf("[error] %v\n", err)
+	if errors.Is(err, ui.ErrTimeout) {
+		return exitTimeout
+	}
+	return exitFailed
+}
+
+// flagSet reports whether the named flag was given on the command line.
+func flagSet(name string) bool {
+	set := false
+	flag.Visit(func(f *flag.Flag) {
+		if f.Name == name {
+			set = true
+		}
+	})
+	return set
+}
@@ -1,12 +1,30 @@
 package main
 
 import (
+	"errors"
 	"flag"
 	"log"
 	"os"
+	"regexp"
+	"strings"
+	"time"
 
+	"github.com/fatih/color"
+	"github.com/jennxsierra/dualnet-chat/internal/commands"
+	"github.com/jennxsierra/dualnet-chat/internal/discovery"
 	"github.com/jennxsierra/dualnet-chat/internal/netutils"
 	"github.com/jennxsierra/dualnet-chat/internal/udp/client"
+	"github.com/jennxsierra/dualnet-chat/internal/ui"
+)
+
+// How long --discover waits for servers to answer
+const discoverTimeout = 2 * time.Second
+
+// Exit codes of scripts, besides 0 for success
+const (
+	exitFailed  = 1 // Unable to reach the server, or disconnected before the end
+	exitUsage   = 2 // Invalid flags
+	exitTimeout = 3 // The replies waited for did not arrive in time
 )
 
 func main() {
@@ -18,8 +36,64 @@ func main() {
 
 	clientName := flag.String("name", hostname, "Name of the client")                            // --name flag
 	serverAddr := flag.String("server", "127.0.0.1:4001", "Address of the server to connect to") // --server flag
+	heartbeat := flag.Duration("heartbeat", 10*time.Second, "Interval between heartbeats")       // --heartbeat flag
+	maxMissed := flag.Int("max-missed", 3, "Unanswered heartbeats before the server is lost")    // --max-missed flag
+	discover := flag.Bool("discover", false, "Pick a server from those on the local network")    // --discover flag
+	fullScreen := flag.Bool("tui", false, "Use the full-screen interface instead of the prompt") // --tui flag
+
+	// Scripting mode, for CI jobs and cron
+	scriptMode := flag.Bool("script", false, "Send the lines of standard input and print what arrives as JSON lines") // --script flag
+	message := flag.String("message", "", "Send this message like --script, instead of standard input")               // --message flag
+	replies := flag.Int("replies", 0, "In scripts, wait for this many messages after sending")                        // --replies flag
+	match := flag.String("match", "", "In scripts, wait for a message matching this regular expression")              // --match flag
+	timeout := flag.Duration("timeout", 10*time.Second, "In scripts, how long to wait for the server")                // --timeout flag
+	delay := flag.Duration("delay", time.Second, "In scripts, pause between messages to avoid the rate limit")        // --delay flag
+
+	// How lines look
+	noColor := flag.Bool("no-color", false, "Show everything without colors, like NO_COLOR")               // --no-color flag
+	timeFormat := flag.String("time-format", ui.DefaultTimeFormat, "Layout of timestamps, empty for none") // --time-format flag
+	keywords := flag.String("keywords", "", "Comma-separated words that count as mentions besides @name")  // --keywords flag
+	notify := flag.String("notify", "bell", "How to tell about mentions: off, bell, osc9 or osc777")       // --notify flag
+
+	// Messages kept on this machine
+	logDir := flag.String("log-dir", "", "Log the messages of every room to a file in this directory") // --log-dir flag
 	flag.Parse()
 
+	// NO_COLOR is honored on its own
+	if *noColor {
+		color.NoColor = true
+	}
+
+	// Mentions are notified in a way the terminal understands
+	notification, err := ui.ParseNotification(*notify)
+	if err != nil {
+		log.Printf("[error] Invalid --notify: %v\n", err)
+		os.Exit(exitUsage)
+	}
+
+	// In scripts, send --message or standard input without a prompt, printing
+	// what arrives as JSON lines
+	var script *ui.Script
+	if *scriptMode || *message != "" {
+		if *discover {
+			log.Println("[error] --discover needs a terminal to pick a server; use --server in scripts.")
+			os.Exit(exitUsage)
+		}
+		script = ui.NewScript(os.Stdout, os.Stderr)
+		if *message != "" {
+			script.Lines = strings.Split(*message, "\n")
+		} else {
+			script.Input = os.Stdin
+		}
+		if *match != "" {
+			if script.Match, err = regexp.Compile(*match); err != nil {
+				log.Printf("[error] --match is not a valid regular expression: %v\n", err)
+				os.Exit(exitUsage)
+			}
+		}
+		script.Replies, script.Timeout, script.Delay = *replies, *timeout, *delay
+	}
+
 	// Ensure server address is valid
 	port, err := netutils.GetPortFromAddress(*serverAddr)
 	if err != nil {
@@ -29,10 +103,65 @@ func main() {
 		log.Fatalf("[error] Address %s has invalid port number.\n", *serverAddr)
 	}
 
+	// Find a server on the local network instead of using --server, also probing
+	// the port of --server in case multicast does not get through
+	if *discover {
+		servers, err := discovery.Discover(discoverTimeout, port)
+		if err != nil {
+			log.Fatalf("[error] Unable to look for servers: %v\n", err)
+		}
+		_, addr, err := discovery.Choose(servers, "udp", os.Stdin, os.Stdout)
+		if err != nil {
+			log.Fatalf("[error] No server picked: %v\n", err)
+		}
+		*serverAddr = addr
+	}
+
+	// Ensure heartbeat settings are usable
+	if *heartbeat <= 0 || *maxMissed < 1 {
+		log.Fatalln("[error] --heartbeat must be positive and --max-missed at least 1.")
+	}
+
 	// Create client and start chat
 	client, err := client.NewClient(*serverAddr, *clientName)
 	if err != nil {
 		log.Fatalf("[error] Unable to connect to server: %v\n", err)
 	}
+	client.HeartbeatInterval = *heartbeat
+	client.MaxMissedHeartbeats = *maxMissed
+	client.TimeFormat = *timeFormat
+	client.Keywords = commands.SplitKeywords(*keywords)
+	client.Notification = notification
+	client.LogDir = *logDir
+
+	// Scripts take precedence over --tui, and exit with a code telling how they
+	// went
+	if script != nil {
+		client.UI = script
+		client.Start()
+		os.Exit(exitCode(script.Err()))
+	}
+
+	// Take over the terminal if asked to, falling back to the prompt
+	if *fullScreen {
+		if screen, err := ui.NewScreen(client.Name, "udp", *serverAddr); err != nil {
+			log.Printf("[info] %v, using the prompt instead.\n", err)
+		} else {
+			client.UI = screen
+		}
+	}
 	client.Start()
 }
+
+// exitCode logs why a script failed, if it did, and returns the code to exit
+// with
+func exitCode(err error) int {
+	if err == nil {
+		return 0
+	}
+	log.Printf("[error] %v\n", err)
+	if errors.Is(err, ui.ErrTimeout) {
+		return exitTimeout
+	}
+	return exitFailed
+}
@@ -1,26 +1,211 @@
 package main
 
 import (
+	"cmp"
 	"flag"
 	"fmt"
 	"log"
+	"log/slog"
+	"net"
+	"os"
+	"strconv"
+	"time"
 
-	"github.com/jennxsierra/dualnet-chat/internal/netutils"
+	"github.com/jennxsierra/dualnet-chat/internal/admin"
+	"github.com/jennxsierra/dualnet-chat/internal/config"
+	"github.com/jennxsierra/dualnet-chat/internal/discovery"
+	"github.com/jennxsierra/dualnet-chat/internal/irc"
+	"github.com/jennxsierra/dualnet-chat/internal/logging"
+	"github.com/jennxsierra/dualnet-chat/internal/metrics"
 	"github.com/jennxsierra/dualnet-chat/internal/udp/server"
+	"github.com/jennxsierra/dualnet-chat/internal/web"
 )
 
 func main() {
-	port := flag.Int("port", 4001, "Port to run the UDP server on") // --port flag
+	defaults := server.DefaultConfig()
+	cfg := defaults
+
+	configPath := flag.String("config", "", "Path to a JSON configuration file, reloaded on SIGHUP") // --config flag
+	port := flag.Int("port", 4001, "Port to run the UDP server on")                                  // --port flag
+
+	// Timeouts and idle policy
+	flag.DurationVar(&cfg.InactivityTimeout, "inactivity-timeout", cfg.InactivityTimeout, "Silence after which a client is dropped")
+	flag.DurationVar(&cfg.SweepInterval, "sweep-interval", cfg.SweepInterval, "How often inactive and idle clients are checked")
+	flag.DurationVar(&cfg.Idle.AwayAfter, "away-after", cfg.Idle.AwayAfter, "Idle time before a client is marked away (0 disables)")
+	flag.DurationVar(&cfg.Idle.DisconnectAfter, "idle-timeout", cfg.Idle.DisconnectAfter, "Idle time before a client is disconnected (0 disables)")
+
+	// Logging
+	logCfg := logging.DefaultConfig()
+	flag.StringVar(&logCfg.Level, "log-level", logCfg.Level, "Minimum log level: debug, info, warn or error")
+	flag.StringVar(&logCfg.Format, "log-format", logCfg.Format, "Log output format: text or json")
+	flag.StringVar(&logCfg.File, "log-file", logCfg.File, "Also write the log to this file, rotated by size")
+
+	// Metrics
+	metricsAddr := flag.String("metrics-addr", "", "Serve Prometheus metrics at /metrics on this address, e.g. 127.0.0.1:9100")
+
+	// WebSocket gateway
+	webAddr := flag.String("ws-addr", "", "Serve the WebSocket gateway and browser client on this address, e.g. [::]:8080")
+
+	// IRC gateway
+	ircAddr := flag.String("irc-addr", "", "Accept IRC clients on this address, e.g. [::]:6667")
+
+	// Admin API
+	adminAddr := flag.String("admin-addr", "", "Serve the admin API on this loopback address, e.g. 127.0.0.1:9200")
+	adminToken := flag.String("admin-token", "", "Token required by the admin API, defaults to $CHAT_ADMIN_TOKEN")
+
+	// Discovery
+	announce := flag.Bool("announce", true, "Announce the server on the local network for clients started with --discover")
+	serverName := flag.String("server-name", "", "Name to announce the server under, defaults to the host name")
 	flag.Parse()
 
-	// Ensure port is within the valid range
-	if !netutils.IsValidPort(*port) {
-		log.Fatalf("[error] Port %d is invalid. Port must be between 1 and 65535.\n", *port)
+	// Read the configuration file, if any, and let flags given on the command line override it
+	load := func() (config.File, error) {
+		file := config.New(fmt.Sprintf("[::]:%d", *port), defaults.Config)
+		if *configPath != "" {
+			var err error
+			if file, err = config.Load(*configPath, file); err != nil {
+				return config.File{}, err
+			}
+		}
+
+		if token := cmp.Or(*adminToken, os.Getenv("CHAT_ADMIN_TOKEN")); token != "" {
+			file.Admin.Token = token
+		}
+		flag.Visit(func(f *flag.Flag) {
+			switch f.Name {
+			case "port":
+				host, _, _ := net.SplitHostPort(file.Listen)
+				file.Listen = net.JoinHostPort(host, strconv.Itoa(*port))
+			case "inactivity-timeout":
+				file.Timeouts.Inactivity = config.Duration(cfg.InactivityTimeout)
+			case "admin-addr":
+				file.Admin.Listen = *adminAddr
+			case "announce":
+				file.Discovery.Announce = *announce
+			case "server-name":
+				file.Discovery.Name = *serverName
+			case "metrics-addr":
+				file.Metrics = *metricsAddr
+			case "ws-addr":
+				file.Web = *webAddr
+			case "irc-addr":
+				file.IRC = *ircAddr
+			case "log-level":
+				file.Log.Level = logCfg.Level
+			case "log-format":
+				file.Log.Format = logCfg.Format
+			case "log-file":
+				file.Log.File = logCfg.File
+			case "sweep-interval":
+				file.Timeouts.Sweep = config.Duration(cfg.SweepInterval)
+			case "away-after":
+				file.Timeouts.AwayAfter = config.Duration(cfg.Idle.AwayAfter)
+			case "idle-timeout":
+				file.Timeouts.IdleTimeout = config.Duration(cfg.Idle.DisconnectAfter)
+			}
+		})
+
+		return file, file.Validate("udp")
+	}
+
+	file, err := load()
+	if err != nil {
+		log.Fatalf("[error] Invalid configuration:\n%v\n", err)
 	}
+	if err := logging.Setup(file.Log); err != nil {
+		log.Fatalf("[error] Unable to open log file: %v\n", err)
+	}
+
+	// Serve metrics if requested
+	if addr := file.Metrics; addr != "" {
+		go func() {
+			if err := metrics.ListenAndServe(addr); err != nil {
+				slog.Error("metrics listener failed", "addr", addr, "err", err)
+			}
+		}()
+	}
+
+	// Create the server
+	server := server.NewServer(file.Listen, serverConfig(file))
 
-	// Create and start server
-	server := server.NewServer(fmt.Sprintf("0.0.0.0:%d", *port))
+	// Serve the WebSocket gateway if requested
+	if addr := file.Web; addr != "" {
+		go func() {
+			if err := web.ListenAndServe(addr, server.Hub); err != nil {
+				slog.Error("websocket gateway failed", "addr", addr, "err", err)
+			}
+		}()
+	}
+
+	// Serve the IRC gateway if requested
+	if addr := file.IRC; addr != "" {
+		go func() {
+			if err := irc.ListenAndServe(addr, server.Hub); err != nil {
+				slog.Error("irc gateway failed", "addr", addr, "err", err)
+			}
+		}()
+	}
+
+	// Serve the admin API if requested
+	if cfg := file.Admin; cfg.Listen != "" {
+		go func() {
+			if err := admin.ListenAndServe(cfg.Listen, cfg.Token, server.Hub); err != nil {
+				slog.Error("admin API failed", "addr", cfg.Listen, "err", err)
+			}
+		}()
+	}
+
+	// Announce the server so clients can find it on the local network, and
+	// answer their probes on the chat socket as well
+	if d := file.Discovery; d.Announce {
+		announcer := discovery.NewAnnouncer(cmp.Or(d.Name, hostname()), file.Endpoints("udp"), server.Hub)
+		announcer.Interval = time.Duration(d.Interval)
+		server.Discovery = announcer
+		go func() {
+			if err := announcer.Run(); err != nil {
+				slog.Error("discovery announcements failed", "group", discovery.Group, "err", err)
+			}
+		}()
+	}
+
+	// Reload the configuration on SIGHUP, keeping the old one if the new one is invalid
+	config.OnReload(func() {
+		next, err := load()
+		if err != nil {
+			slog.Error("configuration not reloaded", "err", err)
+			return
+		}
+		if err := logging.Setup(next.Log); err != nil {
+			slog.Error("unable to open log file", "file", next.Log.File, "err", err)
+		}
+		for _, setting := range config.RestartRequired(file, next) {
+			slog.Warn("setting changed, restart the server to apply it", "setting", setting)
+		}
+		server.Reload(serverConfig(next))
+
+		// The listen addresses stay as they are until a restart
+		next.Listen, next.TLS, next.Metrics, next.Web, next.IRC, next.Admin = file.Listen, file.TLS, file.Metrics, file.Web, file.IRC, file.Admin
+		next.Discovery = file.Discovery
+		file = next
+		slog.Info("configuration reloaded")
+	})
+
+	// Start the server
 	if err := server.Start(); err != nil {
 		log.Fatalf("[error] Server failed to start: %v\n", err)
 	}
 }
+
+// serverConfig converts a validated configuration file to the server's configuration
+func serverConfig(file config.File) server.Config {
+	return server.Config{Config: file.Chat()}
+}
+
+// hostname returns the machine's host name, the default name to announce
+func hostname() string {
+	name, err := os.Hostname()
+	if err != nil {
+		return "dualnet-chat"
+	}
+	return name
+}
@@ -0,0 +1,261 @@
+// Package admin implements the servers' HTTP/JSON admin API and a client for
+// it. The API only listens on loopback addresses and every request must carry
+// the admin token.
+package admin
+
+import (
+	"crypto/subtle"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log/slog"
+	"net"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/jennxsierra/dualnet-chat/internal/chat"
+)
+
+// Session is a connected client as reported by the API.
+type Session struct {
+	ID          string    `json:"id"`
+	Name        string    `json:"name"`
+	Transport   string    `json:"transport"`
+	Addr        string    `json:"addr"`
+	Rooms       []string  `json:"rooms"`
+	IdleSeconds float64   `json:"idle_seconds"` // since the last chat message or command
+	LastSeen    time.Time `json:"last_seen"`    // last envelope of any kind
+	Away        bool      `json:"away"`
+	Operator    bool      `json:"operator"`
+	RateLimit   float64   `json:"rate_limit"`  // messages per second
+	RateBurst   int       `json:"rate_burst"`  // messages in a burst
+	RateTokens  float64   `json:"rate_tokens"` // messages the client may send right now
+}
+
+// Room is a room with at least one member.
+type Room struct {
+	Name    string   `json:"name"`
+	Members []string `json:"members"`
+}
+
+// Message is a chat message from the history.
+type Message struct {
+	ID   uint64    `json:"id"`
+	Time time.Time `json:"time"`
+	From string    `json:"from"`
+	Room string    `json:"room"`
+	Text string    `json:"text"`
+}
+
+// Announcement is the body of an announcement request.
+type Announcement struct {
+	Room string `json:"room,omitempty"` // every client if empty
+	Text string `json:"text"`
+}
+
+// KickRequest is the body of a kick request.
+type KickRequest struct {
+	Reason string `json:"reason,omitempty"`
+}
+
+// BanRequest is the body of a ban request.
+type BanRequest struct {
+	ByAddr bool `json:"by_addr,omitempty"` // ban the IP address instead of the name
+}
+
+// errorResponse is the body of every failed request.
+type errorResponse struct {
+	Error string `json:"error"`
+}
+
+// defaultHistoryLimit is how many messages the history endpoint returns by default.
+const defaultHistoryLimit = 50
+
+// Handler serves the admin API for the hub, requiring the given token.
+func Handler(hub *chat.Hub, token string) http.Handler {
+	mux := http.NewServeMux()
+
+	mux.HandleFunc("GET /api/sessions", func(w http.ResponseWriter, r *http.Request) {
+		now := time.Now()
+		sessions := []Session{}
+		for _, s := range hub.Sessions() {
+			sessions = append(sessions, Session{
+				ID:          s.ID,
+				Name:        s.Name,
+				Transport:   s.Transport,
+				Addr:        s.Addr,
+				Rooms:       s.Rooms,
+				IdleSeconds: now.Sub(s.LastActive).Seconds(),
+				LastSeen:    s.LastSeen,
+				Away:        s.Away,
+				Operator:    s.Operator,
+				RateLimit:   s.RateLimit,
+				RateBurst:   s.RateBurst,
+				RateTokens:  s.RateTokens,
+			})
+		}
+		writeJSON(w, http.StatusOK, sessions)
+	})
+
+	mux.HandleFunc("POST /api/sessions/{id}/kick", func(w http.ResponseWriter, r *http.Request) {
+		var req KickRequest
+		if !readJSON(w, r, &req) {
+			return
+		}
+		if err := hub.Kick(r.PathValue("id"), req.Reason); err != nil {
+			writeError(w, http.StatusNotFound, err)
+			return
+		}
+		w.WriteHeader(http.StatusNoContent)
+	})
+
+	mux.HandleFunc("POST /api/sessions/{id}/ban", func(w http.ResponseWriter, r *http.Request) {
+		var req BanRequest
+		if !readJSON(w, r, &req) {
+			return
+		}
+		entry, err := hub.Ban(r.PathValue("id"), req.ByAddr)
+		if errors.Is(err, chat.ErrNoSession) {
+			writeError(w, http.StatusNotFound, err)
+			return
+		} else if err != nil {
+			writeError(w, http.StatusBadRequest, err)
+			return
+		}
+		writeJSON(w, http.StatusOK, map[string]string{"ban": entry})
+	})
+
+	mux.HandleFunc("POST /api/announce", func(w http.ResponseWriter, r *http.Request) {
+		var req Announcement
+		if !readJSON(w, r, &req) {
+			return
+		}
+		if strings.TrimSpace(req.Text) == "" {
+			writeError(w, http.StatusBadRequest, errors.New("text must not be empty"))
+			return
+		}
+		room := req.Room
+		if room != "" {
+			var ok bool
+			if room, ok = chat.NormalizeRoom(room); !ok {
+				writeError(w, http.StatusBadRequest, fmt.Errorf("invalid room name %q", req.Room))
+				return
+			}
+		}
+		writeJSON(w, http.StatusOK, map[string]int{"recipients": hub.Announce(room, req.Text)})
+	})
+
+	mux.HandleFunc("GET /api/rooms", func(w http.ResponseWriter, r *http.Request) {
+		rooms := []Room{}
+		for _, room := range hub.Rooms() {
+			rooms = append(rooms, Room{Name: room.Name, Members: room.Members})
+		}
+		writeJSON(w, http.StatusOK, rooms)
+	})
+
+	mux.HandleFunc("GET /api/history", func(w http.ResponseWriter, r *http.Request) {
+		limit := defaultHistoryLimit
+		if value := r.URL.Query().Get("limit"); value != "" {
+			n, err := strconv.Atoi(value)
+			if err != nil || n <= 0 {
+				writeError(w, http.StatusBadRequest, fmt.Errorf("limit must be a positive number"))
+				return
+			}
+			limit = n
+		}
+		room := r.URL.Query().Get("room")
+		if room != "" {
+			var ok bool
+			if room, ok = chat.NormalizeRoom(room); !ok {
+				writeError(w, http.StatusBadRequest, fmt.Errorf("invalid room name %q", r.URL.Query().Get("room")))
+				return
+			}
+		}
+
+		messages := []Message{}
+		for _, e := range hub.History.Recent(limit, room) {
+			messages = append(messages, Message{ID: e.ID, Time: e.Time, From: e.From, Room: e.Room, Text: e.Text})
+		}
+		writeJSON(w, http.StatusOK, messages)
+	})
+
+	return requireToken(token, mux)
+}
+
+// requireToken rejects requests without "Authorization: Bearer <token>".
+func requireToken(token string, next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		given, ok := strings.CutPrefix(r.Header.Get("Authorization"), "Bearer ")
+		if !ok || subtle.ConstantTimeCompare([]byte(given), []byte(token)) != 1 {
+			writeError(w, http.StatusUnauthorized, errors.New("missing or invalid admin token"))
+			return
+		}
+		next.ServeHTTP(w, r)
+	})
+}
+
+// readJSON decodes an optional request body, answering with an error if it
+// is invalid.
+func readJSON(w http.ResponseWriter, r *http.Request, v any) bool {
+	if r.ContentLength == 0 {
+		return true
+	}
+	if err := json.NewDecoder(http.MaxBytesReader(w, r.Body, 64<<10)).Decode(v); err != nil {
+		writeError(w, http.StatusBadRequest, fmt.Errorf("invalid request body: %w", err))
+		return false
+	}
+	return true
+}
+
+// writeJSON writes v as the JSON response body.
+func writeJSON(w http.ResponseWriter, status int, v any) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(v)
+}
+
+// writeError writes an error response.
+func writeError(w http.ResponseWriter, status int, err error) {
+	writeJSON(w, status, errorResponse{Error: err.Error()})
+}
+
+// CheckAddr returns an error unless addr is a loopback address such as
+// "127.0.0.1:9200" or "[::1]:9200". The admin API must not be reachable from
+// other machines.
+func CheckAddr(addr string) error {
+	host, _, err := net.SplitHostPort(addr)
+	if err != nil {
+		return err
+	}
+	if host == "localhost" {
+		return nil
+	}
+	if ip := net.ParseIP(host); ip == nil || !ip.IsLoopback() {
+		return fmt.Errorf("%s is not a loopback address", addr)
+	}
+	return nil
+}
+
+// ListenAndServe serves the admin API on addr, which must be a loopback
+// address. It only returns on error.
+func ListenAndServe(addr, token string, hub *chat.Hub) error {
+	if err := CheckAddr(addr); err != nil {
+		return err
+	}
+	if token == "" {
+		return errors.New("the admin API requires a token")
+	}
+
+	listener, err := net.Listen("tcp", addr)
+	if err != nil {
+		return err
+	}
+	server := &http.Server{
+		Handler:           Handler(hub, token),
+		ReadHeaderTimeout: 5 * time.Second,
+	}
+	slog.Info("admin API listening", "addr", listener.Addr().String())
+	return server.Serve(listener)
+}
@@ -0,0 +1,110 @@
+package admin
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strconv"
+	"time"
+)
+
+// Client talks to a server's admin API.
+type Client struct {
+	Addr  string // e.g. "127.0.0.1:9200"
+	Token string
+
+	HTTP *http.Client // [http.DefaultClient] with a timeout if nil
+}
+
+// Sessions lists the connected clients.
+func (c *Client) Sessions() ([]Session, error) {
+	var sessions []Session
+	return sessions, c.do(http.MethodGet, "/api/sessions", nil, &sessions)
+}
+
+// Kick disconnects the session with the given ID or name.
+func (c *Client) Kick(idOrName, reason string) error {
+	return c.do(http.MethodPost, "/api/sessions/"+url.PathEscape(idOrName)+"/kick", KickRequest{Reason: reason}, nil)
+}
+
+// Ban bans and disconnects the session with the given ID or name, by name or
+// by IP address. It returns the added ban entry.
+func (c *Client) Ban(idOrName string, byAddr bool) (string, error) {
+	var result struct {
+		Ban string `json:"ban"`
+	}
+	err := c.do(http.MethodPost, "/api/sessions/"+url.PathEscape(idOrName)+"/ban", BanRequest{ByAddr: byAddr}, &result)
+	return result.Ban, err
+}
+
+// Announce sends a server notice to a room, or everyone if room is empty, and
+// returns how many clients it reached.
+func (c *Client) Announce(room, text string) (int, error) {
+	var result struct {
+		Recipients int `json:"recipients"`
+	}
+	err := c.do(http.MethodPost, "/api/announce", Announcement{Room: room, Text: text}, &result)
+	return result.Recipients, err
+}
+
+// Rooms lists the rooms that have members.
+func (c *Client) Rooms() ([]Room, error) {
+	var rooms []Room
+	return rooms, c.do(http.MethodGet, "/api/rooms", nil, &rooms)
+}
+
+// History returns up to limit recent messages, optionally from a single room.
+func (c *Client) History(room string, limit int) ([]Message, error) {
+	query := url.Values{"limit": {strconv.Itoa(limit)}}
+	if room != "" {
+		query.Set("room", room)
+	}
+	var messages []Message
+	return messages, c.do(http.MethodGet, "/api/history?"+query.Encode(), nil, &messages)
+}
+
+// do sends a request with an optional JSON body and decodes the JSON response
+// into result, if not nil.
+func (c *Client) do(method, path string, body, result any) error {
+	var data []byte
+	if body != nil {
+		var err error
+		if data, err = json.Marshal(body); err != nil {
+			return err
+		}
+	}
+
+	req, err := http.NewRequest(method, "http://"+c.Addr+path, bytes.NewReader(data))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Authorization", "Bearer "+c.Token)
+	if body != nil {
+		req.Header.Set("Content-Type", "application/json")
+	}
+
+	client := c.HTTP
+	if client == nil {
+		client = &http.Client{Timeout: 10 * time.Second}
+	}
+	resp, err := client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode >= 300 {
+		var apiErr errorResponse
+		if json.NewDecoder(resp.Body).Decode(&apiErr) == nil && apiErr.Error != "" {
+			return errors.New(apiErr.Error)
+		}
+		return fmt.Errorf("unexpected response: %s", resp.Status)
+	}
+	if result == nil || resp.StatusCode == http.StatusNoContent {
+		return nil
+	}
+	return json.NewDecoder(resp.Body).Decode(result)
+}
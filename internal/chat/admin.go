@@ -0,0 +1,127 @@
+package chat
+
+import (
+	"errors"
+	"fmt"
+	"log/slog"
+	"maps"
+	"net"
+	"slices"
+	"strings"
+
+	"github.com/jennxsierra/dualnet-chat/internal/protocol"
+)
+
+// ErrNoSession is returned when no session matches the given ID or name.
+var ErrNoSession = errors.New("no such session")
+
+// RoomInfo describes a room that has at least one member.
+type RoomInfo struct {
+	Name    string
+	Members []string
+}
+
+// Kick disconnects the session with the given ID or name and tells its client
+// not to reconnect.
+func (h *Hub) Kick(idOrName, reason string) error {
+	err := ErrNoSession
+	h.call(func() {
+		s := h.find(idOrName)
+		if s == nil {
+			return
+		}
+		text := "You were kicked from the server."
+		if reason != "" {
+			text = fmt.Sprintf("You were kicked from the server: %s", reason)
+		}
+		s.Conn.Send(protocol.Envelope{Type: protocol.TypeBye, Text: text})
+		h.remove(s, "kicked")
+		err = nil
+	})
+	return err
+}
+
+// Ban bans the name of the session with the given ID or name, without the
+// address after any "@", or its IP address if byAddr is set, and disconnects
+// it. It returns the added ban entry. Bans added this way last until the
+// server restarts.
+func (h *Hub) Ban(idOrName string, byAddr bool) (string, error) {
+	var entry string
+	err := ErrNoSession
+	h.call(func() {
+		s := h.find(idOrName)
+		if s == nil {
+			return
+		}
+		// TCP clients name themselves after their port, so only the name before
+		// the "@" stays the same when they come back
+		entry, _, _ = strings.Cut(s.Name, "@")
+		if byAddr {
+			if host, _, splitErr := net.SplitHostPort(s.Conn.Addr()); splitErr == nil {
+				entry = host
+			}
+		}
+		if err = h.bans.Add(entry); err != nil {
+			return
+		}
+
+		slog.Warn("client banned", "client", s.Name, "addr", s.Conn.Addr(), "ban", entry)
+		s.Conn.Send(protocol.Envelope{Type: protocol.TypeBye, Text: "You are banned from this server."})
+		h.remove(s, "banned")
+	})
+	return entry, err
+}
+
+// Announce sends a server notice to every client in the given room, or to
+// every client if room is empty. It returns how many clients it reached.
+func (h *Hub) Announce(room, text string) int {
+	var reached int
+	h.call(func() {
+		reached = h.announce(room, text)
+		slog.Info("announcement", "room", room, "recipients", reached)
+	})
+	return reached
+}
+
+// announce sends a server notice to every client in the room, or every client
+// if room is empty, and returns how many clients it reached.
+func (h *Hub) announce(room, text string) int {
+	var reached int
+	for _, s := range h.sessions {
+		if room == "" || slices.Contains(s.Rooms, room) {
+			s.Conn.Send(protocol.Envelope{Type: protocol.TypeNotice, Room: room, Text: text})
+			reached++
+		}
+	}
+	return reached
+}
+
+// Rooms returns the rooms that have members, sorted by name.
+func (h *Hub) Rooms() []RoomInfo {
+	var rooms []RoomInfo
+	h.call(func() {
+		members := make(map[string][]string)
+		for _, s := range h.sessions {
+			for _, room := range s.Rooms {
+				members[room] = append(members[room], s.Name)
+			}
+		}
+		for _, name := range slices.Sorted(maps.Keys(members)) {
+			rooms = append(rooms, RoomInfo{Name: name, Members: slices.Sorted(slices.Values(members[name]))})
+		}
+	})
+	return rooms
+}
+
+// find returns the session with the given ID or, failing that, name.
+func (h *Hub) find(idOrName string) *Session {
+	if s := h.sessions[idOrName]; s != nil {
+		return s
+	}
+	return h.byName(idOrName)
+}
+
+// banned reports whether a client is banned by the configuration or an operator.
+func (h *Hub) banned(name, addr string) bool {
+	return h.config.Bans.Banned(name, addr) || h.bans.Banned(name, addr)
+}
@@ -0,0 +1,77 @@
+package chat
+
+import (
+	"fmt"
+	"net"
+	"net/netip"
+	"strings"
+)
+
+// BanList holds the clients that may not connect. Entries are client names,
+// IP addresses or CIDR prefixes.
+type BanList struct {
+	names    []string
+	prefixes []netip.Prefix
+}
+
+// ParseBans builds a [BanList] from its entries.
+func ParseBans(entries []string) (BanList, error) {
+	var bans BanList
+	for _, entry := range entries {
+		if err := bans.Add(entry); err != nil {
+			return BanList{}, err
+		}
+	}
+	return bans, nil
+}
+
+// Add bans one more entry. Anything that parses as an IP address or CIDR
+// prefix bans addresses, anything else bans a name.
+func (b *BanList) Add(entry string) error {
+	entry = strings.TrimSpace(entry)
+	switch {
+	case entry == "":
+		return fmt.Errorf("empty ban entry")
+	case strings.Contains(entry, "/"):
+		prefix, err := netip.ParsePrefix(entry)
+		if err != nil {
+			return fmt.Errorf("ban %q: %w", entry, err)
+		}
+		b.prefixes = append(b.prefixes, prefix.Masked())
+	default:
+		if addr, err := netip.ParseAddr(entry); err == nil {
+			b.prefixes = append(b.prefixes, netip.PrefixFrom(addr, addr.BitLen()))
+		} else {
+			b.names = append(b.names, entry)
+		}
+	}
+	return nil
+}
+
+// Banned reports whether a client with the given name and remote address
+// ("host:port") is banned. Names match the part before any "@", so banning
+// "alice" also bans "alice@192.168.1.5:51756".
+func (b BanList) Banned(name, addr string) bool {
+	base, _, _ := strings.Cut(name, "@")
+	for _, banned := range b.names {
+		if strings.EqualFold(banned, name) || strings.EqualFold(banned, base) {
+			return true
+		}
+	}
+
+	host, _, err := net.SplitHostPort(addr)
+	if err != nil {
+		host = addr
+	}
+	ip, err := netip.ParseAddr(host)
+	if err != nil {
+		return false
+	}
+	ip = ip.Unmap().WithZone("") // prefixes never match zoned addresses
+	for _, prefix := range b.prefixes {
+		if prefix.Contains(ip) {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,179 @@
+package chat
+
+import (
+	"fmt"
+	"log/slog"
+
+	"github.com/jennxsierra/dualnet-chat/internal/protocol"
+)
+
+// transfer is a file on its way from one client to another. The hub relays
+// its chunks without keeping them, and checks them against its limits.
+type transfer struct {
+	id       string
+	from, to *Session
+	name     string
+	size     int64
+	accepted bool
+	next     int64 // offset the next chunk has to start at
+	acked    int64 // how much of the file the recipient saved
+}
+
+// streams reports whether a connection can carry file transfers. Only those
+// of the stream transports arrive whole and in order.
+func streams(conn Conn) bool {
+	t := conn.Transport()
+	return t == "tcp" || t == "unix"
+}
+
+// handleFile relays an envelope of a file transfer between the sender and the
+// recipient. Envelopes of transfers that ended already are dropped.
+func (h *Hub) handleFile(s *Session, e protocol.Envelope) {
+	f := e.File
+	if f == nil || f.ID == "" {
+		return
+	}
+	if e.Type == protocol.TypeFileOffer {
+		h.markActive(s)
+		h.offerFile(s, e.To, *f)
+		return
+	}
+
+	t := h.transfers[f.ID]
+	if t == nil || (s != t.from && s != t.to) {
+		return
+	}
+	switch e.Type {
+	case protocol.TypeFileAccept:
+		if s != t.to || t.accepted {
+			return
+		}
+		if f.Offset < 0 || f.Offset > t.size {
+			h.cancelFile(t, "The recipient asked for an invalid part of the file.")
+			return
+		}
+		if quota := h.config.Limits.FileQuota; quota > 0 && t.from.FileBytes+t.size-f.Offset > quota {
+			h.cancelFile(t, fmt.Sprintf("The file would exceed the sender's quota of %s.", sizeText(quota)))
+			return
+		}
+		t.accepted, t.next, t.acked = true, f.Offset, f.Offset
+		t.from.Conn.Send(protocol.Envelope{Type: protocol.TypeFileAccept, From: s.Name, File: &protocol.File{ID: t.id, Offset: f.Offset}})
+		slog.Debug("file accepted", "client", s.Name, "from", t.from.Name, "file_id", t.id, "offset", f.Offset)
+
+	case protocol.TypeFileChunk:
+		if s != t.from || !t.accepted {
+			return
+		}
+		n := int64(len(f.Data))
+		switch {
+		case f.Offset != t.next || n == 0 || n > protocol.FileChunkSize || t.next+n > t.size:
+			h.cancelFile(t, "The file arrived out of order.")
+			return
+		case t.next+n-t.acked > protocol.FileWindow*protocol.FileChunkSize:
+			h.cancelFile(t, "The sender did not wait for the recipient.")
+			return
+		case h.config.Limits.FileQuota > 0 && s.FileBytes+n > h.config.Limits.FileQuota:
+			h.cancelFile(t, fmt.Sprintf("The file exceeds the sender's quota of %s.", sizeText(h.config.Limits.FileQuota)))
+			return
+		}
+		s.FileBytes += n
+		t.next += n
+		t.to.Conn.Send(protocol.Envelope{Type: protocol.TypeFileChunk, From: s.Name, File: &protocol.File{ID: t.id, Offset: f.Offset, Data: f.Data}})
+
+	case protocol.TypeFileAck:
+		if s != t.to || f.Offset < t.acked || f.Offset > t.next {
+			return
+		}
+		t.acked = f.Offset
+		t.from.Conn.Send(protocol.Envelope{Type: protocol.TypeFileAck, From: s.Name, File: &protocol.File{ID: t.id, Offset: f.Offset}})
+		if t.acked == t.size {
+			delete(h.transfers, t.id)
+			slog.Info("file transferred", "client", t.from.Name, "to", t.to.Name, "file_id", t.id, "size", t.size)
+		}
+
+	case protocol.TypeFileCancel:
+		delete(h.transfers, t.id)
+		other := t.to
+		if s == t.to {
+			other = t.from
+		}
+		other.Conn.Send(protocol.Envelope{Type: protocol.TypeFileCancel, From: s.Name, Text: e.Text, File: &protocol.File{ID: t.id}})
+		slog.Debug("file transfer cancelled", "client", s.Name, "file_id", t.id, "reason", e.Text)
+	}
+}
+
+// offerFile passes the offer of a file to its recipient, unless the server's
+// limits forbid it.
+func (h *Hub) offerFile(s *Session, name string, f protocol.File) {
+	refuse := func(reason string) {
+		s.Conn.Send(protocol.Envelope{Type: protocol.TypeFileCancel, Text: reason, File: &protocol.File{ID: f.ID}})
+	}
+
+	to := h.byName(name)
+	switch {
+	case to == nil:
+		refuse(fmt.Sprintf("No client named %s is connected.", name))
+	case to == s:
+		refuse("You cannot send a file to yourself.")
+	case !streams(s.Conn) || !streams(to.Conn):
+		refuse("File transfers are only available between TCP clients.")
+	case f.Name == "" || f.Size < 0 || f.SHA256 == "":
+		refuse("The offer is incomplete.")
+	case h.config.Limits.MaxFileSize > 0 && f.Size > h.config.Limits.MaxFileSize:
+		refuse(fmt.Sprintf("The file is too large (at most %s).", sizeText(h.config.Limits.MaxFileSize)))
+	case h.config.Limits.FileQuota > 0 && s.FileBytes >= h.config.Limits.FileQuota:
+		refuse(fmt.Sprintf("You used up your quota of %s of files.", sizeText(h.config.Limits.FileQuota)))
+	case h.transfers[f.ID] != nil:
+		refuse("Another transfer has the same ID.")
+	default:
+		if h.transfers == nil {
+			h.transfers = make(map[string]*transfer)
+		}
+		h.transfers[f.ID] = &transfer{id: f.ID, from: s, to: to, name: f.Name, size: f.Size}
+		to.Conn.Send(protocol.Envelope{
+			Type: protocol.TypeFileOffer,
+			From: s.Name,
+			To:   to.Name,
+			File: &protocol.File{ID: f.ID, Name: f.Name, Size: f.Size, SHA256: f.SHA256},
+		})
+		slog.Info("file offered", "client", s.Name, "to", to.Name, "file_id", f.ID, "name", f.Name, "size", f.Size)
+	}
+}
+
+// cancelFile ends a transfer, telling both sides why.
+func (h *Hub) cancelFile(t *transfer, reason string) {
+	delete(h.transfers, t.id)
+	for _, s := range []*Session{t.from, t.to} {
+		s.Conn.Send(protocol.Envelope{Type: protocol.TypeFileCancel, Text: reason, File: &protocol.File{ID: t.id}})
+	}
+	slog.Debug("file transfer cancelled", "client", t.from.Name, "file_id", t.id, "reason", reason)
+}
+
+// dropTransfers ends the transfers of a session whose connection went away,
+// telling the other sides. The client sends the file again to resume.
+func (h *Hub) dropTransfers(s *Session) {
+	for id, t := range h.transfers {
+		if t.from != s && t.to != s {
+			continue
+		}
+		delete(h.transfers, id)
+		other := t.to
+		if s == t.to {
+			other = t.from
+		}
+		other.Conn.Send(protocol.Envelope{
+			Type: protocol.TypeFileCancel,
+			From: s.Name,
+			Text: fmt.Sprintf("%s lost the connection.", s.Name),
+			File: &protocol.File{ID: id},
+		})
+	}
+}
+
+// sizeText describes a file size limit.
+func sizeText(n int64) string {
+	if n >= 1<<20 && n%(1<<20) == 0 {
+		return fmt.Sprintf("%d MiB", n>>20)
+	}
+	return fmt.Sprintf("%d bytes", n)
+}
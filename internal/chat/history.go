@@ -0,0 +1,95 @@
+// Package chat holds the server-side state shared by the TCP and UDP servers.
+package chat
+
+import (
+	"slices"
+	"sync"
+	"time"
+
+	"github.com/jennxsierra/dualnet-chat/internal/protocol"
+)
+
+// DefaultHistorySize is the number of messages a [History] keeps by default.
+const DefaultHistorySize = 500
+
+// History is a fixed size ring of recent chat messages. Every message added to
+// it is stamped with an increasing ID that clients use as a resume cursor.
+type History struct {
+	mu      sync.Mutex
+	entries []protocol.Envelope
+	next    int    // index the next entry is written to
+	lastID  uint64 // ID of the most recently added entry
+	size    int
+}
+
+// NewHistory creates a [History] holding at most size messages.
+func NewHistory(size int) *History {
+	if size <= 0 {
+		size = DefaultHistorySize
+	}
+	return &History{size: size}
+}
+
+// Add stamps the message with the next ID and the current time, stores it and
+// returns the stamped copy.
+func (h *History) Add(e protocol.Envelope) protocol.Envelope {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	h.lastID++
+	e.ID = h.lastID
+	if e.Time.IsZero() {
+		e.Time = time.Now()
+	}
+
+	if len(h.entries) < h.size {
+		h.entries = append(h.entries, e)
+	} else {
+		h.entries[h.next] = e
+	}
+	h.next = (h.next + 1) % h.size
+
+	return e
+}
+
+// LastID returns the ID of the most recent message, or 0 if there is none.
+func (h *History) LastID() uint64 {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	return h.lastID
+}
+
+// Since returns the stored messages newer than the given ID, oldest first,
+// limited to the given rooms.
+func (h *History) Since(id uint64, rooms []string) []protocol.Envelope {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	var result []protocol.Envelope
+	for i := range h.entries {
+		// walk the ring starting with the oldest entry
+		e := h.entries[(h.next+i)%len(h.entries)]
+		if e.ID > id && slices.Contains(rooms, e.Room) {
+			result = append(result, e)
+		}
+	}
+	return result
+}
+
+// Recent returns up to n of the newest stored messages, oldest first. If room
+// is not empty, only messages sent to that room are returned.
+func (h *History) Recent(n int, room string) []protocol.Envelope {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	var result []protocol.Envelope
+	for i := len(h.entries) - 1; i >= 0 && len(result) < n; i-- {
+		// walk the ring starting with the newest entry
+		e := h.entries[(h.next+i)%len(h.entries)]
+		if room == "" || e.Room == room {
+			result = append(result, e)
+		}
+	}
+	slices.Reverse(result)
+	return result
+}
@@ -0,0 +1,776 @@
+package chat
+
+import (
+	"crypto/subtle"
+	"fmt"
+	"log/slog"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/jennxsierra/dualnet-chat/internal/metrics"
+	"github.com/jennxsierra/dualnet-chat/internal/protocol"
+	"golang.org/x/time/rate"
+)
+
+// Conn is the transport side of a session: how the hub reaches one client.
+// The hub only calls Send and Close from its own goroutine, so they must not
+// block for long.
+type Conn interface {
+	Send(e protocol.Envelope)
+	Close()
+	Transport() string // e.g. "tcp" or "udp"
+	Addr() string      // remote address of the client
+}
+
+// Datagram is implemented by connections of transports that cannot tell when
+// a peer vanishes, such as UDP. Their sessions expire after
+// [Config.InactivityTimeout] without any traffic.
+type Datagram interface {
+	Conn
+	Datagram()
+}
+
+// Config holds the tunable behavior of a [Hub].
+type Config struct {
+	InactivityTimeout time.Duration // silence (not even heartbeats) after which a datagram client is dropped
+	SweepInterval     time.Duration // how often inactive and idle clients are checked
+	Idle              IdlePolicy    // when idle clients are marked away and disconnected
+	Limits            Limits        // message rate and size, number of clients
+	Rooms             RoomPolicy    // default and allowed rooms
+	MOTD              string        // message of the day, sent to clients when they connect; "{name}" is replaced by theirs
+	Bans              BanList       // clients that may not connect
+	OperatorPassword  string        // lets clients become operators with /oper, disabled if empty
+	Broadcasts        []Broadcast   // scheduled server notices
+}
+
+// DefaultConfig returns the configuration used when none is given.
+func DefaultConfig() Config {
+	return Config{
+		InactivityTimeout: 1 * time.Minute,
+		SweepInterval:     30 * time.Second,
+		Idle:              IdlePolicy{AwayAfter: 10 * time.Minute},
+		Limits:            DefaultLimits(),
+	}
+}
+
+// Session is the state the hub keeps for one registered client. Sessions are
+// owned by the hub goroutine and never handed out; see [SessionInfo].
+type Session struct {
+	ID         string
+	Name       string
+	Conn       Conn
+	Rooms      []string
+	Limiter    *rate.Limiter
+	LastSeen   time.Time // any envelope, including heartbeats
+	LastActive time.Time // last chat message or command
+	Away       bool
+	Operator   bool // may use operator commands such as /announce
+
+	FileBytes int64 // bytes of files sent, counted against Limits.FileQuota
+}
+
+// SessionInfo is a snapshot of a [Session] that is safe to use outside the hub.
+type SessionInfo struct {
+	ID         string
+	Name       string
+	Transport  string
+	Addr       string
+	Rooms      []string
+	LastSeen   time.Time
+	LastActive time.Time
+	Away       bool
+	Operator   bool
+	RateLimit  float64 // messages per second
+	RateBurst  int
+	RateTokens float64 // messages the client may send right now
+}
+
+// Hub owns every session, room and the message history. All of its state is
+// confined to a single goroutine started by [Hub.Start]; transports hand it
+// envelopes through [Hub.Receive] and [Hub.Disconnect], so registration,
+// expiry and disconnects are processed one at a time and in order. Its
+// configuration is read through [Hub.Config] and changed through
+// [Hub.Reconfigure].
+type Hub struct {
+	History *History
+
+	config   Config              // owned by the hub goroutine
+	sessions map[string]*Session // by session ID
+	bans     BanList             // added by operators at runtime, kept across reloads
+	byConn   map[string]*Session // by transport and address, see connKey
+
+	transfers map[string]*transfer // files on their way between clients, by ID
+
+	ticker *time.Ticker // sweeps sessions, owned by the hub goroutine
+	// scheduled broadcasts, owned by the hub goroutine
+	scheduleTimer *time.Timer
+	nextBroadcast []time.Time // parallel to config.Broadcasts, zero if never
+	calls         chan func()
+	done          chan struct{}
+	startOnce     sync.Once
+	stopOnce      sync.Once
+}
+
+// NewHub creates a [Hub] with the given configuration. It does nothing until
+// [Hub.Start] is called.
+func NewHub(cfg Config) *Hub {
+	return &Hub{
+		config:   cfg,
+		History:  NewHistory(DefaultHistorySize),
+		sessions: make(map[string]*Session),
+		byConn:   make(map[string]*Session),
+		calls:    make(chan func(), 1024),
+		done:     make(chan struct{}),
+	}
+}
+
+// Start launches the hub goroutine. Calling it more than once has no effect,
+// which lets several transports share one hub.
+func (h *Hub) Start() {
+	h.startOnce.Do(func() { go h.run() })
+}
+
+// Stop tells every client the server is going away, disconnects them and
+// stops the hub goroutine. It returns once that is done.
+func (h *Hub) Stop(notice string) {
+	h.call(func() {
+		for _, s := range h.sessions {
+			slog.Info("disconnecting client", "client", s.Name, "addr", s.Conn.Addr())
+			s.Conn.Send(protocol.Envelope{Type: protocol.TypeNotice, Text: notice})
+			s.Conn.Close()
+			h.forget(s)
+		}
+	})
+	h.stopOnce.Do(func() { close(h.done) })
+}
+
+// Reconfigure applies a new configuration without disconnecting anyone, except
+// clients that are now banned. Rate limits apply to connected clients right
+// away; rooms that are no longer allowed only stop new joins.
+func (h *Hub) Reconfigure(cfg Config) {
+	h.call(func() {
+		h.config = cfg
+		h.ticker.Reset(h.sweepInterval())
+		h.reschedule(time.Now())
+
+		for _, s := range h.sessions {
+			s.Limiter.SetLimit(rate.Limit(cfg.Limits.MessageRate))
+			s.Limiter.SetBurst(cfg.Limits.MessageBurst)
+
+			if h.banned(s.Name, s.Conn.Addr()) {
+				s.Conn.Send(protocol.Envelope{Type: protocol.TypeBye, Text: "You are banned from this server."})
+				h.remove(s, "banned")
+			}
+		}
+	})
+}
+
+// Config returns the configuration the hub currently runs with.
+func (h *Hub) Config() Config {
+	var cfg Config
+	h.call(func() { cfg = h.config })
+	return cfg
+}
+
+// Receive hands an envelope read from a client connection to the hub.
+func (h *Hub) Receive(conn Conn, e protocol.Envelope) {
+	h.do(func() { h.receive(conn, e) })
+}
+
+// Disconnect tells the hub a client connection is gone. It is a no-op if the
+// connection no longer belongs to a session (e.g. it was taken over).
+func (h *Hub) Disconnect(conn Conn) {
+	h.do(func() {
+		if s := h.byConn[connKey(conn)]; s != nil {
+			h.remove(s, "")
+		}
+	})
+}
+
+// Reject tells a client why it may not stay with a goodbye, and disconnects
+// it. Transports use it to turn away registrations the hub knows nothing
+// about, such as a name the client may not use on that transport, whether or
+// not the connection already has a session.
+func (h *Hub) Reject(conn Conn, text string) {
+	h.do(func() {
+		conn.Send(protocol.Envelope{Type: protocol.TypeBye, Text: text})
+		if s := h.byConn[connKey(conn)]; s != nil {
+			h.remove(s, "")
+		} else {
+			conn.Close()
+		}
+	})
+}
+
+// Sessions returns a snapshot of the connected clients.
+func (h *Hub) Sessions() []SessionInfo {
+	var infos []SessionInfo
+	h.call(func() {
+		for _, s := range h.sessions {
+			infos = append(infos, SessionInfo{
+				ID:         s.ID,
+				Name:       s.Name,
+				Transport:  s.Conn.Transport(),
+				Addr:       s.Conn.Addr(),
+				Rooms:      slices.Clone(s.Rooms),
+				LastSeen:   s.LastSeen,
+				LastActive: s.LastActive,
+				Away:       s.Away,
+				Operator:   s.Operator,
+				RateLimit:  float64(s.Limiter.Limit()),
+				RateBurst:  s.Limiter.Burst(),
+				RateTokens: s.Limiter.Tokens(),
+			})
+		}
+	})
+	return infos
+}
+
+// do queues f to run on the hub goroutine. It is dropped if the hub stopped.
+func (h *Hub) do(f func()) {
+	select {
+	case h.calls <- f:
+	case <-h.done:
+	}
+}
+
+// call runs f on the hub goroutine and waits for it to finish.
+func (h *Hub) call(f func()) {
+	finished := make(chan struct{})
+	h.do(func() {
+		defer close(finished)
+		f()
+	})
+	select {
+	case <-finished:
+	case <-h.done:
+	}
+}
+
+// run is the hub goroutine.
+func (h *Hub) run() {
+	h.ticker = time.NewTicker(h.sweepInterval())
+	defer h.ticker.Stop()
+
+	h.scheduleTimer = time.NewTimer(time.Hour)
+	defer h.scheduleTimer.Stop()
+	h.reschedule(time.Now())
+
+	for {
+		select {
+		case f := <-h.calls:
+			f()
+		case <-h.ticker.C:
+			h.sweep()
+		case now := <-h.scheduleTimer.C:
+			h.runBroadcasts(now)
+		case <-h.done:
+			return
+		}
+	}
+}
+
+// sweepInterval returns how often sessions are swept, the default interval if
+// the configuration has none.
+func (h *Hub) sweepInterval() time.Duration {
+	if h.config.SweepInterval <= 0 {
+		return DefaultConfig().SweepInterval
+	}
+	return h.config.SweepInterval
+}
+
+// connKey identifies a client connection across envelopes. UDP transports
+// create a new Conn value per datagram, so the key is derived from the
+// transport and address rather than the Conn itself.
+func connKey(conn Conn) string {
+	return conn.Transport() + "/" + conn.Addr()
+}
+
+// byName returns the session with the given name, or nil.
+func (h *Hub) byName(name string) *Session {
+	for _, s := range h.sessions {
+		if s.Name == name {
+			return s
+		}
+	}
+	return nil
+}
+
+// receive processes one envelope on the hub goroutine.
+func (h *Hub) receive(conn Conn, e protocol.Envelope) {
+	if e.Type == protocol.TypeRegister {
+		h.register(conn, e)
+		return
+	}
+
+	s := h.byConn[connKey(conn)]
+	if s == nil {
+		// a known session arriving from a new address (e.g. after NAT rebinding) moves there
+		if s = h.sessions[e.Session]; s == nil || e.Session == "" {
+			// ask unknown senders (e.g. after a server restart) to register again
+			if _, datagram := conn.(Datagram); datagram {
+				metrics.DroppedDatagrams.Inc()
+			}
+			conn.Send(protocol.Envelope{Type: protocol.TypeRegister})
+			return
+		}
+		h.move(s, conn)
+	}
+	s.LastSeen = time.Now()
+
+	switch e.Type {
+	case protocol.TypeHeartbeat:
+		// echo the sequence number so the client can measure the round trip
+		s.Conn.Send(protocol.Envelope{Type: protocol.TypeHeartbeatAck, Seq: e.Seq})
+	case protocol.TypeBye:
+		h.remove(s, "")
+	case protocol.TypeMessage:
+		h.markActive(s)
+		h.handleMessage(s, e)
+	case protocol.TypeFileOffer, protocol.TypeFileAccept, protocol.TypeFileChunk, protocol.TypeFileAck, protocol.TypeFileCancel:
+		h.handleFile(s, e)
+	}
+}
+
+// register adds a new session, or resumes the session named by the
+// registration's session ID, even from a new address. Without the session ID a
+// name can only be taken over from the same address.
+func (h *Hub) register(conn Conn, reg protocol.Envelope) {
+	name := strings.TrimSpace(reg.From)
+	if name == "" {
+		name = conn.Addr()
+	}
+
+	// a resumed session keeps its name, whatever the registration says
+	s, resumed := h.sessions[reg.Session]
+	resumed = resumed && reg.Session != ""
+	if resumed {
+		name = s.Name
+	}
+
+	if h.banned(name, conn.Addr()) {
+		slog.Warn("rejected banned client", "client", name, "addr", conn.Addr())
+		conn.Send(protocol.Envelope{Type: protocol.TypeBye, Text: "You are banned from this server."})
+		conn.Close()
+		return
+	}
+
+	if resumed {
+		h.move(s, conn)
+	} else {
+		for _, other := range h.sessions {
+			if other.Name != name {
+				continue
+			}
+			if connKey(other.Conn) != connKey(conn) {
+				conn.Send(protocol.Envelope{Type: protocol.TypeBye, Text: fmt.Sprintf("The name %s is already in use.", name)})
+				conn.Close()
+				return
+			}
+			h.forget(other)
+			resumed = true
+		}
+
+		// a different name registering on the same connection replaces the old session
+		if old := h.byConn[connKey(conn)]; old != nil {
+			h.remove(old, "")
+		}
+
+		if limit := h.config.Limits.MaxClients; limit > 0 && len(h.sessions) >= limit {
+			slog.Warn("rejected client, server full", "client", name, "addr", conn.Addr(), "max_clients", limit)
+			conn.Send(protocol.Envelope{Type: protocol.TypeBye, Text: "The server is full. Please try again later."})
+			conn.Close()
+			return
+		}
+
+		// create a limiter for this client
+		now := time.Now()
+		s = &Session{
+			ID:         NewSessionID(),
+			Name:       name,
+			Conn:       conn,
+			Rooms:      h.config.Rooms.Resume(reg.Rooms),
+			Limiter:    rate.NewLimiter(rate.Limit(h.config.Limits.MessageRate), h.config.Limits.MessageBurst),
+			LastSeen:   now,
+			LastActive: now,
+		}
+		h.sessions[s.ID] = s
+		h.byConn[connKey(conn)] = s
+		metrics.ClientsConnected.Add(conn.Transport(), 1)
+	}
+	s.LastSeen = time.Now()
+
+	// confirm the registration, followed by the messages the client missed
+	s.Conn.Send(protocol.Envelope{
+		Type:    protocol.TypeWelcome,
+		ID:      h.History.LastID(),
+		Text:    fmt.Sprintf("Welcome %s, you are now connected!", s.Name),
+		Rooms:   s.Rooms,
+		Session: s.ID,
+		Addr:    s.Conn.Addr(),
+	})
+	if h.config.MOTD != "" && !resumed {
+		s.Conn.Send(protocol.Envelope{Type: protocol.TypeNotice, Text: strings.ReplaceAll(h.config.MOTD, "{name}", s.Name)})
+	}
+	for _, room := range s.Rooms {
+		h.sendMembers(s, room)
+	}
+	if reg.Since > 0 {
+		for _, e := range h.History.Since(reg.Since, s.Rooms) {
+			if e.From != s.Name {
+				s.Conn.Send(e)
+			}
+		}
+	}
+
+	// log and broadcast the connection, unless it silently resumed its old session
+	if resumed {
+		slog.Info("client resumed", "client", s.Name, "addr", s.Conn.Addr(), "transport", s.Conn.Transport(), "since", reg.Since)
+		return
+	}
+	slog.Info("client connected", "client", s.Name, "addr", s.Conn.Addr(), "transport", s.Conn.Transport(), "rooms", s.Rooms)
+	for _, room := range s.Rooms {
+		h.broadcast(protocol.Envelope{Type: protocol.TypeJoin, From: s.Name, Room: room}, s)
+	}
+}
+
+// move re-indexes a session under a new connection, closing the old one.
+func (h *Hub) move(s *Session, conn Conn) {
+	oldKey, newKey := connKey(s.Conn), connKey(conn)
+	if oldKey == newKey {
+		return
+	}
+	slog.Info("client moved", "client", s.Name, "from", s.Conn.Addr(), "to", conn.Addr())
+
+	// another session registered at the new address is replaced
+	if other := h.byConn[newKey]; other != nil {
+		h.remove(other, "")
+	}
+
+	// the client starts its transfers over on the new connection
+	h.dropTransfers(s)
+
+	delete(h.byConn, oldKey)
+	s.Conn.Close()
+	s.Conn = conn
+	h.byConn[newKey] = s
+}
+
+// forget drops a session without telling anyone.
+func (h *Hub) forget(s *Session) {
+	if h.sessions[s.ID] != s {
+		return // already forgotten
+	}
+	delete(h.sessions, s.ID)
+	h.dropTransfers(s)
+	metrics.ClientsConnected.Add(s.Conn.Transport(), -1)
+	if h.byConn[connKey(s.Conn)] == s {
+		delete(h.byConn, connKey(s.Conn))
+	}
+}
+
+// remove drops a session, closes its connection and tells its rooms it left,
+// optionally with a reason.
+func (h *Hub) remove(s *Session, reason string) {
+	h.forget(s)
+	s.Conn.Close()
+
+	attrs := []any{"client", s.Name, "addr", s.Conn.Addr()}
+	if reason != "" {
+		attrs = append(attrs, "reason", reason)
+	}
+	slog.Info("client disconnected", attrs...)
+	for _, room := range s.Rooms {
+		h.broadcast(protocol.Envelope{Type: protocol.TypeLeave, From: s.Name, Room: room, Text: reason}, s)
+	}
+}
+
+// markActive records chat activity and announces that the client is back if it
+// was away.
+func (h *Hub) markActive(s *Session) {
+	s.LastActive = time.Now()
+	if s.Away {
+		s.Away = false
+		h.broadcastPresence(s, protocol.PresenceBack)
+	}
+}
+
+// broadcastPresence tells every room of a session that it went away or came back.
+func (h *Hub) broadcastPresence(s *Session, presence string) {
+	for _, room := range s.Rooms {
+		h.broadcast(protocol.Envelope{Type: protocol.TypePresence, From: s.Name, Room: room, Text: presence}, s)
+	}
+}
+
+// handleMessage runs a chat command or broadcasts a chat message to the room it
+// was sent to.
+func (h *Hub) handleMessage(s *Session, e protocol.Envelope) {
+	metrics.MessagesReceived.Inc(s.Conn.Transport())
+
+	text := strings.TrimSpace(e.Text)
+	if text == "" {
+		return // skip empty messages
+	}
+
+	// messages without a room (e.g. from older clients) go to the first joined room
+	room := s.Rooms[0]
+	if e.Room != "" {
+		room = e.Room
+	}
+
+	if strings.HasPrefix(text, "/") {
+		h.handleCommand(s, room, text)
+		return
+	}
+
+	if !slices.Contains(s.Rooms, room) {
+		s.Conn.Send(protocol.Envelope{Type: protocol.TypeError, Text: fmt.Sprintf("You are not in #%s.", room)})
+		return
+	}
+
+	if !h.allow(s, text) {
+		return
+	}
+
+	msg := h.History.Add(protocol.Envelope{Type: protocol.TypeMessage, From: s.Name, Room: room, Text: text})
+	slog.Debug("message", "client", s.Name, "room", room, "msg_id", msg.ID, "length", len(text))
+	h.broadcast(msg, s)
+}
+
+// allow checks a chat message against the client's length and rate limits,
+// telling the client if it is rejected.
+func (h *Hub) allow(s *Session, text string) bool {
+	if limit := h.config.Limits.MaxMessageLength; limit > 0 && len(text) > limit {
+		s.Conn.Send(protocol.Envelope{Type: protocol.TypeError, Text: fmt.Sprintf("Your message is too long (at most %d bytes).", limit)})
+		return false
+	}
+
+	// check if the client is allowed to send the message
+	if !s.Limiter.Allow() {
+		metrics.RateLimited.Inc(s.Conn.Transport())
+		s.Conn.Send(protocol.Envelope{Type: protocol.TypeError, Text: "You are sending messages too fast. Please slow down."})
+		return false
+	}
+	return true
+}
+
+// handleCommand runs a chat command such as "/join <room>" or "/part [room]",
+// typed in the given room.
+func (h *Hub) handleCommand(s *Session, room, text string) {
+	fields := strings.Fields(text)
+	switch fields[0] {
+	case "/join":
+		if len(fields) < 2 {
+			s.Conn.Send(protocol.Envelope{Type: protocol.TypeError, Text: "Usage: /join <room>"})
+			return
+		}
+		room, ok := NormalizeRoom(fields[1])
+		if !ok {
+			s.Conn.Send(protocol.Envelope{Type: protocol.TypeError, Text: fmt.Sprintf("Invalid room name %q.", fields[1])})
+			return
+		}
+		if !h.config.Rooms.Allows(room) {
+			s.Conn.Send(protocol.Envelope{Type: protocol.TypeError, Text: fmt.Sprintf("Room #%s does not exist.", room)})
+			return
+		}
+
+		// everyone in the room hears about the join, including the client itself so
+		// it can switch to the room; joining a room the client is already in only switches
+		join := protocol.Envelope{Type: protocol.TypeJoin, From: s.Name, Room: room}
+		if slices.Contains(s.Rooms, room) {
+			s.Conn.Send(join)
+			return
+		}
+		s.Rooms = append(s.Rooms, room)
+		h.broadcast(join, nil)
+		h.sendMembers(s, room)
+		slog.Debug("client joined room", "client", s.Name, "room", room)
+
+	case "/part":
+		if len(fields) > 1 {
+			var ok bool
+			if room, ok = NormalizeRoom(fields[1]); !ok {
+				s.Conn.Send(protocol.Envelope{Type: protocol.TypeError, Text: fmt.Sprintf("Invalid room name %q.", fields[1])})
+				return
+			}
+		}
+
+		i := slices.Index(s.Rooms, room)
+		switch {
+		case i < 0:
+			s.Conn.Send(protocol.Envelope{Type: protocol.TypeError, Text: fmt.Sprintf("You are not in #%s.", room)})
+			return
+		case len(s.Rooms) == 1:
+			s.Conn.Send(protocol.Envelope{Type: protocol.TypeError, Text: "You cannot leave your last room."})
+			return
+		}
+		s.Rooms = slices.Delete(s.Rooms, i, i+1)
+		slog.Debug("client left room", "client", s.Name, "room", room)
+
+		leave := protocol.Envelope{Type: protocol.TypeLeave, From: s.Name, Room: room}
+		s.Conn.Send(leave)
+		h.broadcast(leave, s)
+
+	case "/msg":
+		// direct messages are delivered to one client and kept out of the history
+		if len(fields) < 3 {
+			s.Conn.Send(protocol.Envelope{Type: protocol.TypeError, Text: "Usage: /msg <name> <text>"})
+			return
+		}
+		to := h.byName(fields[1])
+		if to == nil {
+			s.Conn.Send(protocol.Envelope{Type: protocol.TypeError, Text: fmt.Sprintf("No client named %s is connected.", fields[1])})
+			return
+		}
+		body := strings.TrimSpace(text[len(fields[0]):])
+		body = strings.TrimSpace(body[len(fields[1]):])
+		if !h.allow(s, body) {
+			return
+		}
+		to.Conn.Send(protocol.Envelope{Type: protocol.TypeMessage, Time: time.Now(), From: s.Name, To: to.Name, Text: body})
+		metrics.MessagesSent.Inc(to.Conn.Transport())
+		slog.Debug("direct message", "client", s.Name, "to", to.Name, "length", len(body))
+
+	case "/who":
+		// "/who [room]" lists who is in a room, the one typed in by default
+		if len(fields) > 1 {
+			var ok bool
+			if room, ok = NormalizeRoom(fields[1]); !ok {
+				s.Conn.Send(protocol.Envelope{Type: protocol.TypeError, Text: fmt.Sprintf("Invalid room name %q.", fields[1])})
+				return
+			}
+		}
+		members := h.members(room)
+		var listed []string
+		for _, name := range members {
+			if other := h.byName(name); other != nil && other.Away {
+				name += " (away)"
+			}
+			listed = append(listed, name)
+		}
+		if len(members) == 0 {
+			s.Conn.Send(protocol.Envelope{Type: protocol.TypeNotice, Room: room, Text: fmt.Sprintf("Nobody is in #%s.", room)})
+			return
+		}
+		s.Conn.Send(protocol.Envelope{Type: protocol.TypeNotice, Room: room, Members: members, Text: fmt.Sprintf("In #%s: %s", room, strings.Join(listed, ", "))})
+
+	case "/oper":
+		switch {
+		case h.config.OperatorPassword == "":
+			s.Conn.Send(protocol.Envelope{Type: protocol.TypeError, Text: "Operator commands are disabled on this server."})
+		case len(fields) < 2 || subtle.ConstantTimeCompare([]byte(fields[1]), []byte(h.config.OperatorPassword)) != 1:
+			slog.Warn("failed operator login", "client", s.Name, "addr", s.Conn.Addr())
+			s.Conn.Send(protocol.Envelope{Type: protocol.TypeError, Text: "Wrong operator password."})
+		default:
+			s.Operator = true
+			slog.Info("client became operator", "client", s.Name, "addr", s.Conn.Addr())
+			s.Conn.Send(protocol.Envelope{Type: protocol.TypeNotice, Text: "You are now an operator."})
+		}
+
+	case "/announce":
+		if !s.Operator {
+			s.Conn.Send(protocol.Envelope{Type: protocol.TypeError, Text: "You must be an operator to announce (see /oper)."})
+			return
+		}
+
+		// "/announce #room text" announces to one room, "/announce text" to everyone
+		target, rest := "", strings.TrimSpace(strings.TrimPrefix(text, fields[0]))
+		if len(fields) > 1 && strings.HasPrefix(fields[1], "#") {
+			room, ok := NormalizeRoom(fields[1])
+			if !ok {
+				s.Conn.Send(protocol.Envelope{Type: protocol.TypeError, Text: fmt.Sprintf("Invalid room name %q.", fields[1])})
+				return
+			}
+			target, rest = room, strings.TrimSpace(strings.TrimPrefix(rest, fields[1]))
+		}
+		if rest == "" {
+			s.Conn.Send(protocol.Envelope{Type: protocol.TypeError, Text: "Usage: /announce [#room] <text>"})
+			return
+		}
+
+		reached := h.announce(target, rest)
+		slog.Info("announcement", "client", s.Name, "room", target, "recipients", reached)
+		if target != "" && !slices.Contains(s.Rooms, target) {
+			s.Conn.Send(protocol.Envelope{Type: protocol.TypeNotice, Text: fmt.Sprintf("Announced to %d client(s) in #%s.", reached, target)})
+		}
+
+	case "/help":
+		names, usages := make([]string, len(commandHelp)), make([]string, len(commandHelp))
+		for i, c := range commandHelp {
+			names[i], usages[i] = c.name, c.usage
+		}
+		s.Conn.Send(protocol.Envelope{Type: protocol.TypeNotice, Commands: names, Text: "Commands: " + strings.Join(usages, ", ")})
+
+	default:
+		s.Conn.Send(protocol.Envelope{Type: protocol.TypeError, Text: fmt.Sprintf("Unknown command %s. Type /help for a list.", fields[0])})
+	}
+}
+
+// commandHelp lists the chat commands in the order "/help" describes them.
+var commandHelp = []struct{ name, usage string }{
+	{"/join", "/join <room>"},
+	{"/part", "/part [room]"},
+	{"/msg", "/msg <name> <text>"},
+	{"/who", "/who [room]"},
+	{"/oper", "/oper <password>"},
+	{"/announce", "/announce [#room] <text>"},
+	{"/help", "/help"},
+}
+
+// members returns the sorted names of the sessions in a room.
+func (h *Hub) members(room string) []string {
+	var members []string
+	for _, s := range h.sessions {
+		if slices.Contains(s.Rooms, room) {
+			members = append(members, s.Name)
+		}
+	}
+	slices.Sort(members)
+	return members
+}
+
+// sendMembers tells a session who is in a room it joined, so its client can
+// list them and complete their names.
+func (h *Hub) sendMembers(s *Session, room string) {
+	s.Conn.Send(protocol.Envelope{Type: protocol.TypeMembers, Room: room, Members: h.members(room)})
+}
+
+// broadcast sends an envelope to every session in the envelope's room except
+// the given one.
+func (h *Hub) broadcast(e protocol.Envelope, except *Session) {
+	start := time.Now()
+	for _, s := range h.sessions {
+		if s != except && slices.Contains(s.Rooms, e.Room) {
+			s.Conn.Send(e)
+			metrics.MessagesSent.Inc(s.Conn.Transport())
+		}
+	}
+	metrics.BroadcastDuration.Observe(time.Since(start).Seconds())
+}
+
+// sweep drops datagram clients that stopped sending anything, and marks clients
+// that stopped chatting as away or disconnects them per the idle policy.
+func (h *Hub) sweep() {
+	now := time.Now()
+	for _, s := range h.sessions {
+		_, datagram := s.Conn.(Datagram)
+		idle := now.Sub(s.LastActive)
+
+		switch {
+		case datagram && now.Sub(s.LastSeen) > h.config.InactivityTimeout:
+			// client hasn't sent anything in too long, consider them disconnected
+			metrics.HeartbeatTimeouts.Inc()
+			h.remove(s, "timeout")
+		case h.config.Idle.Expired(idle):
+			// tell the client not to reconnect before dropping it
+			s.Conn.Send(protocol.Envelope{Type: protocol.TypeBye, Text: fmt.Sprintf("Disconnected after %s of inactivity.", h.config.Idle.DisconnectAfter)})
+			h.remove(s, "idle")
+		case h.config.Idle.Away(idle) && !s.Away:
+			s.Away = true
+			slog.Info("client away", "client", s.Name, "idle", idle.Round(time.Second))
+			h.broadcastPresence(s, protocol.PresenceAway)
+		}
+	}
+}
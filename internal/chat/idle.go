@@ -0,0 +1,21 @@
+package chat
+
+import "time"
+
+// IdlePolicy decides what happens to users who stop chatting. Only chat
+// messages and commands count as activity, not heartbeats. A zero duration
+// disables the corresponding step.
+type IdlePolicy struct {
+	AwayAfter       time.Duration // mark the user away
+	DisconnectAfter time.Duration // disconnect the user
+}
+
+// Away reports whether a user idle for the given duration should be marked away.
+func (p IdlePolicy) Away(idle time.Duration) bool {
+	return p.AwayAfter > 0 && idle >= p.AwayAfter
+}
+
+// Expired reports whether a user idle for the given duration should be disconnected.
+func (p IdlePolicy) Expired(idle time.Duration) bool {
+	return p.DisconnectAfter > 0 && idle >= p.DisconnectAfter
+}
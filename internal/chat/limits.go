@@ -0,0 +1,19 @@
+package chat
+
+// Limits bounds what a single client, and the server as a whole, may do.
+type Limits struct {
+	MessageRate      float64 // messages per second each client may send
+	MessageBurst     int     // messages a client may send in a quick burst
+	MaxMessageLength int     // longest accepted message in bytes, 0 for no limit
+	MaxClients       int     // most clients connected at once, 0 for no limit
+
+	MaxFileSize int64 // largest file a client may send in bytes, 0 for no limit
+	FileQuota   int64 // bytes of files a client may send while connected, 0 for no limit
+}
+
+// DefaultLimits returns the limits used when none are configured: 1 message
+// per second with a burst of 3, and files of up to 100 MiB, 1 GiB of them per
+// client.
+func DefaultLimits() Limits {
+	return Limits{MessageRate: 1, MessageBurst: 3, MaxFileSize: 100 << 20, FileQuota: 1 << 30}
+}
@@ -0,0 +1,60 @@
+package chat
+
+import (
+	"slices"
+	"strings"
+
+	"github.com/jennxsierra/dualnet-chat/internal/protocol"
+)
+
+// maxRoomLength bounds the length of a room name.
+const maxRoomLength = 32
+
+// NormalizeRoom strips a leading '#' and lowercases the room name. It returns
+// false if the result is not a valid room name.
+func NormalizeRoom(name string) (string, bool) {
+	name = strings.ToLower(strings.TrimPrefix(strings.TrimSpace(name), "#"))
+	if name == "" || len(name) > maxRoomLength {
+		return "", false
+	}
+	for _, r := range name {
+		if !(r >= 'a' && r <= 'z' || r >= '0' && r <= '9' || r == '-' || r == '_') {
+			return "", false
+		}
+	}
+	return name, true
+}
+
+// RoomPolicy decides which rooms clients start in and which rooms exist.
+type RoomPolicy struct {
+	Default []string // rooms new clients join, [protocol.DefaultRoom] if empty
+	Allowed []string // rooms clients may join besides the default ones, any room if empty
+}
+
+// Allows reports whether clients may be in the given room.
+func (p RoomPolicy) Allows(room string) bool {
+	return len(p.Allowed) == 0 || slices.Contains(p.Allowed, room) || slices.Contains(p.defaults(), room)
+}
+
+// defaults returns the rooms new clients join.
+func (p RoomPolicy) defaults() []string {
+	if len(p.Default) == 0 {
+		return []string{protocol.DefaultRoom}
+	}
+	return p.Default
+}
+
+// Resume returns the valid and allowed rooms from a registration, falling back
+// to the default rooms when none were requested.
+func (p RoomPolicy) Resume(requested []string) []string {
+	var rooms []string
+	for _, r := range requested {
+		if room, ok := NormalizeRoom(r); ok && p.Allows(room) && !slices.Contains(rooms, room) {
+			rooms = append(rooms, room)
+		}
+	}
+	if len(rooms) == 0 {
+		rooms = slices.Clone(p.defaults())
+	}
+	return rooms
+}
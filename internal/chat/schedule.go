@@ -0,0 +1,60 @@
+package chat
+
+import (
+	"log/slog"
+	"time"
+
+	"github.com/jennxsierra/dualnet-chat/internal/cron"
+)
+
+// Broadcast is a server notice the hub posts to rooms on a schedule, such as a
+// stand-up reminder.
+type Broadcast struct {
+	Schedule cron.Schedule
+	Rooms    []string // every client if empty
+	Text     string
+}
+
+// reschedule computes when every broadcast fires next and arms the schedule
+// timer. It runs on the hub goroutine, whenever the configuration changes.
+func (h *Hub) reschedule(now time.Time) {
+	h.nextBroadcast = make([]time.Time, len(h.config.Broadcasts))
+	for i, b := range h.config.Broadcasts {
+		h.nextBroadcast[i] = b.Schedule.Next(now)
+	}
+	h.armSchedule(now)
+}
+
+// armSchedule sets the schedule timer to the earliest pending broadcast.
+func (h *Hub) armSchedule(now time.Time) {
+	h.scheduleTimer.Stop()
+
+	var earliest time.Time
+	for _, next := range h.nextBroadcast {
+		if !next.IsZero() && (earliest.IsZero() || next.Before(earliest)) {
+			earliest = next
+		}
+	}
+	if !earliest.IsZero() {
+		h.scheduleTimer.Reset(earliest.Sub(now))
+	}
+}
+
+// runBroadcasts posts the broadcasts that are due and schedules their next run.
+func (h *Hub) runBroadcasts(now time.Time) {
+	for i, b := range h.config.Broadcasts {
+		next := h.nextBroadcast[i]
+		if next.IsZero() || next.After(now) {
+			continue
+		}
+		if len(b.Rooms) == 0 {
+			h.announce("", b.Text)
+		}
+		for _, room := range b.Rooms {
+			h.announce(room, b.Text)
+		}
+		slog.Info("scheduled broadcast", "schedule", b.Schedule.String(), "rooms", b.Rooms)
+		h.nextBroadcast[i] = b.Schedule.Next(now)
+	}
+	h.armSchedule(now)
+}
@@ -0,0 +1,9 @@
+package chat
+
+import "crypto/rand"
+
+// NewSessionID returns a random, unguessable session identifier. Knowing it is
+// what lets a client prove it owns a session.
+func NewSessionID() string {
+	return rand.Text()
+}
@@ -0,0 +1,208 @@
+// Package chatlog keeps the messages a chat client sends and receives on the
+// user's machine, in a log file for each room and each direct conversation,
+// and searches them.
+package chatlog
+
+import (
+	"bufio"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/jennxsierra/dualnet-chat/internal/protocol"
+)
+
+// timeLayout starts every line, so sorting lines sorts them by time.
+const timeLayout = time.DateTime
+
+// directPrefix starts the names of the logs of direct conversations.
+const directPrefix = "direct-"
+
+// Dir is a directory of logs, one per room or person written to directly.
+type Dir struct {
+	path string
+	name string // the user's own name, to tell who the other side of a DM is
+
+	mu    sync.Mutex
+	files map[string]*os.File // open logs by file name
+}
+
+// Match is a line of a log that a search found.
+type Match struct {
+	Log  string // the room, e.g. "#general", or "@bob" for direct messages
+	Line string
+}
+
+// Open creates the directory at path if needed and keeps the logs of the user
+// with the given name there.
+func Open(path, name string) (*Dir, error) {
+	if err := os.MkdirAll(path, 0o700); err != nil {
+		return nil, err
+	}
+	return &Dir{path: path, name: name, files: make(map[string]*os.File)}, nil
+}
+
+// Path returns the directory the logs are kept in.
+func (d *Dir) Path() string {
+	return d.path
+}
+
+// Write appends a message to the log of its room, or of the conversation with
+// the other side if it is a direct message. Other envelopes are not logged.
+func (d *Dir) Write(e protocol.Envelope) error {
+	if e.Type != protocol.TypeMessage {
+		return nil
+	}
+	at := e.Time
+	if at.IsZero() {
+		at = time.Now()
+	}
+
+	var file, line string
+	if e.To != "" {
+		other := e.From
+		if other == d.name {
+			other = e.To
+		}
+		user, _, _ := strings.Cut(other, "@")
+		file = directPrefix + fileName(user) + ".log"
+		line = at.Local().Format(timeLayout) + " [" + e.From + " -> " + e.To + "]: "
+	} else {
+		room := e.Room
+		if room == "" {
+			room = protocol.DefaultRoom
+		}
+		file = fileName(room) + ".log"
+		line = at.Local().Format(timeLayout) + " #" + room + " [" + e.From + "]: "
+	}
+	// the further lines of a multi-line message are indented, so every line
+	// of the log still starts with a time or belongs to the one above
+	line += strings.ReplaceAll(e.Text, "\n", "\n\t") + "\n"
+
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	f, err := d.open(file)
+	if err != nil {
+		return err
+	}
+	_, err = f.WriteString(line)
+	return err
+}
+
+// open returns the open log with the given file name, opening it first if
+// needed. The caller holds mu.
+func (d *Dir) open(file string) (*os.File, error) {
+	if f, ok := d.files[file]; ok {
+		return f, nil
+	}
+	f, err := os.OpenFile(filepath.Join(d.path, file), os.O_WRONLY|os.O_CREATE|os.O_APPEND, 0o600)
+	if err != nil {
+		return nil, err
+	}
+	d.files[file] = f
+	return f, nil
+}
+
+// Search returns the lines of all the logs that contain text, ignoring case,
+// oldest first. Only the newest limit are returned, along with how many
+// matched in all.
+func (d *Dir) Search(text string, limit int) ([]Match, int, error) {
+	paths, err := filepath.Glob(filepath.Join(d.path, "*.log"))
+	if err != nil {
+		return nil, 0, err
+	}
+
+	text = strings.ToLower(text)
+	var matches []Match
+	for _, path := range paths {
+		name := strings.TrimSuffix(filepath.Base(path), ".log")
+		log := "#" + name
+		if user, ok := strings.CutPrefix(name, directPrefix); ok {
+			log = "@" + user
+		}
+
+		found, err := searchFile(path, text)
+		if err != nil {
+			return nil, 0, err
+		}
+		for _, line := range found {
+			matches = append(matches, Match{Log: log, Line: line})
+		}
+	}
+
+	// lines start with their time, and the further lines of a multi-line
+	// message stay after its first
+	slices.SortStableFunc(matches, func(a, b Match) int {
+		return strings.Compare(lineTime(a.Line), lineTime(b.Line))
+	})
+	total := len(matches)
+	if len(matches) > limit {
+		matches = matches[len(matches)-limit:]
+	}
+	return matches, total, nil
+}
+
+// Close closes the logs.
+func (d *Dir) Close() error {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	var first error
+	for file, f := range d.files {
+		if err := f.Close(); err != nil && first == nil {
+			first = err
+		}
+		delete(d.files, file)
+	}
+	return first
+}
+
+// searchFile returns the lines of a log containing text, which is lower case.
+// The further lines of a multi-line message are returned with the time, room
+// and sender of its first line in front.
+func searchFile(path, text string) ([]string, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	var found []string
+	head := "" // up to the text of the message the line belongs to
+	scanner := bufio.NewScanner(f)
+	scanner.Buffer(nil, 1024*1024)
+	for scanner.Scan() {
+		line := scanner.Text()
+		if rest, ok := strings.CutPrefix(line, "\t"); ok {
+			line = head + rest
+		} else if i := strings.Index(line, "]: "); i >= 0 {
+			head = line[:i+len("]: ")]
+		}
+		if strings.Contains(strings.ToLower(line), text) {
+			found = append(found, line)
+		}
+	}
+	return found, scanner.Err()
+}
+
+// lineTime returns the time a log line starts with.
+func lineTime(line string) string {
+	if len(line) < len(timeLayout) {
+		return line
+	}
+	return line[:len(timeLayout)]
+}
+
+// fileName turns a room or user name into a file name that stays inside the
+// directory.
+func fileName(name string) string {
+	return strings.Map(func(r rune) rune {
+		switch {
+		case r >= 'a' && r <= 'z', r >= 'A' && r <= 'Z', r >= '0' && r <= '9', r == '-', r == '_':
+			return r
+		}
+		return '_'
+	}, name)
+}
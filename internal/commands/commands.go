@@ -0,0 +1,790 @@
+// Package commands runs the slash commands the chat clients handle themselves,
+// such as "/quit" or "/ignore", instead of sending them to the server, and
+// keeps the preferences they change.
+package commands
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+	"unicode"
+	"unicode/utf8"
+
+	"github.com/fatih/color"
+	"github.com/jennxsierra/dualnet-chat/internal/chatlog"
+	"github.com/jennxsierra/dualnet-chat/internal/protocol"
+	"github.com/jennxsierra/dualnet-chat/internal/ui"
+)
+
+// DefaultLogFile is where "/log on" keeps the transcript unless "/set log-file"
+// says otherwise.
+const DefaultLogFile = "dualnet-chat.log"
+
+// maxRecentMentions is how many mentions "/mentions" shows again.
+const maxRecentMentions = 20
+
+// maxSearchResults is how many of the newest matches "/search" shows.
+const maxSearchResults = 20
+
+// maxMessageSize is the largest a message may be once encoded, leaving room
+// for the room and session the clients add, so the server reads it whole.
+const maxMessageSize = protocol.MaxLineSize - 1024
+
+// pastePrompt is the prompt while a "/paste" block is typed.
+const pastePrompt = "... "
+
+// Client is what the commands need from a chat client.
+type Client interface {
+	// Connect switches to the server at addr, starting a new session there.
+	Connect(addr string) error
+
+	// Reconnect replaces the connection to the server with a new one,
+	// resuming the session.
+	Reconnect() error
+
+	// Refresh shows the prompt again, e.g. after colors were turned off.
+	Refresh()
+
+	// Send sends a line to the server as if the user typed it.
+	Send(line string) error
+}
+
+// Files is what the file transfer commands need from a client that can send
+// files to other users.
+type Files interface {
+	// SendFile offers the file at path to the user named to.
+	SendFile(to, path string) error
+
+	// AcceptFile saves the file offered with the given ID, or the only one
+	// offered if id is empty.
+	AcceptFile(id string) error
+
+	// DeclineFile declines the file offered with the given ID or stops its
+	// transfer, or does so to the only transfer if id is empty.
+	DeclineFile(id string) error
+}
+
+// names lists the commands the client runs itself, for completion and "/help".
+var names = []string{"/quit", "/clear", "/connect", "/reconnect", "/log", "/color", "/ignore", "/mentions", "/search", "/paste", "/send", "/accept", "/decline", "/set"}
+
+// Local wraps a client's UI: it runs the commands meant for the client, hides
+// the messages of ignored users, highlights and notifies the user of mentions,
+// keeps the transcript and the logs of every room, and completes names, rooms
+// and commands from what the server tells it.
+type Local struct {
+	ui.UI
+	client Client
+	name   string // the user's own name
+
+	mu         sync.Mutex
+	ignored    []string // names of the users whose messages are hidden
+	logFile    string   // where the transcript is kept
+	transcript *os.File // open while the transcript is on
+	timeFormat string   // layout of the timestamps, empty for none
+
+	logs *chatlog.Dir // the logs of every room and conversation, nil for none
+
+	// completion state, guarded by mu
+	members     map[string][]string // who is in each joined room
+	commands    []string            // the server's commands, from "/help"
+	helpPending bool                // "/help" was sent on the user's behalf
+
+	// the "/paste" block being typed, guarded by mu
+	pasting bool
+	pasted  []string
+
+	progress string // how far the file transfers are, guarded by mu
+
+	// mentions of the user, guarded by mu
+	keywords []string            // words that count as mentions besides "@name"
+	notify   ui.Notification     // how the user is told about them
+	unseen   int                 // mentions since the user last typed a line
+	recent   []protocol.Envelope // the latest mentions, for "/mentions"
+}
+
+// NewLocal wraps the UI of the client of a user with the given name, and
+// completes what they type.
+func NewLocal(u ui.UI, client Client, name string) *Local {
+	l := &Local{
+		UI:         u,
+		client:     client,
+		name:       name,
+		logFile:    DefaultLogFile,
+		timeFormat: ui.DefaultTimeFormat,
+		members:    make(map[string][]string),
+		notify:     ui.NotifyBell,
+	}
+	u.SetCompleter(l.Complete)
+	return l
+}
+
+// Run runs line if it is a command for the client, and reports whether it was.
+// Lines of a "/paste" block, and messages too large to send, are taken care of
+// too. Other lines, including the commands for the server, are left to the
+// caller to send. Typing a line counts as having seen the mentions so far.
+func (l *Local) Run(line string) bool {
+	l.seen()
+	if l.collect(line) {
+		return true
+	}
+
+	line = strings.TrimSpace(line)
+	name, arg, _ := strings.Cut(line, " ")
+	arg = strings.TrimSpace(arg)
+
+	switch name {
+	case "/quit":
+		// closing the UI ends the prompt loop, which says goodbye to the server
+		l.Close()
+	case "/clear":
+		l.Clear()
+	case "/connect":
+		if arg == "" {
+			l.Error("Usage: /connect <address>")
+			break
+		}
+		if err := l.client.Connect(arg); err != nil {
+			l.Error(fmt.Sprintf("Unable to connect to %s: %v", arg, err))
+			break
+		}
+		l.Info(fmt.Sprintf("Connected to [%s].", arg))
+	case "/reconnect":
+		if err := l.client.Reconnect(); err != nil {
+			l.Error(fmt.Sprintf("Unable to reconnect: %v", err))
+			break
+		}
+		l.Info("Reconnected to server.")
+	case "/log":
+		l.set("log", arg)
+	case "/color":
+		l.set("color", arg)
+	case "/ignore":
+		l.ignore(arg)
+	case "/mentions":
+		l.showMentions()
+	case "/search":
+		l.search(arg)
+	case "/paste":
+		l.mu.Lock()
+		l.pasting, l.pasted = true, nil
+		l.mu.Unlock()
+		l.Info("Type or paste the message, then /end on a line of its own to send it, or /cancel.")
+		l.client.Refresh()
+	case "/send", "/accept", "/decline":
+		l.files(name, arg)
+	case "/set":
+		key, value, _ := strings.Cut(arg, " ")
+		if key == "" {
+			l.showSettings()
+			break
+		}
+		l.set(key, strings.TrimSpace(value))
+	default:
+		if !fits(line) {
+			l.Error(fmt.Sprintf("The message is too long to send (at most %d bytes).", maxMessageSize))
+			return true
+		}
+		return false
+	}
+	return true
+}
+
+// collect adds line to the "/paste" block being typed, and reports whether
+// there is one. "/end" sends the block as one message, "/cancel" drops it.
+func (l *Local) collect(line string) bool {
+	l.mu.Lock()
+	if !l.pasting {
+		l.mu.Unlock()
+		return false
+	}
+	command := strings.TrimSpace(line)
+	if command != "/end" && command != "/cancel" {
+		l.pasted = append(l.pasted, line)
+		l.mu.Unlock()
+		return true
+	}
+	text := strings.Trim(strings.Join(l.pasted, "\n"), "\n")
+	l.pasting, l.pasted = false, nil
+	l.mu.Unlock()
+	l.client.Refresh()
+
+	switch {
+	case command == "/cancel":
+		l.Info("Message dropped.")
+	case strings.TrimSpace(text) == "":
+		l.Info("Nothing to send.")
+	case !fits(text):
+		l.Error(fmt.Sprintf("The message is too long to send (at most %d bytes).", maxMessageSize))
+	default:
+		if err := l.client.Send(text); err != nil {
+			l.Error(fmt.Sprintf("Unable to send the message: %v", err))
+		}
+	}
+	return true
+}
+
+// files runs the file transfer commands, if the client can send files.
+func (l *Local) files(name, arg string) {
+	files, ok := l.client.(Files)
+	if !ok {
+		l.Error("File transfers need the TCP client.")
+		return
+	}
+
+	switch name {
+	case "/send":
+		to, path, _ := strings.Cut(arg, " ")
+		to, path = strings.TrimPrefix(to, "@"), strings.TrimSpace(path)
+		if to == "" || path == "" {
+			l.Error("Usage: /send <name> <path>")
+			return
+		}
+		if rest, ok := strings.CutPrefix(path, "~/"); ok {
+			if home, err := os.UserHomeDir(); err == nil {
+				path = filepath.Join(home, rest)
+			}
+		}
+		if err := files.SendFile(to, path); err != nil {
+			l.Error(fmt.Sprintf("Unable to send %s: %v", path, err))
+		}
+	case "/accept":
+		if err := files.AcceptFile(arg); err != nil {
+			l.Error(fmt.Sprintf("Unable to accept the file: %v", err))
+		}
+	case "/decline":
+		if err := files.DeclineFile(arg); err != nil {
+			l.Error(fmt.Sprintf("Unable to decline the file: %v", err))
+		}
+	}
+}
+
+// fits reports whether a message is small enough to send.
+func fits(text string) bool {
+	return len(protocol.Encode(protocol.Envelope{Type: protocol.TypeMessage, Text: text})) <= maxMessageSize
+}
+
+// Show shows an envelope unless it comes from an ignored user, and adds it to
+// the transcript. Mentions of the user are highlighted, counted and notified.
+// The server's commands and the members of the rooms are kept for completion.
+func (l *Local) Show(e protocol.Envelope) {
+	l.mu.Lock()
+	if (e.Type == protocol.TypeMessage || e.Type == protocol.TypePresence) && l.isIgnored(e.From) {
+		l.mu.Unlock()
+		return
+	}
+	fetchHelp, showLocal := l.track(e)
+	if e.Commands != nil && l.helpPending {
+		// the reply to the "/help" sent on the user's behalf
+		l.helpPending = false
+		l.mu.Unlock()
+		return
+	}
+	if l.transcript != nil && e.Type != protocol.TypeMembers {
+		fmt.Fprintf(l.transcript, "%s %s\n", time.Now().Format(time.DateTime), e)
+	}
+	if l.logs != nil {
+		l.logs.Write(e)
+	}
+	mention := l.isMention(e)
+	if mention {
+		l.unseen++
+		l.recent = append(l.recent, e)
+		if len(l.recent) > maxRecentMentions {
+			l.recent = l.recent[1:]
+		}
+	}
+	notify := l.notify
+	l.mu.Unlock()
+
+	if mention {
+		l.UI.ShowMention(e)
+		l.UI.Notify(notify, "dualnet-chat", mentionText(e))
+		// the prompt shows the new count
+		l.client.Refresh()
+	} else {
+		l.UI.Show(e)
+	}
+	if showLocal {
+		l.Info("Client commands: " + strings.Join(names, ", "))
+	}
+	if fetchHelp {
+		l.client.Send("/help")
+	}
+}
+
+// track keeps the completion state up to date with an envelope, and returns
+// whether to fetch the server's commands and whether to list the client's own
+// after it. The caller holds mu.
+func (l *Local) track(e protocol.Envelope) (fetchHelp, showLocal bool) {
+	switch e.Type {
+	case protocol.TypeWelcome:
+		// the session may be new, or on another server
+		clear(l.members)
+		for _, room := range e.Rooms {
+			l.members[room] = nil
+		}
+		l.helpPending = true
+		return true, false
+	case protocol.TypeMembers:
+		l.members[e.Room] = e.Members
+	case protocol.TypeJoin:
+		if !slices.Contains(l.members[e.Room], e.From) {
+			l.members[e.Room] = append(l.members[e.Room], e.From)
+		}
+	case protocol.TypeLeave:
+		if e.From == l.name {
+			delete(l.members, e.Room)
+		} else if members, ok := l.members[e.Room]; ok {
+			l.members[e.Room] = slices.DeleteFunc(members, func(m string) bool { return m == e.From })
+		}
+	case protocol.TypeNotice:
+		if e.Commands != nil {
+			l.commands = e.Commands
+			return false, !l.helpPending
+		}
+	}
+	return false, false
+}
+
+// Complete returns the names of the members of the joined rooms after "@",
+// the joined rooms after "#", and the commands of the server and the client
+// after "/", that start with word.
+func (l *Local) Complete(word string) []string {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	var words []string
+	switch {
+	case strings.HasPrefix(word, "@"):
+		for _, members := range l.members {
+			for _, m := range members {
+				if m != l.name {
+					words = append(words, "@"+m)
+				}
+			}
+		}
+	case strings.HasPrefix(word, "#"):
+		for room := range l.members {
+			words = append(words, "#"+room)
+		}
+	case strings.HasPrefix(word, "/"):
+		words = append(slices.Clone(l.commands), names...)
+	}
+
+	words = slices.DeleteFunc(words, func(w string) bool { return !strings.HasPrefix(w, word) })
+	slices.Sort(words)
+	return slices.Compact(words)
+}
+
+// Sent shows a line the user sent to room and adds it to the logs, if it is a
+// message or "/msg".
+func (l *Local) Sent(room, line string) {
+	e := protocol.Envelope{Type: protocol.TypeMessage, Time: time.Now(), From: l.name, Room: room, Text: line}
+	if rest, ok := strings.CutPrefix(line, "/msg "); ok {
+		to, text, _ := strings.Cut(strings.TrimSpace(rest), " ")
+		e.Room, e.To, e.Text = "", to, strings.TrimSpace(text)
+	} else if strings.HasPrefix(line, "/") {
+		return
+	}
+
+	l.mu.Lock()
+	if l.logs != nil {
+		l.logs.Write(e)
+	}
+	l.mu.Unlock()
+
+	l.UI.ShowSent(e)
+}
+
+// SetLogDir starts keeping the logs of every room and conversation in dir, or
+// stops if it is empty.
+func (l *Local) SetLogDir(dir string) error {
+	var logs *chatlog.Dir
+	if dir != "" {
+		var err error
+		if logs, err = chatlog.Open(dir, l.name); err != nil {
+			return err
+		}
+	}
+
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if l.logs != nil {
+		l.logs.Close()
+	}
+	l.logs = logs
+	return nil
+}
+
+// SetStatus shows the state of the connection, and the file transfers and
+// the mentions the user has not seen in front of the prompt.
+func (l *Local) SetStatus(st ui.Status) {
+	l.mu.Lock()
+	st.Mentions = l.unseen
+	st.Transfers = l.progress
+	pasting := l.pasting
+	l.mu.Unlock()
+
+	if st.Prompt != "" && pasting {
+		st.Prompt = pastePrompt
+	}
+	if st.Prompt != "" && st.Transfers != "" {
+		st.Prompt = color.CyanString("(%s) ", st.Transfers) + st.Prompt
+	}
+	if st.Prompt != "" && st.Mentions > 0 {
+		st.Prompt = color.New(color.FgHiYellow, color.Bold).Sprintf("(%d@) ", st.Mentions) + st.Prompt
+	}
+	l.UI.SetStatus(st)
+}
+
+// Progress shows how far the file transfers are in front of the prompt, or
+// nothing if text is empty.
+func (l *Local) Progress(text string) {
+	l.mu.Lock()
+	l.progress = text
+	l.mu.Unlock()
+	l.client.Refresh()
+}
+
+// SetKeywords sets the words that count as mentions besides "@name", such as
+// the user's nickname or the name of a project.
+func (l *Local) SetKeywords(words []string) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.keywords = slices.DeleteFunc(slices.Clone(words), func(w string) bool { return w == "" })
+}
+
+// SetNotification sets how the user is told about mentions.
+func (l *Local) SetNotification(n ui.Notification) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.notify = n
+}
+
+// SetTimeFormat sets the layout of the timestamps, as in
+// [time.Time.Format], or turns them off if it is empty.
+func (l *Local) SetTimeFormat(layout string) {
+	l.mu.Lock()
+	l.timeFormat = layout
+	l.mu.Unlock()
+	l.UI.SetTimeFormat(layout)
+}
+
+// Close closes the transcript, the logs and the UI.
+func (l *Local) Close() {
+	l.mu.Lock()
+	if l.transcript != nil {
+		l.transcript.Close()
+		l.transcript = nil
+	}
+	if l.logs != nil {
+		l.logs.Close()
+		l.logs = nil
+	}
+	l.mu.Unlock()
+
+	l.UI.Close()
+}
+
+// settings lists the preferences "/set" changes, in the order it shows them.
+var settings = []string{"color", "time-format", "keywords", "notify", "log", "log-file", "log-dir"}
+
+// showSettings lists the preferences and their values.
+func (l *Local) showSettings() {
+	for _, key := range settings {
+		l.Info(fmt.Sprintf("%s = %s", key, l.get(key)))
+	}
+}
+
+// get returns the value of a preference.
+func (l *Local) get(key string) string {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	switch key {
+	case "color":
+		return onOff(!color.NoColor)
+	case "log":
+		return onOff(l.transcript != nil)
+	case "log-file":
+		return l.logFile
+	case "log-dir":
+		if l.logs == nil {
+			return "off"
+		}
+		return l.logs.Path()
+	case "time-format":
+		if l.timeFormat == "" {
+			return "off"
+		}
+		return l.timeFormat
+	case "keywords":
+		if len(l.keywords) == 0 {
+			return "none"
+		}
+		return strings.Join(l.keywords, ",")
+	case "notify":
+		return string(l.notify)
+	}
+	return ""
+}
+
+// set changes a preference, or shows it if value is empty.
+func (l *Local) set(key, value string) {
+	if !slices.Contains(settings, key) {
+		l.Error(fmt.Sprintf("Unknown setting %q; try /set to list them.", key))
+		return
+	}
+	if value == "" {
+		l.Info(fmt.Sprintf("%s = %s", key, l.get(key)))
+		return
+	}
+
+	var err error
+	switch key {
+	case "color":
+		var on bool
+		if on, err = parseOnOff(value); err == nil {
+			color.NoColor = !on
+			l.client.Refresh()
+		}
+	case "log":
+		var on bool
+		if on, err = parseOnOff(value); err == nil {
+			err = l.setLog(on)
+		}
+	case "log-file":
+		l.mu.Lock()
+		l.logFile = value
+		l.mu.Unlock()
+	case "log-dir":
+		if value == "off" {
+			value = ""
+		}
+		err = l.SetLogDir(value)
+	case "time-format":
+		if value == "off" {
+			value = ""
+		}
+		l.SetTimeFormat(value)
+	case "keywords":
+		var words []string
+		if value != "none" {
+			words = SplitKeywords(value)
+		}
+		l.SetKeywords(words)
+	case "notify":
+		var n ui.Notification
+		if n, err = ui.ParseNotification(value); err == nil {
+			l.SetNotification(n)
+		}
+	}
+	if err != nil {
+		l.Error(fmt.Sprintf("Unable to set %s: %v", key, err))
+		return
+	}
+	l.Info(fmt.Sprintf("%s = %s", key, l.get(key)))
+}
+
+// setLog starts or stops keeping the transcript.
+func (l *Local) setLog(on bool) error {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if !on {
+		if l.transcript != nil {
+			l.transcript.Close()
+			l.transcript = nil
+		}
+		return nil
+	}
+	if l.transcript != nil {
+		return nil
+	}
+	f, err := os.OpenFile(l.logFile, os.O_WRONLY|os.O_CREATE|os.O_APPEND, 0o600)
+	if err != nil {
+		return err
+	}
+	l.transcript = f
+	return nil
+}
+
+// ignore starts or stops hiding a user's messages, or lists the ignored users
+// if name is empty.
+func (l *Local) ignore(name string) {
+	l.mu.Lock()
+	ignored := slices.Clone(l.ignored)
+	i := slices.Index(l.ignored, name)
+	switch {
+	case name == "":
+	case i >= 0:
+		l.ignored = slices.Delete(l.ignored, i, i+1)
+	default:
+		l.ignored = append(l.ignored, name)
+	}
+	l.mu.Unlock()
+
+	switch {
+	case name == "" && len(ignored) == 0:
+		l.Info("You are not ignoring anyone.")
+	case name == "":
+		l.Info("Ignoring " + strings.Join(ignored, ", ") + ".")
+	case i >= 0:
+		l.Info(fmt.Sprintf("No longer ignoring %s.", name))
+	default:
+		l.Info(fmt.Sprintf("Ignoring %s; /ignore %s again to stop.", name, name))
+	}
+}
+
+// isIgnored reports whether from, a full name such as "bob@10.0.0.2:5000", is
+// one of the ignored users, who may be given with or without the address. The
+// caller holds mu.
+func (l *Local) isIgnored(from string) bool {
+	user, _, _ := strings.Cut(from, "@")
+	return slices.Contains(l.ignored, from) || slices.Contains(l.ignored, user)
+}
+
+// isMention reports whether e is a message for the user: a direct message, or
+// one naming them with "@name" or containing one of the keywords. The caller
+// holds mu.
+func (l *Local) isMention(e protocol.Envelope) bool {
+	if e.Type != protocol.TypeMessage || e.From == l.name {
+		return false
+	}
+	if e.To != "" {
+		return true
+	}
+	user, _, _ := strings.Cut(l.name, "@")
+	if containsWord(e.Text, "@"+user) {
+		return true
+	}
+	return slices.ContainsFunc(l.keywords, func(k string) bool { return containsWord(e.Text, k) })
+}
+
+// seen resets the count of unseen mentions.
+func (l *Local) seen() {
+	l.mu.Lock()
+	unseen := l.unseen
+	l.unseen = 0
+	l.mu.Unlock()
+
+	if unseen > 0 {
+		l.client.Refresh()
+	}
+}
+
+// showMentions lists the latest mentions of the user again.
+func (l *Local) showMentions() {
+	l.mu.Lock()
+	recent := slices.Clone(l.recent)
+	l.mu.Unlock()
+
+	if len(recent) == 0 {
+		l.Info("Nobody has mentioned you yet.")
+		return
+	}
+	for _, e := range recent {
+		l.Info(e.Time.Local().Format(time.DateTime) + " " + e.String())
+	}
+}
+
+// search shows the newest lines of the logs that contain text.
+func (l *Local) search(text string) {
+	if text == "" {
+		l.Error("Usage: /search <text>")
+		return
+	}
+	l.mu.Lock()
+	logs := l.logs
+	l.mu.Unlock()
+	if logs == nil {
+		l.Error("No logs to search; start the client with --log-dir or use /set log-dir <path>.")
+		return
+	}
+
+	matches, total, err := logs.Search(text, maxSearchResults)
+	switch {
+	case err != nil:
+		l.Error(fmt.Sprintf("Unable to search the logs: %v", err))
+		return
+	case total == 0:
+		l.Info(fmt.Sprintf("No messages contain %q.", text))
+		return
+	case total > len(matches):
+		l.Info(fmt.Sprintf("%d messages contain %q; the newest %d:", total, text, len(matches)))
+	}
+	for _, m := range matches {
+		l.Info(m.Line)
+	}
+}
+
+// mentionText describes a mention in a notification.
+func mentionText(e protocol.Envelope) string {
+	user, _, _ := strings.Cut(e.From, "@")
+	if e.To != "" {
+		return user + " (direct): " + e.Text
+	}
+	room := e.Room
+	if room == "" {
+		room = protocol.DefaultRoom
+	}
+	return user + " in #" + room + ": " + e.Text
+}
+
+// SplitKeywords splits a comma-separated list of keywords, as given to
+// --keywords or "/set keywords".
+func SplitKeywords(list string) []string {
+	var words []string
+	for _, w := range strings.Split(list, ",") {
+		if w = strings.TrimSpace(w); w != "" {
+			words = append(words, w)
+		}
+	}
+	return words
+}
+
+// containsWord reports whether word appears in text on its own rather than as
+// part of a longer word, ignoring case.
+func containsWord(text, word string) bool {
+	text, word = strings.ToLower(text), strings.ToLower(word)
+	for i := 0; word != "" && i <= len(text); {
+		j := strings.Index(text[i:], word)
+		if j < 0 {
+			return false
+		}
+		start, end := i+j, i+j+len(word)
+		before, _ := utf8.DecodeLastRuneInString(text[:start])
+		after, _ := utf8.DecodeRuneInString(text[end:])
+		if !isWordRune(before) && !isWordRune(after) {
+			return true
+		}
+		i = start + 1
+	}
+	return false
+}
+
+// isWordRune reports whether r can be part of a word.
+func isWordRune(r rune) bool {
+	return r == '_' || unicode.IsLetter(r) || unicode.IsDigit(r)
+}
+
+// onOff describes a switch.
+func onOff(on bool) string {
+	if on {
+		return "on"
+	}
+	return "off"
+}
+
+// parseOnOff parses the value of a switch.
+func parseOnOff(value string) (bool, error) {
+	switch value {
+	case "on":
+		return true, nil
+	case "off":
+		return false, nil
+	}
+	return false, fmt.Errorf("%q is neither on nor off", value)
+}
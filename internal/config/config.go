@@ -0,0 +1,399 @@
+// Package config loads the JSON configuration file shared by the TCP and UDP
+// servers.
+package config
+
+import (
+	"bytes"
+	"crypto/tls"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/jennxsierra/dualnet-chat/internal/admin"
+	"github.com/jennxsierra/dualnet-chat/internal/chat"
+	"github.com/jennxsierra/dualnet-chat/internal/cron"
+	"github.com/jennxsierra/dualnet-chat/internal/discovery"
+	"github.com/jennxsierra/dualnet-chat/internal/logging"
+	"github.com/jennxsierra/dualnet-chat/internal/netutils"
+)
+
+// File is the contents of a server configuration file. Settings missing from
+// the file keep their defaults.
+type File struct {
+	Listen   string         `json:"listen"`           // address to listen on, e.g. "[::]:4000"
+	Metrics  string         `json:"metrics_listen"`   // address of the metrics HTTP listener, none if empty
+	Web      string         `json:"websocket_listen"` // address of the WebSocket gateway, none if empty
+	IRC      string         `json:"irc_listen"`       // address of the IRC gateway, none if empty
+	Unix     UnixSocket     `json:"unix_socket"`      // TCP only
+	Admin    Admin          `json:"admin"`
+	Timeouts Timeouts       `json:"timeouts"`
+	Limits   Limits         `json:"limits"`
+	Rooms    Rooms          `json:"rooms"`
+	MOTD     string         `json:"motd"`      // message of the day, "{name}" is replaced by the client's
+	MOTDFile string         `json:"motd_file"` // file to read the message of the day from instead
+	Bans     []string       `json:"bans"`      // client names, IP addresses or CIDR prefixes
+	TLS      TLS            `json:"tls"`
+	Log      logging.Config `json:"log"`
+
+	OperatorPassword string      `json:"operator_password"` // for /oper, operator commands are disabled if empty
+	Broadcasts       []Broadcast `json:"broadcasts"`
+	Discovery        Discovery   `json:"discovery"`
+}
+
+// Broadcast is a server notice posted on a schedule, mirroring [chat.Broadcast].
+type Broadcast struct {
+	Cron  string   `json:"cron"`  // e.g. "0 9 * * 1-5" for 9:00 on weekdays
+	Rooms []string `json:"rooms"` // every client if empty
+	Text  string   `json:"text"`
+}
+
+// Timeouts mirror the servers' timeout flags.
+type Timeouts struct {
+	KeepAlive   Duration `json:"keepalive"`          // TCP only
+	Inactivity  Duration `json:"inactivity_timeout"` // UDP only
+	Sweep       Duration `json:"sweep_interval"`
+	AwayAfter   Duration `json:"away_after"`
+	IdleTimeout Duration `json:"idle_timeout"`
+}
+
+// Limits mirror [chat.Limits].
+type Limits struct {
+	MessageRate      float64 `json:"message_rate"`
+	MessageBurst     int     `json:"message_burst"`
+	MaxMessageLength int     `json:"max_message_length"`
+	MaxClients       int     `json:"max_clients"`
+
+	MaxFileSizeMB int `json:"max_file_size_mb"` // 0 for no limit
+	FileQuotaMB   int `json:"file_quota_mb"`    // per client while connected, 0 for no limit
+}
+
+// Rooms mirror [chat.RoomPolicy].
+type Rooms struct {
+	Default []string `json:"default"`
+	Allowed []string `json:"allowed"`
+}
+
+// UnixSocket is a Unix socket the TCP server also accepts local clients on.
+// Its permissions decide who may connect.
+type UnixSocket struct {
+	Path string `json:"path"` // disabled if empty
+	Mode string `json:"mode"` // permissions in octal, e.g. "0660"
+}
+
+// FileMode parses the socket's permissions. It returns 0 if they are not set.
+func (u UnixSocket) FileMode() (os.FileMode, error) {
+	if u.Mode == "" {
+		return 0, nil
+	}
+	mode, err := strconv.ParseUint(u.Mode, 8, 32)
+	if err != nil || mode > 0o777 {
+		return 0, fmt.Errorf("mode %q must be octal permissions such as \"0660\"", u.Mode)
+	}
+	return os.FileMode(mode), nil
+}
+
+// Admin configures the admin API, which is disabled if Listen is empty.
+type Admin struct {
+	Listen string `json:"listen"` // loopback address, e.g. "127.0.0.1:9200"
+	Token  string `json:"token"`  // required by every request
+}
+
+// TLS names the certificate and key the TCP server encrypts connections with.
+// Both are empty to disable TLS.
+type TLS struct {
+	Cert string `json:"cert"`
+	Key  string `json:"key"`
+}
+
+// Discovery configures how the server announces itself to clients looking for
+// servers on the local network.
+type Discovery struct {
+	Announce bool     `json:"announce"`
+	Name     string   `json:"name"` // the host name if empty
+	Interval Duration `json:"interval"`
+}
+
+// Duration is a [time.Duration] written as a string such as "30s" or "10m".
+type Duration time.Duration
+
+// UnmarshalJSON parses a duration string.
+func (d *Duration) UnmarshalJSON(data []byte) error {
+	var s string
+	if err := json.Unmarshal(data, &s); err != nil {
+		return fmt.Errorf("duration must be a string such as \"30s\": %s", data)
+	}
+	parsed, err := time.ParseDuration(s)
+	if err != nil {
+		return err
+	}
+	*d = Duration(parsed)
+	return nil
+}
+
+// MarshalJSON writes the duration as a string.
+func (d Duration) MarshalJSON() ([]byte, error) {
+	return json.Marshal(time.Duration(d).String())
+}
+
+// New returns the configuration equivalent to the given listen address and hub
+// configuration, which serves as the defaults for a configuration file.
+func New(listen string, cfg chat.Config) File {
+	return File{
+		Listen: listen,
+		Timeouts: Timeouts{
+			Inactivity:  Duration(cfg.InactivityTimeout),
+			Sweep:       Duration(cfg.SweepInterval),
+			AwayAfter:   Duration(cfg.Idle.AwayAfter),
+			IdleTimeout: Duration(cfg.Idle.DisconnectAfter),
+		},
+		Limits: Limits{
+			MessageRate:      cfg.Limits.MessageRate,
+			MessageBurst:     cfg.Limits.MessageBurst,
+			MaxMessageLength: cfg.Limits.MaxMessageLength,
+			MaxClients:       cfg.Limits.MaxClients,
+			MaxFileSizeMB:    int(cfg.Limits.MaxFileSize >> 20),
+			FileQuotaMB:      int(cfg.Limits.FileQuota >> 20),
+		},
+		Rooms:     Rooms{Default: cfg.Rooms.Default, Allowed: cfg.Rooms.Allowed},
+		MOTD:      cfg.MOTD,
+		Log:       logging.DefaultConfig(),
+		Discovery: Discovery{Announce: true, Interval: Duration(discovery.DefaultInterval)},
+	}
+}
+
+// Load reads the configuration file at path on top of the given defaults.
+// Unknown settings are rejected so typos do not go unnoticed.
+func Load(path string, defaults File) (File, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return File{}, err
+	}
+
+	f := defaults
+	decoder := json.NewDecoder(bytes.NewReader(data))
+	decoder.DisallowUnknownFields()
+	if err := decoder.Decode(&f); err != nil {
+		return File{}, fmt.Errorf("%s: %w", path, err)
+	}
+	return f, nil
+}
+
+// Validate reports every problem with the configuration at once. The
+// transport ("tcp" or "udp") decides which settings apply.
+func (f File) Validate(transport string) error {
+	var errs []error
+	check := func(ok bool, format string, args ...any) {
+		if !ok {
+			errs = append(errs, fmt.Errorf(format, args...))
+		}
+	}
+
+	if _, port, err := net.SplitHostPort(f.Listen); err != nil {
+		errs = append(errs, fmt.Errorf("listen: %w", err))
+	} else {
+		n, err := strconv.Atoi(port)
+		check(err == nil && netutils.IsValidPort(n), "listen: port %s must be between 1 and 65535", port)
+	}
+
+	if f.Metrics != "" {
+		if _, _, err := net.SplitHostPort(f.Metrics); err != nil {
+			errs = append(errs, fmt.Errorf("metrics_listen: %w", err))
+		}
+	}
+
+	if f.Web != "" {
+		if _, _, err := net.SplitHostPort(f.Web); err != nil {
+			errs = append(errs, fmt.Errorf("websocket_listen: %w", err))
+		}
+	}
+
+	if f.IRC != "" {
+		if _, _, err := net.SplitHostPort(f.IRC); err != nil {
+			errs = append(errs, fmt.Errorf("irc_listen: %w", err))
+		}
+	}
+
+	if f.Admin.Listen != "" {
+		if err := admin.CheckAddr(f.Admin.Listen); err != nil {
+			errs = append(errs, fmt.Errorf("admin.listen: %w", err))
+		}
+		check(f.Admin.Token != "", "admin.token must be set when the admin API is enabled")
+	}
+
+	t := f.Timeouts
+	if transport == "tcp" {
+		check(t.KeepAlive > 0, "timeouts.keepalive must be positive")
+	} else {
+		check(t.Inactivity > 0, "timeouts.inactivity_timeout must be positive")
+	}
+	check(t.Sweep > 0, "timeouts.sweep_interval must be positive")
+	check(t.AwayAfter >= 0, "timeouts.away_after must not be negative")
+	check(t.IdleTimeout >= 0, "timeouts.idle_timeout must not be negative")
+
+	l := f.Limits
+	check(l.MessageRate > 0, "limits.message_rate must be positive")
+	check(l.MessageBurst > 0, "limits.message_burst must be positive")
+	check(l.MaxMessageLength >= 0, "limits.max_message_length must not be negative")
+	check(l.MaxClients >= 0, "limits.max_clients must not be negative")
+	check(l.MaxFileSizeMB >= 0, "limits.max_file_size_mb must not be negative")
+	check(l.FileQuotaMB >= 0, "limits.file_quota_mb must not be negative")
+
+	for _, room := range append(f.Rooms.Default, f.Rooms.Allowed...) {
+		normalized, ok := chat.NormalizeRoom(room)
+		check(ok && normalized == room, "rooms: %q is not a valid room name (lowercase letters, digits, '-' and '_')", room)
+	}
+
+	if f.MOTDFile != "" {
+		if _, err := os.ReadFile(f.MOTDFile); err != nil {
+			errs = append(errs, fmt.Errorf("motd_file: %w", err))
+		}
+	}
+
+	for i, b := range f.Broadcasts {
+		if _, err := cron.Parse(b.Cron); err != nil {
+			errs = append(errs, fmt.Errorf("broadcasts[%d]: %w", i, err))
+		}
+		for _, room := range b.Rooms {
+			normalized, ok := chat.NormalizeRoom(room)
+			check(ok && normalized == room, "broadcasts[%d]: %q is not a valid room name", i, room)
+		}
+		check(strings.TrimSpace(b.Text) != "", "broadcasts[%d]: text must not be empty", i)
+	}
+
+	if _, err := chat.ParseBans(f.Bans); err != nil {
+		errs = append(errs, fmt.Errorf("bans: %w", err))
+	}
+
+	if transport == "udp" {
+		check(f.Unix.Path == "", "unix_socket is not supported by the UDP server")
+	} else if _, err := f.Unix.FileMode(); err != nil {
+		errs = append(errs, fmt.Errorf("unix_socket: %w", err))
+	}
+
+	if transport == "udp" {
+		check(f.TLS == TLS{}, "tls is not supported by the UDP server")
+	} else if (f.TLS.Cert == "") != (f.TLS.Key == "") {
+		errs = append(errs, errors.New("tls: cert and key must be set together"))
+	} else if _, err := f.TLS.Load(); err != nil {
+		errs = append(errs, fmt.Errorf("tls: %w", err))
+	}
+
+	if f.Discovery.Announce {
+		check(f.Discovery.Interval > 0, "discovery.interval must be positive")
+	}
+
+	if err := f.Log.Validate(); err != nil {
+		errs = append(errs, fmt.Errorf("log: %w", err))
+	}
+
+	return errors.Join(errs...)
+}
+
+// Chat returns the hub configuration. The file must have been validated; the
+// MOTD file, if any, is read again so a reload picks up its changes.
+func (f File) Chat() chat.Config {
+	bans, _ := chat.ParseBans(f.Bans)
+
+	motd := f.MOTD
+	if f.MOTDFile != "" {
+		if data, err := os.ReadFile(f.MOTDFile); err == nil {
+			motd = strings.TrimRight(string(data), "\n")
+		}
+	}
+
+	var broadcasts []chat.Broadcast
+	for _, b := range f.Broadcasts {
+		schedule, _ := cron.Parse(b.Cron)
+		broadcasts = append(broadcasts, chat.Broadcast{Schedule: schedule, Rooms: b.Rooms, Text: b.Text})
+	}
+
+	return chat.Config{
+		InactivityTimeout: time.Duration(f.Timeouts.Inactivity),
+		SweepInterval:     time.Duration(f.Timeouts.Sweep),
+		Idle: chat.IdlePolicy{
+			AwayAfter:       time.Duration(f.Timeouts.AwayAfter),
+			DisconnectAfter: time.Duration(f.Timeouts.IdleTimeout),
+		},
+		Limits: chat.Limits{
+			MessageRate:      f.Limits.MessageRate,
+			MessageBurst:     f.Limits.MessageBurst,
+			MaxMessageLength: f.Limits.MaxMessageLength,
+			MaxClients:       f.Limits.MaxClients,
+			MaxFileSize:      int64(f.Limits.MaxFileSizeMB) << 20,
+			FileQuota:        int64(f.Limits.FileQuotaMB) << 20,
+		},
+		Rooms:            chat.RoomPolicy{Default: f.Rooms.Default, Allowed: f.Rooms.Allowed},
+		MOTD:             motd,
+		Bans:             bans,
+		OperatorPassword: f.OperatorPassword,
+		Broadcasts:       broadcasts,
+	}
+}
+
+// Load reads the certificate and key. It returns nil if TLS is disabled.
+func (t TLS) Load() (*tls.Config, error) {
+	if t.Cert == "" && t.Key == "" {
+		return nil, nil
+	}
+	cert, err := tls.LoadX509KeyPair(t.Cert, t.Key)
+	if err != nil {
+		return nil, err
+	}
+	return &tls.Config{Certificates: []tls.Certificate{cert}}, nil
+}
+
+// RestartRequired lists the settings that differ between two configurations
+// but only take effect when the server restarts.
+func RestartRequired(old, new File) []string {
+	var changed []string
+	if old.Listen != new.Listen {
+		changed = append(changed, "listen")
+	}
+	if old.Metrics != new.Metrics {
+		changed = append(changed, "metrics_listen")
+	}
+	if old.Web != new.Web {
+		changed = append(changed, "websocket_listen")
+	}
+	if old.IRC != new.IRC {
+		changed = append(changed, "irc_listen")
+	}
+	if old.Admin != new.Admin {
+		changed = append(changed, "admin")
+	}
+	if old.Unix != new.Unix {
+		changed = append(changed, "unix_socket")
+	}
+	if old.TLS != new.TLS {
+		changed = append(changed, "tls")
+	}
+	if old.Discovery != new.Discovery {
+		changed = append(changed, "discovery")
+	}
+	return changed
+}
+
+// Endpoints lists the transports clients can connect with, for the server's
+// discovery announcements. The transport ("tcp" or "udp") is the server's own.
+func (f File) Endpoints(transport string) []discovery.Endpoint {
+	var endpoints []discovery.Endpoint
+	add := func(transport, addr string, tls bool) {
+		if port, err := netutils.GetPortFromAddress(addr); err == nil {
+			endpoints = append(endpoints, discovery.Endpoint{Transport: transport, Port: port, TLS: tls})
+		}
+	}
+
+	add(transport, f.Listen, transport == "tcp" && f.TLS.Cert != "")
+	if f.Web != "" {
+		add("ws", f.Web, false)
+	}
+	if f.IRC != "" {
+		add("irc", f.IRC, false)
+	}
+	return endpoints
+}
@@ -0,0 +1,22 @@
+package config
+
+import (
+	"log/slog"
+	"os"
+	"os/signal"
+	"syscall"
+)
+
+// OnReload calls reload every time the process receives SIGHUP, one call at a
+// time.
+func OnReload(reload func()) {
+	hangup := make(chan os.Signal, 1)
+	signal.Notify(hangup, syscall.SIGHUP)
+
+	go func() {
+		for range hangup {
+			slog.Info("reloading configuration")
+			reload()
+		}
+	}()
+}
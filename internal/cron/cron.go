@@ -0,0 +1,205 @@
+// Package cron parses standard five-field cron expressions and computes when
+// they next fire.
+package cron
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Schedule is a parsed cron expression: minute, hour, day of month, month and
+// day of week.
+type Schedule struct {
+	expr string
+
+	minutes, hours, days, months, weekdays uint64 // bit sets of allowed values
+
+	// like cron, a restricted day of month and day of week match either one
+	anyDay, anyWeekday bool
+}
+
+// field describes the valid range of one cron field.
+type field struct {
+	name     string
+	min, max int
+}
+
+var fields = [5]field{
+	{"minute", 0, 59},
+	{"hour", 0, 23},
+	{"day of month", 1, 31},
+	{"month", 1, 12},
+	{"day of week", 0, 7}, // 0 and 7 are both Sunday
+}
+
+// descriptors are the supported shorthands for common schedules.
+var descriptors = map[string]string{
+	"@hourly":  "0 * * * *",
+	"@daily":   "0 0 * * *",
+	"@weekly":  "0 0 * * 0",
+	"@monthly": "0 0 1 * *",
+	"@yearly":  "0 0 1 1 *",
+}
+
+// Parse parses an expression such as "0 9 * * 1-5" (9:00 on weekdays) or
+// "*/15 * * * *" (every 15 minutes). Each field is "*", a value, a range
+// "a-b" or a list of those separated by commas, optionally followed by a step
+// "/n". The shorthands @hourly, @daily, @weekly, @monthly and @yearly are
+// accepted as well.
+func Parse(expr string) (Schedule, error) {
+	spec := strings.TrimSpace(expr)
+	if full, ok := descriptors[spec]; ok {
+		spec = full
+	}
+
+	parts := strings.Fields(spec)
+	if len(parts) != len(fields) {
+		return Schedule{}, fmt.Errorf("cron expression %q must have 5 fields", expr)
+	}
+
+	var sets [5]uint64
+	for i, part := range parts {
+		set, err := parseField(part, fields[i])
+		if err != nil {
+			return Schedule{}, fmt.Errorf("cron expression %q: %w", expr, err)
+		}
+		sets[i] = set
+	}
+
+	// fold Sunday as 7 into 0
+	if sets[4]&(1<<7) != 0 {
+		sets[4] = sets[4]&^(1<<7) | 1
+	}
+
+	return Schedule{
+		expr:       expr,
+		minutes:    sets[0],
+		hours:      sets[1],
+		days:       sets[2],
+		months:     sets[3],
+		weekdays:   sets[4],
+		anyDay:     parts[2] == "*",
+		anyWeekday: parts[4] == "*",
+	}, nil
+}
+
+// parseField parses one comma-separated field into a bit set.
+func parseField(s string, f field) (uint64, error) {
+	var set uint64
+	for _, item := range strings.Split(s, ",") {
+		rangePart, stepPart, hasStep := strings.Cut(item, "/")
+
+		step := 1
+		if hasStep {
+			n, err := strconv.Atoi(stepPart)
+			if err != nil || n <= 0 {
+				return 0, fmt.Errorf("invalid step %q in %s field", stepPart, f.name)
+			}
+			step = n
+		}
+
+		lo, hi := f.min, f.max
+		switch {
+		case rangePart == "*":
+		case strings.Contains(rangePart, "-"):
+			a, b, _ := strings.Cut(rangePart, "-")
+			var err error
+			if lo, err = parseValue(a, f); err != nil {
+				return 0, err
+			}
+			if hi, err = parseValue(b, f); err != nil {
+				return 0, err
+			}
+			if lo > hi {
+				return 0, fmt.Errorf("invalid range %q in %s field", rangePart, f.name)
+			}
+		default:
+			v, err := parseValue(rangePart, f)
+			if err != nil {
+				return 0, err
+			}
+			lo = v
+			if !hasStep {
+				hi = v
+			}
+		}
+
+		for v := lo; v <= hi; v += step {
+			set |= 1 << v
+		}
+	}
+	return set, nil
+}
+
+// parseValue parses a single number within the field's range.
+func parseValue(s string, f field) (int, error) {
+	v, err := strconv.Atoi(s)
+	if err != nil || v < f.min || v > f.max {
+		return 0, fmt.Errorf("%q is not a valid %s (%d-%d)", s, f.name, f.min, f.max)
+	}
+	return v, nil
+}
+
+// String returns the expression the schedule was parsed from.
+func (s Schedule) String() string {
+	return s.expr
+}
+
+// Next returns the first time after t, truncated to the minute, that the
+// schedule fires. Times skipped by a daylight saving change do not fire that
+// day. It returns the zero time if it never fires within five years (e.g.
+// "0 0 31 2 *").
+func (s Schedule) Next(t time.Time) time.Time {
+	t = t.Truncate(time.Minute).Add(time.Minute)
+	limit := t.AddDate(5, 0, 0)
+
+	for t.Before(limit) {
+		switch {
+		case !has(s.months, int(t.Month())):
+			t = later(t, time.Date(t.Year(), t.Month()+1, 1, 0, 0, 0, 0, t.Location()))
+		case !s.dayMatches(t):
+			t = later(t, time.Date(t.Year(), t.Month(), t.Day()+1, 0, 0, 0, 0, t.Location()))
+		case !has(s.hours, t.Hour()):
+			t = later(t, time.Date(t.Year(), t.Month(), t.Day(), t.Hour()+1, 0, 0, 0, t.Location()))
+		case !has(s.minutes, t.Minute()):
+			t = t.Add(time.Minute)
+		default:
+			return t
+		}
+	}
+	return time.Time{}
+}
+
+// later returns next, or the start of the hour after t if next is not after
+// t. A time in the gap of a daylight saving change, such as 2:00 when clocks
+// jump from 2:00 to 3:00, is moved back by [time.Date], which would keep Next
+// from advancing.
+func later(t, next time.Time) time.Time {
+	if !next.After(t) {
+		return t.Add(time.Duration(60-t.Minute()) * time.Minute)
+	}
+	return next
+}
+
+// dayMatches applies cron's rule for day of month and day of week: if both
+// are restricted, matching either one is enough.
+func (s Schedule) dayMatches(t time.Time) bool {
+	day, weekday := has(s.days, t.Day()), has(s.weekdays, int(t.Weekday()))
+	switch {
+	case s.anyDay && s.anyWeekday:
+		return true
+	case s.anyDay:
+		return weekday
+	case s.anyWeekday:
+		return day
+	default:
+		return day || weekday
+	}
+}
+
+// has reports whether v is in the bit set.
+func has(set uint64, v int) bool {
+	return set&(1<<v) != 0
+}
@@ -0,0 +1,52 @@
+package discovery
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+)
+
+// ErrNoServers is returned by [Choose] when no server offers the transport.
+var ErrNoServers = errors.New("no servers found on the local network")
+
+// Choose lists the servers that offer a transport on out and asks the user to
+// pick one on in. It returns the chosen server and its endpoint's address.
+func Choose(servers []Server, transport string, in io.Reader, out io.Writer) (Server, string, error) {
+	var offering []Server
+	for _, s := range servers {
+		if _, ok := s.Endpoint(transport); ok {
+			offering = append(offering, s)
+		}
+	}
+	if len(offering) == 0 {
+		return Server{}, "", ErrNoServers
+	}
+
+	fmt.Fprintln(out, "Servers on the local network:")
+	for i, s := range offering {
+		addr, _ := s.Addr(transport)
+		e, _ := s.Endpoint(transport)
+		tls := ""
+		if e.TLS {
+			tls = ", TLS"
+		}
+		fmt.Fprintf(out, "  %d) %s at %s (%d rooms, %d clients%s)\n", i+1, s.Name, addr, s.Rooms, s.Clients, tls)
+	}
+
+	scanner := bufio.NewScanner(in)
+	for {
+		fmt.Fprintf(out, "Pick a server [1-%d]: ", len(offering))
+		if !scanner.Scan() {
+			return Server{}, "", io.EOF
+		}
+		n, err := strconv.Atoi(strings.TrimSpace(scanner.Text()))
+		if err == nil && n >= 1 && n <= len(offering) {
+			s := offering[n-1]
+			addr, _ := s.Addr(transport)
+			return s, addr, nil
+		}
+	}
+}
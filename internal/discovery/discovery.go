@@ -0,0 +1,248 @@
+// Package discovery lets clients find chat servers on the local network. Servers
+// announce themselves on a multicast group every few seconds and answer probes
+// right away; clients listen on the group, send a probe and collect the
+// announcements that arrive.
+package discovery
+
+import (
+	"encoding/json"
+	"log/slog"
+	"net"
+	"slices"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/jennxsierra/dualnet-chat/internal/chat"
+	"github.com/jennxsierra/dualnet-chat/internal/protocol"
+)
+
+// Group is the multicast group servers announce themselves on. It is in the
+// organization-local scope, so announcements stay on the local network.
+const Group = "239.255.42.99:4099"
+
+// DefaultInterval is how often servers announce themselves.
+const DefaultInterval = 5 * time.Second
+
+// typeAnnounce is the type of an [Announcement].
+const typeAnnounce = "announce"
+
+// probe asks servers to announce themselves right away.
+var probe = protocol.Encode(protocol.Envelope{Type: protocol.TypeDiscover})
+
+// Endpoint is a transport a server accepts clients on.
+type Endpoint struct {
+	Transport string `json:"transport"` // "tcp", "udp", "ws" or "irc"
+	Port      int    `json:"port"`
+	TLS       bool   `json:"tls,omitempty"`
+}
+
+// Announcement describes a server.
+type Announcement struct {
+	Type      string     `json:"type"` // always "announce"
+	Name      string     `json:"name"`
+	Endpoints []Endpoint `json:"endpoints"`
+	Rooms     int        `json:"rooms"`
+	Clients   int        `json:"clients"`
+}
+
+// Endpoint returns the server's endpoint for a transport.
+func (a Announcement) Endpoint(transport string) (Endpoint, bool) {
+	for _, e := range a.Endpoints {
+		if e.Transport == transport {
+			return e, true
+		}
+	}
+	return Endpoint{}, false
+}
+
+// Announcer announces a server on the multicast group and answers probes.
+type Announcer struct {
+	Name      string
+	Endpoints []Endpoint
+	Interval  time.Duration // DefaultInterval if zero
+
+	hub *chat.Hub
+
+	mu      sync.Mutex
+	current []byte // latest announcement, encoded
+}
+
+// NewAnnouncer returns an announcer for a server and its hub, which provides
+// the room and client counts.
+func NewAnnouncer(name string, endpoints []Endpoint, hub *chat.Hub) *Announcer {
+	return &Announcer{Name: name, Endpoints: endpoints, hub: hub}
+}
+
+// refresh encodes an announcement with the hub's current counts.
+func (a *Announcer) refresh() []byte {
+	data, _ := json.Marshal(Announcement{
+		Type:      typeAnnounce,
+		Name:      a.Name,
+		Endpoints: a.Endpoints,
+		Rooms:     len(a.hub.Rooms()),
+		Clients:   len(a.hub.Sessions()),
+	})
+	data = append(data, '\n')
+
+	a.mu.Lock()
+	a.current = data
+	a.mu.Unlock()
+	return data
+}
+
+// Reply returns the latest announcement, for answering a probe, or nil before
+// [Announcer.Run] made the first. It does not wait for the hub, so it may be
+// called from a transport's read loop.
+func (a *Announcer) Reply() []byte {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	return a.current
+}
+
+// Run announces the server on the multicast group until it fails, answering
+// probes sent to the group in between. It only returns on error.
+func (a *Announcer) Run() error {
+	group, err := net.ResolveUDPAddr("udp4", Group)
+	if err != nil {
+		return err
+	}
+	conn, err := net.ListenUDP("udp4", nil)
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+
+	// probes may fail to arrive when no interface supports multicast, but the
+	// periodic announcements are still worth sending
+	if probes, err := net.ListenMulticastUDP("udp4", nil, group); err != nil {
+		slog.Warn("not answering discovery probes", "group", Group, "err", err)
+	} else {
+		defer probes.Close()
+		go a.answer(probes, conn)
+	}
+
+	interval := a.Interval
+	if interval <= 0 {
+		interval = DefaultInterval
+	}
+	slog.Info("announcing server", "group", Group, "name", a.Name, "interval", interval)
+
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		if _, err := conn.WriteToUDP(a.refresh(), group); err != nil {
+			return err
+		}
+		<-ticker.C
+	}
+}
+
+// answer replies to the probes received on the group from the local network,
+// from conn so the reply comes from a regular unicast address.
+func (a *Announcer) answer(probes, conn *net.UDPConn) {
+	buffer := make([]byte, 1024)
+	for {
+		n, addr, err := probes.ReadFromUDP(buffer)
+		if err != nil {
+			return
+		}
+		if Local(addr.IP) && protocol.Decode(buffer[:n]).Type == protocol.TypeDiscover {
+			conn.WriteToUDP(a.Reply(), addr)
+		}
+	}
+}
+
+// Local reports whether a probe from ip comes from the local network, i.e. a
+// loopback, link-local or private address. Servers only answer those, so one
+// reachable from the internet does not describe itself to strangers, nor send
+// its announcement to whoever a forged probe names.
+func Local(ip net.IP) bool {
+	return ip.IsLoopback() || ip.IsLinkLocalUnicast() || ip.IsPrivate()
+}
+
+// Server is a server found on the network.
+type Server struct {
+	Host string // IP address the announcement came from
+	Announcement
+}
+
+// Addr returns the host:port address of the server's endpoint for a transport.
+func (s Server) Addr(transport string) (string, bool) {
+	e, ok := s.Endpoint(transport)
+	if !ok {
+		return "", false
+	}
+	return net.JoinHostPort(s.Host, strconv.Itoa(e.Port)), true
+}
+
+// Discover collects the servers that announce themselves within timeout. It
+// probes the multicast group so servers answer right away, and also broadcasts
+// the probe to each of udpPorts, which UDP servers answer on their chat socket
+// where multicast does not get through.
+func Discover(timeout time.Duration, udpPorts ...int) ([]Server, error) {
+	group, err := net.ResolveUDPAddr("udp4", Group)
+	if err != nil {
+		return nil, err
+	}
+
+	// replies to probes arrive on the probing socket, announcements on the group
+	conn, err := net.ListenUDP("udp4", nil)
+	if err != nil {
+		return nil, err
+	}
+	defer conn.Close()
+	sockets := []*net.UDPConn{conn}
+	if listener, err := net.ListenMulticastUDP("udp4", nil, group); err == nil {
+		defer listener.Close()
+		sockets = append(sockets, listener)
+	}
+
+	conn.WriteToUDP(probe, group)
+	for _, port := range udpPorts {
+		conn.WriteToUDP(probe, &net.UDPAddr{IP: net.IPv4bcast, Port: port})
+	}
+
+	var (
+		mu      sync.Mutex
+		servers []Server
+		wg      sync.WaitGroup
+	)
+	deadline := time.Now().Add(timeout)
+	for _, socket := range sockets {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			socket.SetReadDeadline(deadline)
+			buffer := make([]byte, 64*1024)
+			for {
+				n, addr, err := socket.ReadFromUDP(buffer)
+				if err != nil {
+					return
+				}
+				var a Announcement
+				if json.Unmarshal(buffer[:n], &a) != nil || a.Type != typeAnnounce {
+					continue
+				}
+				mu.Lock()
+				servers = add(servers, Server{Host: addr.IP.String(), Announcement: a})
+				mu.Unlock()
+			}
+		}()
+	}
+	wg.Wait()
+	return servers, nil
+}
+
+// add adds a server to the list, replacing an earlier announcement of the same
+// server. Servers on the same host are told apart by their endpoints, since a
+// TCP and a UDP server on one machine usually share its name.
+func add(servers []Server, s Server) []Server {
+	for i, other := range servers {
+		if other.Host == s.Host && slices.Equal(other.Endpoints, s.Endpoints) {
+			servers[i] = s
+			return servers
+		}
+	}
+	return append(servers, s)
+}
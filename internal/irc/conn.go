@@ -0,0 +1,196 @@
+package irc
+
+import (
+	"fmt"
+	"net"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/jennxsierra/dualnet-chat/internal/chat"
+	"github.com/jennxsierra/dualnet-chat/internal/metrics"
+	"github.com/jennxsierra/dualnet-chat/internal/protocol"
+)
+
+// outboxSize is how many lines may queue up for a client before it is
+// considered too slow and dropped.
+const outboxSize = 512
+
+// writeTimeout bounds a single write to a client.
+const writeTimeout = 10 * time.Second
+
+// conn adapts an IRC connection to [chat.Conn], translating envelopes from the
+// hub into IRC lines. Unlike the other transports, replies to queries such as
+// NAMES are also written from the connection's reader, so the outbox is
+// guarded by a mutex.
+type conn struct {
+	netConn net.Conn
+	hub     *chat.Hub
+	nick    string // set once, before the client registers with the hub
+
+	mu     sync.Mutex
+	outbox chan []byte
+	closed bool
+}
+
+// newConn wraps an IRC connection and starts its writer.
+func newConn(netConn net.Conn, hub *chat.Hub) *conn {
+	c := &conn{netConn: netConn, hub: hub, outbox: make(chan []byte, outboxSize)}
+	go c.writeLoop()
+	return c
+}
+
+// writeLoop writes queued lines until the outbox is closed, then closes the
+// connection so its reader stops as well.
+func (c *conn) writeLoop() {
+	for data := range c.outbox {
+		c.netConn.SetWriteDeadline(time.Now().Add(writeTimeout))
+		n, err := c.netConn.Write(data)
+		metrics.BytesSent.Add("irc", uint64(n))
+		if err != nil {
+			break
+		}
+	}
+	c.netConn.Close()
+
+	// drain whatever is left so writes never block
+	for range c.outbox {
+	}
+}
+
+// write queues lines for the client. A client whose outbox is full is
+// disconnected.
+func (c *conn) write(lines ...string) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	for _, line := range lines {
+		if c.closed {
+			return
+		}
+		select {
+		case c.outbox <- []byte(line + "\r\n"):
+		default:
+			c.closeLocked()
+		}
+	}
+}
+
+// reply queues a numeric reply to the client.
+func (c *conn) reply(numeric string, params ...string) {
+	c.write(format(serverName, numeric, append([]string{c.target()}, params...)...))
+}
+
+// notice queues a server notice to the client.
+func (c *conn) notice(text string) {
+	for _, line := range lines(text) {
+		c.write(format(serverName, "NOTICE", c.target(), line))
+	}
+}
+
+// target is who replies are addressed to: the nickname, or "*" before the
+// client has picked one.
+func (c *conn) target() string {
+	if c.nick == "" {
+		return "*"
+	}
+	return c.nick
+}
+
+// Send translates an envelope from the hub into IRC lines.
+func (c *conn) Send(e protocol.Envelope) {
+	switch e.Type {
+	case protocol.TypeWelcome:
+		c.reply("001", fmt.Sprintf("Welcome to the dualnet-chat IRC gateway, %s", c.nick))
+		c.reply("002", "Your host is "+serverName)
+		c.reply("004", serverName, "dualnet-chat", "o", "o")
+		c.reply("005", "CHANTYPES=#", "NETWORK=dualnet-chat", "CASEMAPPING=ascii", "are supported by this server")
+		// the hub sends its MOTD as a notice of its own after the welcome
+		c.reply("422", "MOTD File is missing")
+		for _, room := range e.Rooms {
+			c.joined(room)
+		}
+
+	case protocol.TypeMessage:
+		target := channel(e.Room)
+		if e.To != "" {
+			target = nick(e.To)
+		}
+		for _, line := range lines(e.Text) {
+			c.write(format(prefix(e.From), "PRIVMSG", target, line))
+		}
+
+	case protocol.TypeJoin:
+		if e.From == c.nick {
+			c.joined(e.Room)
+			return
+		}
+		c.write(format(prefix(e.From), "JOIN", channel(e.Room)))
+
+	case protocol.TypeLeave:
+		if e.Text != "" {
+			c.write(format(prefix(e.From), "PART", channel(e.Room), e.Text))
+		} else {
+			c.write(format(prefix(e.From), "PART", channel(e.Room)))
+		}
+
+	case protocol.TypePresence:
+		c.write(format(serverName, "NOTICE", channel(e.Room), fmt.Sprintf("%s is %s", nick(e.From), e.Text)))
+
+	case protocol.TypeNotice, protocol.TypeError:
+		if e.Room != "" {
+			c.write(format(serverName, "NOTICE", channel(e.Room), e.Text))
+			return
+		}
+		c.notice(e.Text)
+
+	case protocol.TypeBye:
+		c.write(format("", "ERROR", "Closing link: "+strings.TrimSpace(e.Text)))
+	}
+}
+
+// joined tells the client it is in a room and who else is there. The member
+// list is fetched from the hub on another goroutine, since Send runs on the
+// hub's.
+func (c *conn) joined(room string) {
+	c.write(format(prefix(c.nick), "JOIN", channel(room)))
+	go c.names(room)
+}
+
+// names replies with the members of a room (RPL_NAMREPLY, RPL_ENDOFNAMES).
+func (c *conn) names(room string) {
+	for _, r := range c.hub.Rooms() {
+		if r.Name != room {
+			continue
+		}
+		members := make([]string, len(r.Members))
+		for i, m := range r.Members {
+			members[i] = nick(m)
+		}
+		c.reply("353", "=", channel(room), strings.Join(members, " "))
+	}
+	c.reply("366", channel(room), "End of /NAMES list.")
+}
+
+// Close flushes the queued lines and closes the connection.
+func (c *conn) Close() {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.closeLocked()
+}
+
+func (c *conn) closeLocked() {
+	if !c.closed {
+		c.closed = true
+		close(c.outbox)
+	}
+}
+
+// Transport identifies the connection as IRC.
+func (c *conn) Transport() string {
+	return "irc"
+}
+
+// Addr returns the client's address.
+func (c *conn) Addr() string {
+	return c.netConn.RemoteAddr().String()
+}
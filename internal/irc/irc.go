@@ -0,0 +1,281 @@
+// Package irc is the servers' IRC gateway. It implements the subset of the
+// client protocol that regular IRC clients need to chat (NICK, USER, JOIN,
+// PART, PRIVMSG, NOTICE, PING, QUIT, NAMES and WHO), mapping channels onto the
+// hub's rooms and private messages onto its direct messages, so IRC users
+// share the conversation with every other client.
+package irc
+
+import (
+	"bufio"
+	"errors"
+	"io"
+	"log/slog"
+	"net"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/jennxsierra/dualnet-chat/internal/chat"
+	"github.com/jennxsierra/dualnet-chat/internal/metrics"
+	"github.com/jennxsierra/dualnet-chat/internal/protocol"
+)
+
+// serverName is the source of the gateway's own replies.
+const serverName = "dualnet-chat"
+
+// maxLineSize bounds a line from a client. IRC allows 512 bytes, but message
+// tags and long chat messages from lenient clients may be longer.
+const maxLineSize = 16 * 1024
+
+// keepAlive is the TCP keepalive period of client connections.
+const keepAlive = 30 * time.Second
+
+// ListenAndServe accepts IRC clients on addr and connects them to the hub. It
+// only returns on error.
+func ListenAndServe(addr string, hub *chat.Hub) error {
+	listener, err := net.Listen("tcp", addr)
+	if err != nil {
+		return err
+	}
+	slog.Info("irc gateway listening", "addr", listener.Addr().String())
+	return Serve(listener, hub)
+}
+
+// Serve accepts IRC clients on listener and connects them to the hub. It only
+// returns on error.
+func Serve(listener net.Listener, hub *chat.Hub) error {
+	for {
+		netConn, err := listener.Accept()
+		if err != nil {
+			return err
+		}
+		go serve(hub, netConn)
+	}
+}
+
+// serve reads lines from an IRC client until it disconnects.
+func serve(hub *chat.Hub, netConn net.Conn) {
+	if tcpConn, ok := netConn.(*net.TCPConn); ok {
+		tcpConn.SetKeepAlive(true)
+		tcpConn.SetKeepAlivePeriod(keepAlive)
+	}
+
+	c := newConn(netConn, hub)
+	client := &client{conn: c, hub: hub}
+
+	scanner := bufio.NewScanner(countingReader{netConn})
+	scanner.Buffer(make([]byte, 0, 4096), maxLineSize)
+	for scanner.Scan() {
+		m, ok := parse(scanner.Text())
+		if !ok {
+			continue
+		}
+		if !client.handle(m) {
+			break
+		}
+	}
+	if err := scanner.Err(); err != nil && !errors.Is(err, net.ErrClosed) && err != io.EOF {
+		slog.Debug("reading irc line", "addr", c.Addr(), "err", err)
+	}
+
+	if client.registered {
+		// the hub removes the client and closes the connection, unless it already
+		// did so (e.g. the client quit)
+		hub.Disconnect(c)
+	} else {
+		c.Close() // the hub never saw this connection, so it is safe to close here
+	}
+}
+
+// client tracks an IRC client's registration and handles its commands. It is
+// only used by the connection's reader.
+type client struct {
+	conn       *conn
+	hub        *chat.Hub
+	user       bool // USER was sent
+	registered bool // the hub knows about the client
+}
+
+// handle runs a single command. It returns false once the client quits.
+func (c *client) handle(m message) bool {
+	switch m.Command {
+	case "CAP":
+		// no capabilities are supported, but answering lets modern clients carry on
+		if strings.EqualFold(m.param(0), "LS") || strings.EqualFold(m.param(0), "LIST") {
+			c.conn.write(format(serverName, "CAP", c.conn.target(), strings.ToUpper(m.param(0)), ""))
+		}
+
+	case "PASS":
+
+	case "NICK":
+		switch {
+		case c.registered:
+			c.conn.notice("Changing your nickname is not supported, reconnect with the new one.")
+		case m.param(0) == "":
+			c.conn.reply("431", "No nickname given")
+		case nick(m.param(0)) != m.param(0):
+			c.conn.reply("432", m.param(0), "Erroneous nickname")
+		default:
+			c.conn.nick = m.param(0)
+			c.register()
+		}
+
+	case "USER":
+		c.user = true
+		c.register()
+
+	case "PING":
+		c.conn.write(format(serverName, "PONG", serverName, m.param(0)))
+
+	case "PONG":
+
+	case "QUIT":
+		c.conn.write(format("", "ERROR", "Closing link: quit"))
+		if c.registered {
+			c.hub.Receive(c.conn, protocol.Envelope{Type: protocol.TypeBye})
+		}
+		return false
+
+	default:
+		if !c.registered {
+			c.conn.reply("451", "You have not registered")
+			return true
+		}
+		c.handleRegistered(m)
+	}
+	return true
+}
+
+// register registers the client with the hub once it has sent both NICK and
+// USER.
+func (c *client) register() {
+	if c.registered || !c.user || c.conn.nick == "" {
+		return
+	}
+	c.registered = true
+	c.hub.Receive(c.conn, protocol.Envelope{Type: protocol.TypeRegister, From: c.conn.nick})
+}
+
+// handleRegistered runs the commands that need a registered client.
+func (c *client) handleRegistered(m message) {
+	switch m.Command {
+	case "JOIN":
+		for _, ch := range strings.Split(m.param(0), ",") {
+			if room, ok := roomOf(ch); ok {
+				c.command("/join " + room)
+			} else if ch != "" {
+				c.conn.reply("403", ch, "No such channel")
+			}
+		}
+
+	case "PART":
+		for _, ch := range strings.Split(m.param(0), ",") {
+			if room, ok := roomOf(ch); ok {
+				c.command("/part " + room)
+			}
+		}
+
+	case "PRIVMSG", "NOTICE":
+		target, text := m.param(0), m.param(1)
+		if text == "" {
+			if m.Command == "PRIVMSG" {
+				c.conn.reply("412", "No text to send")
+			}
+			return
+		}
+		room, isRoom := roomOf(target)
+		if !isRoom {
+			target = c.sessionName(target)
+		}
+		for _, line := range lines(text) {
+			if isRoom {
+				c.hub.Receive(c.conn, protocol.Envelope{Type: protocol.TypeMessage, Room: room, Text: line})
+			} else {
+				c.command("/msg " + target + " " + line)
+			}
+		}
+
+	case "NAMES":
+		for _, ch := range strings.Split(m.param(0), ",") {
+			if room, ok := roomOf(ch); ok {
+				c.conn.names(room)
+			}
+		}
+
+	case "WHO":
+		c.who(m.param(0))
+
+	case "MODE":
+		// modes are not supported; report none so clients stop asking
+		if room, ok := roomOf(m.param(0)); ok {
+			c.conn.reply("324", channel(room), "+")
+		} else if m.param(0) == c.conn.nick {
+			c.conn.reply("221", "+")
+		}
+
+	default:
+		c.conn.reply("421", m.Command, "Unknown command")
+	}
+}
+
+// command sends a chat command, such as "/join general", to the hub.
+func (c *client) command(text string) {
+	c.hub.Receive(c.conn, protocol.Envelope{Type: protocol.TypeMessage, Text: text})
+}
+
+// sessionName returns the chat name of the client known by the given
+// nickname, which differs from it when the name has characters nicknames
+// cannot, e.g. "alice@192.168.1.5:51756" for "alice_192.168.1.5:51756".
+func (c *client) sessionName(nickname string) string {
+	for _, s := range c.hub.Sessions() {
+		if nick(s.Name) == nickname {
+			return s.Name
+		}
+	}
+	return nickname
+}
+
+// who replies with the members of a channel, or a single client by nickname
+// (RPL_WHOREPLY, RPL_ENDOFWHO).
+func (c *client) who(mask string) {
+	room, isRoom := roomOf(mask)
+	for _, s := range c.hub.Sessions() {
+		switch {
+		case isRoom && !slices.Contains(s.Rooms, room):
+			continue
+		case !isRoom && nick(s.Name) != mask:
+			continue
+		}
+
+		ch := "*"
+		if isRoom {
+			ch = channel(room)
+		}
+		status := "H"
+		if s.Away {
+			status = "G"
+		}
+		n := nick(s.Name)
+		c.conn.reply("352", ch, n, s.Transport, serverName, n, status, "0 "+s.Name)
+	}
+	c.conn.reply("315", mask, "End of /WHO list.")
+}
+
+// roomOf returns the chat room of an IRC channel such as "#general".
+func roomOf(ch string) (string, bool) {
+	if !strings.HasPrefix(ch, "#") {
+		return "", false
+	}
+	return chat.NormalizeRoom(ch)
+}
+
+// countingReader counts the bytes read from a client.
+type countingReader struct {
+	io.Reader
+}
+
+func (r countingReader) Read(p []byte) (int, error) {
+	n, err := r.Reader.Read(p)
+	metrics.BytesReceived.Add("irc", uint64(n))
+	return n, err
+}
@@ -0,0 +1,108 @@
+package irc
+
+import (
+	"strings"
+)
+
+// message is a single IRC protocol line (RFC 1459, section 2.3.1).
+type message struct {
+	Prefix  string
+	Command string // upper case, e.g. "PRIVMSG" or "001"
+	Params  []string
+}
+
+// parse splits a line into its prefix, command and parameters. Message tags
+// (IRCv3) are skipped. It returns false for empty lines.
+func parse(line string) (message, bool) {
+	line = strings.TrimRight(line, "\r\n")
+	if strings.HasPrefix(line, "@") {
+		_, line, _ = strings.Cut(line, " ")
+	}
+
+	var m message
+	line = strings.TrimLeft(line, " ")
+	if strings.HasPrefix(line, ":") {
+		m.Prefix, line, _ = strings.Cut(line[1:], " ")
+	}
+
+	for line = strings.TrimLeft(line, " "); line != ""; line = strings.TrimLeft(line, " ") {
+		if m.Command != "" && strings.HasPrefix(line, ":") {
+			m.Params = append(m.Params, line[1:]) // the trailing parameter may contain spaces
+			break
+		}
+		var field string
+		field, line, _ = strings.Cut(line, " ")
+		if m.Command == "" {
+			m.Command = strings.ToUpper(field)
+		} else {
+			m.Params = append(m.Params, field)
+		}
+	}
+	return m, m.Command != ""
+}
+
+// param returns the i-th parameter, or "" if there are fewer.
+func (m message) param(i int) string {
+	if i < len(m.Params) {
+		return m.Params[i]
+	}
+	return ""
+}
+
+// format builds a line, without the line ending. The last parameter is always
+// sent as a trailing parameter, so it may contain spaces. Line breaks and NUL
+// bytes in the parameters, which would let text from other transports start a
+// line of its own, are dropped; use [lines] to keep the lines apart.
+func format(prefix, command string, params ...string) string {
+	var b strings.Builder
+	if prefix != "" {
+		b.WriteString(":" + prefix + " ")
+	}
+	b.WriteString(command)
+	for i, p := range params {
+		p = lineBreaks.Replace(p)
+		if i == len(params)-1 {
+			b.WriteString(" :" + p)
+		} else {
+			b.WriteString(" " + p)
+		}
+	}
+	return b.String()
+}
+
+// lineBreaks replaces the characters that may not appear within a line.
+var lineBreaks = strings.NewReplacer("\r\n", " ", "\r", " ", "\n", " ", "\x00", "")
+
+// lines splits text into the lines to send one by one, at any of "\r\n", "\r"
+// and "\n".
+func lines(text string) []string {
+	text = strings.ReplaceAll(text, "\r\n", "\n")
+	return strings.Split(strings.ReplaceAll(text, "\r", "\n"), "\n")
+}
+
+// nick turns a chat name into a valid IRC nickname; names from the other
+// transports may contain spaces and other characters IRC reserves.
+func nick(name string) string {
+	nick := strings.Map(func(r rune) rune {
+		switch r {
+		case ' ', ',', '!', '@', '*', '?', '\r', '\n', '\x00':
+			return '_'
+		}
+		return r
+	}, name)
+	if strings.HasPrefix(nick, ":") || strings.HasPrefix(nick, "#") {
+		nick = "_" + nick[1:]
+	}
+	return nick
+}
+
+// prefix is the source of a line sent on behalf of a chat user.
+func prefix(name string) string {
+	n := nick(name)
+	return n + "!" + n + "@" + serverName
+}
+
+// channel is the IRC channel of a chat room.
+func channel(room string) string {
+	return "#" + room
+}
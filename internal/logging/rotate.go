@@ -0,0 +1,96 @@
+package logging
+
+import (
+	"fmt"
+	"os"
+	"sync"
+)
+
+// rotatingFile appends to a log file and, once it grows past maxSize, renames
+// it to file.1 (shifting older backups to file.2 and so on) and starts over.
+type rotatingFile struct {
+	mu         sync.Mutex
+	path       string
+	maxSize    int64 // 0 never rotates
+	maxBackups int
+	file       *os.File
+	size       int64
+}
+
+// openRotating opens path for appending.
+func openRotating(path string, maxSize int64, maxBackups int) (*rotatingFile, error) {
+	r := &rotatingFile{path: path, maxSize: maxSize, maxBackups: maxBackups}
+	if err := r.open(); err != nil {
+		return nil, err
+	}
+	return r, nil
+}
+
+// open opens the log file and records its current size.
+func (r *rotatingFile) open() error {
+	file, err := os.OpenFile(r.path, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0644)
+	if err != nil {
+		return err
+	}
+	info, err := file.Stat()
+	if err != nil {
+		file.Close()
+		return err
+	}
+	r.file, r.size = file, info.Size()
+	return nil
+}
+
+// Write appends p, rotating the file first if p would make it too large.
+func (r *rotatingFile) Write(p []byte) (int, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if r.file == nil {
+		return 0, os.ErrClosed
+	}
+	if r.maxSize > 0 && r.size > 0 && r.size+int64(len(p)) > r.maxSize {
+		if err := r.rotate(); err != nil {
+			return 0, err
+		}
+	}
+
+	n, err := r.file.Write(p)
+	r.size += int64(n)
+	return n, err
+}
+
+// rotate shifts the backups, drops the oldest one and reopens an empty file.
+func (r *rotatingFile) rotate() error {
+	r.file.Close()
+
+	os.Remove(r.backup(r.maxBackups))
+	for i := r.maxBackups - 1; i >= 1; i-- {
+		os.Rename(r.backup(i), r.backup(i+1))
+	}
+	if r.maxBackups > 0 {
+		os.Rename(r.path, r.backup(1))
+	} else {
+		os.Remove(r.path)
+	}
+
+	return r.open()
+}
+
+// backup returns the name of the i-th newest backup.
+func (r *rotatingFile) backup(i int) string {
+	return fmt.Sprintf("%s.%d", r.path, i)
+}
+
+// Close closes the log file.
+func (r *rotatingFile) Close() error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if r.file == nil {
+		return nil
+	}
+	err := r.file.Close()
+	r.file = nil
+	return err
+}
@@ -0,0 +1,19 @@
+package metrics
+
+// The metrics of the chat servers, labeled by transport ("tcp" or "udp") where
+// it applies.
+var (
+	ClientsConnected = NewGaugeVec("chat_clients_connected", "Clients currently connected.", "transport")
+
+	MessagesReceived = NewCounterVec("chat_messages_received_total", "Chat messages and commands received from clients.", "transport")
+	MessagesSent     = NewCounterVec("chat_messages_sent_total", "Envelopes broadcast to clients.", "transport")
+	BytesReceived    = NewCounterVec("chat_bytes_received_total", "Bytes read from clients.", "transport")
+	BytesSent        = NewCounterVec("chat_bytes_sent_total", "Bytes written to clients.", "transport")
+	RateLimited      = NewCounterVec("chat_rate_limited_total", "Messages rejected because the client sent too fast.", "transport")
+
+	BroadcastDuration = NewHistogram("chat_broadcast_duration_seconds", "Time taken to fan a broadcast out to every recipient.",
+		[]float64{0.00001, 0.000025, 0.00005, 0.0001, 0.00025, 0.0005, 0.001, 0.0025, 0.005, 0.01, 0.025, 0.05, 0.1})
+
+	HeartbeatTimeouts = NewCounter("chat_udp_heartbeat_timeouts_total", "UDP clients dropped because they stopped sending heartbeats.")
+	DroppedDatagrams  = NewCounter("chat_udp_dropped_datagrams_total", "UDP datagrams that could not be read, sent or matched to a client.")
+)
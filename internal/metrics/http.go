@@ -0,0 +1,28 @@
+package metrics
+
+import (
+	"net/http"
+	"time"
+)
+
+// Handler serves every registered metric in the Prometheus text format.
+func Handler() http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "text/plain; version=0.0.4; charset=utf-8")
+		WriteTo(w)
+	})
+}
+
+// ListenAndServe serves the metrics at /metrics on addr. It only returns on
+// error.
+func ListenAndServe(addr string) error {
+	mux := http.NewServeMux()
+	mux.Handle("/metrics", Handler())
+
+	server := &http.Server{
+		Addr:              addr,
+		Handler:           mux,
+		ReadHeaderTimeout: 5 * time.Second,
+	}
+	return server.ListenAndServe()
+}
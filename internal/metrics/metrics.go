@@ -0,0 +1,238 @@
+// Package metrics is a small, dependency-free implementation of the metric
+// types the servers need, exposed in the Prometheus text format.
+package metrics
+
+import (
+	"fmt"
+	"io"
+	"maps"
+	"math"
+	"slices"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+)
+
+// collector is a metric that can write itself in the text format.
+type collector interface {
+	write(w io.Writer)
+}
+
+var (
+	registryMu sync.Mutex
+	registry   []collector
+)
+
+// register adds a metric to the ones written by [WriteTo].
+func register(c collector) {
+	registryMu.Lock()
+	defer registryMu.Unlock()
+	registry = append(registry, c)
+}
+
+// Escaping in the text format: HELP text escapes backslashes and line breaks,
+// and label values double quotes as well.
+var (
+	helpEscaper  = strings.NewReplacer(`\`, `\\`, "\n", `\n`)
+	labelEscaper = strings.NewReplacer(`\`, `\\`, "\n", `\n`, `"`, `\"`)
+)
+
+// writeHeader writes the HELP and TYPE lines of a metric.
+func writeHeader(w io.Writer, name, help, kind string) {
+	fmt.Fprintf(w, "# HELP %s %s\n# TYPE %s %s\n", name, helpEscaper.Replace(help), name, kind)
+}
+
+// writeLabeled writes a sample of a metric with one label.
+func writeLabeled(w io.Writer, name, label, value string, sample any) {
+	fmt.Fprintf(w, "%s{%s=\"%s\"} %v\n", name, label, labelEscaper.Replace(value), sample)
+}
+
+// formatFloat formats a sample value the way Prometheus expects.
+func formatFloat(v float64) string {
+	if math.IsInf(v, +1) {
+		return "+Inf"
+	}
+	return strconv.FormatFloat(v, 'g', -1, 64)
+}
+
+// Counter is a value that only goes up.
+type Counter struct {
+	name, help string
+	value      atomic.Uint64
+}
+
+// NewCounter creates and registers a [Counter].
+func NewCounter(name, help string) *Counter {
+	c := &Counter{name: name, help: help}
+	register(c)
+	return c
+}
+
+// Inc adds one to the counter.
+func (c *Counter) Inc() {
+	c.value.Add(1)
+}
+
+// Value returns the current count.
+func (c *Counter) Value() uint64 {
+	return c.value.Load()
+}
+
+func (c *Counter) write(w io.Writer) {
+	writeHeader(w, c.name, c.help, "counter")
+	fmt.Fprintf(w, "%s %d\n", c.name, c.value.Load())
+}
+
+// CounterVec is a family of counters told apart by the value of one label,
+// e.g. the transport.
+type CounterVec struct {
+	name, help, label string
+
+	mu     sync.Mutex
+	values map[string]*atomic.Uint64
+}
+
+// NewCounterVec creates and registers a [CounterVec].
+func NewCounterVec(name, help, label string) *CounterVec {
+	c := &CounterVec{name: name, help: help, label: label, values: make(map[string]*atomic.Uint64)}
+	register(c)
+	return c
+}
+
+// Inc adds one to the counter with the given label value.
+func (c *CounterVec) Inc(value string) {
+	c.Add(value, 1)
+}
+
+// Add adds n to the counter with the given label value.
+func (c *CounterVec) Add(value string, n uint64) {
+	c.mu.Lock()
+	v := c.values[value]
+	if v == nil {
+		v = new(atomic.Uint64)
+		c.values[value] = v
+	}
+	c.mu.Unlock()
+	v.Add(n)
+}
+
+// Value returns the counter with the given label value.
+func (c *CounterVec) Value(value string) uint64 {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if v := c.values[value]; v != nil {
+		return v.Load()
+	}
+	return 0
+}
+
+func (c *CounterVec) write(w io.Writer) {
+	writeHeader(w, c.name, c.help, "counter")
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	for _, value := range slices.Sorted(maps.Keys(c.values)) {
+		writeLabeled(w, c.name, c.label, value, c.values[value].Load())
+	}
+}
+
+// GaugeVec is a family of values that go up and down, told apart by the value
+// of one label.
+type GaugeVec struct {
+	name, help, label string
+
+	mu     sync.Mutex
+	values map[string]int64
+}
+
+// NewGaugeVec creates and registers a [GaugeVec].
+func NewGaugeVec(name, help, label string) *GaugeVec {
+	g := &GaugeVec{name: name, help: help, label: label, values: make(map[string]int64)}
+	register(g)
+	return g
+}
+
+// Add adds delta, which may be negative, to the gauge with the given label value.
+func (g *GaugeVec) Add(value string, delta int64) {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	g.values[value] += delta
+}
+
+// Value returns the gauge with the given label value.
+func (g *GaugeVec) Value(value string) int64 {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	return g.values[value]
+}
+
+func (g *GaugeVec) write(w io.Writer) {
+	writeHeader(w, g.name, g.help, "gauge")
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	for _, value := range slices.Sorted(maps.Keys(g.values)) {
+		writeLabeled(w, g.name, g.label, value, g.values[value])
+	}
+}
+
+// Histogram counts observations, such as durations in seconds, in buckets.
+type Histogram struct {
+	name, help string
+	buckets    []float64 // upper bounds, ascending
+
+	mu     sync.Mutex
+	counts []uint64 // per bucket, not cumulative
+	sum    float64
+	count  uint64
+}
+
+// NewHistogram creates and registers a [Histogram] with the given ascending
+// bucket upper bounds.
+func NewHistogram(name, help string, buckets []float64) *Histogram {
+	h := &Histogram{name: name, help: help, buckets: buckets, counts: make([]uint64, len(buckets))}
+	register(h)
+	return h
+}
+
+// Observe records one observation.
+func (h *Histogram) Observe(v float64) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	if i, _ := slices.BinarySearch(h.buckets, v); i < len(h.buckets) {
+		h.counts[i]++
+	}
+	h.sum += v
+	h.count++
+}
+
+// Count returns the number of observations.
+func (h *Histogram) Count() uint64 {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	return h.count
+}
+
+func (h *Histogram) write(w io.Writer) {
+	writeHeader(w, h.name, h.help, "histogram")
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	var cumulative uint64
+	for i, bound := range h.buckets {
+		cumulative += h.counts[i]
+		writeLabeled(w, h.name+"_bucket", "le", formatFloat(bound), cumulative)
+	}
+	writeLabeled(w, h.name+"_bucket", "le", formatFloat(math.Inf(+1)), h.count)
+	fmt.Fprintf(w, "%s_sum %s\n", h.name, formatFloat(h.sum))
+	fmt.Fprintf(w, "%s_count %d\n", h.name, h.count)
+}
+
+// WriteTo writes every registered metric in the Prometheus text format.
+func WriteTo(w io.Writer) {
+	registryMu.Lock()
+	collectors := slices.Clone(registry)
+	registryMu.Unlock()
+
+	for _, c := range collectors {
+		c.write(w)
+	}
+}
@@ -1,44 +1,89 @@
 package netutils
 
 import (
+	"fmt"
+	"math/rand/v2"
 	"net"
 	"strconv"
+	"strings"
+	"time"
 )
 
-// GetIPv4Addr returns a IPv4 net.Addr for the local machine based on the network ("tcp", "udp") and port.
-func GetIPv4Addr(network string, port int) net.Addr {
-	addrs, err := net.InterfaceAddrs()
+// InterfaceAddr is an address on one of the machine's network interfaces.
+type InterfaceAddr struct {
+	Interface string // e.g. "eth0", empty if no interface has the address
+	Addr      net.Addr
+}
+
+// ListenAddrs returns the addresses a socket bound to local, such as a
+// listener's, can be reached at on the network ("tcp", "udp"), for showing in a
+// banner. A socket bound to a single address is only reachable there. One bound
+// to "0.0.0.0" is reachable at every IPv4 address of every interface that is
+// up, and one bound to "::" at every IPv4 and IPv6 address, since such sockets
+// are dual-stack. Link-local IPv6 addresses carry their interface as the zone
+// (e.g. "[fe80::1%eth0]:4000").
+func ListenAddrs(network string, local net.Addr) []InterfaceAddr {
+	ip, port := splitAddr(local)
+	ifaces, err := net.Interfaces()
 	if err != nil {
-		return fallbackAddr(network, port)
+		return []InterfaceAddr{{Addr: local}}
 	}
 
-	for _, addr := range addrs {
-		// Check that the address is not a loopback
-		if ipNet, ok := addr.(*net.IPNet); ok && !ipNet.IP.IsLoopback() {
-			// Only use IPv4 addresses
-			if ip := ipNet.IP.To4(); ip != nil {
-				return makeAddr(network, ip, port)
+	var addrs []InterfaceAddr
+	for _, iface := range ifaces {
+		if iface.Flags&net.FlagUp == 0 {
+			continue
+		}
+		ifaceAddrs, err := iface.Addrs()
+		if err != nil {
+			continue
+		}
+		for _, addr := range ifaceAddrs {
+			ipNet, ok := addr.(*net.IPNet)
+			if !ok {
+				continue
 			}
+			switch {
+			case ip.Equal(net.IPv4zero) && ipNet.IP.To4() == nil:
+				continue
+			case !ip.IsUnspecified() && !ip.Equal(ipNet.IP):
+				continue
+			}
+			zone := ""
+			if ipNet.IP.To4() == nil && ipNet.IP.IsLinkLocalUnicast() {
+				zone = iface.Name
+			}
+			addrs = append(addrs, InterfaceAddr{Interface: iface.Name, Addr: makeAddr(network, ipNet.IP, zone, port)})
 		}
 	}
 
-	return fallbackAddr(network, port)
+	// e.g. an address that was removed from its interface since
+	if len(addrs) == 0 {
+		return []InterfaceAddr{{Addr: local}}
+	}
+	return addrs
 }
 
-func fallbackAddr(network string, port int) net.Addr {
-	ip := net.ParseIP("127.0.0.1")
-	return makeAddr(network, ip, port)
+// splitAddr returns the IP and port of a TCP or UDP address.
+func splitAddr(addr net.Addr) (net.IP, int) {
+	switch a := addr.(type) {
+	case *net.TCPAddr:
+		return a.IP, a.Port
+	case *net.UDPAddr:
+		return a.IP, a.Port
+	}
+	return nil, 0
 }
 
-func makeAddr(network string, ip net.IP, port int) net.Addr {
+func makeAddr(network string, ip net.IP, zone string, port int) net.Addr {
 	switch network {
 	case "tcp", "tcp4", "tcp6":
-		return &net.TCPAddr{IP: ip, Port: port}
+		return &net.TCPAddr{IP: ip, Port: port, Zone: zone}
 	case "udp", "udp4", "udp6":
-		return &net.UDPAddr{IP: ip, Port: port}
+		return &net.UDPAddr{IP: ip, Port: port, Zone: zone}
 	default:
 		// unknown network, fallback to TCPAddr
-		return &net.TCPAddr{IP: ip, Port: port}
+		return &net.TCPAddr{IP: ip, Port: port, Zone: zone}
 	}
 }
 
@@ -47,11 +92,46 @@ func IsValidPort(port int) bool {
 	return port >= 1 && port <= 65535
 }
 
-// IsValidTCPAddress checks if the given address is a valid IP:port format.
-func IsValidTCPAddress(addr string) bool {
-	// try to resolve the TCP address to validate it
-	_, err := net.ResolveTCPAddr("tcp", addr)
-	return err == nil
+// Address is a server address: a network as understood by [net.Dial] and the
+// address on that network.
+type Address struct {
+	Network string // "tcp" or "unix"
+	Address string // "host:port", or a socket path for "unix"
+}
+
+// ParseAddress parses a server address given on the command line. It accepts
+// "host:port", "tcp://host:port" and "unix:///path/to/socket" (or a relative
+// "unix://chat.sock"). IPv6 hosts are written in brackets, with an optional
+// zone for link-local addresses, e.g. "[fe80::1%eth0]:4000". TCP addresses are
+// resolved to check them.
+func ParseAddress(s string) (Address, error) {
+	scheme, rest, found := strings.Cut(s, "://")
+	if !found {
+		scheme, rest = "tcp", s
+	}
+
+	switch scheme {
+	case "tcp":
+		if _, err := net.ResolveTCPAddr("tcp", rest); err != nil {
+			return Address{}, fmt.Errorf("invalid address %q: %w", s, err)
+		}
+		return Address{Network: "tcp", Address: rest}, nil
+	case "unix":
+		if rest == "" {
+			return Address{}, fmt.Errorf("invalid address %q: missing socket path", s)
+		}
+		return Address{Network: "unix", Address: rest}, nil
+	default:
+		return Address{}, fmt.Errorf("invalid address %q: unknown scheme %q", s, scheme)
+	}
+}
+
+// String formats the address the way [ParseAddress] accepts it.
+func (a Address) String() string {
+	if a.Network == "unix" {
+		return "unix://" + a.Address
+	}
+	return a.Address
 }
 
 // GetPortFromAddress extracts the port number from an address string in the format "host:port".
@@ -69,3 +149,38 @@ func GetPortFromAddress(address string) (int, error) {
 
 	return port, nil
 }
+
+// Backoff produces exponentially growing delays with random jitter, used when
+// reconnecting to a server.
+type Backoff struct {
+	Min     time.Duration // first delay (default 500ms)
+	Max     time.Duration // upper bound for any delay (default 30s)
+	attempt int
+}
+
+// Next returns the delay to wait before the next attempt. Half of the delay is
+// fixed and the other half is random so that many clients do not reconnect in
+// lockstep after a server restart.
+func (b *Backoff) Next() time.Duration {
+	minDelay, maxDelay := b.Min, b.Max
+	if minDelay <= 0 {
+		minDelay = 500 * time.Millisecond
+	}
+	if maxDelay <= 0 {
+		maxDelay = 30 * time.Second
+	}
+
+	delay := minDelay << min(b.attempt, 16)
+	if delay <= 0 || delay > maxDelay {
+		delay = maxDelay
+	}
+	b.attempt++
+
+	half := delay / 2
+	return half + rand.N(half+1)
+}
+
+// Reset starts the delays over from [Backoff.Min].
+func (b *Backoff) Reset() {
+	b.attempt = 0
+}
@@ -0,0 +1,223 @@
+// Package protocol defines the envelope exchanged between the chat servers and
+// clients. Every envelope travels as a single line of JSON (or a single datagram
+// over UDP), and the servers still accept the plain text lines sent by the
+// original clients.
+package protocol
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"strings"
+	"time"
+)
+
+// Envelope types understood by the servers and clients.
+const (
+	TypeRegister     = "register"      // client introduces (or re-introduces) itself
+	TypeWelcome      = "welcome"       // server accepted a registration
+	TypeMessage      = "msg"           // chat message to a room
+	TypeJoin         = "join"          // someone joined a room
+	TypeLeave        = "leave"         // someone left a room
+	TypeMembers      = "members"       // who is in a room, sent to a client joining it
+	TypePresence     = "presence"      // someone went away or came back
+	TypeNotice       = "notice"        // informational line from the server
+	TypeError        = "error"         // request rejected by the server
+	TypeHeartbeat    = "heartbeat"     // keepalive from a client
+	TypeHeartbeatAck = "heartbeat_ack" // server reply to a heartbeat
+	TypeBye          = "bye"           // either side is ending the session on purpose
+	TypeDiscover     = "discover"      // client looking for servers on the local network
+
+	// file transfers between TCP clients, relayed by the server
+	TypeFileOffer  = "file-offer"  // sender offers a file to another client
+	TypeFileAccept = "file-accept" // recipient takes the offer, from an offset to resume at
+	TypeFileChunk  = "file-chunk"  // part of the file, from sender to recipient
+	TypeFileAck    = "file-ack"    // recipient saved the file up to an offset
+	TypeFileCancel = "file-cancel" // either side, or the server, ends the transfer
+)
+
+// Presence values carried in the text of a [TypePresence] envelope.
+const (
+	PresenceAway = "away"
+	PresenceBack = "back"
+)
+
+// DefaultRoom is the room every client joins when it does not ask for any.
+const DefaultRoom = "general"
+
+// MaxLineSize is the longest envelope a [Reader] will return. Longer lines are
+// truncated rather than treated as an error so a misbehaving peer cannot stall
+// the connection.
+const MaxLineSize = 64 * 1024
+
+// FileChunkSize is the most a [TypeFileChunk] envelope carries, which keeps
+// it well below [MaxLineSize] once encoded.
+const FileChunkSize = 16 * 1024
+
+// FileWindow is how many chunks a sender may have on their way before the
+// recipient acknowledges them, so a transfer never fills a connection that
+// chat messages share.
+const FileWindow = 8
+
+// Envelope is a single protocol message.
+type Envelope struct {
+	Type  string    `json:"type"`
+	ID    uint64    `json:"id,omitempty"`
+	Time  time.Time `json:"time,omitzero"`
+	From  string    `json:"from,omitempty"`
+	Room  string    `json:"room,omitempty"`
+	To    string    `json:"to,omitempty"` // recipient of a direct message, instead of a room
+	Text  string    `json:"text,omitempty"`
+	Rooms []string  `json:"rooms,omitempty"`
+	Since uint64    `json:"since,omitempty"`
+	Seq   uint64    `json:"seq,omitempty"` // heartbeat sequence number, echoed in the ack
+
+	// Session is issued by the server in its welcome and lets a UDP client keep
+	// its session when its source address changes.
+	Session string `json:"session,omitempty"`
+
+	// Addr is the client's address as the server sees it, sent in the welcome.
+	// It differs from the client's own when a NAT or proxy sits in between.
+	Addr string `json:"addr,omitempty"`
+
+	// Members lists who is in Room, in the server's reply to "/who" and in the
+	// [TypeMembers] envelope a client gets when it joins the room.
+	Members []string `json:"members,omitempty"`
+
+	// Commands lists the server's chat commands, in its reply to "/help".
+	Commands []string `json:"commands,omitempty"`
+
+	// File is the file a file-* envelope is about, and To its recipient in
+	// the offer.
+	File *File `json:"file,omitempty"`
+}
+
+// File describes a file transfer, or the part of it an envelope carries.
+type File struct {
+	ID     string `json:"id"`               // picked by the sender
+	Name   string `json:"name,omitempty"`   // base name, in the offer
+	Size   int64  `json:"size,omitempty"`   // in bytes, in the offer
+	SHA256 string `json:"sha256,omitempty"` // hex digest of the whole file, in the offer
+	Offset int64  `json:"offset,omitempty"` // where Data starts, where to resume, or how much was saved
+	Data   []byte `json:"data,omitempty"`   // a chunk of at most FileChunkSize bytes
+}
+
+// Encode serializes an envelope as a newline terminated line of JSON.
+func Encode(e Envelope) []byte {
+	data, err := json.Marshal(e)
+	if err != nil {
+		// an Envelope only holds strings, numbers, bytes and times
+		panic(fmt.Sprintf("protocol: encoding envelope: %v", err))
+	}
+	return append(data, '\n')
+}
+
+// Decode parses a single line into an envelope. Lines that are not a JSON
+// envelope are mapped onto the legacy text protocol: "REGISTER:<name>",
+// "HEARTBEAT", "BYE", and anything else is a chat message.
+func Decode(line []byte) Envelope {
+	line = bytes.TrimSpace(line)
+	if len(line) > 0 && line[0] == '{' {
+		var e Envelope
+		if err := json.Unmarshal(line, &e); err == nil && e.Type != "" {
+			return e
+		}
+	}
+
+	text := string(line)
+	switch {
+	case strings.HasPrefix(text, "REGISTER:"):
+		return Envelope{Type: TypeRegister, From: strings.TrimPrefix(text, "REGISTER:")}
+	case text == "HEARTBEAT":
+		return Envelope{Type: TypeHeartbeat}
+	case text == "BYE":
+		return Envelope{Type: TypeBye}
+	default:
+		return Envelope{Type: TypeMessage, Text: text}
+	}
+}
+
+// String renders an envelope the way it is shown in a terminal.
+func (e Envelope) String() string {
+	switch e.Type {
+	case TypeMessage:
+		if e.To != "" {
+			return fmt.Sprintf("[%s -> %s]: %s", e.From, e.To, e.Text)
+		}
+		return fmt.Sprintf("%s[%s]: %s", roomPrefix(e.Room), e.From, e.Text)
+	case TypeJoin:
+		return fmt.Sprintf("[+] %s joined %s", e.From, roomName(e.Room))
+	case TypePresence:
+		return fmt.Sprintf("[~] %s is %s", e.From, e.Text)
+	case TypeLeave:
+		if e.Text != "" {
+			return fmt.Sprintf("[-] %s left %s (%s)", e.From, roomName(e.Room), e.Text)
+		}
+		return fmt.Sprintf("[-] %s left %s", e.From, roomName(e.Room))
+	default:
+		return fmt.Sprintf("[server]: %s", e.Text)
+	}
+}
+
+// roomPrefix labels messages outside of the default room.
+func roomPrefix(room string) string {
+	if room == "" || room == DefaultRoom {
+		return ""
+	}
+	return "#" + room + " "
+}
+
+// roomName describes a room in join and leave lines.
+func roomName(room string) string {
+	if room == "" || room == DefaultRoom {
+		return "the chat"
+	}
+	return "#" + room
+}
+
+// Reader reads newline delimited envelopes from a stream.
+type Reader struct {
+	r *bufio.Reader
+}
+
+// NewReader creates a [Reader] on top of r.
+func NewReader(r io.Reader) *Reader {
+	return &Reader{r: bufio.NewReaderSize(r, 4096)}
+}
+
+// ReadLine returns the next line without its trailing newline. Lines longer
+// than [MaxLineSize] are truncated and the remainder is discarded.
+func (r *Reader) ReadLine() ([]byte, error) {
+	var line []byte
+	for {
+		chunk, isPrefix, err := r.r.ReadLine()
+		if err != nil {
+			if len(line) > 0 && err == io.EOF {
+				return line, nil
+			}
+			return nil, err
+		}
+		if room := MaxLineSize - len(line); room > 0 {
+			line = append(line, chunk[:min(len(chunk), room)]...)
+		}
+		if !isPrefix {
+			return line, nil
+		}
+	}
+}
+
+// Read returns the next envelope, skipping blank lines.
+func (r *Reader) Read() (Envelope, error) {
+	for {
+		line, err := r.ReadLine()
+		if err != nil {
+			return Envelope{}, err
+		}
+		if len(bytes.TrimSpace(line)) == 0 {
+			continue
+		}
+		return Decode(line), nil
+	}
+}
@@ -1,109 +1,497 @@
 package client
 
 import (
+	"crypto/tls"
 	"fmt"
 	"net"
+	"slices"
 	"strings"
+	"sync"
+	"time"
 
-	"github.com/chzyer/readline"
 	"github.com/fatih/color"
+	"github.com/jennxsierra/dualnet-chat/internal/commands"
 	"github.com/jennxsierra/dualnet-chat/internal/netutils"
+	"github.com/jennxsierra/dualnet-chat/internal/protocol"
+	"github.com/jennxsierra/dualnet-chat/internal/transfer"
+	"github.com/jennxsierra/dualnet-chat/internal/ui"
 )
 
 // Client stores the client connection and name.
 type Client struct {
 	Conn net.Conn
 	Name string
-	rl   *readline.Instance
-	done chan struct{}
+
+	// UI is how the client talks to the user, a readline prompt unless set
+	// before Start
+	UI ui.UI
+
+	// TimeFormat is the layout of the timestamp in front of every line, as in
+	// [time.Time.Format], or empty for none
+	TimeFormat string
+
+	// Keywords count as mentions of the user besides "@name", and Notification
+	// is how the user is told about mentions
+	Keywords     []string
+	Notification ui.Notification
+
+	// LogDir is where the messages of every room are logged, or empty for
+	// nowhere
+	LogDir string
+
+	// DownloadDir is where files other users send are saved, or empty for
+	// the working directory
+	DownloadDir string
+
+	local *commands.Local   // runs the commands typed for the client itself
+	files *transfer.Manager // sends and receives files
+
+	serverAddr netutils.Address
+	tlsConfig  *tls.Config   // encrypts the connection if set
+	done       chan struct{} // closed when the user quits
+	backoff    netutils.Backoff
+
+	// resume state, guarded by mu
+	mu        sync.Mutex
+	session   string   // session token issued by the server
+	lastID    uint64   // ID of the newest message received
+	rooms     []string // rooms joined, restored after a reconnect
+	room      string   // room typed messages are sent to
+	connected bool     // false while reconnecting
+	seenAs    string   // address the server last reported seeing us at
 }
 
-// NewClient creates a new client instance that connects to the server.
-func NewClient(serverAddr string, name string) (*Client, error) {
-	// establish the TCP connection
-	conn, err := net.Dial("tcp", serverAddr)
+// NewClient creates a new client instance that connects to the server over TCP
+// or a Unix socket, and over TLS if tlsConfig is not nil.
+func NewClient(serverAddr netutils.Address, name string, tlsConfig *tls.Config) (*Client, error) {
+	// establish the connection
+	conn, err := dial(serverAddr, tlsConfig)
 	if err != nil {
 		return nil, err
 	}
 
-	// get the connection's IPv4 address and port
-	clientAddr := netutils.GetIPv4Addr("tcp", conn.LocalAddr().(*net.TCPAddr).Port)
-	fullName := fmt.Sprintf("%s@%s", name, clientAddr) // e.g. AHARCH@192.168.18.4:51756
-
-	// create readline instance
-	rl, err := readline.New(color.YellowString("[%s]: ", fmt.Sprintf("%s@%s", name, clientAddr)))
-	if err != nil {
-		return nil, err
+	// the address and port the connection actually uses, or the socket for local
+	// connections
+	var clientAddr fmt.Stringer = serverAddr
+	if _, ok := conn.LocalAddr().(*net.TCPAddr); ok {
+		clientAddr = conn.LocalAddr()
 	}
+	fullName := fmt.Sprintf("%s@%s", name, clientAddr) // e.g. AHARCH@192.168.18.4:51756
 
 	client := &Client{
-		Conn: conn,
-		Name: fullName,
-		rl:   rl,
-		done: make(chan struct{}),
+		Conn:         conn,
+		Name:         fullName,
+		serverAddr:   serverAddr,
+		tlsConfig:    tlsConfig,
+		done:         make(chan struct{}),
+		room:         protocol.DefaultRoom,
+		connected:    true,
+		TimeFormat:   ui.DefaultTimeFormat,
+		Notification: ui.NotifyBell,
 	}
 
 	return client, nil
 }
 
+// dial connects to the server, over TLS if tlsConfig is not nil.
+func dial(serverAddr netutils.Address, tlsConfig *tls.Config) (net.Conn, error) {
+	if tlsConfig != nil {
+		return tls.Dial(serverAddr.Network, serverAddr.Address, tlsConfig)
+	}
+	return net.Dial(serverAddr.Network, serverAddr.Address)
+}
+
 // Start starts the client, connecting to the server and handling messages
 func (c *Client) Start() {
+	// the classic prompt, unless another interface was chosen
+	if c.UI == nil {
+		fmt.Println("[dualnet-chat TCP Client]")
+		line, err := ui.NewLine(c.prompt())
+		if err != nil {
+			fmt.Printf("[error] Unable to read input: %v\n", err)
+			return
+		}
+		c.UI = line
+	}
+	c.local = commands.NewLocal(c.UI, c, c.Name)
+	c.local.SetTimeFormat(c.TimeFormat)
+	c.local.SetKeywords(c.Keywords)
+	c.local.SetNotification(c.Notification)
+	c.UI = c.local
+	if err := c.local.SetLogDir(c.LogDir); err != nil {
+		c.UI.Error(fmt.Sprintf("Unable to keep logs in %s: %v", c.LogDir, err))
+	}
+	c.files = transfer.NewManager(c.DownloadDir, c.sendEnvelope, c.local)
+
 	// welcome message
-	fmt.Println("[dualnet-chat TCP Client]")
-	fmt.Printf("[info] You are connected to [%s] as [%s]\n\n", c.Conn.RemoteAddr(), c.Name)
+	c.UI.SetStatus(ui.Status{State: "connected"})
+	c.UI.Info(fmt.Sprintf("You are connected to [%s] as [%s]", c.Conn.RemoteAddr(), c.Name))
 
-	// send the name as the first message to the server
-	fmt.Fprintf(c.Conn, "%s\n", c.Name)
+	// register with the server
+	c.register(c.Conn)
 
 	go c.handleMessages()
 	c.sendMessages()
 }
 
-// handleMessages listens for messages from the server and prints them to the console.
+// register sends the registration envelope, which also lets the server resume
+// the rooms and missed messages of a previous connection.
+func (c *Client) register(conn net.Conn) {
+	c.mu.Lock()
+	reg := protocol.Envelope{
+		Type:    protocol.TypeRegister,
+		From:    c.Name,
+		Rooms:   c.rooms,
+		Since:   c.lastID,
+		Session: c.session,
+	}
+	c.mu.Unlock()
+
+	write(conn, reg)
+}
+
+// writeTimeout bounds how long a write to a stalled server may block, which
+// would otherwise hold up everything waiting on mu.
+const writeTimeout = 10 * time.Second
+
+// write sends one envelope on conn, giving up after writeTimeout.
+func write(conn net.Conn, e protocol.Envelope) error {
+	conn.SetWriteDeadline(time.Now().Add(writeTimeout))
+	_, err := conn.Write(protocol.Encode(e))
+	return err
+}
+
+// handleMessages listens for messages from the server and prints them to the
+// console, reconnecting whenever the connection is lost.
 func (c *Client) handleMessages() {
-	scanner := readline.NewCancelableStdin(c.Conn)
-	buf := make([]byte, 4096)
 	for {
-		// read server message
-		n, err := scanner.Read(buf)
+		c.mu.Lock()
+		conn := c.Conn
+		c.mu.Unlock()
+
+		// read server envelopes until the connection fails
+		reader := protocol.NewReader(conn)
+		for {
+			e, err := reader.Read()
+			if err != nil {
+				break
+			}
+			c.receive(e)
+
+			// the server ended the session on purpose (e.g. idle timeout), so do
+			// not reconnect; closing the UI makes the prompt loop exit
+			if e.Type == protocol.TypeBye {
+				c.UI.Close()
+				return
+			}
+		}
+
+		// the connection was closed on purpose
+		select {
+		case <-c.done:
+			return
+		default:
+		}
+
+		// the connection was replaced by /connect or /reconnect
+		c.mu.Lock()
+		replaced := c.Conn != conn
+		c.mu.Unlock()
+		if replaced {
+			continue
+		}
+
+		c.mu.Lock()
+		c.connected = false
+		c.mu.Unlock()
+
+		// the server forgets the transfers of a lost connection
+		c.files.Reset()
+		c.UI.SetStatus(ui.Status{State: "reconnecting"})
+		c.printInfo("Connection to server lost. Reconnecting...")
+		if !c.reconnect(conn) {
+			return
+		}
+	}
+}
+
+// receive tracks the resume state carried by an envelope and prints it. File
+// transfers are handed to the transfer manager instead.
+func (c *Client) receive(e protocol.Envelope) {
+	switch e.Type {
+	case protocol.TypeFileOffer, protocol.TypeFileAccept, protocol.TypeFileChunk, protocol.TypeFileAck, protocol.TypeFileCancel:
+		c.files.Handle(e)
+		return
+	}
+
+	var seenAs string
+	c.mu.Lock()
+	switch e.Type {
+	case protocol.TypeWelcome:
+		c.session = e.Session
+		c.rooms = e.Rooms
+		if !slices.Contains(c.rooms, c.room) && len(c.rooms) > 0 {
+			c.room = c.rooms[0]
+		}
+		// the server lost its history (e.g. it restarted), so start over from its cursor
+		if e.ID < c.lastID {
+			c.lastID = e.ID
+		}
+		seenAs = c.observed(e.Addr)
+	case protocol.TypeMessage:
+		// replayed messages may also arrive through a regular broadcast
+		if e.ID != 0 && e.ID <= c.lastID {
+			c.mu.Unlock()
+			return
+		}
+		c.lastID = max(c.lastID, e.ID)
+	case protocol.TypeJoin:
+		if e.From == c.Name {
+			if !slices.Contains(c.rooms, e.Room) {
+				c.rooms = append(c.rooms, e.Room)
+			}
+			c.room = e.Room
+		}
+	case protocol.TypeLeave:
+		if e.From == c.Name {
+			c.rooms = slices.DeleteFunc(c.rooms, func(r string) bool { return r == e.Room })
+			if c.room == e.Room && len(c.rooms) > 0 {
+				c.room = c.rooms[len(c.rooms)-1]
+			}
+		}
+	}
+	c.mu.Unlock()
+
+	// show the server message
+	c.UI.Show(e)
+	if seenAs != "" {
+		c.printInfo(fmt.Sprintf("The server sees you as [%s].", seenAs))
+	}
+}
+
+// reconnect dials the server with exponential backoff until it succeeds or the
+// user quits, and registers again on the new connection, which replaces lost.
+func (c *Client) reconnect(lost net.Conn) bool {
+	for {
+		select {
+		case <-c.done:
+			return false
+		case <-time.After(c.backoff.Next()):
+		}
+
+		// the user connected again in the meantime, e.g. with /connect
+		c.mu.Lock()
+		replaced, serverAddr := c.Conn != lost, c.serverAddr
+		c.mu.Unlock()
+		if replaced {
+			c.backoff.Reset()
+			return true
+		}
+
+		conn, err := dial(serverAddr, c.tlsConfig)
 		if err != nil {
-			break
+			continue
 		}
-		message := string(buf[:n])
 
-		// print server message and refresh screen
-		c.rl.Write([]byte(message))
-		c.rl.Refresh()
+		// register before anything else can be written to the new connection
+		c.register(conn)
+
+		// /connect or /reconnect may have replaced the connection while this one
+		// was dialed, and theirs is kept
+		c.mu.Lock()
+		if c.Conn != lost {
+			c.mu.Unlock()
+			conn.Close()
+			c.backoff.Reset()
+			return true
+		}
+		c.Conn = conn
+		c.connected = true
+		c.mu.Unlock()
+
+		// the user may have quit while dialing
+		select {
+		case <-c.done:
+			conn.Close()
+			return false
+		default:
+		}
+
+		c.backoff.Reset()
+		c.UI.SetStatus(ui.Status{State: "connected"})
+		c.printInfo("Reconnected to server.")
+		return true
+	}
+}
+
+// observed records the address the server reports seeing the client at, and
+// returns it if it is new and differs from the connection's own, e.g. behind a
+// NAT. The caller holds mu.
+func (c *Client) observed(addr string) string {
+	local, ok := c.Conn.LocalAddr().(*net.TCPAddr)
+	if !ok || addr == "" || addr == c.seenAs {
+		return ""
+	}
+	c.seenAs = addr
+	if addr == local.String() {
+		return ""
+	}
+	return addr
+}
+
+// Connect switches to the server at addr, starting a new session there.
+func (c *Client) Connect(addr string) error {
+	serverAddr, err := netutils.ParseAddress(addr)
+	if err != nil {
+		return err
+	}
+	return c.redial(serverAddr, false)
+}
+
+// Reconnect replaces the connection to the server with a new one, resuming
+// the session.
+func (c *Client) Reconnect() error {
+	c.mu.Lock()
+	serverAddr := c.serverAddr
+	c.mu.Unlock()
+	return c.redial(serverAddr, true)
+}
+
+// redial connects to serverAddr and registers on the new connection, then
+// closes the old one. Unless resume is set, the session starts over.
+func (c *Client) redial(serverAddr netutils.Address, resume bool) error {
+	conn, err := dial(serverAddr, c.tlsConfig)
+	if err != nil {
+		return err
+	}
+
+	c.mu.Lock()
+	old := c.Conn
+	if !resume {
+		c.session, c.lastID, c.rooms, c.room, c.seenAs = "", 0, nil, protocol.DefaultRoom, ""
+	}
+	c.mu.Unlock()
+
+	// register before anything else can be written to the new connection
+	c.register(conn)
+
+	c.mu.Lock()
+	c.Conn = conn
+	c.serverAddr = serverAddr
+	c.connected = true
+	c.mu.Unlock()
+
+	// transfers on the old connection end with it
+	c.files.Reset()
+
+	// a server left behind is told so, while a resumed session must stay
+	if !resume {
+		write(old, protocol.Envelope{Type: protocol.TypeBye})
 	}
+	old.Close()
 
-	// if cannot read from server because the server disconnected,
-	// notify channel and close readline
-	close(c.done)
-	c.rl.Close()
+	c.UI.SetStatus(ui.Status{State: "connected", Server: serverAddr.String()})
+	return nil
+}
+
+// Refresh shows the prompt again, e.g. after colors were turned off.
+func (c *Client) Refresh() {
+	state := "connected"
+	c.mu.Lock()
+	if !c.connected {
+		state = "reconnecting"
+	}
+	c.mu.Unlock()
+	c.UI.SetStatus(ui.Status{State: state, Prompt: c.prompt()})
+}
+
+// prompt returns the readline prompt, the user's name.
+func (c *Client) prompt() string {
+	return color.YellowString("[%s]: ", c.Name)
+}
+
+// printInfo shows a client-side status line.
+func (c *Client) printInfo(text string) {
+	c.UI.Info(text)
 }
 
 // sendMessages reads user input from standard input and sends it to the server.
 func (c *Client) sendMessages() {
 	// continuously reading user input
 	for {
-		line, err := c.rl.Readline()
+		line, err := c.UI.ReadLine()
 
 		// return on error
 		if err != nil {
-			select {
-			case <-c.done: // check if server was disconnected
-				fmt.Println("\n[info] Server disconnected. Exiting...")
-			default: // user disconnects themselves
-				fmt.Println("\nGoodbye!")
-			}
+			c.mu.Lock()
+			close(c.done)
+			write(c.Conn, protocol.Envelope{Type: protocol.TypeBye})
+			c.Conn.Close()
+			c.mu.Unlock()
 
+			c.files.Close()
+			c.UI.Close()
 			return
 		}
 
+		// commands such as /quit and the lines of a /paste block are taken care
+		// of by the client itself, the rest go to the server
+		if c.local.Run(line) {
+			continue
+		}
+
 		// trim whitespace
 		line = strings.TrimSpace(line)
+		if line == "" {
+			continue
+		}
 
 		// send message to the server
-		fmt.Fprintf(c.Conn, "%s\n", line)
+		if err := c.Send(line); err != nil {
+			c.printInfo("Not connected to the server; message not sent.")
+		}
+	}
+}
+
+// Send sends a line to the server as if the user typed it, to the room typed
+// messages go to, and logs it once sent.
+func (c *Client) Send(line string) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if !c.connected {
+		return net.ErrClosed
+	}
+	if err := write(c.Conn, protocol.Envelope{Type: protocol.TypeMessage, Room: c.room, Text: line}); err != nil {
+		return err
+	}
+	c.local.Sent(c.room, line)
+	return nil
+}
+
+// SendFile offers the file at path to the user named to.
+func (c *Client) SendFile(to, path string) error {
+	return c.files.Offer(to, path)
+}
+
+// AcceptFile saves the file offered with the given ID, or the only one
+// offered if id is empty.
+func (c *Client) AcceptFile(id string) error {
+	return c.files.Accept(id)
+}
+
+// DeclineFile declines the file offered with the given ID or stops its
+// transfer, or does so to the only transfer if id is empty.
+func (c *Client) DeclineFile(id string) error {
+	return c.files.Decline(id)
+}
+
+// sendEnvelope writes an envelope to the server, unless the client is not
+// connected. Chunks of files are written one at a time, between the messages.
+func (c *Client) sendEnvelope(e protocol.Envelope) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if !c.connected {
+		return net.ErrClosed
 	}
+	return write(c.Conn, e)
 }
@@ -0,0 +1,107 @@
+package server
+
+import (
+	"io"
+	"net"
+	"sync"
+	"time"
+
+	"github.com/jennxsierra/dualnet-chat/internal/metrics"
+	"github.com/jennxsierra/dualnet-chat/internal/protocol"
+)
+
+// outboxSize is how many envelopes may queue up for a client before it is
+// considered too slow and dropped.
+const outboxSize = 256
+
+// writeTimeout bounds a single write to a client.
+const writeTimeout = 10 * time.Second
+
+// conn adapts a TCP connection to [chat.Conn]. Envelopes are queued and written
+// by a dedicated goroutine so a slow client never stalls the hub.
+type conn struct {
+	netConn   net.Conn
+	transport string // "tcp" or "unix"
+	addr      string // the remote address, or the local user for "unix"
+	user      string // the local user's name for "unix", if known, whose name clients must use
+	outbox    chan []byte
+	closed    bool // only touched by the hub goroutine
+}
+
+// newConn wraps a connection and starts its writer, which is tracked by wg.
+func newConn(netConn net.Conn, transport, addr string, wg *sync.WaitGroup) *conn {
+	c := &conn{
+		netConn:   netConn,
+		transport: transport,
+		addr:      addr,
+		outbox:    make(chan []byte, outboxSize),
+	}
+
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		c.writeLoop()
+	}()
+
+	return c
+}
+
+// writeLoop writes queued envelopes until the outbox is closed, then closes the
+// connection so its reader stops as well.
+func (c *conn) writeLoop() {
+	for data := range c.outbox {
+		c.netConn.SetWriteDeadline(time.Now().Add(writeTimeout))
+		n, err := c.netConn.Write(data)
+		metrics.BytesSent.Add(c.transport, uint64(n))
+		if err != nil {
+			break
+		}
+	}
+	c.netConn.Close()
+
+	// drain whatever is left so Send never blocks
+	for range c.outbox {
+	}
+}
+
+// Send queues an envelope. A client whose outbox is full is disconnected.
+func (c *conn) Send(e protocol.Envelope) {
+	if c.closed {
+		return
+	}
+	select {
+	case c.outbox <- protocol.Encode(e):
+	default:
+		c.Close()
+	}
+}
+
+// Close flushes the queued envelopes and closes the connection.
+func (c *conn) Close() {
+	if !c.closed {
+		c.closed = true
+		close(c.outbox)
+	}
+}
+
+// Transport identifies the connection as TCP, or Unix socket.
+func (c *conn) Transport() string {
+	return c.transport
+}
+
+// Addr returns the client's address.
+func (c *conn) Addr() string {
+	return c.addr
+}
+
+// countingReader counts the bytes read from a client.
+type countingReader struct {
+	io.Reader
+	transport string
+}
+
+func (r countingReader) Read(p []byte) (int, error) {
+	n, err := r.Reader.Read(p)
+	metrics.BytesReceived.Add(r.transport, uint64(n))
+	return n, err
+}
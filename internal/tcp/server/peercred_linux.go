@@ -0,0 +1,28 @@
+package server
+
+import (
+	"net"
+	"syscall"
+)
+
+// peerCred returns the user and process IDs of the process at the other end of
+// a Unix socket, as recorded by the kernel when it connected (SO_PEERCRED).
+func peerCred(conn *net.UnixConn) (uid, pid int, err error) {
+	raw, err := conn.SyscallConn()
+	if err != nil {
+		return 0, 0, err
+	}
+
+	var cred *syscall.Ucred
+	var credErr error
+	err = raw.Control(func(fd uintptr) {
+		cred, credErr = syscall.GetsockoptUcred(int(fd), syscall.SOL_SOCKET, syscall.SO_PEERCRED)
+	})
+	if err != nil {
+		return 0, 0, err
+	}
+	if credErr != nil {
+		return 0, 0, credErr
+	}
+	return int(cred.Uid), int(cred.Pid), nil
+}
@@ -0,0 +1,13 @@
+//go:build !linux
+
+package server
+
+import (
+	"errors"
+	"net"
+)
+
+// peerCred is only implemented on Linux, where SO_PEERCRED exists.
+func peerCred(conn *net.UnixConn) (uid, pid int, err error) {
+	return 0, 0, errors.New("peer credentials are not supported on this platform")
+}
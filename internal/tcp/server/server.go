@@ -1,40 +1,68 @@
 package server
 
 import (
+	"crypto/tls"
+	"errors"
 	"fmt"
-	"log"
+	"io"
+	"log/slog"
 	"net"
 	"os"
 	"os/signal"
 	"strings"
 	"sync"
+	"sync/atomic"
 	"syscall"
 	"time"
 
+	"github.com/jennxsierra/dualnet-chat/internal/chat"
 	"github.com/jennxsierra/dualnet-chat/internal/netutils"
-	"github.com/jennxsierra/dualnet-chat/internal/tcp/client"
-	"golang.org/x/time/rate"
+	"github.com/jennxsierra/dualnet-chat/internal/protocol"
 )
 
-// ServerClient wraps [client.Client] along with a rate limiter.
-type ServerClient struct {
-	Client  *client.Client
-	Limiter *rate.Limiter
+// Config holds the tunable behavior of a [Server].
+type Config struct {
+	KeepAlive time.Duration // TCP keepalive period, detects vanished clients
+	TLS       *tls.Config   // encrypts connections if set
+	chat.Config
 }
 
-// Server stores information about its address and connected clients.
+// DefaultConfig returns the configuration used when none is given.
+func DefaultConfig() Config {
+	return Config{
+		KeepAlive: 30 * time.Second, // shorter than default
+		Config:    chat.DefaultConfig(),
+	}
+}
+
+// Server stores information about its address and the [chat.Hub] that keeps
+// track of connected clients.
 type Server struct {
-	Addr         string
-	Clients      map[net.Conn]*ServerClient
-	mu           sync.Mutex
-	shuttingDown bool
+	Addr   string
+	Config Config
+	Hub    *chat.Hub
+
+	// UnixSocket is a path to also accept local connections on, if set. Who may
+	// connect is decided by the socket's permissions, UnixSocketMode.
+	UnixSocket     string
+	UnixSocketMode os.FileMode
+
+	mu           sync.Mutex // guards Config and listeners
+	listeners    []net.Listener
+	writers      sync.WaitGroup // connection writers still flushing
+	shuttingDown atomic.Bool
+	closed       chan struct{} // closed once Close is done
+	closeOnce    sync.Once
 }
 
-// NewServer creates a [Server] instance given an address.
-func NewServer(addr string) *Server {
+// NewServer creates a [Server] instance given an address and configuration.
+func NewServer(addr string, cfg Config) *Server {
 	return &Server{
-		Addr:    addr,
-		Clients: make(map[net.Conn]*ServerClient),
+		Addr:           addr,
+		Config:         cfg,
+		Hub:            chat.NewHub(cfg.Config),
+		UnixSocketMode: DefaultUnixSocketMode,
+		closed:         make(chan struct{}),
 	}
 }
 
@@ -45,119 +73,177 @@ func (s *Server) Start() error {
 	if err != nil {
 		return err
 	}
-	defer listener.Close()
+
+	s.mu.Lock()
+	tlsConfig := s.Config.TLS
+	s.mu.Unlock()
+	if tlsConfig != nil {
+		listener = tls.NewListener(listener, tlsConfig)
+	}
+
+	// local clients connect without TLS, the socket's permissions protect it
+	var unixListener net.Listener
+	if s.UnixSocket != "" {
+		if unixListener, err = listenUnix(s.UnixSocket, s.UnixSocketMode); err != nil {
+			listener.Close()
+			return err
+		}
+	}
 
 	s.monitorTermSig() // monitor for termination signal
 
 	// welcome message
 	fmt.Println("[dualnet-chat TCP Server]")
-	log.Printf("[info] Server is listening on %s\n\n", netutils.GetIPv4Addr("tcp", listener.Addr().(*net.TCPAddr).Port))
+	slog.Info("server listening", "addr", listener.Addr().String(), "transport", "tcp", "tls", tlsConfig != nil)
+	for _, a := range netutils.ListenAddrs("tcp", listener.Addr()) {
+		slog.Info("reachable at", "interface", a.Interface, "addr", a.Addr.String())
+	}
+	if unixListener != nil {
+		slog.Info("server listening", "addr", s.UnixSocket, "transport", "unix", "mode", fmt.Sprintf("%#o", s.UnixSocketMode))
+		go s.Serve(unixListener)
+	}
+
+	return s.Serve(listener)
+}
+
+// Serve accepts connections on the listener until [Server.Close] is called, and
+// returns once Close is done. It may be called for several listeners, e.g. TCP
+// and a Unix socket.
+func (s *Server) Serve(listener net.Listener) error {
+	s.mu.Lock()
+	s.listeners = append(s.listeners, listener)
+	s.mu.Unlock()
+	defer listener.Close()
+
+	s.Hub.Start()
 
 	for {
 		conn, err := listener.Accept()
 		if err != nil {
-			log.Println("[error]", err)
+			if s.shuttingDown.Load() {
+				<-s.closed // let Close finish closing the other listeners and flushing
+				return nil
+			}
+			slog.Error("accepting connection", "err", err)
 			continue
 		}
 		go s.handleConnection(conn)
 	}
 }
 
-// handleConnection reads client messages and broadcasts it to all connected clients.
-func (s *Server) handleConnection(conn net.Conn) {
-	defer conn.Close()
+// Reload applies a new configuration to connected and future clients without
+// dropping anyone. The TLS settings only change when the server restarts.
+func (s *Server) Reload(cfg Config) {
+	s.mu.Lock()
+	cfg.TLS = s.Config.TLS
+	s.Config = cfg
+	s.mu.Unlock()
+
+	s.Hub.Reconfigure(cfg.Config)
+}
+
+// Close disconnects every client, stops accepting connections and waits
+// briefly for pending messages to be written.
+func (s *Server) Close() {
+	s.shuttingDown.Store(true)
+	s.Hub.Stop("Server is shutting down. Goodbye!")
+
+	s.mu.Lock()
+	for _, listener := range s.listeners {
+		listener.Close() // also removes a Unix socket
+	}
+	s.mu.Unlock()
+
+	flushed := make(chan struct{})
+	go func() {
+		s.writers.Wait()
+		close(flushed)
+	}()
+	select {
+	case <-flushed:
+	case <-time.After(time.Second):
+	}
+	s.closeOnce.Do(func() { close(s.closed) })
+}
+
+// handleConnection reads the client's envelopes and hands them to the hub
+// until the client disconnects.
+func (s *Server) handleConnection(netConn net.Conn) {
+	s.mu.Lock()
+	keepAlive := s.Config.KeepAlive
+	s.mu.Unlock()
 
 	// periodially check TCP connection for sudden client disconnects (e.g. closing terminal window)
-	if tcpConn, ok := conn.(*net.TCPConn); ok {
+	rawConn := netConn
+	if tlsConn, ok := netConn.(*tls.Conn); ok {
+		rawConn = tlsConn.NetConn()
+	}
+	if tcpConn, ok := rawConn.(*net.TCPConn); ok {
 		tcpConn.SetKeepAlive(true)
-		tcpConn.SetKeepAlivePeriod(30 * time.Second) // shorter than default
+		tcpConn.SetKeepAlivePeriod(keepAlive)
+	}
+
+	// local clients are identified by their user, as the kernel reports it
+	transport, addr, username := "tcp", netConn.RemoteAddr().String(), ""
+	if unixConn, ok := rawConn.(*net.UnixConn); ok {
+		transport = "unix"
+		addr, username = unixPeer(unixConn)
 	}
 
-	// read the client's name first
-	buf := make([]byte, 1024)
-	n, err := conn.Read(buf)
+	conn := newConn(netConn, transport, addr, &s.writers)
+	conn.user = username
+	reader := protocol.NewReader(countingReader{netConn, transport})
+
+	// read the client's registration first
+	reg, err := reader.Read()
 	if err != nil {
-		if !s.shuttingDown && err.Error() != "EOF" { // do not print if shutting down
-			log.Println("Error reading client name:", err)
+		if !s.shuttingDown.Load() && err != io.EOF { // do not print if shutting down
+			slog.Error("reading client registration", "addr", conn.Addr(), "err", err)
 		}
+		conn.Close() // the hub never saw this connection, so it is safe to close here
 		return
 	}
-	clientName := strings.TrimSpace(string(buf[:n]))
-
-	// create a limiter for this client: 1 message per second with burst of 3
-	limiter := rate.NewLimiter(1, 3)
-
-	// add the new client to the server map
-	s.mu.Lock()
-	c := &ServerClient{
-		Client:  &client.Client{Conn: conn, Name: clientName},
-		Limiter: limiter,
+	if reg.Type != protocol.TypeRegister {
+		// older clients send their bare name first
+		reg = protocol.Envelope{Type: protocol.TypeRegister, From: strings.TrimSpace(reg.Text)}
+	}
+	if !s.receive(conn, reg) {
+		return
 	}
-	s.Clients[conn] = c
-	s.mu.Unlock()
-
-	// log and broadcast client connection
-	log.Printf("[+] %s", c.Client.Name)
-	s.broadcast(fmt.Sprintf("[+] %s joined the chat\n", c.Client.Name), conn)
 
-	// continuously read and broadcast client messages until disconnect
+	// continuously read client envelopes until disconnect
 	for {
-		n, err := conn.Read(buf)
+		e, err := reader.Read()
 		if err != nil {
-			if !s.shuttingDown && err.Error() != "EOF" { // do not print if shutting down
-				log.Println("Error reading client message:", err)
+			// do not print if shutting down or the connection was closed on purpose
+			if !s.shuttingDown.Load() && err != io.EOF && !errors.Is(err, net.ErrClosed) {
+				slog.Error("reading client message", "addr", conn.Addr(), "err", err)
 			}
 			break
 		}
-
-		if n > 0 {
-			text := strings.TrimSpace(string(buf[:n]))
-			if text == "" {
-				continue // skip empty messages
-			}
-
-			// retrieve client
-			s.mu.Lock()
-			sc := s.Clients[conn]
-			s.mu.Unlock()
-
-			// client may have disconnected
-			if sc == nil {
-				break
-			}
-
-			// check if the client is allowed to send the message
-			if sc.Limiter.Allow() {
-				s.broadcast(fmt.Sprintf("[%s]: %s", sc.Client.Name, text), conn)
-			} else {
-				// optionally notify user they're sending too fast
-				fmt.Fprint(conn, "[server]: You are sending messages too fast. Please slow down.\n")
-			}
+		if !s.receive(conn, e) {
+			return
 		}
 	}
 
-	// remove disconnected client from the server map
-	s.mu.Lock()
-	delete(s.Clients, conn)
-	s.mu.Unlock()
-
-	// log and broadcast client disconnection
-	log.Printf("[-] %s", c.Client.Name)
-	s.broadcast(fmt.Sprintf("[-] %s left the chat\n", c.Client.Name), conn)
+	// the hub removes the client and closes the connection, unless it already
+	// did so (e.g. the session was resumed over a newer connection)
+	s.Hub.Disconnect(conn)
 }
 
-// broadcast sends a client message to all clients in the server map
-// except the sending client.
-func (s *Server) broadcast(message string, ignoreConn net.Conn) {
-	s.mu.Lock()
-	defer s.mu.Unlock()
-
-	// write message to every connected client
-	for conn, sc := range s.Clients {
-		if conn != ignoreConn {
-			fmt.Fprintf(sc.Client.Conn, "%s\n", message)
+// receive hands an envelope to the hub. Local clients whose user is known may
+// only register under their user's name, also when registering again on the
+// same connection; it returns false if the hub was told to disconnect a client
+// trying another one.
+func (s *Server) receive(conn *conn, e protocol.Envelope) bool {
+	if e.Type == protocol.TypeRegister && conn.user != "" {
+		if reason := checkUnixName(conn, &e); reason != "" {
+			s.Hub.Reject(conn, reason)
+			return false
 		}
 	}
+	s.Hub.Receive(conn, e)
+	return true
 }
 
 // monitorTermSig listens for a termination signal, and upon receiving one,
@@ -172,17 +258,9 @@ func (s *Server) monitorTermSig() {
 	go func() {
 		<-signalChan
 		fmt.Println() // print a newline for neatness
-		log.Println("[info] Server shutting down...")
-
-		// close all client connections and set shuttingDown to true
-		s.mu.Lock()
-		s.shuttingDown = true
-		for conn, c := range s.Clients {
-			log.Printf("[-] Disconnecting %s", c.Client.Name)
-			conn.Close()
-		}
-		s.mu.Unlock()
+		slog.Info("server shutting down")
 
+		s.Close()
 		os.Exit(0)
 	}()
 }
@@ -0,0 +1,83 @@
+package server
+
+import (
+	"fmt"
+	"log/slog"
+	"net"
+	"os"
+	"os/user"
+	"strconv"
+	"strings"
+	"sync/atomic"
+
+	"github.com/jennxsierra/dualnet-chat/internal/protocol"
+)
+
+// DefaultUnixSocketMode lets the server's user and group connect to its Unix
+// socket.
+const DefaultUnixSocketMode os.FileMode = 0o660
+
+// listenUnix listens on a Unix socket at path with the given permissions,
+// which decide who may connect. A socket left behind by a previous run is
+// removed first; any other file at path is an error.
+func listenUnix(path string, mode os.FileMode) (net.Listener, error) {
+	if info, err := os.Lstat(path); err == nil {
+		if info.Mode()&os.ModeSocket == 0 {
+			return nil, fmt.Errorf("%s exists and is not a socket", path)
+		}
+		if err := os.Remove(path); err != nil {
+			return nil, err
+		}
+	}
+
+	listener, err := net.Listen("unix", path)
+	if err != nil {
+		return nil, err
+	}
+	if err := os.Chmod(path, mode); err != nil {
+		listener.Close()
+		return nil, err
+	}
+	return listener, nil
+}
+
+// unixConns numbers the connections on Unix sockets, see unixPeer.
+var unixConns atomic.Uint64
+
+// unixPeer describes the local user at the other end of a Unix socket, e.g.
+// "unix:jenn(uid=1000,pid=4242)#3", and returns it with the user's name. The
+// description is used as the client's address, so it also shows up in logs and
+// the admin API; the number after the "#" tells apart the connections of the
+// same process, or of any local clients where they are unknown. The user's
+// name is empty if the kernel does not say who connected.
+func unixPeer(conn *net.UnixConn) (addr, username string) {
+	n := unixConns.Add(1)
+	uid, pid, err := peerCred(conn)
+	if err != nil {
+		return fmt.Sprintf("unix:unknown#%d", n), ""
+	}
+
+	username = strconv.Itoa(uid)
+	if u, err := user.LookupId(username); err == nil {
+		username = u.Username
+	}
+	return fmt.Sprintf("unix:%s(uid=%d,pid=%d)#%d", username, uid, pid, n), username
+}
+
+// checkUnixName makes sure a local client registers under the name of the user
+// the kernel reports for its socket, optionally followed by "@" and anything
+// that tells its connections apart, e.g. "jenn" or "jenn@laptop". A client
+// that gives no name is named after its user. It returns why a name belonging
+// to someone else may not be used, or "" if it may.
+func checkUnixName(conn *conn, reg *protocol.Envelope) string {
+	name := strings.TrimSpace(reg.From)
+	if name == "" {
+		reg.From = conn.user
+		return ""
+	}
+	if base, _, _ := strings.Cut(name, "@"); base != conn.user {
+		slog.Warn("rejected local client using another name", "client", name, "addr", conn.Addr())
+		return fmt.Sprintf("Over the local socket your name must be your user name, %s, or start with %s@.", conn.user, conn.user)
+	}
+	return ""
+}
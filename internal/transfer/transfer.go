@@ -0,0 +1,671 @@
+// Package transfer sends files to other chat users and receives theirs. Files
+// travel through the server in chunks, a few at a time so chat messages on the
+// same connection are not held up. Interrupted downloads resume where they
+// stopped, and what arrived is checked against the sender's SHA-256 digest.
+package transfer
+
+import (
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"sync"
+	"unicode"
+
+	"github.com/jennxsierra/dualnet-chat/internal/protocol"
+)
+
+// partSuffix ends the names of files still being received.
+const partSuffix = ".part"
+
+// Output is where a [Manager] tells the user what happens.
+type Output interface {
+	Info(text string)
+	Error(text string)
+
+	// Progress shows how far the transfers under way are, or that none are if
+	// text is empty.
+	Progress(text string)
+}
+
+// Manager runs the file transfers of a client. Its methods are safe to call
+// from any goroutine.
+type Manager struct {
+	dir  string                        // where received files are saved
+	send func(protocol.Envelope) error // writes an envelope to the server
+	out  Output
+
+	mu        sync.Mutex
+	transfers map[string]*transfer // by ID
+	progress  string               // what was last shown
+}
+
+// transfer is a file sent or received.
+type transfer struct {
+	id       string
+	peer     string // the user on the other side
+	name     string // base name of the file
+	size     int64
+	sum      string // hex SHA-256 digest, empty while it is computed
+	outgoing bool
+	path     string   // the file sent, or the partial file received
+	file     *os.File // open while data moves
+
+	accepted bool
+	offset   int64         // how much was sent or received
+	acked    int64         // how much of a file sent the recipient saved
+	wake     chan struct{} // tells the sender of an ack
+	done     chan struct{} // closed when the transfer ends
+}
+
+// NewManager returns a manager saving received files in dir, the working
+// directory if empty, that writes to the server with send and tells the user
+// through out.
+func NewManager(dir string, send func(protocol.Envelope) error, out Output) *Manager {
+	return &Manager{
+		dir:       dir,
+		send:      send,
+		out:       out,
+		transfers: make(map[string]*transfer),
+	}
+}
+
+// Offer offers the file at path to the user named to. The file is read once
+// to compute its digest before the offer is sent, in the background.
+func (m *Manager) Offer(to, path string) error {
+	info, err := os.Stat(path)
+	if err != nil {
+		return err
+	}
+	if !info.Mode().IsRegular() {
+		return fmt.Errorf("%s is not a regular file", path)
+	}
+
+	t := &transfer{
+		id:       newID(),
+		peer:     to,
+		name:     filepath.Base(path),
+		size:     info.Size(),
+		outgoing: true,
+		path:     path,
+		wake:     make(chan struct{}, 1),
+		done:     make(chan struct{}),
+	}
+	m.mu.Lock()
+	m.transfers[t.id] = t
+	m.mu.Unlock()
+
+	go func() {
+		sum, err := digest(path)
+		if err != nil {
+			m.end(t)
+			m.out.Error(fmt.Sprintf("Unable to read %s: %v", path, err))
+			return
+		}
+
+		// the offer may have been taken back in the meantime
+		m.mu.Lock()
+		t.sum = sum
+		current := m.transfers[t.id] == t
+		m.mu.Unlock()
+		if !current {
+			return
+		}
+		offer := protocol.Envelope{
+			Type: protocol.TypeFileOffer,
+			To:   to,
+			File: &protocol.File{ID: t.id, Name: t.name, Size: t.size, SHA256: sum},
+		}
+		if err := m.send(offer); err != nil {
+			m.end(t)
+			m.out.Error("Not connected to the server; file not offered.")
+			return
+		}
+		m.out.Info(fmt.Sprintf("Offered %s (%s) to %s, waiting for them to accept. /decline %s takes it back.", t.name, formatSize(t.size), to, t.id))
+	}()
+	return nil
+}
+
+// Accept saves the file offered with the given ID, or the only file offered
+// if id is empty. A download of the same file that was interrupted before
+// resumes where it stopped.
+func (m *Manager) Accept(id string) error {
+	m.mu.Lock()
+	t, err := m.find(id, func(t *transfer) bool { return !t.outgoing && !t.accepted })
+	if err != nil {
+		m.mu.Unlock()
+		return err
+	}
+
+	file, offset, err := openPart(t.path, t.size)
+	if err != nil {
+		m.mu.Unlock()
+		return err
+	}
+	t.file, t.offset, t.accepted = file, offset, true
+	m.mu.Unlock()
+
+	accept := protocol.Envelope{Type: protocol.TypeFileAccept, File: &protocol.File{ID: t.id, Offset: offset}}
+	if err := m.send(accept); err != nil {
+		m.end(t)
+		return errors.New("not connected to the server")
+	}
+	if offset > 0 {
+		m.out.Info(fmt.Sprintf("Resuming %s from %s at %d%%.", t.name, t.peer, percent(offset, t.size)))
+	}
+	if offset == t.size {
+		go m.finish(t)
+	}
+	m.showProgress()
+	return nil
+}
+
+// Decline declines the file offered with the given ID or stops its transfer,
+// either way. Without an ID it does so to the only transfer there is.
+func (m *Manager) Decline(id string) error {
+	m.mu.Lock()
+	t, err := m.find(id, func(t *transfer) bool { return true })
+	m.mu.Unlock()
+	if err != nil {
+		return err
+	}
+
+	m.end(t)
+	m.send(protocol.Envelope{Type: protocol.TypeFileCancel, File: &protocol.File{ID: t.id}})
+	switch {
+	case !t.outgoing && !t.accepted:
+		m.out.Info(fmt.Sprintf("Declined %s from %s.", t.name, t.peer))
+	default:
+		m.out.Info(fmt.Sprintf("Stopped the transfer of %s.", t.name))
+	}
+	return nil
+}
+
+// find returns the transfer with the given ID, or the only one that matches
+// if id is empty. The caller holds mu.
+func (m *Manager) find(id string, match func(*transfer) bool) (*transfer, error) {
+	if id != "" {
+		t := m.transfers[id]
+		if t == nil || !match(t) {
+			return nil, fmt.Errorf("no transfer has the ID %s", id)
+		}
+		return t, nil
+	}
+
+	var found []*transfer
+	for _, t := range m.transfers {
+		if match(t) {
+			found = append(found, t)
+		}
+	}
+	switch len(found) {
+	case 0:
+		return nil, errors.New("there is no such transfer")
+	case 1:
+		return found[0], nil
+	}
+	ids := make([]string, len(found))
+	for i, t := range found {
+		ids[i] = t.id + " (" + t.name + ")"
+	}
+	slices.Sort(ids)
+	return nil, fmt.Errorf("there are several, name one of %s", strings.Join(ids, ", "))
+}
+
+// Handle processes a file-* envelope from the server.
+func (m *Manager) Handle(e protocol.Envelope) {
+	f := e.File
+	if f == nil {
+		return
+	}
+	if e.Type == protocol.TypeFileOffer {
+		m.offered(e.From, *f)
+		return
+	}
+
+	m.mu.Lock()
+	t := m.transfers[f.ID]
+	m.mu.Unlock()
+	if t == nil {
+		return
+	}
+
+	switch e.Type {
+	case protocol.TypeFileAccept:
+		m.accepted(t, f.Offset)
+	case protocol.TypeFileChunk:
+		m.received(t, *f)
+	case protocol.TypeFileAck:
+		m.acked(t, f.Offset)
+	case protocol.TypeFileCancel:
+		m.end(t)
+		switch {
+		case e.Text != "":
+			m.out.Error(fmt.Sprintf("The transfer of %s stopped: %s", t.name, e.Text))
+		case t.outgoing && !t.accepted:
+			m.out.Info(fmt.Sprintf("%s declined %s.", t.peer, t.name))
+		default:
+			m.out.Info(fmt.Sprintf("%s stopped the transfer of %s.", t.peer, t.name))
+		}
+	}
+}
+
+// offered keeps a file offered by another user until it is accepted or
+// declined.
+func (m *Manager) offered(from string, f protocol.File) {
+	if sum, err := hex.DecodeString(f.SHA256); err != nil || len(sum) != sha256.Size || f.Size < 0 {
+		m.send(protocol.Envelope{Type: protocol.TypeFileCancel, Text: "The offer was invalid.", File: &protocol.File{ID: f.ID}})
+		return
+	}
+
+	name := safeName(f.Name)
+	t := &transfer{
+		id:   f.ID,
+		peer: from,
+		name: name,
+		size: f.Size,
+		sum:  strings.ToLower(f.SHA256),
+		// the digest tells downloads of the same file apart, so they resume
+		path: filepath.Join(m.dir, name+"."+strings.ToLower(f.SHA256[:12])+partSuffix),
+		done: make(chan struct{}),
+	}
+	m.mu.Lock()
+	if m.transfers[t.id] != nil {
+		// the sender picks the ID, which must not take over a transfer under
+		// way; cancelling the offer would end that transfer too
+		m.mu.Unlock()
+		m.out.Error(fmt.Sprintf("Ignored %s's offer of %s, which has the ID of another transfer.", from, name))
+		return
+	}
+	m.transfers[t.id] = t
+	m.mu.Unlock()
+
+	m.out.Info(fmt.Sprintf("%s offers you %s (%s). Type /accept %s to save it, or /decline %s.", from, name, formatSize(f.Size), t.id, t.id))
+}
+
+// accepted starts sending a file the recipient accepted, from the offset they
+// already have.
+func (m *Manager) accepted(t *transfer, offset int64) {
+	if !t.outgoing || offset < 0 || offset > t.size {
+		return
+	}
+
+	// an empty file, or one the recipient has all of already, has nothing left
+	// to send: the recipient checks it and acknowledges the whole file, which
+	// ends the transfer
+	if offset == t.size {
+		m.mu.Lock()
+		if t.accepted || m.transfers[t.id] != t {
+			m.mu.Unlock()
+			return
+		}
+		t.offset, t.acked, t.accepted = offset, offset, true
+		m.mu.Unlock()
+		if offset > 0 {
+			m.out.Info(fmt.Sprintf("%s accepted %s, which they have all of already.", t.peer, t.name))
+		} else {
+			m.out.Info(fmt.Sprintf("%s accepted %s.", t.peer, t.name))
+		}
+		return
+	}
+
+	file, err := os.Open(t.path)
+	if err == nil {
+		_, err = file.Seek(offset, io.SeekStart)
+	}
+	if err != nil {
+		m.end(t)
+		m.send(protocol.Envelope{Type: protocol.TypeFileCancel, Text: "The sender could not read the file.", File: &protocol.File{ID: t.id}})
+		m.out.Error(fmt.Sprintf("Unable to read %s: %v", t.path, err))
+		return
+	}
+
+	m.mu.Lock()
+	if t.accepted || m.transfers[t.id] != t {
+		m.mu.Unlock()
+		file.Close()
+		return
+	}
+	t.file, t.offset, t.acked, t.accepted = file, offset, offset, true
+	m.mu.Unlock()
+
+	if offset > 0 {
+		m.out.Info(fmt.Sprintf("%s accepted %s, resuming at %d%%.", t.peer, t.name, percent(offset, t.size)))
+	} else {
+		m.out.Info(fmt.Sprintf("%s accepted %s.", t.peer, t.name))
+	}
+	go m.stream(t)
+	m.showProgress()
+}
+
+// stream sends the chunks of a file, never more than [protocol.FileWindow]
+// ahead of what the recipient saved. It closes the file when it is done.
+func (m *Manager) stream(t *transfer) {
+	defer t.file.Close()
+	const window = protocol.FileWindow * protocol.FileChunkSize
+	buf := make([]byte, protocol.FileChunkSize)
+	for {
+		m.mu.Lock()
+		offset, acked := t.offset, t.acked
+		m.mu.Unlock()
+		if offset >= t.size {
+			return
+		}
+
+		n := min(int64(len(buf)), t.size-offset)
+		if offset+n-acked > window {
+			select {
+			case <-t.wake:
+				continue
+			case <-t.done:
+				return
+			}
+		}
+
+		if _, err := io.ReadFull(t.file, buf[:n]); err != nil {
+			m.end(t)
+			m.send(protocol.Envelope{Type: protocol.TypeFileCancel, Text: "The sender could not read the file.", File: &protocol.File{ID: t.id}})
+			m.out.Error(fmt.Sprintf("Unable to read %s: %v", t.path, err))
+			return
+		}
+		select {
+		case <-t.done:
+			return
+		default:
+		}
+		chunk := protocol.Envelope{Type: protocol.TypeFileChunk, File: &protocol.File{ID: t.id, Offset: offset, Data: buf[:n]}}
+		if err := m.send(chunk); err != nil {
+			return // the connection is gone, and Reset ends the transfer
+		}
+
+		m.mu.Lock()
+		t.offset += n
+		m.mu.Unlock()
+	}
+}
+
+// acked records how much of a file sent the recipient saved, which lets more
+// chunks go, and reports the file delivered once they have all of it.
+func (m *Manager) acked(t *transfer, offset int64) {
+	m.mu.Lock()
+	// the ack of the whole file may repeat the offset accepted at, when
+	// nothing was left to send
+	final := offset == t.size && t.accepted
+	if !t.outgoing || offset < t.acked || offset > t.offset || (offset == t.acked && !final) {
+		m.mu.Unlock()
+		return
+	}
+	t.acked = offset
+	m.mu.Unlock()
+
+	select {
+	case t.wake <- struct{}{}:
+	default:
+	}
+	if offset == t.size {
+		m.end(t)
+		m.out.Info(fmt.Sprintf("%s received %s.", t.peer, t.name))
+		return
+	}
+	m.showProgress()
+}
+
+// received writes a chunk of a file to its partial file and acknowledges it,
+// or checks the whole file once it is the last.
+func (m *Manager) received(t *transfer, f protocol.File) {
+	m.mu.Lock()
+	if t.outgoing || !t.accepted || t.file == nil {
+		m.mu.Unlock()
+		return
+	}
+	n := int64(len(f.Data))
+	if f.Offset != t.offset || t.offset+n > t.size {
+		m.mu.Unlock()
+		m.end(t)
+		m.send(protocol.Envelope{Type: protocol.TypeFileCancel, Text: "The file arrived out of order.", File: &protocol.File{ID: t.id}})
+		m.out.Error(fmt.Sprintf("The transfer of %s stopped: the file arrived out of order.", t.name))
+		return
+	}
+	if _, err := t.file.Write(f.Data); err != nil {
+		m.mu.Unlock()
+		m.end(t)
+		m.send(protocol.Envelope{Type: protocol.TypeFileCancel, Text: "The recipient could not save the file.", File: &protocol.File{ID: t.id}})
+		m.out.Error(fmt.Sprintf("Unable to save %s: %v", t.path, err))
+		return
+	}
+	t.offset += n
+	offset := t.offset
+	m.mu.Unlock()
+
+	// the last chunk is acknowledged once the file checks out
+	if offset == t.size {
+		go m.finish(t)
+		return
+	}
+	m.send(protocol.Envelope{Type: protocol.TypeFileAck, File: &protocol.File{ID: t.id, Offset: offset}})
+	m.showProgress()
+}
+
+// finish checks a file received in full against the sender's digest, and
+// moves it next to the partial file under its own name if it matches. A file
+// damaged on the way is deleted, so sending it again starts over.
+func (m *Manager) finish(t *transfer) {
+	m.mu.Lock()
+	if t.file != nil {
+		t.file.Close()
+		t.file = nil
+	}
+	m.mu.Unlock()
+
+	sum, err := digest(t.path)
+	select {
+	case <-t.done:
+		return // e.g. the connection was lost meanwhile
+	default:
+	}
+	if err != nil || sum != t.sum {
+		m.end(t)
+		os.Remove(t.path)
+		m.send(protocol.Envelope{Type: protocol.TypeFileCancel, Text: "The file arrived damaged.", File: &protocol.File{ID: t.id}})
+		m.out.Error(fmt.Sprintf("%s from %s arrived damaged (its SHA-256 digest does not match) and was deleted.", t.name, t.peer))
+		return
+	}
+
+	path, err := rename(t.path, filepath.Join(filepath.Dir(t.path), t.name))
+	if err != nil {
+		m.end(t)
+		m.send(protocol.Envelope{Type: protocol.TypeFileCancel, Text: "The recipient could not save the file.", File: &protocol.File{ID: t.id}})
+		m.out.Error(fmt.Sprintf("Unable to save %s: %v", t.name, err))
+		return
+	}
+	m.end(t)
+	m.send(protocol.Envelope{Type: protocol.TypeFileAck, File: &protocol.File{ID: t.id, Offset: t.size}})
+	m.out.Info(fmt.Sprintf("Saved %s from %s as %s.", t.name, t.peer, path))
+}
+
+// end forgets a transfer and stops its goroutines. A partial file received is
+// kept, to resume from.
+func (m *Manager) end(t *transfer) {
+	m.mu.Lock()
+	if m.transfers[t.id] != t {
+		m.mu.Unlock()
+		return
+	}
+	delete(m.transfers, t.id)
+	close(t.done)
+	if t.file != nil && !t.outgoing {
+		t.file.Close()
+		t.file = nil
+	}
+	m.mu.Unlock()
+	m.showProgress()
+}
+
+// Reset ends every transfer after the connection to the server was lost, as
+// the server forgets them too. Sending a file again resumes it.
+func (m *Manager) Reset() {
+	m.mu.Lock()
+	var ended []*transfer
+	for _, t := range m.transfers {
+		ended = append(ended, t)
+	}
+	m.mu.Unlock()
+
+	for _, t := range ended {
+		m.end(t)
+		switch {
+		case t.outgoing && t.accepted:
+			m.out.Error(fmt.Sprintf("The transfer of %s was interrupted. Send it again to resume.", t.name))
+		case t.accepted:
+			m.out.Error(fmt.Sprintf("The transfer of %s was interrupted. Ask %s to send it again to resume.", t.name, t.peer))
+		}
+	}
+}
+
+// Close ends every transfer without a word, e.g. when the user quits.
+func (m *Manager) Close() {
+	m.mu.Lock()
+	var ended []*transfer
+	for _, t := range m.transfers {
+		ended = append(ended, t)
+	}
+	m.mu.Unlock()
+
+	for _, t := range ended {
+		m.end(t)
+	}
+}
+
+// showProgress tells the output how far the accepted transfers are, if that
+// changed since it was last told.
+func (m *Manager) showProgress() {
+	m.mu.Lock()
+	var parts []string
+	for _, t := range m.transfers {
+		if !t.accepted {
+			continue
+		}
+		arrow, done := "↓", t.offset
+		if t.outgoing {
+			arrow, done = "↑", t.acked
+		}
+		parts = append(parts, fmt.Sprintf("%s %s%d%%", t.name, arrow, percent(done, t.size)))
+	}
+	slices.Sort(parts)
+	text := strings.Join(parts, ", ")
+	changed := text != m.progress
+	m.progress = text
+	m.mu.Unlock()
+
+	if changed {
+		m.out.Progress(text)
+	}
+}
+
+// openPart opens the partial file of a download, and returns how much of the
+// file it holds already. A partial file larger than the file starts over.
+func openPart(path string, size int64) (*os.File, int64, error) {
+	file, err := os.OpenFile(path, os.O_WRONLY|os.O_CREATE, 0o600)
+	if err != nil {
+		return nil, 0, err
+	}
+	info, err := file.Stat()
+	if err != nil {
+		file.Close()
+		return nil, 0, err
+	}
+	offset := info.Size()
+	if offset > size {
+		offset = 0
+	}
+	if err := file.Truncate(offset); err != nil {
+		file.Close()
+		return nil, 0, err
+	}
+	if _, err := file.Seek(offset, io.SeekStart); err != nil {
+		file.Close()
+		return nil, 0, err
+	}
+	return file, offset, nil
+}
+
+// rename moves the file at from to path, or to "name (2).ext" and so on if
+// path is taken, and returns where it went.
+func rename(from, path string) (string, error) {
+	ext := filepath.Ext(path)
+	base := strings.TrimSuffix(path, ext)
+	for i := 2; ; i++ {
+		_, err := os.Lstat(path)
+		if errors.Is(err, os.ErrNotExist) {
+			return path, os.Rename(from, path)
+		}
+		if err != nil {
+			return "", err
+		}
+		path = fmt.Sprintf("%s (%d)%s", base, i, ext)
+	}
+}
+
+// digest returns the hex SHA-256 digest of the file at path.
+func digest(path string) (string, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return "", err
+	}
+	defer file.Close()
+	hash := sha256.New()
+	if _, err := io.Copy(hash, file); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(hash.Sum(nil)), nil
+}
+
+// safeName turns the name of a file offered into one that stays inside the
+// directory it is saved in.
+func safeName(name string) string {
+	name = filepath.Base(strings.ReplaceAll(name, "\\", "/"))
+	name = strings.Map(func(r rune) rune {
+		if unicode.IsControl(r) || r == '/' {
+			return '_'
+		}
+		return r
+	}, name)
+	if name == "." || name == ".." || name == "/" || name == "" {
+		return "file"
+	}
+	return name
+}
+
+// newID returns a short random ID for a transfer, easy to type.
+func newID() string {
+	return strings.ToLower(rand.Text()[:6])
+}
+
+// percent returns how much of size done is, in whole percent.
+func percent(done, size int64) int64 {
+	if size == 0 {
+		return 100
+	}
+	return done * 100 / size
+}
+
+// formatSize describes a number of bytes the way people read them, e.g.
+// "1.5 MiB".
+func formatSize(n int64) string {
+	const unit = 1024
+	if n < unit {
+		return fmt.Sprintf("%d B", n)
+	}
+	value, prefix := float64(n)/unit, 0
+	for value >= unit && prefix < 3 {
+		value /= unit
+		prefix++
+	}
+	return fmt.Sprintf("%.1f %ciB", value, "KMGT"[prefix])
+}
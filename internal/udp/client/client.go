@@ -1,23 +1,71 @@
 package client
 
 import (
+	"errors"
 	"fmt"
 	"net"
+	"slices"
 	"strings"
+	"sync"
 	"time"
 
-	"github.com/chzyer/readline"
-	"github.com/fatih/color"
+	"github.com/jennxsierra/dualnet-chat/internal/commands"
 	"github.com/jennxsierra/dualnet-chat/internal/netutils"
+	"github.com/jennxsierra/dualnet-chat/internal/protocol"
+	"github.com/jennxsierra/dualnet-chat/internal/ui"
 )
 
+// errReconnecting is returned by Send while contact with the server is lost
+var errReconnecting = errors.New("not connected to the server")
+
 // Client stores the UDP client connection and details
 type Client struct {
 	conn       *net.UDPConn
 	serverAddr *net.UDPAddr
 	Name       string
-	rl         *readline.Instance
 	done       chan struct{}
+	backoff    netutils.Backoff // Delays of every reconnect loop, copied by each
+
+	// UI is how the client talks to the user, a readline prompt unless set before Start
+	UI ui.UI
+
+	// TimeFormat is the layout of the timestamp in front of every line, as in
+	// time.Time.Format, or empty for none
+	TimeFormat string
+
+	// Keywords count as mentions of the user besides "@name", and Notification
+	// is how the user is told about mentions
+	Keywords     []string
+	Notification ui.Notification
+
+	// LogDir is where the messages of every room are logged, or empty for
+	// nowhere
+	LogDir string
+
+	local *commands.Local // Runs the commands typed for the client itself
+
+	// HeartbeatInterval is how often the client checks in with the server, and
+	// MaxMissedHeartbeats is how many unanswered heartbeats mean the server is gone
+	HeartbeatInterval   time.Duration
+	MaxMissedHeartbeats int
+
+	// Resume state, guarded by mu
+	mu           sync.Mutex
+	session      string   // Session ID issued by the server, sent with every envelope
+	lastID       uint64   // ID of the newest message received
+	rooms        []string // Rooms joined, restored after a reconnect
+	room         string   // Room typed messages are sent to
+	reconnecting bool     // Contact with the server was lost and not yet regained
+	losses       uint64   // Times contact was lost, so only the newest reconnect loop goes on
+	seenAs       string   // Address the server last reported seeing us at
+
+	// Heartbeat state, guarded by mu
+	hbSeq   uint64        // Sequence number of the last heartbeat sent
+	hbAcked uint64        // Sequence number of the last heartbeat answered
+	hbSent  time.Time     // When the last heartbeat was sent
+	missed  int           // Heartbeats sent without an answer
+	rtt     time.Duration // Last measured round-trip time
+	state   connState     // State currently shown in the prompt
 }
 
 // NewClient creates a new UDP client that connects to the server
@@ -34,22 +82,21 @@ func NewClient(serverAddr string, name string) (*Client, error) {
 		return nil, err
 	}
 
-	// Get the client's local address
-	clientAddr := netutils.GetIPv4Addr("udp", conn.LocalAddr().(*net.UDPAddr).Port)
+	// The address and port the connection actually uses, which the route to the
+	// server decides
+	clientAddr := conn.LocalAddr()
 	fullName := fmt.Sprintf("%s@%s", name, clientAddr)
 
-	// Create readline instance
-	rl, err := readline.New(color.YellowString("[%s]: ", fullName))
-	if err != nil {
-		return nil, err
-	}
-
 	client := &Client{
-		conn:       conn,
-		serverAddr: udpAddr,
-		Name:       fullName,
-		rl:         rl,
-		done:       make(chan struct{}),
+		conn:                conn,
+		serverAddr:          udpAddr,
+		Name:                fullName,
+		done:                make(chan struct{}),
+		HeartbeatInterval:   10 * time.Second,
+		MaxMissedHeartbeats: 3,
+		room:                protocol.DefaultRoom,
+		TimeFormat:          ui.DefaultTimeFormat,
+		Notification:        ui.NotifyBell,
 	}
 
 	return client, nil
@@ -57,9 +104,28 @@ func NewClient(serverAddr string, name string) (*Client, error) {
 
 // Start initializes the UDP client and starts handling messages
 func (c *Client) Start() {
+	// The classic prompt, unless another interface was chosen
+	if c.UI == nil {
+		fmt.Println("[dualnet-chat UDP Client]")
+		line, err := ui.NewLine(prompt(c.Name, stateConnected, 0))
+		if err != nil {
+			fmt.Printf("[error] Unable to read input: %v\n", err)
+			return
+		}
+		c.UI = line
+	}
+	c.local = commands.NewLocal(c.UI, c, c.Name)
+	c.local.SetTimeFormat(c.TimeFormat)
+	c.local.SetKeywords(c.Keywords)
+	c.local.SetNotification(c.Notification)
+	c.UI = c.local
+	if err := c.local.SetLogDir(c.LogDir); err != nil {
+		c.UI.Error(fmt.Sprintf("Unable to keep logs in %s: %v", c.LogDir, err))
+	}
+
 	// Welcome message
-	fmt.Println("[dualnet-chat UDP Client]")
-	fmt.Printf("[info] You are connected to [%s] as [%s]\n", c.serverAddr, c.Name)
+	c.UI.SetStatus(ui.Status{State: stateConnected.String()})
+	c.UI.Info(fmt.Sprintf("You are connected to [%s] as [%s]", c.serverAddr, c.Name))
 
 	// Register with the server
 	c.register()
@@ -74,66 +140,349 @@ func (c *Client) Start() {
 	c.sendMessages()
 }
 
-// register sends the client's name to the server for registration
+// register sends the client's name to the server for registration, along with
+// the rooms and message cursor needed to resume a previous session
 func (c *Client) register() {
+	c.mu.Lock()
+	reg := protocol.Envelope{
+		Type:  protocol.TypeRegister,
+		From:  c.Name,
+		Rooms: c.rooms,
+		Since: c.lastID,
+	}
+	c.mu.Unlock()
+
 	// Send registration message
-	_, err := c.conn.Write([]byte(fmt.Sprintf("REGISTER:%s", c.Name)))
+	err := c.send(reg)
 	if err != nil {
-		fmt.Printf("[error] Failed to register with server: %v\n", err)
+		c.printInfo(fmt.Sprintf("Failed to register with server: %v", err))
 		return
 	}
 }
 
-// sendHeartbeats periodically sends heartbeat messages to keep the connection active
+// send writes an envelope to the server, tagged with the current session ID so
+// the server can recognize us even if our address changed
+func (c *Client) send(e protocol.Envelope) error {
+	c.mu.Lock()
+	e.Session = c.session
+	conn := c.conn
+	c.mu.Unlock()
+
+	_, err := conn.Write(protocol.Encode(e))
+	return err
+}
+
+// sendHeartbeats periodically sends heartbeat messages to keep the connection active,
+// and declares the server lost once too many of them go unanswered
 func (c *Client) sendHeartbeats() {
-	ticker := time.NewTicker(30 * time.Second)
+	ticker := time.NewTicker(c.HeartbeatInterval)
 	defer ticker.Stop()
 
 	for {
 		select {
 		case <-ticker.C:
-			c.conn.Write([]byte("HEARTBEAT"))
 		case <-c.done:
 			return
 		}
+
+		c.mu.Lock()
+		if c.reconnecting {
+			// Registration attempts take over until the server answers again
+			c.mu.Unlock()
+			continue
+		}
+		if c.hbAcked != c.hbSeq {
+			c.missed++
+		}
+		lost := c.missed >= c.MaxMissedHeartbeats
+		c.hbSeq++
+		c.hbSent = time.Now()
+		seq := c.hbSeq
+		c.mu.Unlock()
+
+		if lost {
+			c.lostContact()
+			continue
+		}
+		c.updatePrompt()
+		c.send(protocol.Envelope{Type: protocol.TypeHeartbeat, Seq: seq})
+	}
+}
+
+// updatePrompt shows the current connection state in the prompt if it changed
+func (c *Client) updatePrompt() {
+	c.mu.Lock()
+	state := stateConnected
+	switch {
+	case c.reconnecting:
+		state = stateLost
+	case c.missed > 0:
+		state = stateDegraded
+	}
+	changed := state != c.state || state == stateConnected
+	c.state = state
+	status := ui.Status{State: state.String(), RTT: c.rtt, Prompt: prompt(c.Name, state, c.rtt)}
+	c.mu.Unlock()
+
+	if changed {
+		c.UI.SetStatus(status)
 	}
 }
 
 // handleMessages listens for messages from the server and displays them
 func (c *Client) handleMessages() {
-	buffer := make([]byte, 4096)
+	buffer := make([]byte, 64*1024)
 
 	for {
+		c.mu.Lock()
+		conn := c.conn
+		c.mu.Unlock()
+
 		// Set read deadline to check for done channel periodically
-		c.conn.SetReadDeadline(time.Now().Add(1 * time.Second))
+		conn.SetReadDeadline(time.Now().Add(1 * time.Second))
 
-		n, _, err := c.conn.ReadFromUDP(buffer)
+		n, _, err := conn.ReadFromUDP(buffer)
 		if err != nil {
+			select {
+			case <-c.done:
+				return
+			default:
+			}
+
+			// The socket was replaced by /connect or /reconnect
+			c.mu.Lock()
+			replaced := c.conn != conn
+			c.mu.Unlock()
+			if replaced {
+				continue
+			}
+
 			if netErr, ok := err.(net.Error); ok && netErr.Timeout() {
 				// This is just our timeout, not a real error
-				select {
-				case <-c.done:
-					return
-				default:
-					continue
-				}
+				continue
 			}
 
-			// Real error, likely server disconnected
-			close(c.done)
-			c.rl.Write([]byte("\n[info] Connection to server lost. Exiting...\n"))
-			c.rl.Close()
-			return
+			// Real error, likely the server is unreachable, so keep trying to register again
+			c.lostContact()
+			continue
 		}
 
 		// Reset read deadline
-		c.conn.SetReadDeadline(time.Time{})
+		conn.SetReadDeadline(time.Time{})
 
-		message := string(buffer[:n])
+		e := protocol.Decode(buffer[:n])
+		switch e.Type {
+		case protocol.TypeRegister:
+			// The server does not know us (e.g. it restarted), so register again
+			c.register()
+		case protocol.TypeHeartbeatAck:
+			c.heartbeatAcked(e.Seq)
+		case protocol.TypeBye:
+			// The server ended the session on purpose (e.g. idle timeout), so do not
+			// re-register; closing the UI makes the prompt loop exit
+			c.receive(e)
+			c.UI.Close()
+			return
+		default:
+			c.receive(e)
+		}
+	}
+}
 
-		// Print server message and refresh screen
-		c.rl.Write([]byte(message))
-		c.rl.Refresh()
+// heartbeatAcked records the round-trip time of an answered heartbeat
+func (c *Client) heartbeatAcked(seq uint64) {
+	c.mu.Lock()
+	if seq != c.hbSeq {
+		// Answers to older heartbeats arrived too late to count
+		c.mu.Unlock()
+		return
+	}
+	c.hbAcked = seq
+	c.rtt = time.Since(c.hbSent)
+	c.missed = 0
+	c.mu.Unlock()
+
+	c.updatePrompt()
+}
+
+// receive tracks the resume state carried by an envelope and prints it
+func (c *Client) receive(e protocol.Envelope) {
+	var seenAs string
+	var reconnected bool
+	c.mu.Lock()
+	switch e.Type {
+	case protocol.TypeWelcome:
+		c.session = e.Session
+		c.rooms = e.Rooms
+		if !slices.Contains(c.rooms, c.room) && len(c.rooms) > 0 {
+			c.room = c.rooms[0]
+		}
+		// The server lost its history (e.g. it restarted), so start over from its cursor
+		if e.ID < c.lastID {
+			c.lastID = e.ID
+		}
+		seenAs = c.observed(e.Addr)
+		if c.reconnecting {
+			c.reconnecting = false
+			c.missed = 0
+			c.hbAcked = c.hbSeq
+			reconnected = true
+		}
+	case protocol.TypeMessage:
+		// Replayed messages may also arrive through a regular broadcast
+		if e.ID != 0 && e.ID <= c.lastID {
+			c.mu.Unlock()
+			return
+		}
+		c.lastID = max(c.lastID, e.ID)
+	case protocol.TypeJoin:
+		if e.From == c.Name {
+			if !slices.Contains(c.rooms, e.Room) {
+				c.rooms = append(c.rooms, e.Room)
+			}
+			c.room = e.Room
+		}
+	case protocol.TypeLeave:
+		if e.From == c.Name {
+			c.rooms = slices.DeleteFunc(c.rooms, func(r string) bool { return r == e.Room })
+			if c.room == e.Room && len(c.rooms) > 0 {
+				c.room = c.rooms[len(c.rooms)-1]
+			}
+		}
+	}
+	c.mu.Unlock()
+
+	if reconnected {
+		c.updatePrompt()
+		c.printInfo("Reconnected to server.")
+	}
+
+	// Show the server message, which also lets the UI start over with the
+	// members and commands of the new session
+	c.UI.Show(e)
+	c.printSeenAs(seenAs)
+}
+
+// lostContact starts re-registering with the server unless that is already in progress
+func (c *Client) lostContact() {
+	c.mu.Lock()
+	if c.reconnecting {
+		c.mu.Unlock()
+		return
+	}
+	c.reconnecting = true
+	c.losses++
+	loss := c.losses
+	c.mu.Unlock()
+
+	c.updatePrompt()
+	c.printInfo("Connection to server lost. Reconnecting...")
+	go c.reconnect(loss)
+}
+
+// reconnect re-sends the registration with exponential backoff until the server
+// welcomes us back. A loop still waiting when contact is regained and lost again
+// stops in favor of the one started for the newer loss, and each loop counts
+// its own attempts, so that they never share a backoff
+func (c *Client) reconnect(loss uint64) {
+	backoff := c.backoff
+
+	for {
+		select {
+		case <-c.done:
+			return
+		case <-time.After(backoff.Next()):
+		}
+
+		c.mu.Lock()
+		current := c.reconnecting && c.losses == loss
+		c.mu.Unlock()
+		if !current {
+			return
+		}
+
+		c.register()
+	}
+}
+
+// observed records the address the server reports seeing the client at, and
+// returns it if it is new and differs from the connection's own, e.g. behind a
+// NAT. The caller holds mu
+func (c *Client) observed(addr string) string {
+	if addr == "" || addr == c.seenAs {
+		return ""
+	}
+	c.seenAs = addr
+	if addr == c.conn.LocalAddr().String() {
+		return ""
+	}
+	return addr
+}
+
+// Connect switches to the server at addr, starting a new session there
+func (c *Client) Connect(addr string) error {
+	udpAddr, err := net.ResolveUDPAddr("udp", addr)
+	if err != nil {
+		return err
+	}
+
+	// Tell the server we are leaving while its session ID is still ours
+	c.send(protocol.Envelope{Type: protocol.TypeBye})
+	return c.redial(udpAddr, false)
+}
+
+// Reconnect replaces the socket with a new one, which the server moves the
+// session to when it sees its ID
+func (c *Client) Reconnect() error {
+	c.mu.Lock()
+	udpAddr := c.serverAddr
+	c.mu.Unlock()
+	return c.redial(udpAddr, true)
+}
+
+// redial replaces the socket with a new one to udpAddr and registers through
+// it. Unless resume is set, the session starts over
+func (c *Client) redial(udpAddr *net.UDPAddr, resume bool) error {
+	conn, err := net.DialUDP("udp", nil, udpAddr)
+	if err != nil {
+		return err
+	}
+
+	c.mu.Lock()
+	old := c.conn
+	c.conn = conn
+	c.serverAddr = udpAddr
+	if !resume {
+		c.session, c.lastID, c.rooms, c.room, c.seenAs = "", 0, nil, protocol.DefaultRoom, ""
+	}
+	// Heartbeats sent through the old socket will not be answered
+	c.missed = 0
+	c.hbAcked = c.hbSeq
+	c.mu.Unlock()
+	old.Close()
+
+	c.register()
+	c.UI.SetStatus(ui.Status{State: stateConnected.String(), Server: udpAddr.String()})
+	return nil
+}
+
+// Refresh shows the prompt again, e.g. after colors were turned off
+func (c *Client) Refresh() {
+	c.mu.Lock()
+	status := ui.Status{State: c.state.String(), RTT: c.rtt, Prompt: prompt(c.Name, c.state, c.rtt)}
+	c.mu.Unlock()
+	c.UI.SetStatus(status)
+}
+
+// printInfo shows a client-side status line
+func (c *Client) printInfo(text string) {
+	c.UI.Info(text)
+}
+
+// printSeenAs tells the user the address the server sees, if there is one to tell
+func (c *Client) printSeenAs(addr string) {
+	if addr != "" {
+		c.printInfo(fmt.Sprintf("The server sees you as [%s].", addr))
 	}
 }
 
@@ -141,23 +490,23 @@ func (c *Client) handleMessages() {
 func (c *Client) sendMessages() {
 	// Continuously reading user input
 	for {
-		line, err := c.rl.Readline()
+		line, err := c.UI.ReadLine()
 
 		// Return on error
 		if err != nil {
-			select {
-			case <-c.done: // Check if server was disconnected
-				fmt.Println("\n[info] Server disconnected. Exiting...")
-			default: // User disconnects themselves
-				// Send disconnect message to server before exiting
-				c.conn.Write([]byte("BYE"))
-				fmt.Println("\nGoodbye!")
-				close(c.done)
-			}
-
+			// Send disconnect message to server before exiting
+			c.send(protocol.Envelope{Type: protocol.TypeBye})
+			c.UI.Close()
+			close(c.done)
 			return
 		}
 
+		// Commands such as /quit and the lines of a /paste block are taken care
+		// of by the client itself, the rest go to the server
+		if c.local.Run(line) {
+			continue
+		}
+
 		// Trim whitespace
 		line = strings.TrimSpace(line)
 		if line == "" {
@@ -165,10 +514,28 @@ func (c *Client) sendMessages() {
 		}
 
 		// Send message to the server
-		_, err = c.conn.Write([]byte(line))
-		if err != nil {
-			c.rl.Write([]byte(fmt.Sprintf("[error] Failed to send message: %v\n", err)))
-			c.rl.Refresh()
+		err = c.Send(line)
+		switch {
+		case errors.Is(err, errReconnecting):
+			c.printInfo("Not connected to the server; message not sent.")
+		case err != nil:
+			c.UI.Error(fmt.Sprintf("Failed to send message: %v", err))
 		}
 	}
 }
+
+// Send sends a line to the server as if the user typed it, to the room typed
+// messages go to, and logs it once sent
+func (c *Client) Send(line string) error {
+	c.mu.Lock()
+	reconnecting, room := c.reconnecting, c.room
+	c.mu.Unlock()
+	if reconnecting {
+		return errReconnecting
+	}
+	if err := c.send(protocol.Envelope{Type: protocol.TypeMessage, Room: room, Text: line}); err != nil {
+		return err
+	}
+	c.local.Sent(room, line)
+	return nil
+}
@@ -0,0 +1,51 @@
+package client
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/fatih/color"
+)
+
+// connState describes how healthy the link to the server looks based on
+// heartbeat replies
+type connState int
+
+const (
+	stateConnected connState = iota // Every heartbeat is being answered
+	stateDegraded                   // Some heartbeats went unanswered
+	stateLost                       // Too many heartbeats went unanswered, reconnecting
+)
+
+// String returns the label shown in the prompt
+func (s connState) String() string {
+	switch s {
+	case stateConnected:
+		return "connected"
+	case stateDegraded:
+		return "degraded"
+	default:
+		return "lost"
+	}
+}
+
+// prompt builds the readline prompt, prefixed with a colored status indicator
+// and the last measured round-trip time
+func prompt(name string, state connState, rtt time.Duration) string {
+	var status string
+	switch state {
+	case stateConnected:
+		status = color.GreenString("● %s", state)
+		switch {
+		case rtt >= time.Millisecond:
+			status += color.GreenString(" %s", rtt.Round(time.Millisecond))
+		case rtt > 0:
+			status += color.GreenString(" <1ms")
+		}
+	case stateDegraded:
+		status = color.YellowString("◐ %s", state)
+	default:
+		status = color.RedString("○ %s", state)
+	}
+	return fmt.Sprintf("%s %s", status, color.YellowString("[%s]: ", name))
+}
@@ -2,43 +2,54 @@ package server
 
 import (
 	"fmt"
-	"log"
+	"log/slog"
 	"net"
 	"os"
 	"os/signal"
-	"strings"
 	"sync"
 	"syscall"
 	"time"
 
+	"github.com/jennxsierra/dualnet-chat/internal/chat"
+	"github.com/jennxsierra/dualnet-chat/internal/discovery"
+	"github.com/jennxsierra/dualnet-chat/internal/metrics"
 	"github.com/jennxsierra/dualnet-chat/internal/netutils"
-	"golang.org/x/time/rate"
+	"github.com/jennxsierra/dualnet-chat/internal/protocol"
 )
 
-// ClientInfo stores information about a connected UDP client
-type ClientInfo struct {
-	Name     string
-	Addr     *net.UDPAddr
-	Limiter  *rate.Limiter
-	LastSeen time.Time
+// Config holds the tunable behavior of a [Server]
+type Config struct {
+	chat.Config
 }
 
-// Server stores information about its address and connected clients
+// DefaultConfig returns the configuration used when none is given
+func DefaultConfig() Config {
+	return Config{Config: chat.DefaultConfig()}
+}
+
+// Server stores information about its address and the [chat.Hub] that keeps track of connected clients
 type Server struct {
-	Addr         string
-	Conn         *net.UDPConn
-	Clients      map[string]*ClientInfo
-	mu           sync.Mutex
-	shuttingDown bool
-	done         chan struct{}
+	Addr   string
+	Config Config
+	Conn   *net.UDPConn
+	Hub    *chat.Hub
+
+	// Discovery answers discovery probes sent to the chat socket, e.g. broadcast
+	// by clients on networks that drop multicast, if set
+	Discovery *discovery.Announcer
+
+	mu        sync.Mutex // Guards Config and Conn
+	done      chan struct{}
+	closeOnce sync.Once
 }
 
-// NewServer creates a new UDP server instance given an address
-func NewServer(addr string) *Server {
+// NewServer creates a new UDP server instance given an address and configuration
+func NewServer(addr string, cfg Config) *Server {
 	return &Server{
-		Addr:    addr,
-		Clients: make(map[string]*ClientInfo),
-		done:    make(chan struct{}),
+		Addr:   addr,
+		Config: cfg,
+		Hub:    chat.NewHub(cfg.Config),
+		done:   make(chan struct{}),
 	}
 }
 
@@ -51,26 +62,56 @@ func (s *Server) Start() error {
 	}
 
 	// Create a UDP connection
-	s.Conn, err = net.ListenUDP("udp", udpAddr)
+	conn, err := net.ListenUDP("udp", udpAddr)
 	if err != nil {
 		return err
 	}
-	defer s.Conn.Close()
 
-	s.monitorTermSig()         // Monitor for termination signal
-	s.monitorInactiveClients() // Monitor for inactive clients
+	s.monitorTermSig() // Monitor for termination signal
 
 	// Welcome message
 	fmt.Println("[dualnet-chat UDP Server]")
-	log.Printf("[info] Server is listening on %s\n\n", netutils.GetIPv4Addr("udp", udpAddr.Port))
+	slog.Info("server listening", "addr", conn.LocalAddr().String(), "transport", "udp")
+	for _, a := range netutils.ListenAddrs("udp", conn.LocalAddr()) {
+		slog.Info("reachable at", "interface", a.Interface, "addr", a.Addr.String())
+	}
 
 	// Process incoming messages
-	return s.processMessages()
+	return s.Serve(conn)
+}
+
+// Serve processes datagrams received on conn until [Server.Close] is called
+func (s *Server) Serve(conn *net.UDPConn) error {
+	s.mu.Lock()
+	s.Conn = conn
+	s.mu.Unlock()
+	defer conn.Close()
+
+	s.Hub.Start()
+	return s.processMessages(conn)
+}
+
+// Reload applies a new configuration to connected and future clients without
+// dropping anyone
+func (s *Server) Reload(cfg Config) {
+	s.mu.Lock()
+	s.Config = cfg
+	s.mu.Unlock()
+
+	s.Hub.Reconfigure(cfg.Config)
+}
+
+// Close tells every client the server is shutting down and stops processing messages
+func (s *Server) Close() {
+	s.closeOnce.Do(func() {
+		s.Hub.Stop("Server is shutting down. Goodbye!")
+		close(s.done)
+	})
 }
 
-// processMessages handles incoming UDP messages
-func (s *Server) processMessages() error {
-	buffer := make([]byte, 4096)
+// processMessages hands incoming datagrams to the hub
+func (s *Server) processMessages(conn *net.UDPConn) error {
+	buffer := make([]byte, 64*1024)
 
 	for {
 		select {
@@ -78,159 +119,77 @@ func (s *Server) processMessages() error {
 			return nil
 		default:
 			// Set a read deadline so we can check for server shutdown
-			s.Conn.SetReadDeadline(time.Now().Add(1 * time.Second))
+			conn.SetReadDeadline(time.Now().Add(1 * time.Second))
 
 			// Read message
-			n, addr, err := s.Conn.ReadFromUDP(buffer)
+			n, addr, err := conn.ReadFromUDP(buffer)
 			if err != nil {
 				if netErr, ok := err.(net.Error); ok && netErr.Timeout() {
 					// This is just a timeout from our deadline, not a real error
 					continue
 				}
-				log.Printf("[error] Reading from UDP: %v", err)
+				slog.Error("reading from UDP", "err", err)
+				metrics.DroppedDatagrams.Inc()
+				continue
+			}
+			metrics.BytesReceived.Add("udp", uint64(n))
+
+			// Answer discovery probes, which come from clients that are not chatting
+			// yet, as long as they come from the local network
+			e := protocol.Decode(buffer[:n])
+			if e.Type == protocol.TypeDiscover {
+				if reply := s.discoveryReply(); reply != nil && discovery.Local(addr.IP) {
+					conn.WriteToUDP(reply, addr)
+				}
 				continue
 			}
-
-			// Reset read deadline
-			s.Conn.SetReadDeadline(time.Time{})
 
 			// Process the message
-			message := strings.TrimSpace(string(buffer[:n]))
-			s.handleMessage(addr, message)
+			s.Hub.Receive(&clientConn{conn: conn, addr: addr}, e)
 		}
 	}
 }
 
-// handleMessage processes a single message from a UDP client
-func (s *Server) handleMessage(addr *net.UDPAddr, message string) {
-	addrStr := addr.String()
-
-	// Check if this is a new client (registration message)
-	s.mu.Lock()
-	client, exists := s.Clients[addrStr]
-	s.mu.Unlock()
-
-	if !exists {
-		// This is a new client, register them
-		if strings.HasPrefix(message, "REGISTER:") {
-			clientName := strings.TrimPrefix(message, "REGISTER:")
-			s.registerClient(addr, clientName)
-		}
-		return
-	}
-
-	// Update last seen time for existing client
-	s.mu.Lock()
-	client.LastSeen = time.Now()
-	s.mu.Unlock()
-
-	// Handle heartbeat message
-	if message == "HEARTBEAT" {
-		return
-	}
-
-	// Handle disconnect message
-	if message == "BYE" {
-		s.handleClientDisconnect(addr)
-		return
-	}
-
-	// Handle regular message
-	// Check rate limit
-	if client.Limiter.Allow() {
-		// Broadcast message to all other clients
-		s.broadcast(fmt.Sprintf("[%s]: %s", client.Name, message), addr)
-	} else {
-		// Notify client they're sending too fast
-		s.Conn.WriteToUDP([]byte("[server]: You are sending messages too fast. Please slow down.\n"), addr)
+// discoveryReply returns the server's announcement, or nil if it does not announce itself
+func (s *Server) discoveryReply() []byte {
+	if s.Discovery == nil {
+		return nil
 	}
+	return s.Discovery.Reply()
 }
 
-// handleClientDisconnect processes a client disconnection
-func (s *Server) handleClientDisconnect(addr *net.UDPAddr) {
-	addrStr := addr.String()
-
-	s.mu.Lock()
-	client, exists := s.Clients[addrStr]
-	if exists {
-		clientName := client.Name
-		delete(s.Clients, addrStr)
-		s.mu.Unlock()
-
-		// Log the disconnection
-		log.Printf("[-] %s", clientName)
-		// Broadcast disconnection message to other clients
-		s.broadcast(fmt.Sprintf("[-] %s left the chat\n", clientName), addr)
-	} else {
-		s.mu.Unlock()
-	}
+// clientConn adapts a UDP client address to [chat.Conn]
+type clientConn struct {
+	conn *net.UDPConn
+	addr *net.UDPAddr
 }
 
-// registerClient adds a new client to the server
-func (s *Server) registerClient(addr *net.UDPAddr, name string) {
-	// Create a limiter for this client: 1 message per second with burst of 3
-	limiter := rate.NewLimiter(1, 3)
-
-	s.mu.Lock()
-	s.Clients[addr.String()] = &ClientInfo{
-		Name:     name,
-		Addr:     addr,
-		Limiter:  limiter,
-		LastSeen: time.Now(),
+// Send writes a single envelope to the client as one datagram
+func (c *clientConn) Send(e protocol.Envelope) {
+	n, err := c.conn.WriteToUDP(protocol.Encode(e), c.addr)
+	if err != nil {
+		metrics.DroppedDatagrams.Inc()
+		return
 	}
-	s.mu.Unlock()
-
-	// Log and broadcast client connection
-	log.Printf("[+] %s", name)
-	s.broadcast(fmt.Sprintf("[+] %s joined the chat\n", name), addr)
-
-	// Send confirmation to the client
-	s.Conn.WriteToUDP([]byte(fmt.Sprintf("[server]: Welcome %s, you are now registered!\n\n", name)), addr)
+	metrics.BytesSent.Add("udp", uint64(n))
 }
 
-// broadcast sends a message to all connected clients except the sender
-func (s *Server) broadcast(message string, ignoreAddr *net.UDPAddr) {
-	s.mu.Lock()
-	defer s.mu.Unlock()
+// Close does nothing, as there is no connection to close
+func (c *clientConn) Close() {}
 
-	for _, client := range s.Clients {
-		if client.Addr.String() != ignoreAddr.String() {
-			s.Conn.WriteToUDP([]byte(message+"\n"), client.Addr)
-		}
-	}
+// Transport identifies the connection as UDP
+func (c *clientConn) Transport() string {
+	return "udp"
 }
 
-// monitorInactiveClients periodically checks for clients that haven't sent messages recently
-func (s *Server) monitorInactiveClients() {
-	go func() {
-		ticker := time.NewTicker(30 * time.Second)
-		defer ticker.Stop()
-
-		for {
-			select {
-			case <-ticker.C:
-				now := time.Now()
-				inactiveThreshold := 1 * time.Minute
-
-				for addrStr, client := range s.Clients {
-					if now.Sub(client.LastSeen) > inactiveThreshold {
-						// Client hasn't sent a message in too long, consider them disconnected
-						log.Printf("[-] %s (inactive timeout)", client.Name)
-						s.broadcast(fmt.Sprintf("[-] %s left the chat (timeout)\n", client.Name), client.Addr)
-
-						s.mu.Lock()
-						delete(s.Clients, addrStr)
-						s.mu.Unlock()
-					}
-				}
-
-			case <-s.done:
-				return
-			}
-		}
-	}()
+// Addr returns the client's address
+func (c *clientConn) Addr() string {
+	return c.addr.String()
 }
 
+// Datagram marks UDP clients as needing the hub's inactivity timeout
+func (c *clientConn) Datagram() {}
+
 // monitorTermSig listens for termination signals and gracefully shuts down
 func (s *Server) monitorTermSig() {
 	signalChan := make(chan os.Signal, 1)
@@ -242,19 +201,10 @@ func (s *Server) monitorTermSig() {
 	go func() {
 		<-signalChan
 		fmt.Println() // Print a newline for neatness
-		log.Println("[info] Server shutting down...")
-
-		// Set shutting down flag and notify all clients
-		s.mu.Lock()
-		s.shuttingDown = true
-		for _, client := range s.Clients {
-			log.Printf("[-] Disconnecting %s", client.Name)
-			s.Conn.WriteToUDP([]byte("[server]: Server is shutting down. Goodbye!\n"), client.Addr)
-		}
-		s.mu.Unlock()
+		slog.Info("server shutting down")
 
-		// Signal to stop all goroutines
-		close(s.done)
+		// Notify all clients and stop all goroutines
+		s.Close()
 
 		os.Exit(0)
 	}()
@@ -0,0 +1,64 @@
+package ui
+
+import (
+	"slices"
+	"strings"
+)
+
+// Completer returns the words that complete word, the start of a "@name",
+// "#room" or "/command" the user is typing, in full.
+type Completer func(word string) []string
+
+// completable returns where the word before pos in line starts, and whether it
+// can be completed: a "@name" or "#room" anywhere, or a "/command" at the start
+// of the line.
+func completable(line []rune, pos int) (int, bool) {
+	start := pos
+	for start > 0 && line[start-1] != ' ' {
+		start--
+	}
+	if start == pos {
+		return start, false
+	}
+	switch line[start] {
+	case '@', '#':
+		return start, true
+	case '/':
+		return start, start == 0
+	}
+	return start, false
+}
+
+// completions returns the completions of the word before pos in line, without
+// the part already typed, and the length of that part.
+func completions(complete Completer, line []rune, pos int) ([][]rune, int) {
+	start, ok := completable(line, pos)
+	if !ok || complete == nil {
+		return nil, 0
+	}
+	word := string(line[start:pos])
+
+	var rest [][]rune
+	for _, c := range complete(word) {
+		if suffix, ok := strings.CutPrefix(c, word); ok {
+			rest = append(rest, []rune(suffix+" "))
+		}
+	}
+	return rest, pos - start
+}
+
+// commonPrefix returns the longest start the words share.
+func commonPrefix(words [][]rune) []rune {
+	if len(words) == 0 {
+		return nil
+	}
+	prefix := words[0]
+	for _, w := range words[1:] {
+		n := 0
+		for n < len(prefix) && n < len(w) && prefix[n] == w[n] {
+			n++
+		}
+		prefix = prefix[:n]
+	}
+	return slices.Clone(prefix)
+}
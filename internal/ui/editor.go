@@ -0,0 +1,125 @@
+package ui
+
+import (
+	"slices"
+	"strings"
+)
+
+// LineEditor holds the line being typed in the full-screen interface, the
+// cursor's position in it and the lines entered before, which the arrow keys
+// bring back. The zero value is an empty line without history.
+type LineEditor struct {
+	input   []rune
+	cursor  int // position in input
+	history []string
+	recall  int // position in history while browsing it, len(history) if not
+}
+
+// Text returns the line being typed.
+func (e *LineEditor) Text() string {
+	return string(e.input)
+}
+
+// Cursor returns the cursor's position in the line, in characters.
+func (e *LineEditor) Cursor() int {
+	return e.cursor
+}
+
+// Empty reports whether nothing has been typed.
+func (e *LineEditor) Empty() bool {
+	return len(e.input) == 0
+}
+
+// Insert types characters at the cursor.
+func (e *LineEditor) Insert(rs ...rune) {
+	e.input = slices.Insert(e.input, e.cursor, rs...)
+	e.cursor += len(rs)
+}
+
+// Backspace deletes the character before the cursor.
+func (e *LineEditor) Backspace() {
+	if e.cursor > 0 {
+		e.input = slices.Delete(e.input, e.cursor-1, e.cursor)
+		e.cursor--
+	}
+}
+
+// Delete deletes the character under the cursor.
+func (e *LineEditor) Delete() {
+	if e.cursor < len(e.input) {
+		e.input = slices.Delete(e.input, e.cursor, e.cursor+1)
+	}
+}
+
+// Left moves the cursor back a character.
+func (e *LineEditor) Left() {
+	e.cursor = max(e.cursor-1, 0)
+}
+
+// Right moves the cursor forward a character.
+func (e *LineEditor) Right() {
+	e.cursor = min(e.cursor+1, len(e.input))
+}
+
+// Home moves the cursor to the start of the line.
+func (e *LineEditor) Home() {
+	e.cursor = 0
+}
+
+// End moves the cursor to the end of the line.
+func (e *LineEditor) End() {
+	e.cursor = len(e.input)
+}
+
+// KillLine deletes everything before the cursor, like Ctrl-U.
+func (e *LineEditor) KillLine() {
+	e.input, e.cursor = slices.Delete(e.input, 0, e.cursor), 0
+}
+
+// KillEnd deletes everything from the cursor on, like Ctrl-K.
+func (e *LineEditor) KillEnd() {
+	e.input = e.input[:e.cursor]
+}
+
+// KillWord deletes the word before the cursor and the spaces after it, like
+// Ctrl-W.
+func (e *LineEditor) KillWord() {
+	start := e.cursor
+	for start > 0 && e.input[start-1] == ' ' {
+		start--
+	}
+	for start > 0 && e.input[start-1] != ' ' {
+		start--
+	}
+	e.input, e.cursor = slices.Delete(e.input, start, e.cursor), start
+}
+
+// Enter empties the line and returns it without surrounding spaces. Lines
+// that are not blank are added to the history as they were typed.
+func (e *LineEditor) Enter() string {
+	line := strings.TrimSpace(string(e.input))
+	if line != "" {
+		e.history = append(e.history, string(e.input))
+	}
+	e.input, e.cursor, e.recall = nil, 0, len(e.history)
+	return line
+}
+
+// Browse replaces the line with the previous entered one if back is true, or
+// the next one otherwise, with the cursor at its end. Going forward past the
+// newest line leaves it empty.
+func (e *LineEditor) Browse(back bool) {
+	switch {
+	case back && e.recall > 0:
+		e.recall--
+	case !back && e.recall < len(e.history):
+		e.recall++
+	default:
+		return
+	}
+	e.input = nil
+	if e.recall < len(e.history) {
+		e.input = []rune(e.history[e.recall])
+	}
+	e.cursor = len(e.input)
+}
@@ -0,0 +1,149 @@
+package ui
+
+import (
+	"fmt"
+	"hash/fnv"
+	"strings"
+	"time"
+
+	"github.com/fatih/color"
+	"github.com/jennxsierra/dualnet-chat/internal/protocol"
+)
+
+// DefaultTimeFormat is the layout of the timestamp in front of every line,
+// hours and minutes.
+const DefaultTimeFormat = "15:04"
+
+// styles of the kinds of lines. They follow [color.NoColor], which --no-color,
+// NO_COLOR and "/color off" set.
+var (
+	timeStyle     = color.New(color.Faint)
+	roomStyle     = color.New(color.Bold)
+	directStyle   = color.New(color.FgHiMagenta, color.Bold)
+	joinStyle     = color.New(color.FgGreen)
+	leaveStyle    = color.New(color.FgHiBlack)
+	presenceStyle = color.New(color.Faint, color.Italic)
+	noticeStyle   = color.New(color.FgCyan)
+	errorStyle    = color.New(color.FgRed, color.Bold)
+	infoStyle     = color.New(color.Faint)
+	mentionStyle  = color.New(color.FgHiYellow, color.Bold)
+)
+
+// senderColors are the colors names are shown in, picked by a hash of the name
+// so everyone keeps theirs.
+var senderColors = []*color.Color{
+	color.New(color.FgRed),
+	color.New(color.FgGreen),
+	color.New(color.FgYellow),
+	color.New(color.FgBlue),
+	color.New(color.FgMagenta),
+	color.New(color.FgCyan),
+	color.New(color.FgHiRed),
+	color.New(color.FgHiGreen),
+	color.New(color.FgHiYellow),
+	color.New(color.FgHiBlue),
+	color.New(color.FgHiMagenta),
+	color.New(color.FgHiCyan),
+}
+
+// Format turns envelopes into the lines the terminal interfaces show: with a
+// local timestamp, senders in colors of their own and a style for each kind of
+// line. Control characters from the server are replaced, so nobody can send
+// escape sequences to the user's terminal.
+type Format struct {
+	// TimeFormat is the layout of the timestamp, as in [time.Time.Format], or
+	// empty for none.
+	TimeFormat string
+}
+
+// Envelope formats an envelope from the server. Messages are stamped with the
+// time the server received them, anything else with the time it arrived.
+func (f Format) Envelope(e protocol.Envelope) string {
+	return f.envelope(e, false)
+}
+
+// Mention formats a message that mentions the user, marked with a star so it
+// stands out even without colors.
+func (f Format) Mention(e protocol.Envelope) string {
+	return f.envelope(e, true)
+}
+
+// envelope does the work of Envelope and Mention.
+func (f Format) envelope(e protocol.Envelope, mention bool) string {
+	at := e.Time
+	if at.IsZero() {
+		at = time.Now()
+	}
+
+	var line string
+	switch e.Type {
+	case protocol.TypeMessage:
+		text := sanitize(e.Text)
+		if mention {
+			line = mentionStyle.Sprint("*") + " "
+			text = mentionStyle.Sprint(text)
+		}
+		if e.To != "" {
+			line += directStyle.Sprintf("[%s -> %s]:", sanitize(e.From), sanitize(e.To)) + " " + text
+			break
+		}
+		if e.Room != "" && e.Room != protocol.DefaultRoom {
+			line += roomStyle.Sprint("#"+sanitize(e.Room)) + " "
+		}
+		line += senderColor(e.From).Sprintf("[%s]:", sanitize(e.From)) + " " + text
+	case protocol.TypeJoin:
+		line = joinStyle.Sprint(sanitize(e.String()))
+	case protocol.TypeLeave:
+		line = leaveStyle.Sprint(sanitize(e.String()))
+	case protocol.TypePresence:
+		line = presenceStyle.Sprint(sanitize(e.String()))
+	case protocol.TypeError, protocol.TypeBye:
+		line = errorStyle.Sprint("[server]:") + " " + sanitize(e.Text)
+	default:
+		line = noticeStyle.Sprint("[server]:") + " " + sanitize(e.Text)
+	}
+	return f.stamp(at) + line
+}
+
+// Info formats a status line from the client itself.
+func (f Format) Info(text string) string {
+	return f.stamp(time.Now()) + infoStyle.Sprint("[info] "+sanitize(text))
+}
+
+// Error formats a problem noticed by the client itself.
+func (f Format) Error(text string) string {
+	return f.stamp(time.Now()) + errorStyle.Sprint("[error]") + " " + sanitize(text)
+}
+
+// stamp returns the timestamp in front of a line, with its trailing space.
+func (f Format) stamp(at time.Time) string {
+	if f.TimeFormat == "" {
+		return ""
+	}
+	return timeStyle.Sprint(at.Local().Format(f.TimeFormat)) + " "
+}
+
+// senderColor returns the color a name is shown in. Only the part before the
+// address counts, so users keep their color when they connect again.
+func senderColor(name string) *color.Color {
+	user, _, _ := strings.Cut(name, "@")
+	h := fnv.New32a()
+	fmt.Fprint(h, user)
+	return senderColors[h.Sum32()%uint32(len(senderColors))]
+}
+
+// sanitize replaces the control characters in text from the server, except
+// line breaks, so they cannot move the cursor or change colors.
+func sanitize(text string) string {
+	return strings.Map(func(r rune) rune {
+		switch {
+		case r == '\n':
+			return r
+		case r == '\t':
+			return ' '
+		case r < 0x20 || r == 0x7f || (r >= 0x80 && r < 0xa0):
+			return '�'
+		}
+		return r
+	}, text)
+}
@@ -0,0 +1,145 @@
+package ui
+
+import (
+	"unicode/utf8"
+)
+
+// key is a key press the screen reacts to.
+type key int
+
+const (
+	keyNone key = iota
+	keyRune     // a printable character
+	keyEnter
+	keyBackspace
+	keyDelete
+	keyLeft
+	keyRight
+	keyUp
+	keyDown
+	keyHome
+	keyEnd
+	keyPageUp
+	keyPageDown
+	keyTab
+	keyBacktab // shift-tab
+	keyInterrupt
+	keyEOF
+	keyKillLine // ctrl-u
+	keyKillWord // ctrl-w
+	keyKillEnd  // ctrl-k
+	keyRedraw   // ctrl-l
+	keyNewline  // alt+enter, a line break in the message
+	keyPasteStart
+	keyPasteEnd
+)
+
+// keypress is a decoded key, with the character for keyRune.
+type keypress struct {
+	key  key
+	rune rune
+}
+
+// escapes maps the escape sequences terminals send for special keys, without
+// the leading ESC, to the keys.
+var escapes = map[string]key{
+	"[A": keyUp, "[B": keyDown, "[C": keyRight, "[D": keyLeft,
+	"OA": keyUp, "OB": keyDown, "OC": keyRight, "OD": keyLeft,
+	"[H": keyHome, "[F": keyEnd, "OH": keyHome, "OF": keyEnd,
+	"[1~": keyHome, "[7~": keyHome, "[4~": keyEnd, "[8~": keyEnd,
+	"[3~": keyDelete, "[5~": keyPageUp, "[6~": keyPageDown, "[Z": keyBacktab,
+	"[200~": keyPasteStart, "[201~": keyPasteEnd, // bracketed paste
+}
+
+// decodeKeys decodes the keys in data. An incomplete escape sequence or
+// character at the end is returned as rest, to be completed by the next read.
+func decodeKeys(data []byte) (keys []keypress, rest []byte) {
+	for len(data) > 0 {
+		b := data[0]
+		switch {
+		case b == 0x1b:
+			k, n, complete := decodeEscape(data)
+			if !complete {
+				return keys, data
+			}
+			if k != keyNone {
+				keys = append(keys, keypress{key: k})
+			}
+			data = data[n:]
+			continue
+
+		case b == '\r' || b == '\n':
+			keys = append(keys, keypress{key: keyEnter})
+			if b == '\r' && len(data) > 1 && data[1] == '\n' {
+				data = data[1:] // a pasted Windows line break
+			}
+		case b == 0x7f || b == 0x08:
+			keys = append(keys, keypress{key: keyBackspace})
+		case b == '\t':
+			keys = append(keys, keypress{key: keyTab})
+		case b == 0x03:
+			keys = append(keys, keypress{key: keyInterrupt})
+		case b == 0x04:
+			keys = append(keys, keypress{key: keyEOF})
+		case b == 0x01:
+			keys = append(keys, keypress{key: keyHome})
+		case b == 0x05:
+			keys = append(keys, keypress{key: keyEnd})
+		case b == 0x02:
+			keys = append(keys, keypress{key: keyLeft})
+		case b == 0x06:
+			keys = append(keys, keypress{key: keyRight})
+		case b == 0x10:
+			keys = append(keys, keypress{key: keyUp})
+		case b == 0x0e:
+			keys = append(keys, keypress{key: keyDown})
+		case b == 0x15:
+			keys = append(keys, keypress{key: keyKillLine})
+		case b == 0x17:
+			keys = append(keys, keypress{key: keyKillWord})
+		case b == 0x0b:
+			keys = append(keys, keypress{key: keyKillEnd})
+		case b == 0x0c:
+			keys = append(keys, keypress{key: keyRedraw})
+		case b < 0x20:
+			// other control characters do nothing
+
+		default:
+			if !utf8.FullRune(data) {
+				return keys, data
+			}
+			r, n := utf8.DecodeRune(data)
+			if r != utf8.RuneError {
+				keys = append(keys, keypress{key: keyRune, rune: r})
+			}
+			data = data[n:]
+			continue
+		}
+		data = data[1:]
+	}
+	return keys, nil
+}
+
+// decodeEscape decodes the escape sequence at the start of data, returning
+// the key (keyNone if unknown), its length, and false if the sequence is cut
+// off.
+func decodeEscape(data []byte) (key, int, bool) {
+	if len(data) < 2 {
+		return keyNone, 0, false
+	}
+	switch data[1] {
+	case '\r', '\n':
+		return keyNewline, 2, true
+	case '[', 'O':
+	default:
+		return keyNone, 2, true // alt+key
+	}
+
+	// CSI and SS3 sequences end with a byte in 0x40–0x7e
+	for i := 2; i < len(data); i++ {
+		if data[i] >= 0x40 && data[i] <= 0x7e {
+			return escapes[string(data[1:i+1])], i + 1, true
+		}
+	}
+	return keyNone, 0, false
+}
@@ -0,0 +1,134 @@
+package ui
+
+import (
+	"fmt"
+	"slices"
+	"strings"
+	"unicode/utf8"
+
+	"github.com/chzyer/readline"
+)
+
+// Members are the members of a room, as the full-screen interface lists them
+// beside its messages.
+type Members []string
+
+// Add returns the members with another one added, sorted, unless they are
+// there already.
+func (m Members) Add(name string) Members {
+	if slices.Contains(m, name) {
+		return m
+	}
+	m = append(m, name)
+	slices.Sort(m)
+	return m
+}
+
+// Remove returns the members without one of them.
+func (m Members) Remove(name string) Members {
+	return slices.DeleteFunc(m, func(member string) bool { return member == name })
+}
+
+// Sidebar returns the rows of the member list, at most height of them and
+// width columns each: a header with the count, then a member per row, dimmed
+// if they are away.
+func (m Members) Sidebar(away map[string]bool, height, width int) []string {
+	if height <= 0 {
+		return nil
+	}
+	header, _ := Fit(fmt.Sprintf(" Members (%d)", len(m)), width)
+	rows := []string{bold + header + reset}
+	for _, member := range m[:min(len(m), height-1)] {
+		name, _ := Fit(" "+strings.ReplaceAll(sanitize(member), "\n", " "), width)
+		if away[member] {
+			name = dim + name + reset
+		}
+		rows = append(rows, name)
+	}
+	return rows
+}
+
+// runeWidth returns the number of columns a character takes.
+func runeWidth(r rune) int {
+	return readline.Runes{}.Width(r)
+}
+
+// runesWidth returns the number of columns a string of characters takes.
+func runesWidth(rs []rune) int {
+	return readline.Runes{}.WidthAll(rs)
+}
+
+// Fit cuts text to at most width columns, returning it and the columns used.
+// Escape sequences take no columns and are never cut.
+func Fit(text string, width int) (string, int) {
+	used := 0
+	for i := 0; i < len(text); {
+		if n := escapeLen(text[i:]); n > 0 {
+			i += n
+			continue
+		}
+		r, size := utf8.DecodeRuneInString(text[i:])
+		w := runeWidth(r)
+		if used+w > width {
+			return text[:i], used
+		}
+		used += w
+		i += size
+	}
+	return text, used
+}
+
+// escapeLen returns the length of the CSI escape sequence, such as a color,
+// at the start of text, or 0 if there is none.
+func escapeLen(text string) int {
+	if !strings.HasPrefix(text, "\x1b[") {
+		return 0
+	}
+	for i := 2; i < len(text); i++ {
+		if text[i] >= 0x40 && text[i] <= 0x7e {
+			return i + 1
+		}
+	}
+	return 0
+}
+
+// style returns the escape sequences in effect at the end of text, those
+// since the last reset, to carry a style over to the next row.
+func style(text string) string {
+	var seqs []string
+	for i := 0; i < len(text); i++ {
+		n := escapeLen(text[i:])
+		if n == 0 {
+			continue
+		}
+		if seq := text[i : i+n]; seq == reset || seq == "\x1b[m" {
+			seqs = nil
+		} else if strings.HasSuffix(seq, "m") {
+			seqs = append(seqs, seq)
+		}
+		i += n - 1
+	}
+	return strings.Join(seqs, "")
+}
+
+// Wrap splits a line into rows of at most width columns, breaking at spaces
+// where possible.
+func Wrap(line string, width int) []string {
+	var rows []string
+	for {
+		row, used := Fit(line, width)
+		if len(row) == len(line) {
+			return append(rows, line)
+		}
+		if used == 0 {
+			// not even one character fits
+			return append(rows, line)
+		}
+		// a row that ends right before a space is already cut between words
+		if i := strings.LastIndexByte(row, ' '); i > 0 && line[len(row)] != ' ' {
+			row = row[:i]
+		}
+		rows = append(rows, row)
+		line = style(row) + strings.TrimLeft(line[len(row):], " ")
+	}
+}
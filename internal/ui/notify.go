@@ -0,0 +1,56 @@
+package ui
+
+import (
+	"fmt"
+	"strings"
+)
+
+// Notification is how the terminal tells the user they were mentioned.
+type Notification string
+
+// the ways to notify the user
+const (
+	NotifyOff    Notification = "off"    // stay silent
+	NotifyBell   Notification = "bell"   // ring the terminal bell
+	NotifyOSC9   Notification = "osc9"   // desktop notification of iTerm2, kitty, Windows Terminal and others
+	NotifyOSC777 Notification = "osc777" // desktop notification of VTE terminals, urxvt and foot
+)
+
+// Notifications lists the ways to notify the user.
+var Notifications = []Notification{NotifyOff, NotifyBell, NotifyOSC9, NotifyOSC777}
+
+// ParseNotification parses the name of a way to notify the user.
+func ParseNotification(name string) (Notification, error) {
+	for _, n := range Notifications {
+		if string(n) == name {
+			return n, nil
+		}
+	}
+	return "", fmt.Errorf("%q is none of off, bell, osc9 and osc777", name)
+}
+
+// sequence returns what to write to the terminal to notify the user, which
+// the terminal does not show.
+func (n Notification) sequence(title, text string) string {
+	switch n {
+	case NotifyBell:
+		return "\a"
+	case NotifyOSC9:
+		return "\x1b]9;" + oscText(title+": "+text) + "\a"
+	case NotifyOSC777:
+		// the title ends at the first semicolon
+		return "\x1b]777;notify;" + strings.ReplaceAll(oscText(title), ";", ",") + ";" + oscText(text) + "\a"
+	}
+	return ""
+}
+
+// oscText makes text safe to put in an escape sequence, on a single line and
+// not too long for a notification.
+func oscText(text string) string {
+	const maxRunes = 200
+	text = strings.ReplaceAll(sanitize(text), "\n", " ")
+	if runes := []rune(text); len(runes) > maxRunes {
+		text = string(runes[:maxRunes-1]) + "…"
+	}
+	return text
+}
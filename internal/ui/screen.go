@@ -0,0 +1,764 @@
+package ui
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/chzyer/readline"
+	"github.com/jennxsierra/dualnet-chat/internal/protocol"
+)
+
+// ErrNotTerminal is returned by [NewScreen] when standard input or output is
+// not a terminal.
+var ErrNotTerminal = errors.New("the full-screen interface needs a terminal")
+
+// maxScrollback is how many lines are kept for each room.
+const maxScrollback = 2000
+
+// sidebarWidth is the width of the member list, which is hidden on terminals
+// narrower than minSidebarTerminal.
+const (
+	sidebarWidth       = 20
+	minSidebarTerminal = 60
+)
+
+// escape sequences
+const (
+	altScreenOn  = "\x1b[?1049h"
+	altScreenOff = "\x1b[?1049l"
+	pasteOn      = "\x1b[?2004h" // bracketed paste
+	pasteOff     = "\x1b[?2004l"
+	hideCursor   = "\x1b[?25l"
+	showCursor   = "\x1b[?25h"
+	clearLine    = "\x1b[K"
+	reverse      = "\x1b[7m"
+	bold         = "\x1b[1m"
+	dim          = "\x1b[2m"
+	reset        = "\x1b[0m"
+)
+
+// Screen is a full-screen terminal interface: a tab for each room joined, a
+// scrollable message pane per room, the members of the current room in a
+// sidebar, a status bar and an input line.
+//
+// Switching tabs sends "/join <room>" for a room the user is already in,
+// which the server answers by making it the room typed messages go to. The
+// server sends the members of every room the user joins, and of their rooms
+// when they connect, which are kept up to date from the joins and leaves that
+// follow.
+type Screen struct {
+	name      string // the user's name, to recognize their own joins and leaves
+	transport string
+	server    string
+
+	in    *os.File
+	out   io.Writer
+	saved *readline.State
+
+	lines     chan string   // entered lines and commands, returned by ReadLine
+	done      chan struct{} // closed by Close
+	closeOnce sync.Once
+
+	mu       sync.Mutex
+	width    int
+	height   int
+	rooms    []*roomView // in the order they were joined
+	current  int         // index in rooms, -1 before the welcome
+	early    []string    // lines shown before any room is known
+	away     map[string]bool
+	status   Status
+	format   Format
+	complete Completer // what Tab completes words with
+
+	edit   LineEditor
+	closed bool
+
+	pasting bool // between the start and end of a bracketed paste
+}
+
+// roomView is a room's tab.
+type roomView struct {
+	name    string
+	lines   []string
+	members Members
+	unread  bool
+	scroll  int // rows scrolled up from the newest line
+
+	mentioned bool // a mention arrived while another tab was shown
+}
+
+// NewScreen takes over the terminal for a user with the given name, connected
+// to server over transport ("tcp" or "udp").
+func NewScreen(name, transport, server string) (*Screen, error) {
+	in, out := int(os.Stdin.Fd()), int(os.Stdout.Fd())
+	if !readline.IsTerminal(in) || !readline.IsTerminal(out) {
+		return nil, ErrNotTerminal
+	}
+	saved, err := readline.MakeRaw(in)
+	if err != nil {
+		return nil, err
+	}
+
+	s := &Screen{
+		name:      name,
+		transport: transport,
+		server:    server,
+		in:        os.Stdin,
+		out:       os.Stdout,
+		saved:     saved,
+		lines:     make(chan string, 16),
+		done:      make(chan struct{}),
+		current:   -1,
+		away:      make(map[string]bool),
+		status:    Status{State: "connecting"},
+		format:    Format{TimeFormat: DefaultTimeFormat},
+	}
+	s.width, s.height = s.size()
+
+	io.WriteString(s.out, altScreenOn+pasteOn)
+	readline.DefaultOnWidthChanged(s.resize)
+	go s.readInput()
+
+	s.mu.Lock()
+	s.draw()
+	s.mu.Unlock()
+	return s, nil
+}
+
+// size returns the size of the terminal, or a classic 80x24 if it is unknown.
+func (s *Screen) size() (int, int) {
+	width, height, err := readline.GetSize(int(os.Stdout.Fd()))
+	if err != nil || width <= 0 || height <= 0 {
+		return 80, 24
+	}
+	return width, height
+}
+
+// resize redraws the screen for the terminal's new size.
+func (s *Screen) resize() {
+	width, height := s.size()
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.width, s.height = width, height
+	s.draw()
+}
+
+// ReadLine returns the next line entered, or a command the screen sends on the
+// user's behalf, such as switching rooms.
+func (s *Screen) ReadLine() (string, error) {
+	select {
+	case line := <-s.lines:
+		return line, nil
+	case <-s.done:
+		return "", io.EOF
+	}
+}
+
+// Show adds an envelope to the pane of its room and keeps the tabs and member
+// lists up to date.
+func (s *Screen) Show(e protocol.Envelope) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.show(e, false)
+	s.draw()
+}
+
+// ShowMention adds a highlighted message to the pane of its room, and marks
+// its tab if another one is shown.
+func (s *Screen) ShowMention(e protocol.Envelope) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.show(e, true)
+	s.draw()
+}
+
+// ShowSent adds a message the user sent to the pane of its room, as the server
+// does not send it back.
+func (s *Screen) ShowSent(e protocol.Envelope) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.show(e, false)
+	s.draw()
+}
+
+// Notify writes the notification's escape sequence to the terminal.
+func (s *Screen) Notify(n Notification, title, text string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if seq := n.sequence(title, text); seq != "" && !s.closed {
+		io.WriteString(s.out, seq)
+	}
+}
+
+// show does the work of Show and ShowMention. The caller holds mu.
+func (s *Screen) show(e protocol.Envelope, mention bool) {
+	room := s.room(e.Room)
+	switch e.Type {
+	case protocol.TypeWelcome:
+		// keep the tabs of rooms the server still has us in, with their scrollback
+		var rooms []*roomView
+		for _, name := range e.Rooms {
+			r := s.room(name)
+			if r == nil {
+				r = &roomView{name: name}
+			}
+			rooms = append(rooms, r)
+		}
+		s.setRooms(rooms)
+		room = nil
+
+	case protocol.TypeJoin:
+		if e.From == s.name {
+			if room != nil {
+				// the server confirms a switch between tabs, which needs no line
+				s.switchTo(slices.Index(s.rooms, room))
+				return
+			}
+			room = &roomView{name: e.Room}
+			s.rooms = append(s.rooms, room)
+			s.switchTo(len(s.rooms) - 1)
+		} else if room != nil {
+			room.members = room.members.Add(e.From)
+		}
+
+	case protocol.TypeLeave:
+		if e.From == s.name && room != nil {
+			s.setRooms(slices.DeleteFunc(slices.Clone(s.rooms), func(r *roomView) bool { return r == room }))
+			room = nil
+		} else if room != nil {
+			room.members = room.members.Remove(e.From)
+		}
+
+	case protocol.TypePresence:
+		s.away[e.From] = e.Text == protocol.PresenceAway
+
+	case protocol.TypeMembers:
+		// the sidebar shows them, so there is no line to add
+		if room != nil {
+			room.members = e.Members
+		}
+		return
+
+	case protocol.TypeNotice:
+		// the answer to "/who" is as fresh as it gets
+		if e.Members != nil && room != nil {
+			room.members = e.Members
+		}
+	}
+
+	// direct messages and lines without a room of their own go to the current one
+	if e.To != "" || room == nil {
+		room = s.currentRoom()
+	}
+	if !mention {
+		s.add(room, s.format.Envelope(e))
+		return
+	}
+	s.add(room, s.format.Mention(e))
+	if room != nil && room != s.currentRoom() {
+		room.mentioned = true
+	}
+}
+
+// Info adds a status line to the current room's pane.
+func (s *Screen) Info(text string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.add(s.currentRoom(), s.format.Info(text))
+	s.draw()
+}
+
+// Error adds a problem to the current room's pane.
+func (s *Screen) Error(text string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.add(s.currentRoom(), s.format.Error(text))
+	s.draw()
+}
+
+// SetStatus updates the status bar.
+func (s *Screen) SetStatus(status Status) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.status = status
+	if status.Server != "" {
+		s.server = status.Server
+	}
+	s.draw()
+}
+
+// SetTimeFormat sets the layout of the timestamps of new lines.
+func (s *Screen) SetTimeFormat(layout string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.format.TimeFormat = layout
+}
+
+// SetCompleter sets what Tab completes with.
+func (s *Screen) SetCompleter(c Completer) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.complete = c
+}
+
+// Clear empties the current room's pane.
+func (s *Screen) Clear() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if r := s.currentRoom(); r != nil {
+		r.lines, r.scroll = nil, 0
+	} else {
+		s.early = nil
+	}
+	s.draw()
+}
+
+// Close restores the terminal and makes ReadLine return [io.EOF].
+func (s *Screen) Close() {
+	s.closeOnce.Do(func() {
+		s.mu.Lock()
+		s.closed = true
+		io.WriteString(s.out, reset+showCursor+pasteOff+altScreenOff)
+		readline.Restore(int(s.in.Fd()), s.saved)
+		s.mu.Unlock()
+		close(s.done)
+		fmt.Fprintln(s.out, "Goodbye!")
+	})
+}
+
+// send hands a line to ReadLine, unless the screen is closed first.
+func (s *Screen) send(line string) {
+	select {
+	case s.lines <- line:
+	case <-s.done:
+	}
+}
+
+// room returns the tab of a room, or nil.
+func (s *Screen) room(name string) *roomView {
+	for _, r := range s.rooms {
+		if r.name == name {
+			return r
+		}
+	}
+	return nil
+}
+
+// currentRoom returns the tab being looked at, or nil before the welcome.
+func (s *Screen) currentRoom() *roomView {
+	if s.current < 0 || s.current >= len(s.rooms) {
+		return nil
+	}
+	return s.rooms[s.current]
+}
+
+// setRooms replaces the tabs, staying on the current room if it is still
+// there.
+func (s *Screen) setRooms(rooms []*roomView) {
+	current := s.currentRoom()
+	s.rooms = rooms
+	if i := slices.Index(rooms, current); i >= 0 {
+		s.current = i
+	} else {
+		s.switchTo(len(rooms) - 1)
+	}
+
+	// the lines shown before the welcome go to the first room
+	if len(s.early) > 0 && len(rooms) > 0 {
+		rooms[0].lines = append(s.early, rooms[0].lines...)
+		s.early = nil
+	}
+}
+
+// switchTo makes a tab the current one.
+func (s *Screen) switchTo(i int) {
+	s.current = i
+	if r := s.currentRoom(); r != nil {
+		r.unread, r.mentioned = false, false
+	}
+}
+
+// add appends a formatted line to a room's pane, or to the early lines if
+// there is no room yet. A pane scrolled up stays where it is.
+func (s *Screen) add(r *roomView, line string) {
+	// each line of a multi-line message starts a row of its own, in the
+	// style the previous one ended with
+	lines := strings.Split(line, "\n")
+	for i := 1; i < len(lines); i++ {
+		lines[i] = style(lines[i-1]) + lines[i]
+	}
+	if r == nil {
+		s.early = append(s.early, lines...)
+		return
+	}
+
+	r.lines = append(r.lines, lines...)
+	if len(r.lines) > maxScrollback {
+		r.lines = slices.Delete(r.lines, 0, len(r.lines)-maxScrollback)
+	}
+	if r.scroll > 0 {
+		for _, l := range lines {
+			r.scroll += len(Wrap(l, s.paneWidth()))
+		}
+	}
+	if r != s.currentRoom() {
+		r.unread = true
+	}
+}
+
+// readInput reads key presses until the screen is closed.
+func (s *Screen) readInput() {
+	buffer := make([]byte, 4096)
+	var pending []byte
+	for {
+		n, err := s.in.Read(buffer)
+		if err != nil {
+			s.Close()
+			return
+		}
+
+		var keys []keypress
+		keys, pending = decodeKeys(append(pending, buffer[:n]...))
+		pending = slices.Clone(pending)
+		for _, k := range keys {
+			if !s.handleKey(k) {
+				return
+			}
+		}
+	}
+}
+
+// handleKey edits the input line, scrolls or switches tabs. It returns false
+// once the user quits.
+func (s *Screen) handleKey(k keypress) bool {
+	s.mu.Lock()
+	if s.closed {
+		s.mu.Unlock()
+		return false
+	}
+
+	// pasted text goes into the input as it is, line breaks and all, to be
+	// sent as one message
+	if s.pasting {
+		s.paste(k)
+		s.draw()
+		s.mu.Unlock()
+		return true
+	}
+
+	var line string
+	switch k.key {
+	case keyRune:
+		s.edit.Insert(k.rune)
+	case keyNewline:
+		s.edit.Insert('\n')
+	case keyPasteStart:
+		s.pasting = true
+	case keyEnter:
+		line = s.edit.Enter()
+	case keyBackspace:
+		s.edit.Backspace()
+	case keyDelete:
+		s.edit.Delete()
+	case keyLeft:
+		s.edit.Left()
+	case keyRight:
+		s.edit.Right()
+	case keyHome:
+		s.edit.Home()
+	case keyEnd:
+		s.edit.End()
+	case keyUp, keyDown:
+		s.edit.Browse(k.key == keyUp)
+	case keyKillLine:
+		s.edit.KillLine()
+	case keyKillEnd:
+		s.edit.KillEnd()
+	case keyKillWord:
+		s.edit.KillWord()
+	case keyPageUp, keyPageDown:
+		s.scroll(k.key == keyPageUp)
+	case keyTab, keyBacktab:
+		// complete the "@name", "#room" or "/command" being typed, or else switch tabs
+		if k.key == keyTab && s.completeWord() {
+			break
+		}
+		if len(s.rooms) > 1 {
+			step := 1
+			if k.key == keyBacktab {
+				step = len(s.rooms) - 1
+			}
+			s.switchTo((max(s.current, 0) + step) % len(s.rooms))
+			line = "/join " + s.rooms[s.current].name
+		}
+	case keyInterrupt:
+		s.mu.Unlock()
+		s.Close()
+		return false
+	case keyEOF:
+		if s.edit.Empty() {
+			s.mu.Unlock()
+			s.Close()
+			return false
+		}
+		s.edit.Delete()
+	case keyRedraw:
+		io.WriteString(s.out, "\x1b[2J")
+	}
+	s.draw()
+	s.mu.Unlock()
+
+	if line != "" {
+		s.send(line)
+	}
+	return true
+}
+
+// paste adds a key of a bracketed paste to the input, until the paste ends.
+// The caller holds mu.
+func (s *Screen) paste(k keypress) {
+	var r rune
+	switch k.key {
+	case keyRune:
+		r = k.rune
+	case keyEnter, keyNewline:
+		r = '\n'
+	case keyTab:
+		r = '\t'
+	case keyPasteEnd:
+		s.pasting = false
+		return
+	default:
+		return // other control characters are dropped
+	}
+	s.edit.Insert(r)
+}
+
+// completeWord completes the word before the cursor, and reports whether it
+// could be completed. With several completions, it completes what they share
+// and lists them.
+func (s *Screen) completeWord() bool {
+	rest, n := completions(s.complete, s.edit.input, s.edit.cursor)
+	if n == 0 {
+		return false
+	}
+
+	word := string(s.edit.input[s.edit.cursor-n : s.edit.cursor])
+	s.edit.Insert(commonPrefix(rest)...)
+	if len(rest) > 1 {
+		var words []string
+		for _, r := range rest {
+			words = append(words, word+strings.TrimSpace(string(r)))
+		}
+		s.add(s.currentRoom(), s.format.Info(strings.Join(words, "  ")))
+	}
+	return true
+}
+
+// scroll moves the current pane up or down by almost a page.
+func (s *Screen) scroll(up bool) {
+	r := s.currentRoom()
+	if r == nil {
+		return
+	}
+	page := max(s.paneHeight()-1, 1)
+	if !up {
+		r.scroll = max(r.scroll-page, 0)
+		return
+	}
+	rows := 0
+	for _, line := range r.lines {
+		rows += len(Wrap(line, s.paneWidth()))
+	}
+	r.scroll = min(r.scroll+page, max(rows-s.paneHeight(), 0))
+}
+
+// sidebar reports whether the member list fits on the screen.
+func (s *Screen) sidebar() bool {
+	return s.width >= minSidebarTerminal
+}
+
+// paneWidth is the width of the message pane.
+func (s *Screen) paneWidth() int {
+	if s.sidebar() {
+		return max(s.width-sidebarWidth-1, 1)
+	}
+	return max(s.width, 1)
+}
+
+// paneHeight is the height of the message pane, between the tabs at the top
+// and the status bar and input line at the bottom.
+func (s *Screen) paneHeight() int {
+	return max(s.height-3, 1)
+}
+
+// draw renders the whole screen. The caller holds mu.
+func (s *Screen) draw() {
+	if s.closed {
+		return
+	}
+	var b strings.Builder
+	b.WriteString(hideCursor)
+	moveTo(&b, 1, 1)
+	s.drawTabs(&b)
+	s.drawPane(&b)
+	moveTo(&b, s.height-1, 1)
+	s.drawStatus(&b)
+	moveTo(&b, s.height, 1)
+	col := s.drawInput(&b)
+	moveTo(&b, s.height, col)
+	b.WriteString(showCursor)
+	io.WriteString(s.out, b.String())
+}
+
+// drawTabs renders the room tabs, marking the current one and those with
+// unread messages or mentions.
+func (s *Screen) drawTabs(b *strings.Builder) {
+	used := 0
+	for i, r := range s.rooms {
+		label := " #" + r.name + " "
+		switch {
+		case r.mentioned:
+			label = " #" + r.name + "! "
+		case r.unread:
+			label = " #" + r.name + "+ "
+		}
+		label, width := Fit(label, s.width-used)
+		if width == 0 {
+			break
+		}
+		switch {
+		case i == s.current:
+			b.WriteString(reverse + label + reset)
+		case r.unread:
+			b.WriteString(bold + label + reset)
+		default:
+			b.WriteString(label)
+		}
+		used += width
+	}
+	if len(s.rooms) == 0 {
+		label, _ := Fit(" dualnet-chat ", s.width)
+		b.WriteString(dim + label + reset)
+	}
+	b.WriteString(clearLine)
+}
+
+// drawPane renders the newest lines of the current room that fit, or older
+// ones if the pane is scrolled up, with the member list beside them.
+func (s *Screen) drawPane(b *strings.Builder) {
+	width, height := s.paneWidth(), s.paneHeight()
+
+	lines := s.early
+	var members Members
+	scroll := 0
+	if r := s.currentRoom(); r != nil {
+		lines, members, scroll = r.lines, r.members, r.scroll
+	}
+
+	// wrap lines from the newest back until the pane and scrolled rows are full
+	var rows []string
+	for i := len(lines) - 1; i >= 0 && len(rows) < height+scroll; i-- {
+		rows = append(Wrap(lines[i], width), rows...)
+	}
+	end := max(len(rows)-scroll, 0)
+	rows = rows[max(end-height, 0):end]
+	sidebar := members.Sidebar(s.away, height, sidebarWidth)
+
+	for i := range height {
+		moveTo(b, i+2, 1)
+		// the newest lines sit at the bottom of the pane
+		if j := i - (height - len(rows)); j >= 0 {
+			text, w := Fit(rows[j], width)
+			b.WriteString(text + reset + strings.Repeat(" ", width-w))
+		} else {
+			b.WriteString(strings.Repeat(" ", width))
+		}
+
+		if !s.sidebar() {
+			continue
+		}
+		b.WriteString(dim + "│" + reset)
+		if i < len(sidebar) {
+			b.WriteString(sidebar[i])
+		}
+		b.WriteString(clearLine)
+	}
+}
+
+// drawStatus renders the status bar: transport, connection state, round-trip
+// time, who the user is and where they are connected, mentions and file
+// transfers.
+func (s *Screen) drawStatus(b *strings.Builder) {
+	state := s.status.State
+	switch rtt := s.status.RTT; {
+	case rtt >= time.Millisecond:
+		state += " " + rtt.Round(time.Millisecond).String()
+	case rtt > 0:
+		state += " <1ms"
+	}
+
+	parts := []string{s.transport, state, s.name + " → " + s.server}
+	switch n := s.status.Mentions; {
+	case n == 1:
+		parts = append(parts, "1 mention")
+	case n > 1:
+		parts = append(parts, fmt.Sprintf("%d mentions", n))
+	}
+	if s.status.Transfers != "" {
+		parts = append(parts, s.status.Transfers)
+	}
+	if r := s.currentRoom(); r != nil && r.scroll > 0 {
+		parts = append(parts, fmt.Sprintf("scrolled up %d, PgDn for newer", r.scroll))
+	} else {
+		parts = append(parts, "Tab switches rooms, PgUp scrolls, Ctrl-C quits")
+	}
+
+	text, width := Fit(" "+strings.Join(parts, " │ "), s.width)
+	b.WriteString(reverse + text + strings.Repeat(" ", s.width-width) + reset)
+}
+
+// drawInput renders the input line, scrolled sideways to keep the cursor in
+// view, and returns the cursor's column.
+func (s *Screen) drawInput(b *strings.Builder) int {
+	const prompt = "> "
+	room := ""
+	if r := s.currentRoom(); r != nil {
+		room = "#" + r.name + " "
+	}
+	prefix, prefixWidth := Fit(room+prompt, s.width/2)
+	avail := max(s.width-prefixWidth-1, 1)
+
+	// line breaks show as arrows and tabs as spaces, keeping the input on one row
+	input := slices.Clone(s.edit.input)
+	for i, r := range input {
+		switch r {
+		case '\n':
+			input[i] = '↵'
+		case '\t':
+			input[i] = ' '
+		}
+	}
+
+	// start far enough into the input for the cursor to fit
+	start, cursorWidth := 0, runesWidth(input[:s.edit.cursor])
+	for cursorWidth > avail {
+		cursorWidth -= runeWidth(input[start])
+		start++
+	}
+	text, _ := Fit(string(input[start:]), avail)
+
+	b.WriteString(bold + prefix + reset + text + clearLine)
+	return prefixWidth + cursorWidth + 1
+}
+
+// moveTo moves the cursor to a row and column, counted from 1.
+func moveTo(b *strings.Builder, row, col int) {
+	fmt.Fprintf(b, "\x1b[%d;%dH", row, col)
+}
@@ -0,0 +1,278 @@
+package ui
+
+import (
+	"bufio"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"regexp"
+	"sync"
+	"time"
+
+	"github.com/jennxsierra/dualnet-chat/internal/protocol"
+)
+
+var (
+	// ErrNoWelcome is reported by [Script.Err] when the server did not accept
+	// the client within the timeout.
+	ErrNoWelcome = errors.New("the server did not answer")
+
+	// ErrDisconnected is reported by [Script.Err] when the connection was lost
+	// or closed by the server before the script finished.
+	ErrDisconnected = errors.New("disconnected from the server")
+
+	// ErrTimeout is reported by [Script.Err] when the replies waited for did
+	// not arrive within the timeout.
+	ErrTimeout = errors.New("timed out waiting for replies")
+)
+
+// Script drives a client without a terminal, for CI jobs and cron: it sends
+// Lines and then the lines of Input, waits for replies if asked to, and writes
+// every envelope it receives to its output as a JSON line. Status lines go to
+// its log. Set its fields before the client starts.
+type Script struct {
+	Lines   []string       // sent first, e.g. from --message
+	Input   io.Reader      // read line by line after Lines, nil for none
+	Delay   time.Duration  // pause between lines, to stay under the rate limit
+	Replies int            // messages to wait for once everything is sent
+	Match   *regexp.Regexp // text of a message to wait for, nil for none
+	Timeout time.Duration  // how long to wait for the welcome and the replies
+
+	out *json.Encoder
+	log io.Writer
+
+	mu       sync.Mutex
+	welcomed chan struct{} // closed on the server's welcome
+	answered chan struct{} // closed once the replies to the latest line arrived
+	done     chan struct{} // closed by Close
+	input    chan string   // lines of Input, closed at its end
+	sent     bool          // a line was handed out, so the next waits Delay
+	finished bool          // everything was sent and waited for
+	received int           // messages received since the latest line
+	err      error         // why the script failed
+
+	closeOnce sync.Once
+	startOnce sync.Once
+}
+
+// NewScript returns a script UI writing envelopes to out and status lines to
+// log.
+func NewScript(out, log io.Writer) *Script {
+	return &Script{
+		Timeout:  10 * time.Second,
+		out:      json.NewEncoder(out),
+		log:      log,
+		welcomed: make(chan struct{}),
+		answered: make(chan struct{}),
+		done:     make(chan struct{}),
+	}
+}
+
+// ReadLine returns the next line to send, once the server has welcomed the
+// client. After the last one it waits for the replies, then returns [io.EOF].
+func (s *Script) ReadLine() (string, error) {
+	s.startOnce.Do(s.start)
+
+	timeout := time.NewTimer(s.Timeout)
+	defer timeout.Stop()
+	select {
+	case <-s.welcomed:
+	case <-s.done:
+		return "", io.EOF
+	case <-timeout.C:
+		s.fail(ErrNoWelcome)
+		return "", io.EOF
+	}
+
+	// keep successive lines apart so the server does not drop them
+	s.mu.Lock()
+	sent := s.sent
+	s.mu.Unlock()
+	if sent && s.Delay > 0 {
+		select {
+		case <-time.After(s.Delay):
+		case <-s.done:
+			return "", io.EOF
+		}
+	}
+
+	if line, ok := s.next(); ok {
+		return line, nil
+	}
+	s.wait()
+	return "", io.EOF
+}
+
+// start begins reading Input, which may block, in the background.
+func (s *Script) start() {
+	s.input = make(chan string)
+	if s.Input == nil {
+		close(s.input)
+		return
+	}
+	go func() {
+		defer close(s.input)
+		scanner := bufio.NewScanner(s.Input)
+		for scanner.Scan() {
+			select {
+			case s.input <- scanner.Text():
+			case <-s.done:
+				return
+			}
+		}
+	}()
+}
+
+// next returns the next line of Lines or Input, or false after the last one.
+func (s *Script) next() (string, bool) {
+	s.mu.Lock()
+	if len(s.Lines) > 0 {
+		line := s.Lines[0]
+		s.Lines = s.Lines[1:]
+		s.sending()
+		s.mu.Unlock()
+		return line, true
+	}
+	s.mu.Unlock()
+
+	select {
+	case line, ok := <-s.input:
+		if ok {
+			s.mu.Lock()
+			s.sending()
+			s.mu.Unlock()
+		}
+		return line, ok
+	case <-s.done:
+		return "", false
+	}
+}
+
+// sending records that a line is handed out. Only what arrives after the last
+// line counts as a reply, so messages received earlier, such as the answers to
+// previous lines, are forgotten. The caller holds mu.
+func (s *Script) sending() {
+	s.sent = true
+	s.received = 0
+	select {
+	case <-s.answered:
+		s.answered = make(chan struct{})
+	default:
+	}
+}
+
+// wait waits for the replies once everything is sent, and marks the script
+// finished unless they do not arrive in time.
+func (s *Script) wait() {
+	if s.Replies > 0 || s.Match != nil {
+		s.mu.Lock()
+		answered := s.answered
+		s.mu.Unlock()
+		select {
+		case <-answered:
+		case <-s.done:
+			return
+		case <-time.After(s.Timeout):
+			s.fail(ErrTimeout)
+			return
+		}
+	}
+	s.mu.Lock()
+	s.finished = true
+	s.mu.Unlock()
+}
+
+// Show writes an envelope as a JSON line and counts it if it is a message.
+func (s *Script) Show(e protocol.Envelope) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.out.Encode(e)
+
+	switch e.Type {
+	case protocol.TypeWelcome:
+		select {
+		case <-s.welcomed:
+		default:
+			close(s.welcomed)
+		}
+	case protocol.TypeMessage:
+		s.received++
+		if s.received >= s.Replies && (s.Match == nil || s.Match.MatchString(e.Text)) {
+			select {
+			case <-s.answered:
+			default:
+				close(s.answered)
+			}
+		}
+	}
+}
+
+// ShowMention writes a message like Show does; the JSON line is the same.
+func (s *Script) ShowMention(e protocol.Envelope) {
+	s.Show(e)
+}
+
+// ShowSent does nothing, as the script knows what it sent.
+func (s *Script) ShowSent(e protocol.Envelope) {}
+
+// Notify does nothing, as nobody is watching.
+func (s *Script) Notify(n Notification, title, text string) {}
+
+// Info writes a status line to the log.
+func (s *Script) Info(text string) {
+	fmt.Fprintln(s.log, "[info] "+text)
+}
+
+// Error writes a problem to the log.
+func (s *Script) Error(text string) {
+	fmt.Fprintln(s.log, "[error] "+text)
+}
+
+// SetStatus ends the script when the connection is lost, rather than
+// reconnecting in the background as the interactive UIs do.
+func (s *Script) SetStatus(st Status) {
+	if st.State != "connected" && st.State != "degraded" {
+		s.fail(ErrDisconnected)
+		s.Close()
+	}
+}
+
+// Clear does nothing, as what was written cannot be taken back.
+func (s *Script) Clear() {}
+
+// SetCompleter does nothing, as nobody types into a script.
+func (s *Script) SetCompleter(c Completer) {}
+
+// SetTimeFormat does nothing, as the envelopes written carry their time.
+func (s *Script) SetTimeFormat(layout string) {}
+
+// Close ends the script. Closing it before it finished, e.g. because the
+// server said goodbye, is reported by [Script.Err].
+func (s *Script) Close() {
+	s.closeOnce.Do(func() {
+		s.mu.Lock()
+		if !s.finished && s.err == nil {
+			s.err = ErrDisconnected
+		}
+		s.mu.Unlock()
+		close(s.done)
+	})
+}
+
+// Err returns why the script failed, or nil if everything was sent and the
+// replies arrived.
+func (s *Script) Err() error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.err
+}
+
+// fail records the first reason the script failed.
+func (s *Script) fail(err error) {
+	s.mu.Lock()
+	if s.err == nil {
+		s.err = err
+	}
+	s.mu.Unlock()
+}
@@ -0,0 +1,299 @@
+// Package ui is how the chat clients talk to their users: through a readline
+// prompt with messages printed above it ([Line]), through a full-screen
+// terminal interface ([Screen]), or through scripts without a terminal
+// ([Script]).
+package ui
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+	"sync"
+	"time"
+	"unicode/utf8"
+
+	"github.com/chzyer/readline"
+	"github.com/jennxsierra/dualnet-chat/internal/protocol"
+)
+
+// UI shows what happens in the chat and reads what the user types. Its
+// methods are safe to call from any goroutine.
+type UI interface {
+	// ReadLine returns the next line the user entered, or [io.EOF] once they
+	// quit or the UI is closed.
+	ReadLine() (string, error)
+
+	// Show displays an envelope from the server.
+	Show(e protocol.Envelope)
+
+	// ShowMention displays a message that mentions the user, highlighted.
+	ShowMention(e protocol.Envelope)
+
+	// ShowSent displays a message the user sent, which the server does not
+	// send back, if it is not on screen already.
+	ShowSent(e protocol.Envelope)
+
+	// Notify tells the user about a mention the way they chose, even if they
+	// are looking at another window.
+	Notify(n Notification, title, text string)
+
+	// Info and Error display a status line or a problem noticed by the client
+	// itself.
+	Info(text string)
+	Error(text string)
+
+	// SetStatus updates the state of the connection shown to the user.
+	SetStatus(s Status)
+
+	// Clear removes the messages shown so far.
+	Clear()
+
+	// SetCompleter sets what Tab completes names, rooms and commands with.
+	SetCompleter(c Completer)
+
+	// SetTimeFormat sets the layout of the timestamp in front of every line,
+	// as in [time.Time.Format], or turns timestamps off if it is empty.
+	SetTimeFormat(layout string)
+
+	// Close stops reading input, restores the terminal and says goodbye. It
+	// may be called more than once.
+	Close()
+}
+
+// Status is what the prompt or status bar shows: the state of the connection
+// to the server, how many mentions the user missed and how far their file
+// transfers are.
+type Status struct {
+	State  string        // e.g. "connected", "degraded" or "lost"
+	RTT    time.Duration // last measured round-trip time, zero if unknown
+	Prompt string        // prompt of a line-based UI, kept if empty
+	Server string        // address of the server, kept if empty
+
+	// Mentions counts the mentions of the user they have not seen yet.
+	Mentions int
+
+	// Transfers tells how far the file transfers under way are, e.g.
+	// "notes.pdf ↑42%", or is empty if there are none.
+	Transfers string
+}
+
+// pastedBreak and pastedTab stand in for the line breaks and tabs of a
+// bracketed paste at the prompt, which readline would take for Enter and Tab.
+// They also show the user where the line breaks are.
+const (
+	pastedBreak = '↵'
+	pastedTab   = '⇥'
+)
+
+// unpaste turns the stand-ins of a pasted line back into what was pasted.
+var unpaste = strings.NewReplacer(string(pastedBreak), "\n", string(pastedTab), "\t")
+
+// Line prints messages above a readline prompt, the clients' classic
+// interface. It works on any terminal.
+type Line struct {
+	rl        *readline.Instance
+	closeOnce sync.Once
+
+	mu       sync.Mutex
+	complete Completer
+	format   Format
+}
+
+// NewLine returns a line-based UI with the given prompt.
+func NewLine(prompt string) (*Line, error) {
+	l := &Line{format: Format{TimeFormat: DefaultTimeFormat}}
+	rl, err := readline.NewEx(&readline.Config{
+		Prompt:       prompt,
+		AutoComplete: lineCompleter{l},
+		Stdin:        readline.NewCancelableStdin(&pasteReader{r: os.Stdin}),
+	})
+	if err != nil {
+		return nil, err
+	}
+	l.rl = rl
+	if readline.DefaultIsTerminal() {
+		fmt.Print(pasteOn)
+	}
+	return l, nil
+}
+
+// ReadLine returns the next line typed at the prompt. Text pasted into the
+// prompt is returned as one line, line breaks and all, like text typed after
+// "/paste".
+func (l *Line) ReadLine() (string, error) {
+	line, err := l.rl.Readline()
+	if err != nil {
+		return "", io.EOF
+	}
+	return unpaste.Replace(line), nil
+}
+
+// Show prints an envelope above the prompt. Member lists are only kept for
+// completion, as the prompt has nowhere to show them.
+func (l *Line) Show(e protocol.Envelope) {
+	if e.Type == protocol.TypeMembers {
+		return
+	}
+	l.print(l.getFormat().Envelope(e))
+}
+
+// ShowMention prints a highlighted message above the prompt.
+func (l *Line) ShowMention(e protocol.Envelope) {
+	l.print(l.getFormat().Mention(e))
+}
+
+// ShowSent does nothing, as what the user typed stays above the prompt.
+func (l *Line) ShowSent(e protocol.Envelope) {}
+
+// Notify writes the notification's escape sequence to the terminal.
+func (l *Line) Notify(n Notification, title, text string) {
+	if seq := n.sequence(title, text); seq != "" {
+		l.rl.Write([]byte(seq))
+	}
+}
+
+// Info prints a status line above the prompt.
+func (l *Line) Info(text string) {
+	l.print(l.getFormat().Info(text))
+}
+
+// Error prints a problem above the prompt.
+func (l *Line) Error(text string) {
+	l.print(l.getFormat().Error(text))
+}
+
+// SetStatus changes the prompt, if the status has one.
+func (l *Line) SetStatus(s Status) {
+	if s.Prompt != "" {
+		l.rl.SetPrompt(s.Prompt)
+		l.rl.Refresh()
+	}
+}
+
+// Clear clears the terminal, leaving the prompt at the top.
+func (l *Line) Clear() {
+	readline.ClearScreen(l.rl.Stdout())
+	l.rl.Refresh()
+}
+
+// SetTimeFormat sets the layout of the timestamps of new lines.
+func (l *Line) SetTimeFormat(layout string) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.format.TimeFormat = layout
+}
+
+// getFormat returns how lines are formatted.
+func (l *Line) getFormat() Format {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	return l.format
+}
+
+// SetCompleter sets what Tab completes with.
+func (l *Line) SetCompleter(c Completer) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.complete = c
+}
+
+// Close closes the prompt, which makes a pending ReadLine return.
+func (l *Line) Close() {
+	l.closeOnce.Do(func() {
+		l.rl.Close()
+		if readline.DefaultIsTerminal() {
+			fmt.Print(pasteOff)
+		}
+		fmt.Println("\nGoodbye!")
+	})
+}
+
+// print writes a line above the prompt and redraws the prompt.
+func (l *Line) print(text string) {
+	l.rl.Write([]byte(text + "\n"))
+	l.rl.Refresh()
+}
+
+// lineCompleter hands readline's Tab completion to the completer of a [Line].
+type lineCompleter struct{ l *Line }
+
+// Do returns the completions of the word before pos in line, as readline
+// expects them.
+func (c lineCompleter) Do(line []rune, pos int) ([][]rune, int) {
+	c.l.mu.Lock()
+	complete := c.l.complete
+	c.l.mu.Unlock()
+	return completions(complete, line, pos)
+}
+
+// pasteReader reads the terminal for readline. It takes out the markers the
+// terminal puts around pasted text, and puts stand-ins for the line breaks
+// and tabs between them, so that a paste stays on the prompt as one line.
+type pasteReader struct {
+	r       io.Reader
+	pasting bool   // between the start and end of a bracketed paste
+	cr      bool   // the last byte of the paste was a carriage return
+	rest    []byte // start of a marker cut off by the end of the last read
+	out     []byte // filtered bytes not returned yet
+}
+
+// pasteStart and pasteEnd are the markers around a bracketed paste.
+var (
+	pasteStart = []byte("\x1b[200~")
+	pasteEnd   = []byte("\x1b[201~")
+)
+
+func (p *pasteReader) Read(b []byte) (int, error) {
+	buf := make([]byte, max(len(b), 64))
+	for len(p.out) == 0 {
+		n, err := p.r.Read(buf)
+		p.filter(append(p.rest, buf[:n]...))
+		if err != nil && len(p.out) == 0 {
+			return 0, err
+		}
+	}
+	n := copy(b, p.out)
+	p.out = p.out[n:]
+	return n, nil
+}
+
+// filter adds data to the bytes to return, without the paste markers. The
+// start of a marker at the end of data is kept in rest for the next read.
+func (p *pasteReader) filter(data []byte) {
+	p.rest = nil
+	for i := 0; i < len(data); i++ {
+		if data[i] == 0x1b {
+			tail := data[i:]
+			switch {
+			case bytes.HasPrefix(tail, pasteStart):
+				p.pasting, p.cr = true, false
+				i += len(pasteStart) - 1
+				continue
+			case bytes.HasPrefix(tail, pasteEnd):
+				p.pasting = false
+				i += len(pasteEnd) - 1
+				continue
+			case bytes.HasPrefix(pasteStart, tail) || bytes.HasPrefix(pasteEnd, tail):
+				p.rest = bytes.Clone(tail)
+				return
+			}
+		}
+		if !p.pasting {
+			p.out = append(p.out, data[i])
+			continue
+		}
+		switch c := data[i]; {
+		case c == '\n' && p.cr:
+			// the second half of a Windows line break
+		case c == '\r' || c == '\n':
+			p.out = utf8.AppendRune(p.out, pastedBreak)
+		case c == '\t':
+			p.out = utf8.AppendRune(p.out, pastedTab)
+		default:
+			p.out = append(p.out, c)
+		}
+		p.cr = data[i] == '\r'
+	}
+}
@@ -0,0 +1,191 @@
+// Package web is the servers' WebSocket gateway: browser clients exchange the
+// same JSON envelopes as the TCP and UDP clients, one per WebSocket message,
+// and share rooms with them through the hub. The gateway also serves a small
+// embedded browser client.
+package web
+
+import (
+	"bytes"
+	"embed"
+	"errors"
+	"io"
+	"io/fs"
+	"log/slog"
+	"net"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/jennxsierra/dualnet-chat/internal/chat"
+	"github.com/jennxsierra/dualnet-chat/internal/metrics"
+	"github.com/jennxsierra/dualnet-chat/internal/protocol"
+)
+
+//go:embed client
+var clientFiles embed.FS
+
+// outboxSize is how many envelopes may queue up for a browser before it is
+// considered too slow and dropped.
+const outboxSize = 256
+
+// writeTimeout bounds a single write to a browser.
+const writeTimeout = 10 * time.Second
+
+// PingInterval is how often browsers are pinged. A browser that sends nothing,
+// not even a pong, for two intervals is considered gone. It is read when a
+// handler is made, so tests can shorten it beforehand.
+var PingInterval = 30 * time.Second
+
+// Handler serves the browser client at "/" and the WebSocket endpoint at "/ws"
+// for the hub.
+func Handler(hub *chat.Hub) http.Handler {
+	static, _ := fs.Sub(clientFiles, "client")
+	interval := PingInterval
+
+	mux := http.NewServeMux()
+	mux.Handle("GET /", http.FileServerFS(static))
+	mux.HandleFunc("GET /ws", func(w http.ResponseWriter, r *http.Request) {
+		ws, err := upgrade(w, r)
+		if err != nil {
+			slog.Warn("rejected websocket connection", "addr", r.RemoteAddr, "err", err)
+			return
+		}
+		serve(hub, newConn(ws, r.RemoteAddr, interval))
+	})
+	return mux
+}
+
+// ListenAndServe serves the gateway on addr. It only returns on error.
+func ListenAndServe(addr string, hub *chat.Hub) error {
+	listener, err := net.Listen("tcp", addr)
+	if err != nil {
+		return err
+	}
+	server := &http.Server{
+		Handler:           Handler(hub),
+		ReadHeaderTimeout: 5 * time.Second,
+	}
+	slog.Info("websocket gateway listening", "addr", listener.Addr().String())
+	return server.Serve(listener)
+}
+
+// serve reads envelopes from a browser until it disconnects. The first one
+// must be its registration.
+func serve(hub *chat.Hub, c *conn) {
+	reg, err := c.read()
+	if err != nil {
+		c.Close() // the hub never saw this connection, so it is safe to close here
+		return
+	}
+	if reg.Type != protocol.TypeRegister {
+		reg = protocol.Envelope{Type: protocol.TypeRegister, From: strings.TrimSpace(reg.Text)}
+	}
+	hub.Receive(c, reg)
+
+	for {
+		e, err := c.read()
+		if err != nil {
+			if err != io.EOF && !errors.Is(err, net.ErrClosed) {
+				slog.Debug("reading websocket message", "addr", c.Addr(), "err", err)
+			}
+			break
+		}
+		hub.Receive(c, e)
+	}
+
+	// the hub removes the client and closes the connection, unless it already
+	// did so (e.g. the session was resumed over a newer connection)
+	hub.Disconnect(c)
+}
+
+// conn adapts a WebSocket to [chat.Conn]. Like the TCP server's connections,
+// envelopes are queued and written by a dedicated goroutine, which also pings
+// the browser.
+type conn struct {
+	ws     *websocket
+	addr   string
+	outbox chan []byte
+	ping   time.Duration // how often the browser is pinged
+
+	closed bool // only touched by the hub goroutine
+}
+
+// newConn wraps a WebSocket and starts its writer, which pings the browser
+// every interval. Any frame from the browser, pongs included, shows it is
+// still there for two more.
+func newConn(ws *websocket, addr string, ping time.Duration) *conn {
+	ws.readTimeout = 2 * ping
+	c := &conn{ws: ws, addr: addr, outbox: make(chan []byte, outboxSize), ping: ping}
+	go c.writeLoop()
+	return c
+}
+
+// writeLoop writes queued envelopes and pings until the outbox is closed, then
+// closes the WebSocket so its reader stops as well.
+func (c *conn) writeLoop() {
+	ticker := time.NewTicker(c.ping)
+	defer ticker.Stop()
+
+loop:
+	for {
+		select {
+		case data, ok := <-c.outbox:
+			if !ok {
+				break loop
+			}
+			if err := c.ws.WriteText(data); err != nil {
+				break loop
+			}
+			metrics.BytesSent.Add("ws", uint64(len(data)))
+		case <-ticker.C:
+			if err := c.ws.Ping(); err != nil {
+				break loop
+			}
+		}
+	}
+	c.ws.Close()
+
+	// drain whatever is left so Send never blocks
+	for range c.outbox {
+	}
+}
+
+// read returns the next envelope from the browser.
+func (c *conn) read() (protocol.Envelope, error) {
+	data, err := c.ws.ReadMessage()
+	if err != nil {
+		return protocol.Envelope{}, err
+	}
+	metrics.BytesReceived.Add("ws", uint64(len(data)))
+	return protocol.Decode(data), nil
+}
+
+// Send queues an envelope. A browser whose outbox is full is disconnected.
+func (c *conn) Send(e protocol.Envelope) {
+	if c.closed {
+		return
+	}
+	select {
+	case c.outbox <- bytes.TrimSuffix(protocol.Encode(e), []byte("\n")):
+	default:
+		c.Close()
+	}
+}
+
+// Close flushes the queued envelopes and closes the WebSocket.
+func (c *conn) Close() {
+	if !c.closed {
+		c.closed = true
+		close(c.outbox)
+	}
+}
+
+// Transport identifies the connection as a WebSocket.
+func (c *conn) Transport() string {
+	return "ws"
+}
+
+// Addr returns the browser's address, as seen by the gateway.
+func (c *conn) Addr() string {
+	return c.addr
+}
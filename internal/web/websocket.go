@@ -0,0 +1,247 @@
+package web
+
+import (
+	"bufio"
+	"crypto/sha1"
+	"encoding/base64"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/jennxsierra/dualnet-chat/internal/protocol"
+)
+
+// websocketGUID is mixed into the handshake key (RFC 6455, section 1.3).
+const websocketGUID = "258EAFA5-E914-47DA-95CA-C5AB0DC85B11"
+
+// frame opcodes (RFC 6455, section 5.2)
+const (
+	opContinuation = 0x0
+	opText         = 0x1
+	opBinary       = 0x2
+	opClose        = 0x8
+	opPing         = 0x9
+	opPong         = 0xA
+)
+
+// maxControlPayload is the largest payload a control frame may carry.
+const maxControlPayload = 125
+
+// errMessageTooBig is returned for messages longer than [protocol.MaxLineSize].
+var errMessageTooBig = errors.New("websocket message too big")
+
+// websocket is the server side of a WebSocket connection. Only what the chat
+// needs is implemented: text messages in, text messages out, ping, pong and
+// close. Reads must happen on one goroutine; writes are safe from any.
+type websocket struct {
+	netConn net.Conn
+	reader  *bufio.Reader
+
+	readTimeout time.Duration // how long to wait for each frame, forever if zero
+
+	writeMu   sync.Mutex
+	closeSent bool // nothing may follow a close frame
+}
+
+// upgrade performs the WebSocket handshake on an HTTP request. Requests from
+// pages served by another origin are rejected so other sites cannot open
+// connections on a visitor's behalf.
+func upgrade(w http.ResponseWriter, r *http.Request) (*websocket, error) {
+	if r.Method != http.MethodGet ||
+		!headerContains(r.Header, "Connection", "upgrade") ||
+		!headerContains(r.Header, "Upgrade", "websocket") {
+		http.Error(w, "expected a WebSocket upgrade", http.StatusBadRequest)
+		return nil, errors.New("not a websocket handshake")
+	}
+	if r.Header.Get("Sec-WebSocket-Version") != "13" {
+		w.Header().Set("Sec-WebSocket-Version", "13")
+		http.Error(w, "unsupported WebSocket version", http.StatusUpgradeRequired)
+		return nil, errors.New("unsupported websocket version")
+	}
+	key := r.Header.Get("Sec-WebSocket-Key")
+	if key == "" {
+		http.Error(w, "missing Sec-WebSocket-Key", http.StatusBadRequest)
+		return nil, errors.New("missing websocket key")
+	}
+	if origin := r.Header.Get("Origin"); origin != "" {
+		if u, err := url.Parse(origin); err != nil || !strings.EqualFold(u.Host, r.Host) {
+			http.Error(w, "cross-origin WebSocket connections are not allowed", http.StatusForbidden)
+			return nil, fmt.Errorf("rejected origin %q", origin)
+		}
+	}
+
+	netConn, rw, err := http.NewResponseController(w).Hijack()
+	if err != nil {
+		http.Error(w, "upgrade not supported", http.StatusInternalServerError)
+		return nil, err
+	}
+
+	sum := sha1.Sum([]byte(key + websocketGUID))
+	fmt.Fprintf(rw, "HTTP/1.1 101 Switching Protocols\r\n"+
+		"Upgrade: websocket\r\n"+
+		"Connection: Upgrade\r\n"+
+		"Sec-WebSocket-Accept: %s\r\n\r\n", base64.StdEncoding.EncodeToString(sum[:]))
+	if err := rw.Flush(); err != nil {
+		netConn.Close()
+		return nil, err
+	}
+
+	// the server's read and write deadlines no longer apply once hijacked
+	netConn.SetDeadline(time.Time{})
+	return &websocket{netConn: netConn, reader: rw.Reader}, nil
+}
+
+// headerContains reports whether a comma-separated header has the given token.
+func headerContains(h http.Header, name, token string) bool {
+	for _, value := range h.Values(name) {
+		for _, t := range strings.Split(value, ",") {
+			if strings.EqualFold(strings.TrimSpace(t), token) {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// ReadMessage returns the next text or binary message, answering pings along
+// the way. It returns [io.EOF] once the peer closes the connection.
+func (ws *websocket) ReadMessage() ([]byte, error) {
+	var message []byte
+	for {
+		fin, opcode, payload, err := ws.readFrame()
+		if err != nil {
+			return nil, err
+		}
+
+		switch opcode {
+		case opPing:
+			if err := ws.writeFrame(opPong, payload); err != nil {
+				return nil, err
+			}
+		case opPong:
+		case opClose:
+			// echo the status code, as the protocol asks, and stop reading
+			ws.writeFrame(opClose, payload[:min(len(payload), 2)])
+			return nil, io.EOF
+		case opText, opBinary, opContinuation:
+			if (opcode == opContinuation) == (message == nil) {
+				return nil, errors.New("websocket: unexpected continuation frame")
+			}
+			if len(message)+len(payload) > protocol.MaxLineSize {
+				ws.writeFrame(opClose, binary.BigEndian.AppendUint16(nil, 1009)) // message too big
+				return nil, errMessageTooBig
+			}
+			message = append(message, payload...)
+			if message == nil {
+				message = []byte{} // an empty first frame still starts a message
+			}
+			if fin {
+				return message, nil
+			}
+		default:
+			return nil, fmt.Errorf("websocket: unknown opcode %#x", opcode)
+		}
+	}
+}
+
+// readFrame reads and unmasks a single frame, waiting at most readTimeout for
+// it to start.
+func (ws *websocket) readFrame() (fin bool, opcode byte, payload []byte, err error) {
+	if ws.readTimeout > 0 {
+		ws.netConn.SetReadDeadline(time.Now().Add(ws.readTimeout))
+	}
+	var header [2]byte
+	if _, err := io.ReadFull(ws.reader, header[:]); err != nil {
+		return false, 0, nil, err
+	}
+	fin, opcode = header[0]&0x80 != 0, header[0]&0x0F
+	masked := header[1]&0x80 != 0
+
+	length := uint64(header[1] & 0x7F)
+	switch length {
+	case 126:
+		var ext [2]byte
+		if _, err := io.ReadFull(ws.reader, ext[:]); err != nil {
+			return false, 0, nil, err
+		}
+		length = uint64(binary.BigEndian.Uint16(ext[:]))
+	case 127:
+		var ext [8]byte
+		if _, err := io.ReadFull(ws.reader, ext[:]); err != nil {
+			return false, 0, nil, err
+		}
+		length = binary.BigEndian.Uint64(ext[:])
+	}
+
+	// browsers must mask what they send, and control frames are never split
+	if !masked {
+		return false, 0, nil, errors.New("websocket: unmasked client frame")
+	}
+	if opcode >= opClose && (!fin || length > maxControlPayload) {
+		return false, 0, nil, errors.New("websocket: invalid control frame")
+	}
+	if length > protocol.MaxLineSize {
+		ws.writeFrame(opClose, binary.BigEndian.AppendUint16(nil, 1009))
+		return false, 0, nil, errMessageTooBig
+	}
+
+	var mask [4]byte
+	if _, err := io.ReadFull(ws.reader, mask[:]); err != nil {
+		return false, 0, nil, err
+	}
+	payload = make([]byte, length)
+	if _, err := io.ReadFull(ws.reader, payload); err != nil {
+		return false, 0, nil, err
+	}
+	for i := range payload {
+		payload[i] ^= mask[i%4]
+	}
+	return fin, opcode, payload, nil
+}
+
+// WriteText sends a text message in a single frame.
+func (ws *websocket) WriteText(data []byte) error {
+	return ws.writeFrame(opText, data)
+}
+
+// Ping sends a ping, which browsers answer with a pong.
+func (ws *websocket) Ping() error {
+	return ws.writeFrame(opPing, nil)
+}
+
+// writeFrame writes a single unmasked frame, as servers do.
+func (ws *websocket) writeFrame(opcode byte, payload []byte) error {
+	frame := []byte{0x80 | opcode}
+	switch n := len(payload); {
+	case n < 126:
+		frame = append(frame, byte(n))
+	case n <= 0xFFFF:
+		frame = binary.BigEndian.AppendUint16(append(frame, 126), uint16(n))
+	default:
+		frame = binary.BigEndian.AppendUint64(append(frame, 127), uint64(n))
+	}
+	frame = append(frame, payload...)
+
+	ws.writeMu.Lock()
+	defer ws.writeMu.Unlock()
+	if ws.closeSent {
+		return net.ErrClosed
+	}
+	ws.closeSent = opcode == opClose
+	ws.netConn.SetWriteDeadline(time.Now().Add(writeTimeout))
+	_, err := ws.netConn.Write(frame)
+	return err
+}
+
+// Close sends a normal closure frame and closes the connection.
+func (ws *websocket) Close() error {
+	ws.writeFrame(opClose, binary.BigEndian.AppendUint16(nil, 1000))
+	return ws.netConn.Close()
+}
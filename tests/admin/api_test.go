@@ -0,0 +1,255 @@
+package admin
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"slices"
+	"strings"
+	"testing"
+
+	"github.com/jennxsierra/dualnet-chat/internal/admin"
+	"github.com/jennxsierra/dualnet-chat/internal/chat"
+	"github.com/jennxsierra/dualnet-chat/internal/protocol"
+	"github.com/jennxsierra/dualnet-chat/tests/testutil"
+)
+
+// token is the admin token the tests' APIs require.
+const token = "secret"
+
+// serveAPI serves the admin API of a new hub until the test ends, and returns
+// the hub and the API's address.
+func serveAPI(t *testing.T) (*chat.Hub, string) {
+	t.Helper()
+	hub := testutil.StartHub(t, chat.DefaultConfig())
+	api := httptest.NewServer(admin.Handler(hub, token))
+	t.Cleanup(api.Close)
+	return hub, strings.TrimPrefix(api.URL, "http://")
+}
+
+// request sends a request with the given Authorization header and body to
+// the API at addr and returns the status and the decoded error, if any.
+func request(t *testing.T, addr, method, path, auth, body string) (int, string) {
+	t.Helper()
+	req, err := http.NewRequest(method, "http://"+addr+path, strings.NewReader(body))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if auth != "" {
+		req.Header.Set("Authorization", auth)
+	}
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer resp.Body.Close()
+
+	var result struct {
+		Error string `json:"error"`
+	}
+	json.NewDecoder(resp.Body).Decode(&result)
+	return resp.StatusCode, result.Error
+}
+
+// TestToken checks that every endpoint refuses requests without the right
+// token, and leaves the hub alone when it does.
+func TestToken(t *testing.T) {
+	hub, addr := serveAPI(t)
+	alice := testutil.NewFakeConn("alice:1")
+	alice.Register(t, hub, "alice")
+
+	endpoints := []struct{ method, path string }{
+		{"GET", "/api/sessions"},
+		{"POST", "/api/sessions/alice/kick"},
+		{"POST", "/api/sessions/alice/ban"},
+		{"POST", "/api/announce"},
+		{"GET", "/api/rooms"},
+		{"GET", "/api/history"},
+	}
+	for _, endpoint := range endpoints {
+		for _, auth := range []string{"", "Bearer wrong", token, "Basic " + token} {
+			status, text := request(t, addr, endpoint.method, endpoint.path, auth, `{"text":"hi"}`)
+			if status != http.StatusUnauthorized || text == "" {
+				t.Errorf("%s %s with Authorization %q answered %d %q, want 401 with an error", endpoint.method, endpoint.path, auth, status, text)
+			}
+		}
+	}
+
+	if sessions := hub.Sessions(); len(sessions) != 1 {
+		t.Errorf("sessions %+v after refused requests, want alice's", sessions)
+	}
+	alice.Quiet(t, hub)
+}
+
+// TestSessions checks that the connected clients are listed with their rooms.
+func TestSessions(t *testing.T) {
+	hub, addr := serveAPI(t)
+	client := &admin.Client{Addr: addr, Token: token}
+
+	sessions, err := client.Sessions()
+	if err != nil || len(sessions) != 0 {
+		t.Fatalf("Sessions() = %+v, %v; want none", sessions, err)
+	}
+
+	testutil.NewFakeConn("alice:1").Register(t, hub, "alice", "dev")
+	sessions, err = client.Sessions()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(sessions) != 1 {
+		t.Fatalf("Sessions() = %+v, want alice's", sessions)
+	}
+	s := sessions[0]
+	if s.ID == "" || s.Name != "alice" || s.Transport != "fake" || s.Addr != "alice:1" || !slices.Equal(s.Rooms, []string{"dev"}) {
+		t.Errorf("alice is listed as %+v", s)
+	}
+}
+
+// TestKick checks that kicking tells the client why and removes its session,
+// by name or ID, and that kicking no one is not found.
+func TestKick(t *testing.T) {
+	hub, addr := serveAPI(t)
+	client := &admin.Client{Addr: addr, Token: token}
+	alice, bob := testutil.NewFakeConn("alice:1"), testutil.NewFakeConn("bob:1")
+	alice.Register(t, hub, "alice")
+	bob.Register(t, hub, "bob")
+
+	if err := client.Kick("alice", "spam"); err != nil {
+		t.Fatal(err)
+	}
+	if e := alice.Expect(t, protocol.TypeBye); !strings.Contains(e.Text, "spam") {
+		t.Errorf("alice was told %q, want the reason", e.Text)
+	}
+
+	id := hub.Sessions()[0].ID
+	if status, _ := request(t, addr, "POST", "/api/sessions/"+id+"/kick", "Bearer "+token, ""); status != http.StatusNoContent {
+		t.Errorf("kicking bob by ID answered %d, want 204", status)
+	}
+	bob.Expect(t, protocol.TypeBye)
+	if sessions := hub.Sessions(); len(sessions) != 0 {
+		t.Errorf("sessions %+v after kicking everyone", sessions)
+	}
+
+	if status, _ := request(t, addr, "POST", "/api/sessions/carol/kick", "Bearer "+token, ""); status != http.StatusNotFound {
+		t.Errorf("kicking no one answered %d, want 404", status)
+	}
+	if status, _ := request(t, addr, "POST", "/api/sessions/carol/kick", "Bearer "+token, "{"); status != http.StatusBadRequest {
+		t.Errorf("an invalid body answered %d, want 400", status)
+	}
+}
+
+// TestBan checks that banning returns the entry added, by name or address,
+// disconnects the client, and that banning no one is not found.
+func TestBan(t *testing.T) {
+	hub, addr := serveAPI(t)
+	client := &admin.Client{Addr: addr, Token: token}
+	alice, bob := testutil.NewFakeConn("alice:1"), testutil.NewFakeConn("10.0.0.2:1")
+	alice.Register(t, hub, "alice@10.0.0.1:51756")
+	bob.Register(t, hub, "bob")
+
+	if entry, err := client.Ban("alice@10.0.0.1:51756", false); err != nil || entry != "alice" {
+		t.Errorf("Ban(alice) = %q, %v; want the name alice", entry, err)
+	}
+	alice.Expect(t, protocol.TypeBye)
+
+	if entry, err := client.Ban("bob", true); err != nil || entry != "10.0.0.2" {
+		t.Errorf("Ban(bob, by address) = %q, %v; want bob's address", entry, err)
+	}
+	bob.Expect(t, protocol.TypeBye)
+
+	if status, _ := request(t, addr, "POST", "/api/sessions/carol/ban", "Bearer "+token, ""); status != http.StatusNotFound {
+		t.Errorf("banning no one answered %d, want 404", status)
+	}
+}
+
+// TestAnnounce checks that announcements reach everyone or one room, and that
+// empty ones and invalid rooms are refused.
+func TestAnnounce(t *testing.T) {
+	hub, addr := serveAPI(t)
+	client := &admin.Client{Addr: addr, Token: token}
+	alice, bob := testutil.NewFakeConn("alice:1"), testutil.NewFakeConn("bob:1")
+	alice.Register(t, hub, "alice")
+	bob.Register(t, hub, "bob", "dev")
+
+	if n, err := client.Announce("", "maintenance at noon"); err != nil || n != 2 {
+		t.Errorf("Announce to everyone = %d, %v; want 2 recipients", n, err)
+	}
+	alice.Expect(t, protocol.TypeNotice)
+	bob.Expect(t, protocol.TypeNotice)
+
+	if n, err := client.Announce("#dev", "deploy done"); err != nil || n != 1 {
+		t.Errorf("Announce to #dev = %d, %v; want 1 recipient", n, err)
+	}
+	if e := bob.Expect(t, protocol.TypeNotice); e.Room != "dev" || e.Text != "deploy done" {
+		t.Errorf("bob was sent %+v, want the announcement to #dev", e)
+	}
+	alice.Quiet(t, hub)
+
+	for _, body := range []string{`{"text":"  "}`, `{}`, `{"room":"bad!","text":"hi"}`, `{"text":`} {
+		if status, text := request(t, addr, "POST", "/api/announce", "Bearer "+token, body); status != http.StatusBadRequest || text == "" {
+			t.Errorf("announcing %s answered %d %q, want 400 with an error", body, status, text)
+		}
+	}
+	alice.Quiet(t, hub)
+	bob.Quiet(t, hub)
+}
+
+// TestRooms checks that the rooms with members are listed with them.
+func TestRooms(t *testing.T) {
+	hub, addr := serveAPI(t)
+	client := &admin.Client{Addr: addr, Token: token}
+	testutil.NewFakeConn("alice:1").Register(t, hub, "alice", "dev", "ops")
+	testutil.NewFakeConn("bob:1").Register(t, hub, "bob", "dev")
+
+	rooms, err := client.Rooms()
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []admin.Room{{Name: "dev", Members: []string{"alice", "bob"}}, {Name: "ops", Members: []string{"alice"}}}
+	if !slices.EqualFunc(rooms, want, func(a, b admin.Room) bool { return a.Name == b.Name && slices.Equal(a.Members, b.Members) }) {
+		t.Errorf("Rooms() = %+v, want %+v", rooms, want)
+	}
+}
+
+// TestHistory checks that the history is returned oldest first, limited and
+// filtered by room, and that invalid limits are refused.
+func TestHistory(t *testing.T) {
+	hub, addr := serveAPI(t)
+	client := &admin.Client{Addr: addr, Token: token}
+	for _, e := range []protocol.Envelope{
+		{From: "alice", Room: "general", Text: "one"},
+		{From: "bob", Room: "dev", Text: "two"},
+		{From: "alice", Room: "general", Text: "three"},
+	} {
+		e.Type = protocol.TypeMessage
+		hub.History.Add(e)
+	}
+
+	texts := func(room string, limit int) []string {
+		t.Helper()
+		messages, err := client.History(room, limit)
+		if err != nil {
+			t.Fatalf("History(%q, %d): %v", room, limit, err)
+		}
+		var texts []string
+		for _, m := range messages {
+			texts = append(texts, m.Text)
+		}
+		return texts
+	}
+	if got := texts("", 10); !slices.Equal(got, []string{"one", "two", "three"}) {
+		t.Errorf("the whole history is %q", got)
+	}
+	if got := texts("", 2); !slices.Equal(got, []string{"two", "three"}) {
+		t.Errorf("the last two messages are %q", got)
+	}
+	if got := texts("#general", 10); !slices.Equal(got, []string{"one", "three"}) {
+		t.Errorf("the history of #general is %q", got)
+	}
+
+	for _, query := range []string{"?limit=0", "?limit=-1", "?limit=many"} {
+		if status, _ := request(t, addr, "GET", "/api/history"+query, "Bearer "+token, ""); status != http.StatusBadRequest {
+			t.Errorf("GET /api/history%s answered %d, want 400", query, status)
+		}
+	}
+}
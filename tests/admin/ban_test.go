@@ -0,0 +1,59 @@
+package admin
+
+import (
+	"net/http"
+	"testing"
+
+	"github.com/jennxsierra/dualnet-chat/internal/protocol"
+	"github.com/jennxsierra/dualnet-chat/internal/tcp/server"
+	"github.com/jennxsierra/dualnet-chat/tests/testutil"
+)
+
+func TestMain(m *testing.M) {
+	testutil.Main(m)
+}
+
+// register connects to the server under name and returns its first reply.
+func register(t *testing.T, addr, name string) protocol.Envelope {
+	t.Helper()
+	_, _, reply := testutil.Reply(t, "tcp", addr, protocol.Envelope{Type: protocol.TypeRegister, From: name})
+	return reply
+}
+
+// TestBanByName checks that banning a TCP client's name keeps it out when it
+// comes back from another port, which changes the address in its name.
+func TestBanByName(t *testing.T) {
+	srv, addr := testutil.StartTCP(t, server.DefaultConfig())
+
+	if reply := register(t, addr, "alice@127.0.0.1:51756"); reply.Type != protocol.TypeWelcome {
+		t.Fatalf("expected a welcome, got %+v", reply)
+	}
+	entry, err := srv.Hub.Ban("alice@127.0.0.1:51756", false)
+	if err != nil || entry != "alice" {
+		t.Fatalf("Ban returned %q, %v; want the name alice", entry, err)
+	}
+
+	if reply := register(t, addr, "alice@127.0.0.1:51800"); reply.Type != protocol.TypeBye {
+		t.Errorf("alice came back from a new port and got %+v", reply)
+	}
+	if reply := register(t, addr, "bob@127.0.0.1:51801"); reply.Type != protocol.TypeWelcome {
+		t.Errorf("bob was refused too: %+v", reply)
+	}
+}
+
+// TestHistoryInvalidRoom checks that asking for the history of an invalid room
+// is rejected instead of returning every room's messages.
+func TestHistoryInvalidRoom(t *testing.T) {
+	hub, addr := serveAPI(t)
+	hub.History.Add(protocol.Envelope{Type: protocol.TypeMessage, Room: protocol.DefaultRoom, Text: "hi"})
+
+	for query, want := range map[string]int{
+		"":              http.StatusOK,
+		"?room=general": http.StatusOK,
+		"?room=%23bad!": http.StatusBadRequest,
+	} {
+		if status, _ := request(t, addr, "GET", "/api/history"+query, "Bearer "+token, ""); status != want {
+			t.Errorf("GET /api/history%s answered %d, want %d", query, status, want)
+		}
+	}
+}
@@ -0,0 +1,70 @@
+package admin
+
+import (
+	"errors"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/jennxsierra/dualnet-chat/tests/testutil"
+)
+
+// TestChatctl builds chatctl and checks how it handles its arguments: usage
+// errors exit with 2 or 1 before reaching the API, and commands print what the
+// API answered.
+func TestChatctl(t *testing.T) {
+	bin := filepath.Join(t.TempDir(), "chatctl")
+	if out, err := exec.Command("go", "build", "-o", bin, "github.com/jennxsierra/dualnet-chat/cmd/chatctl").CombinedOutput(); err != nil {
+		t.Fatalf("building chatctl: %v\n%s", err, out)
+	}
+
+	hub, addr := serveAPI(t)
+	alice := testutil.NewFakeConn("alice:1")
+	alice.Register(t, hub, "alice", "dev")
+
+	for _, test := range []struct {
+		args   []string
+		status int    // exit status
+		output string // part of the output
+	}{
+		{nil, 2, "Usage: chatctl"},
+		{[]string{"reboot"}, 2, `Unknown command "reboot"`},
+		{[]string{"--nope", "sessions"}, 2, "flag provided but not defined"},
+		{[]string{"kick"}, 1, "Usage: chatctl kick"},
+		{[]string{"ban", "--addr"}, 1, "Usage: chatctl ban"},
+		{[]string{"ban", "--name", "alice"}, 2, "flag provided but not defined"},
+		{[]string{"announce", "--room", "dev"}, 1, "Usage: chatctl announce"},
+		{[]string{"history", "-n", "many"}, 2, "invalid value"},
+		{[]string{"history", "-n", "0"}, 1, "limit must be a positive number"},
+		{[]string{"--token", "wrong", "sessions"}, 1, "missing or invalid admin token"},
+		{[]string{"kick", "carol"}, 1, "no such"},
+		{[]string{"sessions"}, 0, "alice"},
+		{[]string{"--json", "rooms"}, 0, `"members": [`},
+		{[]string{"announce", "--room", "dev", "deploy", "done"}, 0, "Announced to 1 client(s)."},
+		{[]string{"kick", "alice", "too", "loud"}, 0, "Kicked alice."},
+	} {
+		cmd := exec.Command(bin, append([]string{"--addr", addr, "--token", token}, test.args...)...)
+		if len(test.args) == 0 {
+			cmd.Args = cmd.Args[:1]
+		}
+		out, err := cmd.CombinedOutput()
+
+		status := 0
+		if exitErr := (*exec.ExitError)(nil); errors.As(err, &exitErr) {
+			status = exitErr.ExitCode()
+		} else if err != nil {
+			t.Fatal(err)
+		}
+		if status != test.status || !strings.Contains(string(out), test.output) {
+			t.Errorf("chatctl %s exited with %d and printed:\n%s\nwant %d and %q", strings.Join(test.args, " "), status, out, test.status, test.output)
+		}
+	}
+
+	if e := alice.Next(t); e.Text != "deploy done" {
+		t.Errorf("alice was sent %+v, want the announcement", e)
+	}
+	if e := alice.Next(t); e.Text != "You were kicked from the server: too loud" {
+		t.Errorf("alice was sent %+v, want to be kicked", e)
+	}
+}
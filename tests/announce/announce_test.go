@@ -0,0 +1,94 @@
+package announce
+
+import (
+	"testing"
+
+	"github.com/jennxsierra/dualnet-chat/internal/chat"
+	"github.com/jennxsierra/dualnet-chat/internal/protocol"
+	"github.com/jennxsierra/dualnet-chat/tests/testutil"
+)
+
+func TestMain(m *testing.M) {
+	testutil.Main(m)
+}
+
+// TestMOTD checks that the message of the day follows the welcome, with the
+// client's name filled in, and is not repeated when the session resumes.
+func TestMOTD(t *testing.T) {
+	cfg := chat.DefaultConfig()
+	cfg.MOTD = "Hello {name}, be nice."
+	hub := testutil.StartHub(t, cfg)
+
+	alice := testutil.NewFakeConn("alice:1")
+	welcome := alice.Register(t, hub, "alice")
+	if e := alice.Next(t); e.Type != protocol.TypeNotice || e.Text != "Hello alice, be nice." {
+		t.Errorf("alice was sent %+v after the welcome, want the MOTD", e)
+	}
+
+	// coming back with the session token resumes it silently
+	moved := testutil.NewFakeConn("alice:2")
+	hub.Receive(moved, protocol.Envelope{Type: protocol.TypeRegister, From: "alice", Session: welcome.Session})
+	if e := moved.Next(t); e.Type != protocol.TypeWelcome {
+		t.Fatalf("alice was sent %+v on resuming, want a welcome", e)
+	}
+	moved.Quiet(t, hub)
+}
+
+// TestAnnounce checks that only operators can announce, to everyone or to one
+// room, and that the admin API's Announce does the same.
+func TestAnnounce(t *testing.T) {
+	cfg := chat.DefaultConfig()
+	cfg.OperatorPassword = "secret"
+	hub := testutil.StartHub(t, cfg)
+
+	alice, bob, carol := testutil.NewFakeConn("alice:1"), testutil.NewFakeConn("bob:1"), testutil.NewFakeConn("carol:1")
+	alice.Register(t, hub, "alice")
+	bob.Register(t, hub, "bob", "dev")
+	carol.Register(t, hub, "carol")
+	command := func(text string) protocol.Envelope {
+		t.Helper()
+		hub.Receive(alice, protocol.Envelope{Type: protocol.TypeMessage, Text: text})
+		return alice.Next(t)
+	}
+
+	if e := command("/announce hello"); e.Type != protocol.TypeError {
+		t.Errorf("a client who is no operator announced: %+v", e)
+	}
+	if e := command("/oper wrong"); e.Type != protocol.TypeError {
+		t.Errorf("the wrong password was accepted: %+v", e)
+	}
+	if e := command("/oper secret"); e.Type != protocol.TypeNotice {
+		t.Fatalf("the right password was refused: %+v", e)
+	}
+	bob.Quiet(t, hub)
+	carol.Quiet(t, hub)
+
+	// to everyone, alice included
+	hub.Receive(alice, protocol.Envelope{Type: protocol.TypeMessage, Text: "/announce maintenance at noon"})
+	for name, conn := range map[string]*testutil.FakeConn{"alice": alice, "bob": bob, "carol": carol} {
+		if e := conn.Next(t); e.Type != protocol.TypeNotice || e.Text != "maintenance at noon" {
+			t.Errorf("%s was sent %+v, want the announcement", name, e)
+		}
+	}
+
+	// to a room alice is not in, which she is told about
+	if e := command("/announce #dev deploy done"); e.Type != protocol.TypeNotice || e.Text != "Announced to 1 client(s) in #dev." {
+		t.Errorf("alice was sent %+v, want a confirmation", e)
+	}
+	if e := bob.Next(t); e.Type != protocol.TypeNotice || e.Room != "dev" || e.Text != "deploy done" {
+		t.Errorf("bob was sent %+v, want the announcement to #dev", e)
+	}
+	carol.Quiet(t, hub)
+
+	if e := command("/announce #dev"); e.Type != protocol.TypeError {
+		t.Errorf("an empty announcement was accepted: %+v", e)
+	}
+
+	if n := hub.Announce("dev", "from the API"); n != 1 {
+		t.Errorf("Announce reached %d clients, want 1", n)
+	}
+	if e := bob.Next(t); e.Text != "from the API" {
+		t.Errorf("bob was sent %+v, want the API's announcement", e)
+	}
+	carol.Quiet(t, hub)
+}
@@ -0,0 +1,76 @@
+package chatlog
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/jennxsierra/dualnet-chat/internal/chatlog"
+	"github.com/jennxsierra/dualnet-chat/internal/protocol"
+)
+
+// TestLogs checks that messages go to the log of their room or conversation,
+// with their time, room and sender.
+func TestLogs(t *testing.T) {
+	dir := t.TempDir()
+	logs, err := chatlog.Open(dir, "alice@10.0.0.1:5000")
+	if err != nil {
+		t.Fatal(err)
+	}
+	at := time.Date(2024, 5, 1, 9, 30, 0, 0, time.Local)
+	for _, e := range []protocol.Envelope{
+		{Type: protocol.TypeMessage, Time: at, From: "bob", Text: "hello"},
+		{Type: protocol.TypeMessage, Time: at, From: "bob", Room: "../random", Text: "elsewhere"},
+		{Type: protocol.TypeMessage, Time: at, From: "alice@10.0.0.1:5000", To: "bob@10.0.0.2:6000", Text: "psst"},
+		{Type: protocol.TypeJoin, Time: at, From: "carol"},
+	} {
+		if err := logs.Write(e); err != nil {
+			t.Fatal(err)
+		}
+	}
+	logs.Close()
+
+	for file, want := range map[string]string{
+		"general.log":    "2024-05-01 09:30:00 #general [bob]: hello\n",
+		"___random.log":  "2024-05-01 09:30:00 #../random [bob]: elsewhere\n",
+		"direct-bob.log": "2024-05-01 09:30:00 [alice@10.0.0.1:5000 -> bob@10.0.0.2:6000]: psst\n",
+	} {
+		data, err := os.ReadFile(filepath.Join(dir, file))
+		if err != nil || string(data) != want {
+			t.Errorf("%s holds %q (%v), want %q", file, data, err, want)
+		}
+	}
+}
+
+// TestSearch checks that a search finds lines in every log, oldest first,
+// including the further lines of multi-line messages, and keeps the newest.
+func TestSearch(t *testing.T) {
+	logs, err := chatlog.Open(t.TempDir(), "alice")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer logs.Close()
+	at := time.Date(2024, 5, 1, 9, 30, 0, 0, time.Local)
+	logs.Write(protocol.Envelope{Type: protocol.TypeMessage, Time: at.Add(2 * time.Minute), From: "bob", Room: "ops", Text: "Deploy done"})
+	logs.Write(protocol.Envelope{Type: protocol.TypeMessage, Time: at, From: "bob", Text: "trace:\npanic in deploy"})
+	logs.Write(protocol.Envelope{Type: protocol.TypeMessage, Time: at.Add(time.Minute), From: "carol", Text: "unrelated"})
+
+	matches, total, err := logs.Search("DEPLOY", 10)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var lines []string
+	for _, m := range matches {
+		lines = append(lines, m.Log+" "+m.Line)
+	}
+	want := "#general 2024-05-01 09:30:00 #general [bob]: panic in deploy\n#ops 2024-05-01 09:32:00 #ops [bob]: Deploy done"
+	if total != 2 || strings.Join(lines, "\n") != want {
+		t.Errorf("found %d:\n%s\nwant:\n%s", total, strings.Join(lines, "\n"), want)
+	}
+
+	if matches, total, _ := logs.Search("deploy", 1); total != 2 || len(matches) != 1 || matches[0].Log != "#ops" {
+		t.Errorf("limited search found %d: %+v", total, matches)
+	}
+}
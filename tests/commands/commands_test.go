@@ -0,0 +1,217 @@
+package commands
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/jennxsierra/dualnet-chat/internal/commands"
+	"github.com/jennxsierra/dualnet-chat/internal/protocol"
+	"github.com/jennxsierra/dualnet-chat/internal/ui"
+)
+
+// fakeUI records what the commands show.
+type fakeUI struct {
+	shown    []protocol.Envelope
+	mentions []protocol.Envelope
+	notified []string
+	info     []string
+	errors   []string
+	status   ui.Status
+	closed   bool
+}
+
+func (f *fakeUI) ReadLine() (string, error)  { return "", nil }
+func (f *fakeUI) Show(e protocol.Envelope)   { f.shown = append(f.shown, e) }
+func (f *fakeUI) Info(text string)           { f.info = append(f.info, text) }
+func (f *fakeUI) Error(text string)          { f.errors = append(f.errors, text) }
+func (f *fakeUI) SetStatus(status ui.Status) { f.status = status }
+func (f *fakeUI) Clear()                     {}
+func (f *fakeUI) SetCompleter(ui.Completer)  {}
+func (f *fakeUI) SetTimeFormat(string)       {}
+func (f *fakeUI) Close()                     { f.closed = true }
+
+func (f *fakeUI) ShowMention(e protocol.Envelope) { f.mentions = append(f.mentions, e) }
+func (f *fakeUI) ShowSent(e protocol.Envelope)    {}
+
+func (f *fakeUI) Notify(n ui.Notification, title, text string) {
+	f.notified = append(f.notified, string(n)+": "+text)
+}
+
+// fakeClient records the connections asked for.
+type fakeClient struct {
+	connected  []string
+	reconnects int
+	sent       []string
+}
+
+func (f *fakeClient) Connect(addr string) error { f.connected = append(f.connected, addr); return nil }
+func (f *fakeClient) Reconnect() error          { f.reconnects++; return nil }
+func (f *fakeClient) Refresh()                  {}
+func (f *fakeClient) Send(line string) error    { f.sent = append(f.sent, line); return nil }
+
+// TestRun checks which lines the client runs itself and which it leaves for
+// the server.
+func TestRun(t *testing.T) {
+	u, c := &fakeUI{}, &fakeClient{}
+	local := commands.NewLocal(u, c, "me")
+
+	for _, line := range []string{"/connect 10.0.0.1:4000", "/reconnect", "/clear", "/set"} {
+		if !local.Run(line) {
+			t.Errorf("Run(%q) left the line for the server", line)
+		}
+	}
+	for _, line := range []string{"hello", "/join random", "/msg bob hi", "/quitting"} {
+		if local.Run(line) {
+			t.Errorf("Run(%q) kept the line from the server", line)
+		}
+	}
+	if len(c.connected) != 1 || c.connected[0] != "10.0.0.1:4000" || c.reconnects != 1 {
+		t.Errorf("client saw connects %v and %d reconnects", c.connected, c.reconnects)
+	}
+
+	if !local.Run("/quit") || !u.closed {
+		t.Error("/quit did not close the UI")
+	}
+}
+
+// TestIgnore checks that ignored users' messages are hidden, whether they are
+// named with or without their address, until they are no longer ignored.
+func TestIgnore(t *testing.T) {
+	u := &fakeUI{}
+	local := commands.NewLocal(u, &fakeClient{}, "me")
+	spam := protocol.Envelope{Type: protocol.TypeMessage, From: "spam@10.0.0.2:5000", Text: "buy"}
+	join := protocol.Envelope{Type: protocol.TypeJoin, From: "spam@10.0.0.2:5000"}
+
+	local.Run("/ignore spam")
+	local.Show(spam)
+	local.Show(join)
+	if len(u.shown) != 1 || u.shown[0].Type != protocol.TypeJoin {
+		t.Errorf("shown while ignoring: %+v", u.shown)
+	}
+
+	local.Run("/ignore spam")
+	local.Show(spam)
+	if len(u.shown) != 2 {
+		t.Errorf("shown after unignoring: %+v", u.shown)
+	}
+}
+
+// TestLog checks that "/log on" writes what is shown to the transcript file
+// set with "/set log-file".
+func TestLog(t *testing.T) {
+	u := &fakeUI{}
+	local := commands.NewLocal(u, &fakeClient{}, "me")
+	path := filepath.Join(t.TempDir(), "chat.log")
+
+	local.Run("/set log-file " + path)
+	local.Run("/log on")
+	local.Show(protocol.Envelope{Type: protocol.TypeMessage, From: "carol", Text: "hello"})
+	local.Run("/log off")
+	local.Show(protocol.Envelope{Type: protocol.TypeMessage, From: "carol", Text: "unlogged"})
+
+	data, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(string(data), "[carol]: hello") || strings.Contains(string(data), "unlogged") {
+		t.Errorf("transcript is %q", data)
+	}
+	if len(u.errors) > 0 {
+		t.Errorf("errors: %v", u.errors)
+	}
+}
+
+// TestComplete checks that names, rooms and commands are completed from the
+// welcome, member lists, joins and leaves and the server's "/help".
+func TestComplete(t *testing.T) {
+	u, c := &fakeUI{}, &fakeClient{}
+	local := commands.NewLocal(u, c, "me")
+
+	local.Show(protocol.Envelope{Type: protocol.TypeWelcome, Rooms: []string{"general"}})
+	if len(c.sent) != 1 || c.sent[0] != "/help" {
+		t.Fatalf("sent %v after the welcome, want /help", c.sent)
+	}
+	local.Show(protocol.Envelope{Type: protocol.TypeNotice, Commands: []string{"/join", "/part", "/who"}, Text: "Commands: ..."})
+	local.Show(protocol.Envelope{Type: protocol.TypeMembers, Room: "general", Members: []string{"bob", "me"}})
+	local.Show(protocol.Envelope{Type: protocol.TypeJoin, From: "me", Room: "random"})
+	local.Show(protocol.Envelope{Type: protocol.TypeJoin, From: "bella", Room: "random"})
+	local.Show(protocol.Envelope{Type: protocol.TypeLeave, From: "bob", Room: "general"})
+	for _, e := range u.shown {
+		if e.Commands != nil {
+			t.Errorf("the reply to the client's own /help was shown: %+v", e)
+		}
+	}
+
+	for word, want := range map[string]string{
+		"@b": "@bella",
+		"@m": "",
+		"#":  "#general #random",
+		"/j": "/join",
+		"/c": "/clear /color /connect",
+	} {
+		if got := strings.Join(local.Complete(word), " "); got != want {
+			t.Errorf("Complete(%q) = %q, want %q", word, got, want)
+		}
+	}
+}
+
+// TestMentions checks that messages naming the user or one of their keywords
+// are highlighted, notified and counted until the user types something.
+func TestMentions(t *testing.T) {
+	u := &fakeUI{}
+	local := commands.NewLocal(u, &fakeClient{}, "alice@10.0.0.1:5000")
+	local.Run("/set keywords deploy, Outage")
+	local.Run("/set notify osc9")
+
+	for _, e := range []protocol.Envelope{
+		{Type: protocol.TypeMessage, From: "bob", Text: "hey @alice, look"},
+		{Type: protocol.TypeMessage, From: "bob", Text: "the OUTAGE is over"},
+		{Type: protocol.TypeMessage, From: "bob", To: "alice@10.0.0.1:5000", Text: "psst"},
+		{Type: protocol.TypeMessage, From: "bob", Text: "@alicia and redeployment are other words"},
+		{Type: protocol.TypeMessage, From: "alice@10.0.0.1:5000", Text: "I will deploy"},
+		{Type: protocol.TypeJoin, From: "bob", Text: "deploy"},
+	} {
+		local.Show(e)
+	}
+	if len(u.mentions) != 3 || len(u.shown) != 3 {
+		t.Errorf("mentions %+v, other lines %+v", u.mentions, u.shown)
+	}
+	if len(u.notified) != 3 || u.notified[0] != "osc9: bob in #general: hey @alice, look" {
+		t.Errorf("notified %q", u.notified)
+	}
+
+	local.SetStatus(ui.Status{State: "connected", Prompt: "> "})
+	if u.status.Mentions != 3 || !strings.Contains(u.status.Prompt, "(3@)") {
+		t.Errorf("status %+v before typing", u.status)
+	}
+	local.Run("hello")
+	local.SetStatus(ui.Status{State: "connected", Prompt: "> "})
+	if u.status.Mentions != 0 || u.status.Prompt != "> " {
+		t.Errorf("status %+v after typing", u.status)
+	}
+}
+
+// TestPaste checks that a "/paste" block is sent as one message, line breaks,
+// indentation and all, and that messages too large to send are refused.
+func TestPaste(t *testing.T) {
+	u, c := &fakeUI{}, &fakeClient{}
+	local := commands.NewLocal(u, c, "me")
+
+	for _, line := range []string{"/paste", "panic: oops", "", "\tmain.go:12", "/quit", "/end"} {
+		if !local.Run(line) {
+			t.Errorf("Run(%q) left the line for the server", line)
+		}
+	}
+	if want := "panic: oops\n\n\tmain.go:12\n/quit"; len(c.sent) != 1 || c.sent[0] != want || u.closed {
+		t.Errorf("sent %q, want %q", c.sent, want)
+	}
+
+	if local.Run("hello") {
+		t.Error("Run kept a message from the server after the paste")
+	}
+	if !local.Run(strings.Repeat("x", protocol.MaxLineSize)) || len(u.errors) != 1 {
+		t.Errorf("a message too long to send was not refused: %v", u.errors)
+	}
+}
@@ -0,0 +1,39 @@
+package concurrency
+
+import (
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/jennxsierra/dualnet-chat/internal/chat"
+)
+
+// TestReconfigure reads and replaces the hub's configuration from several
+// goroutines at once, including one without a sweep interval, which the hub
+// must not pass on to its ticker. Run with -race.
+func TestReconfigure(t *testing.T) {
+	hub := chat.NewHub(chat.DefaultConfig())
+	hub.Start()
+	t.Cleanup(func() { hub.Stop("bye") })
+
+	var wg sync.WaitGroup
+	for i := range 10 {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			cfg := chat.DefaultConfig()
+			cfg.SweepInterval = time.Duration(i) * time.Millisecond
+			hub.Reconfigure(cfg)
+			hub.Config()
+		}()
+	}
+	wg.Wait()
+
+	cfg := chat.DefaultConfig()
+	cfg.SweepInterval = 0
+	cfg.MOTD = "hello"
+	hub.Reconfigure(cfg)
+	if got := hub.Config(); got.MOTD != "hello" {
+		t.Errorf("Config() returned MOTD %q after Reconfigure, want %q", got.MOTD, "hello")
+	}
+}
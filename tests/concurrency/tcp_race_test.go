@@ -0,0 +1,114 @@
+package concurrency
+
+import (
+	"fmt"
+	"io"
+	"net"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/jennxsierra/dualnet-chat/internal/chat"
+	"github.com/jennxsierra/dualnet-chat/internal/protocol"
+	"github.com/jennxsierra/dualnet-chat/internal/tcp/server"
+	"github.com/jennxsierra/dualnet-chat/tests/testutil"
+)
+
+// number of clients connecting at the same time
+const numClients = 25
+
+func TestMain(m *testing.M) {
+	testutil.Main(m)
+}
+
+// TestTCPConcurrentClients registers, chats, idles out and drops many TCP
+// clients at once while the hub sweeps idle sessions and its state is
+// inspected from another goroutine. Run with -race.
+func TestTCPConcurrentClients(t *testing.T) {
+	cfg := server.DefaultConfig()
+	cfg.SweepInterval = 5 * time.Millisecond
+	cfg.Idle = chat.IdlePolicy{AwayAfter: 20 * time.Millisecond, DisconnectAfter: 300 * time.Millisecond}
+
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	srv := server.NewServer(listener.Addr().String(), cfg)
+	served := make(chan error, 1)
+	go func() { served <- srv.Serve(listener) }()
+
+	// keep reading the hub's state while clients come and go
+	stop := make(chan struct{})
+	var watcher sync.WaitGroup
+	watcher.Add(1)
+	go func() {
+		defer watcher.Done()
+		for {
+			select {
+			case <-stop:
+				return
+			default:
+				for _, s := range srv.Hub.Sessions() {
+					if s.Transport != "tcp" || len(s.Rooms) == 0 {
+						t.Errorf("unexpected session %+v", s)
+					}
+				}
+			}
+		}
+	}()
+
+	var clients sync.WaitGroup
+	for i := range numClients {
+		clients.Add(1)
+		go func() {
+			defer clients.Done()
+
+			conn, err := net.Dial("tcp", listener.Addr().String())
+			if err != nil {
+				t.Error(err)
+				return
+			}
+			defer conn.Close()
+
+			name := fmt.Sprintf("client-%d", i)
+			conn.Write(protocol.Encode(protocol.Envelope{Type: protocol.TypeRegister, From: name}))
+
+			// the welcome carries the session token
+			reader := protocol.NewReader(conn)
+			welcome, err := reader.Read()
+			if err != nil || welcome.Type != protocol.TypeWelcome || welcome.Session == "" {
+				t.Errorf("%s: expected a welcome, got %+v (%v)", name, welcome, err)
+				return
+			}
+			go io.Copy(io.Discard, conn) // drain broadcasts
+
+			for j := range 5 {
+				conn.Write(protocol.Encode(protocol.Envelope{Type: protocol.TypeMessage, Room: protocol.DefaultRoom, Text: fmt.Sprintf("hello %d", j)}))
+				conn.Write(protocol.Encode(protocol.Envelope{Type: protocol.TypeHeartbeat, Seq: uint64(j)}))
+			}
+			conn.Write(protocol.Encode(protocol.Envelope{Type: protocol.TypeMessage, Text: "/join race"}))
+
+			switch i % 3 {
+			case 0: // leave politely
+				conn.Write(protocol.Encode(protocol.Envelope{Type: protocol.TypeBye}))
+			case 1: // vanish
+			case 2: // stay until the idle timeout disconnects the client
+				time.Sleep(500 * time.Millisecond)
+			}
+		}()
+	}
+	clients.Wait()
+
+	// every client either left or was disconnected
+	testutil.WaitFor(t, "all sessions to end", func() bool {
+		return len(srv.Hub.Sessions()) == 0
+	})
+
+	close(stop)
+	watcher.Wait()
+
+	srv.Close()
+	if err := <-served; err != nil {
+		t.Fatalf("Serve returned %v", err)
+	}
+}
@@ -0,0 +1,117 @@
+package concurrency
+
+import (
+	"fmt"
+	"net"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/jennxsierra/dualnet-chat/internal/protocol"
+	"github.com/jennxsierra/dualnet-chat/internal/udp/server"
+	"github.com/jennxsierra/dualnet-chat/tests/testutil"
+)
+
+// TestUDPConcurrentClients registers, chats, migrates and abandons many UDP
+// clients at once while the hub expires inactive sessions and its state is
+// inspected from another goroutine. Run with -race.
+func TestUDPConcurrentClients(t *testing.T) {
+	cfg := server.DefaultConfig()
+	cfg.InactivityTimeout = 200 * time.Millisecond
+	cfg.SweepInterval = 5 * time.Millisecond
+	cfg.Idle.AwayAfter = 20 * time.Millisecond
+
+	conn, err := net.ListenUDP("udp", &net.UDPAddr{IP: net.IPv4(127, 0, 0, 1)})
+	if err != nil {
+		t.Fatal(err)
+	}
+	serverAddr := conn.LocalAddr().(*net.UDPAddr)
+	srv := server.NewServer(serverAddr.String(), cfg)
+	served := make(chan error, 1)
+	go func() { served <- srv.Serve(conn) }()
+
+	// keep reading the hub's state while clients come and go
+	stop := make(chan struct{})
+	var watcher sync.WaitGroup
+	watcher.Add(1)
+	go func() {
+		defer watcher.Done()
+		for {
+			select {
+			case <-stop:
+				return
+			default:
+				for _, s := range srv.Hub.Sessions() {
+					if s.Transport != "udp" || len(s.Rooms) == 0 {
+						t.Errorf("unexpected session %+v", s)
+					}
+				}
+			}
+		}
+	}()
+
+	var clients sync.WaitGroup
+	for i := range numClients {
+		clients.Add(1)
+		go func() {
+			defer clients.Done()
+
+			client, err := net.DialUDP("udp", nil, serverAddr)
+			if err != nil {
+				t.Error(err)
+				return
+			}
+			defer client.Close()
+
+			name := fmt.Sprintf("client-%d", i)
+			client.Write(protocol.Encode(protocol.Envelope{Type: protocol.TypeRegister, From: name}))
+
+			// the welcome carries the session token
+			client.SetReadDeadline(time.Now().Add(2 * time.Second))
+			buffer := make([]byte, protocol.MaxLineSize)
+			var welcome protocol.Envelope
+			for welcome.Type != protocol.TypeWelcome {
+				n, err := client.Read(buffer)
+				if err != nil {
+					t.Errorf("%s: no welcome: %v", name, err)
+					return
+				}
+				welcome = protocol.Decode(buffer[:n])
+			}
+
+			for j := range 5 {
+				client.Write(protocol.Encode(protocol.Envelope{Type: protocol.TypeMessage, Room: protocol.DefaultRoom, Text: fmt.Sprintf("hello %d", j), Session: welcome.Session}))
+				client.Write(protocol.Encode(protocol.Envelope{Type: protocol.TypeHeartbeat, Seq: uint64(j), Session: welcome.Session}))
+			}
+			client.Write(protocol.Encode(protocol.Envelope{Type: protocol.TypeMessage, Text: "/join race", Session: welcome.Session}))
+
+			switch i % 3 {
+			case 0: // leave politely
+				client.Write(protocol.Encode(protocol.Envelope{Type: protocol.TypeBye, Session: welcome.Session}))
+			case 1: // vanish and let the inactivity timeout expire the session
+			case 2: // move to a new address, as after a NAT rebinding
+				moved, err := net.DialUDP("udp", nil, serverAddr)
+				if err != nil {
+					t.Error(err)
+					return
+				}
+				defer moved.Close()
+				moved.Write(protocol.Encode(protocol.Envelope{Type: protocol.TypeHeartbeat, Session: welcome.Session}))
+			}
+		}()
+	}
+	clients.Wait()
+
+	// every client either left or expired
+	testutil.WaitFor(t, "all sessions to expire", func() bool {
+		return len(srv.Hub.Sessions()) == 0
+	})
+
+	close(stop)
+	watcher.Wait()
+
+	srv.Close()
+	if err := <-served; err != nil {
+		t.Fatalf("Serve returned %v", err)
+	}
+}
@@ -0,0 +1,153 @@
+package config
+
+import (
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/jennxsierra/dualnet-chat/internal/chat"
+	"github.com/jennxsierra/dualnet-chat/internal/config"
+)
+
+// defaults returns the configuration a server starts from before reading a file.
+func defaults() config.File {
+	f := config.New("[::]:4000", chat.DefaultConfig())
+	f.Timeouts.KeepAlive = config.Duration(30 * time.Second)
+	return f
+}
+
+// TestExample checks that the shipped example configuration is valid for both
+// servers, so it can be started as it is.
+func TestExample(t *testing.T) {
+	f, err := config.Load(filepath.Join("..", "..", "configs", "server.example.json"), defaults())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := f.Validate("tcp"); err != nil {
+		t.Errorf("the example is invalid for the TCP server:\n%v", err)
+	}
+	if err := f.Validate("udp"); err != nil {
+		t.Errorf("the example is invalid for the UDP server:\n%v", err)
+	}
+}
+
+// TestLoad checks that settings missing from a file keep their defaults and
+// that unknown settings are rejected.
+func TestLoad(t *testing.T) {
+	dir := t.TempDir()
+	write := func(name, data string) string {
+		path := filepath.Join(dir, name)
+		if err := os.WriteFile(path, []byte(data), 0o600); err != nil {
+			t.Fatal(err)
+		}
+		return path
+	}
+
+	f, err := config.Load(write("partial.json", `{"motd": "hi", "timeouts": {"away_after": "1m"}}`), defaults())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if f.MOTD != "hi" || f.Timeouts.AwayAfter != config.Duration(time.Minute) {
+		t.Errorf("settings from the file were not applied: %+v", f)
+	}
+	if f.Listen != "[::]:4000" || f.Timeouts.Sweep != defaults().Timeouts.Sweep {
+		t.Errorf("settings missing from the file lost their defaults: %+v", f)
+	}
+
+	for name, data := range map[string]string{
+		"typo.json":     `{"mtod": "hi"}`,
+		"duration.json": `{"timeouts": {"sweep_interval": 30}}`,
+		"syntax.json":   `{"motd": }`,
+	} {
+		if _, err := config.Load(write(name, data), defaults()); err == nil {
+			t.Errorf("%s was loaded without an error", name)
+		}
+	}
+}
+
+// TestValidate checks that invalid settings are reported, each by the
+// setting's name, and only for the transport they apply to.
+func TestValidate(t *testing.T) {
+	for _, tc := range []struct {
+		name      string
+		transport string
+		change    func(*config.File)
+		want      string // part of the error, none if empty
+	}{
+		{"defaults", "tcp", func(*config.File) {}, ""},
+		{"port out of range", "tcp", func(f *config.File) { f.Listen = "[::]:70000" }, "listen"},
+		{"listen without port", "tcp", func(f *config.File) { f.Listen = "localhost" }, "listen"},
+		{"metrics without port", "tcp", func(f *config.File) { f.Metrics = "localhost" }, "metrics_listen"},
+		{"admin on a public address", "tcp", func(f *config.File) { f.Admin = config.Admin{Listen: "0.0.0.0:9200", Token: "t"} }, "admin.listen"},
+		{"admin without token", "tcp", func(f *config.File) { f.Admin.Listen = "127.0.0.1:9200" }, "admin.token"},
+		{"admin with token", "tcp", func(f *config.File) { f.Admin = config.Admin{Listen: "127.0.0.1:9200", Token: "t"} }, ""},
+		{"no keepalive", "tcp", func(f *config.File) { f.Timeouts.KeepAlive = 0 }, "timeouts.keepalive"},
+		{"keepalive ignored by udp", "udp", func(f *config.File) { f.Timeouts.KeepAlive = 0 }, ""},
+		{"no inactivity timeout", "udp", func(f *config.File) { f.Timeouts.Inactivity = 0 }, "timeouts.inactivity_timeout"},
+		{"no sweep interval", "tcp", func(f *config.File) { f.Timeouts.Sweep = 0 }, "timeouts.sweep_interval"},
+		{"negative away", "tcp", func(f *config.File) { f.Timeouts.AwayAfter = -1 }, "timeouts.away_after"},
+		{"no message rate", "tcp", func(f *config.File) { f.Limits.MessageRate = 0 }, "limits.message_rate"},
+		{"negative quota", "tcp", func(f *config.File) { f.Limits.FileQuotaMB = -1 }, "limits.file_quota_mb"},
+		{"uppercase room", "tcp", func(f *config.File) { f.Rooms.Allowed = []string{"General"} }, "rooms"},
+		{"missing motd file", "tcp", func(f *config.File) { f.MOTDFile = "does-not-exist.txt" }, "motd_file"},
+		{"bad cron", "tcp", func(f *config.File) { f.Broadcasts = []config.Broadcast{{Cron: "61 * * * *", Text: "hi"}} }, "broadcasts[0]"},
+		{"empty broadcast", "tcp", func(f *config.File) { f.Broadcasts = []config.Broadcast{{Cron: "@hourly"}} }, "broadcasts[0]: text"},
+		{"bad ban", "tcp", func(f *config.File) { f.Bans = []string{"10.0.0.0/99"} }, "bans"},
+		{"unix socket mode", "tcp", func(f *config.File) { f.Unix.Mode = "0999" }, "unix_socket"},
+		{"unix socket on udp", "udp", func(f *config.File) { f.Unix.Path = "/tmp/chat.sock" }, "unix_socket"},
+		{"tls without key", "tcp", func(f *config.File) { f.TLS.Cert = "cert.pem" }, "tls"},
+		{"tls on udp", "udp", func(f *config.File) { f.TLS = config.TLS{Cert: "cert.pem", Key: "key.pem"} }, "tls"},
+		{"announce without interval", "tcp", func(f *config.File) { f.Discovery = config.Discovery{Announce: true} }, "discovery.interval"},
+		{"log level", "tcp", func(f *config.File) { f.Log.Level = "loud" }, "log"},
+	} {
+		f := defaults()
+		tc.change(&f)
+		err := f.Validate(tc.transport)
+		switch {
+		case tc.want == "" && err != nil:
+			t.Errorf("%s: unexpected error:\n%v", tc.name, err)
+		case tc.want != "" && err == nil:
+			t.Errorf("%s: no error, want one about %s", tc.name, tc.want)
+		case tc.want != "" && !strings.Contains(err.Error(), tc.want):
+			t.Errorf("%s: error does not mention %s:\n%v", tc.name, tc.want, err)
+		}
+	}
+
+	// every problem is reported at once
+	f := defaults()
+	f.Limits.MessageRate, f.Limits.MessageBurst = 0, 0
+	if err := f.Validate("tcp"); err == nil || strings.Count(err.Error(), "\n") != 1 {
+		t.Errorf("expected two errors, got:\n%v", err)
+	}
+}
+
+// TestRestartRequired checks which changed settings are reported as needing a
+// restart, and that those a reload applies are not.
+func TestRestartRequired(t *testing.T) {
+	for _, tc := range []struct {
+		name   string
+		change func(*config.File)
+		want   []string
+	}{
+		{"nothing", func(*config.File) {}, nil},
+		{"motd", func(f *config.File) { f.MOTD = "changed" }, nil},
+		{"limits", func(f *config.File) { f.Limits.MessageRate = 5 }, nil},
+		{"timeouts", func(f *config.File) { f.Timeouts.AwayAfter = config.Duration(time.Hour) }, nil},
+		{"bans", func(f *config.File) { f.Bans = []string{"spammer"} }, nil},
+		{"listen", func(f *config.File) { f.Listen = "[::]:4001" }, []string{"listen"}},
+		{"admin token", func(f *config.File) { f.Admin.Token = "new" }, []string{"admin"}},
+		{"tls", func(f *config.File) { f.TLS.Cert = "cert.pem" }, []string{"tls"}},
+		{"discovery", func(f *config.File) { f.Discovery.Name = "lab" }, []string{"discovery"}},
+		{"gateways", func(f *config.File) { f.Web, f.IRC = "[::]:8080", "[::]:6667" }, []string{"websocket_listen", "irc_listen"}},
+		{"unix socket and metrics", func(f *config.File) { f.Unix.Path, f.Metrics = "/tmp/chat.sock", "127.0.0.1:9100" }, []string{"metrics_listen", "unix_socket"}},
+	} {
+		next := defaults()
+		tc.change(&next)
+		if got := config.RestartRequired(defaults(), next); !slices.Equal(got, tc.want) {
+			t.Errorf("%s: RestartRequired = %v, want %v", tc.name, got, tc.want)
+		}
+	}
+}
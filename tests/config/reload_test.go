@@ -0,0 +1,30 @@
+//go:build unix
+
+package config
+
+import (
+	"os"
+	"sync/atomic"
+	"syscall"
+	"testing"
+	"time"
+
+	"github.com/jennxsierra/dualnet-chat/internal/config"
+)
+
+// TestOnReload checks that SIGHUP calls the reload function.
+func TestOnReload(t *testing.T) {
+	var reloads atomic.Int32
+	config.OnReload(func() { reloads.Add(1) })
+
+	if err := syscall.Kill(os.Getpid(), syscall.SIGHUP); err != nil {
+		t.Fatal(err)
+	}
+	deadline := time.Now().Add(5 * time.Second)
+	for reloads.Load() == 0 {
+		if time.Now().After(deadline) {
+			t.Fatal("SIGHUP did not reload the configuration")
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+}
@@ -0,0 +1,144 @@
+package cron
+
+import (
+	"testing"
+	"time"
+
+	"github.com/jennxsierra/dualnet-chat/internal/cron"
+)
+
+// TestParseErrors checks that malformed expressions are rejected.
+func TestParseErrors(t *testing.T) {
+	for _, expr := range []string{
+		"",
+		"* * * *",
+		"* * * * * *",
+		"60 * * * *",
+		"* 24 * * *",
+		"* * 0 * *",
+		"* * 32 * *",
+		"* * * 13 *",
+		"* * * * 8",
+		"5-1 * * * *",
+		"*/0 * * * *",
+		"*/x * * * *",
+		"1,,2 * * * *",
+		"a * * * *",
+		"-1 * * * *",
+		"@often",
+	} {
+		if _, err := cron.Parse(expr); err == nil {
+			t.Errorf("Parse(%q) succeeded", expr)
+		}
+	}
+}
+
+// TestNext checks when schedules fire next, from steps, ranges and lists to
+// Sunday written as 7 and cron's rule that a restricted day of month and day
+// of week match either one.
+func TestNext(t *testing.T) {
+	// Wednesday, 15 May 2024, 10:07:30
+	from := time.Date(2024, 5, 15, 10, 7, 30, 0, time.UTC)
+	at := func(month time.Month, day, hour, minute int) time.Time {
+		return time.Date(2024, month, day, hour, minute, 0, 0, time.UTC)
+	}
+
+	for _, tc := range []struct {
+		expr string
+		want time.Time
+	}{
+		{"* * * * *", at(5, 15, 10, 8)},
+		{"*/15 * * * *", at(5, 15, 10, 15)},
+		{"5/15 * * * *", at(5, 15, 10, 20)},
+		{"0-10/5 * * * *", at(5, 15, 10, 10)},
+		{"7 * * * *", at(5, 15, 11, 7)}, // 10:07 itself has passed
+		{"0,30 9,17 * * *", at(5, 15, 17, 0)},
+		{"0 9 * * 1-5", at(5, 16, 9, 0)},
+		{"0 9 * * 0", at(5, 19, 9, 0)},
+		{"0 9 * * 7", at(5, 19, 9, 0)}, // 7 is Sunday too
+		{"0 9 * * 5-7", at(5, 17, 9, 0)},
+		{"0 0 1 * *", at(6, 1, 0, 0)},
+		{"0 0 * 8 *", at(8, 1, 0, 0)},
+		{"0 0 20 * 1", at(5, 20, 0, 0)}, // the 20th, which is also a Monday
+		{"0 0 18 * 5", at(5, 17, 0, 0)}, // Friday the 17th comes before the 18th
+		{"0 0 31 * *", at(5, 31, 0, 0)},
+		{"@hourly", at(5, 15, 11, 0)},
+		{"@daily", at(5, 16, 0, 0)},
+		{"@weekly", at(5, 19, 0, 0)},
+		{"@monthly", at(6, 1, 0, 0)},
+		{"@yearly", time.Date(2025, 1, 1, 0, 0, 0, 0, time.UTC)},
+	} {
+		schedule, err := cron.Parse(tc.expr)
+		if err != nil {
+			t.Errorf("Parse(%q): %v", tc.expr, err)
+			continue
+		}
+		if got := schedule.Next(from); !got.Equal(tc.want) {
+			t.Errorf("%q: Next = %v, want %v", tc.expr, got, tc.want)
+		}
+	}
+}
+
+// TestNextLimit checks that a schedule firing rarely is found years ahead, and
+// one that never fires gives up with the zero time.
+func TestNextLimit(t *testing.T) {
+	from := time.Date(2025, 3, 1, 0, 0, 0, 0, time.UTC)
+
+	leap, _ := cron.Parse("0 0 29 2 *")
+	if got, want := leap.Next(from), time.Date(2028, 2, 29, 0, 0, 0, 0, time.UTC); !got.Equal(want) {
+		t.Errorf("29 February: Next = %v, want %v", got, want)
+	}
+
+	never, _ := cron.Parse("0 0 31 2 *")
+	if got := never.Next(from); !got.IsZero() {
+		t.Errorf("31 February: Next = %v, want the zero time", got)
+	}
+}
+
+// TestNextDST checks schedules across daylight saving changes: a time the
+// clocks skip does not fire that day, and others fire at the local time.
+func TestNextDST(t *testing.T) {
+	loc, err := time.LoadLocation("America/New_York")
+	if err != nil {
+		t.Skipf("no time zone database: %v", err)
+	}
+	// clocks went from 2:00 to 3:00 on 10 March 2024, and from 2:00 back to
+	// 1:00 on 3 November 2024
+	for _, tc := range []struct {
+		expr string
+		from time.Time
+		want time.Time
+	}{
+		{"30 2 * * *", time.Date(2024, 3, 10, 0, 0, 0, 0, loc), time.Date(2024, 3, 11, 2, 30, 0, 0, loc)},
+		{"0 3 * * *", time.Date(2024, 3, 10, 0, 0, 0, 0, loc), time.Date(2024, 3, 10, 3, 0, 0, 0, loc)},
+		{"0 * * * *", time.Date(2024, 3, 10, 1, 30, 0, 0, loc), time.Date(2024, 3, 10, 3, 0, 0, 0, loc)},
+		{"0 3 * * *", time.Date(2024, 3, 10, 1, 30, 0, 0, loc), time.Date(2024, 3, 10, 3, 0, 0, 0, loc)},
+		{"0 9 * * *", time.Date(2024, 3, 9, 12, 0, 0, 0, loc), time.Date(2024, 3, 10, 9, 0, 0, 0, loc)},
+		{"0 9 * * *", time.Date(2024, 11, 2, 12, 0, 0, 0, loc), time.Date(2024, 11, 3, 9, 0, 0, 0, loc)},
+		{"0 3 * * *", time.Date(2024, 11, 3, 0, 0, 0, 0, loc), time.Date(2024, 11, 3, 3, 0, 0, 0, loc)},
+	} {
+		schedule, _ := cron.Parse(tc.expr)
+		if got := schedule.Next(tc.from); !got.Equal(tc.want) {
+			t.Errorf("%q from %v: Next = %v, want %v", tc.expr, tc.from, got, tc.want)
+		}
+	}
+}
+
+// TestNextMidnightGap checks a daylight saving change that skips midnight,
+// which [time.Date] moves to the evening before.
+func TestNextMidnightGap(t *testing.T) {
+	loc, err := time.LoadLocation("America/Santiago")
+	if err != nil {
+		t.Skipf("no time zone database: %v", err)
+	}
+	// clocks went from 0:00 to 1:00 on 8 September 2024
+	daily, _ := cron.Parse("@daily")
+	from := time.Date(2024, 9, 7, 12, 0, 0, 0, loc)
+	if got, want := daily.Next(from), time.Date(2024, 9, 9, 0, 0, 0, 0, loc); !got.Equal(want) {
+		t.Errorf("@daily from %v: Next = %v, want %v", from, got, want)
+	}
+	hourly, _ := cron.Parse("@hourly")
+	if got, want := hourly.Next(time.Date(2024, 9, 7, 23, 30, 0, 0, loc)), time.Date(2024, 9, 8, 1, 0, 0, 0, loc); !got.Equal(want) {
+		t.Errorf("@hourly across the gap: Next = %v, want %v", got, want)
+	}
+}
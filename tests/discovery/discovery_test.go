@@ -0,0 +1,109 @@
+package discovery
+
+import (
+	"encoding/json"
+	"errors"
+	"io"
+	"net"
+	"strings"
+	"testing"
+
+	"github.com/jennxsierra/dualnet-chat/internal/discovery"
+)
+
+// servers are a TCP server with TLS, a UDP server on the same host and a TCP
+// server on an IPv6 host, as [discovery.Discover] would find them.
+var servers = []discovery.Server{
+	{Host: "192.168.1.5", Announcement: discovery.Announcement{Name: "lab", Rooms: 3, Clients: 7,
+		Endpoints: []discovery.Endpoint{{Transport: "tcp", Port: 4000, TLS: true}, {Transport: "ws", Port: 8080}}}},
+	{Host: "192.168.1.5", Announcement: discovery.Announcement{Name: "lab", Rooms: 1, Clients: 2,
+		Endpoints: []discovery.Endpoint{{Transport: "udp", Port: 4001}}}},
+	{Host: "fe80::1", Announcement: discovery.Announcement{Name: "attic", Rooms: 1,
+		Endpoints: []discovery.Endpoint{{Transport: "tcp", Port: 4040}}}},
+}
+
+// TestAnnouncement checks that announcements keep their endpoints through
+// encoding, and that servers give the address of each transport's endpoint.
+func TestAnnouncement(t *testing.T) {
+	data := `{"type":"announce","name":"lab","endpoints":[{"transport":"tcp","port":4000,"tls":true},{"transport":"udp","port":4001}],"rooms":3,"clients":7}`
+	var a discovery.Announcement
+	if err := json.Unmarshal([]byte(data), &a); err != nil {
+		t.Fatal(err)
+	}
+	if encoded, _ := json.Marshal(a); string(encoded) != data {
+		t.Errorf("encoded as %s, want %s", encoded, data)
+	}
+	if e, ok := a.Endpoint("tcp"); !ok || e.Port != 4000 || !e.TLS {
+		t.Errorf("tcp endpoint %+v, %v", e, ok)
+	}
+	if e, ok := a.Endpoint("udp"); !ok || e.Port != 4001 || e.TLS {
+		t.Errorf("udp endpoint %+v, %v", e, ok)
+	}
+	if _, ok := a.Endpoint("irc"); ok {
+		t.Error("found an irc endpoint the server does not announce")
+	}
+
+	for _, test := range []struct {
+		server    discovery.Server
+		transport string
+		want      string
+	}{
+		{servers[0], "tcp", "192.168.1.5:4000"},
+		{servers[0], "ws", "192.168.1.5:8080"},
+		{servers[1], "udp", "192.168.1.5:4001"},
+		{servers[2], "tcp", "[fe80::1]:4040"},
+		{servers[1], "tcp", ""},
+	} {
+		if addr, ok := test.server.Addr(test.transport); addr != test.want || ok != (test.want != "") {
+			t.Errorf("%s %s address %q, %v, want %q", test.server.Host, test.transport, addr, ok, test.want)
+		}
+	}
+}
+
+// TestChoose checks that only the servers offering the transport are listed,
+// that invalid picks are asked again, and what happens without any to pick.
+func TestChoose(t *testing.T) {
+	var out strings.Builder
+	server, addr, err := discovery.Choose(servers, "tcp", strings.NewReader("0\nlab\n3\n2\n"), &out)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if server.Name != "attic" || addr != "[fe80::1]:4040" {
+		t.Errorf("picked %s at %s, want attic at [fe80::1]:4040", server.Name, addr)
+	}
+	want := "Servers on the local network:\n" +
+		"  1) lab at 192.168.1.5:4000 (3 rooms, 7 clients, TLS)\n" +
+		"  2) attic at [fe80::1]:4040 (1 rooms, 0 clients)\n" +
+		strings.Repeat("Pick a server [1-2]: ", 4)
+	if out.String() != want {
+		t.Errorf("listed\n%s\nwant\n%s", out.String(), want)
+	}
+
+	if _, _, err := discovery.Choose(servers, "irc", strings.NewReader("1\n"), io.Discard); !errors.Is(err, discovery.ErrNoServers) {
+		t.Errorf("choosing an irc server: %v, want ErrNoServers", err)
+	}
+	if _, _, err := discovery.Choose(servers, "udp", strings.NewReader("5\n"), io.Discard); err != io.EOF {
+		t.Errorf("choosing without a valid pick: %v, want EOF", err)
+	}
+}
+
+// TestLocal checks which probes servers answer.
+func TestLocal(t *testing.T) {
+	for addr, want := range map[string]bool{
+		"127.0.0.1":    true,
+		"::1":          true,
+		"10.1.2.3":     true,
+		"172.16.0.9":   true,
+		"192.168.1.5":  true,
+		"169.254.7.7":  true,
+		"fe80::1":      true,
+		"fd00::5":      true,
+		"8.8.8.8":      false,
+		"203.0.113.10": false,
+		"2001:db8::1":  false,
+	} {
+		if got := discovery.Local(net.ParseIP(addr)); got != want {
+			t.Errorf("Local(%s) = %v, want %v", addr, got, want)
+		}
+	}
+}
@@ -0,0 +1,61 @@
+package format
+
+import (
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/fatih/color"
+	"github.com/jennxsierra/dualnet-chat/internal/protocol"
+	"github.com/jennxsierra/dualnet-chat/internal/ui"
+)
+
+// TestPlain checks the lines shown without colors, as with --no-color or
+// NO_COLOR: timestamps in the chosen layout, and no escape sequences from the
+// server.
+func TestPlain(t *testing.T) {
+	defer func(noColor bool) { color.NoColor = noColor }(color.NoColor)
+	color.NoColor = true
+
+	at := time.Date(2024, 5, 1, 9, 30, 0, 0, time.Local)
+	for _, tc := range []struct {
+		format string
+		e      protocol.Envelope
+		want   string
+	}{
+		{"15:04", protocol.Envelope{Type: protocol.TypeMessage, From: "carol", Text: "hi", Time: at}, "09:30 [carol]: hi"},
+		{"", protocol.Envelope{Type: protocol.TypeMessage, From: "carol", Room: "random", Text: "hi", Time: at}, "#random [carol]: hi"},
+		{"", protocol.Envelope{Type: protocol.TypeMessage, From: "carol", To: "bob", Text: "psst", Time: at}, "[carol -> bob]: psst"},
+		{"", protocol.Envelope{Type: protocol.TypeMessage, From: "mallory", Text: "\x1b[2Jgone", Time: at}, "[mallory]: �[2Jgone"},
+		{"", protocol.Envelope{Type: protocol.TypeError, Text: "Unknown command.", Time: at}, "[server]: Unknown command."},
+	} {
+		f := ui.Format{TimeFormat: tc.format}
+		if got := f.Envelope(tc.e); got != tc.want {
+			t.Errorf("Envelope(%+v) = %q, want %q", tc.e, got, tc.want)
+		}
+	}
+}
+
+// TestSenderColors checks that a user keeps the same color from any address,
+// and that the kinds of lines are told apart by their styles.
+func TestSenderColors(t *testing.T) {
+	defer func(noColor bool) { color.NoColor = noColor }(color.NoColor)
+	color.NoColor = false
+
+	var f ui.Format
+	name := func(from string) string {
+		line := f.Envelope(protocol.Envelope{Type: protocol.TypeMessage, From: from, Text: "hi"})
+		return line[:strings.Index(line, "[carol")]
+	}
+	if a, b := name("carol@10.0.0.2:5000"), name("carol@10.0.0.3:6000"); a != b || a == "" {
+		t.Errorf("carol got colors %q and %q", a, b)
+	}
+
+	join := f.Envelope(protocol.Envelope{Type: protocol.TypeJoin, From: "carol", Room: "general"})
+	leave := f.Envelope(protocol.Envelope{Type: protocol.TypeLeave, From: "carol", Room: "general"})
+	notice := f.Envelope(protocol.Envelope{Type: protocol.TypeNotice, Text: "hello"})
+	errs := f.Envelope(protocol.Envelope{Type: protocol.TypeError, Text: "hello"})
+	if join[:5] == leave[:5] || notice[:5] == errs[:5] {
+		t.Errorf("styles are not told apart: %q %q %q %q", join, leave, notice, errs)
+	}
+}
@@ -0,0 +1,171 @@
+package ipv6
+
+import (
+	"net"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/jennxsierra/dualnet-chat/internal/netutils"
+	"github.com/jennxsierra/dualnet-chat/internal/protocol"
+	tcpserver "github.com/jennxsierra/dualnet-chat/internal/tcp/server"
+	udpserver "github.com/jennxsierra/dualnet-chat/internal/udp/server"
+	"github.com/jennxsierra/dualnet-chat/tests/testutil"
+)
+
+func TestMain(m *testing.M) {
+	testutil.Main(m)
+}
+
+// listenTCP listens on addr, skipping the test if the machine has no IPv6.
+func listenTCP(t *testing.T, addr string) net.Listener {
+	t.Helper()
+	listener, err := net.Listen("tcp", addr)
+	if err != nil {
+		t.Skipf("IPv6 is not available: %v", err)
+	}
+	return listener
+}
+
+// TestParseAddress checks that IPv6 server addresses, with and without a zone,
+// are accepted.
+func TestParseAddress(t *testing.T) {
+	for _, s := range []string{"[::1]:4000", "tcp://[::1]:4000", "[fe80::1%lo]:4000"} {
+		addr, err := netutils.ParseAddress(s)
+		if err != nil {
+			t.Errorf("ParseAddress(%q): %v", s, err)
+			continue
+		}
+		if addr.Network != "tcp" || !strings.HasPrefix(addr.Address, "[") {
+			t.Errorf("ParseAddress(%q) = %+v", s, addr)
+		}
+	}
+
+	if _, err := netutils.ParseAddress("::1:4000"); err == nil {
+		t.Error("ParseAddress accepted an IPv6 address without brackets")
+	}
+}
+
+// TestTCPOverIPv6 chats between two TCP clients connected over ::1.
+func TestTCPOverIPv6(t *testing.T) {
+	listener := listenTCP(t, "[::1]:0")
+	srv := testutil.Serve(t, listener, tcpserver.DefaultConfig())
+	addr := listener.Addr().String()
+
+	alice, _ := testutil.Connect(t, "tcp", addr, "alice")
+	bob, bobReader := testutil.Connect(t, "tcp", addr, "bob")
+
+	alice.Write(protocol.Encode(protocol.Envelope{Type: protocol.TypeMessage, Text: "hello over IPv6"}))
+	if e := testutil.Expect(t, bob, bobReader, protocol.TypeMessage); e.From != "alice" || e.Text != "hello over IPv6" {
+		t.Errorf("bob received %+v", e)
+	}
+
+	for _, s := range srv.Hub.Sessions() {
+		if !strings.HasPrefix(s.Addr, "[::1]:") {
+			t.Errorf("session %s has address %s, want [::1]:port", s.Name, s.Addr)
+		}
+	}
+}
+
+// TestTCPDualStack checks that a server listening on [::] also accepts IPv4
+// clients, and sees their plain IPv4 address.
+func TestTCPDualStack(t *testing.T) {
+	listener := listenTCP(t, "[::]:0")
+	srv := testutil.Serve(t, listener, tcpserver.DefaultConfig())
+	port := listener.Addr().(*net.TCPAddr).Port
+
+	testutil.Connect(t, "tcp", net.JoinHostPort("127.0.0.1", strconv.Itoa(port)), "v4")
+	testutil.Connect(t, "tcp", net.JoinHostPort("::1", strconv.Itoa(port)), "v6")
+
+	addrs := map[string]string{}
+	for _, s := range srv.Hub.Sessions() {
+		host, _, _ := net.SplitHostPort(s.Addr)
+		addrs[s.Name] = host
+	}
+	if addrs["v4"] != "127.0.0.1" || addrs["v6"] != "::1" {
+		t.Errorf("sessions have addresses %v", addrs)
+	}
+}
+
+// TestUDPOverIPv6 registers a UDP client over ::1.
+func TestUDPOverIPv6(t *testing.T) {
+	conn, err := net.ListenUDP("udp", &net.UDPAddr{IP: net.IPv6loopback})
+	if err != nil {
+		t.Skipf("IPv6 is not available: %v", err)
+	}
+	srv := udpserver.NewServer(conn.LocalAddr().String(), udpserver.DefaultConfig())
+	served := make(chan error, 1)
+	go func() { served <- srv.Serve(conn) }()
+	defer func() {
+		srv.Close()
+		<-served
+	}()
+
+	client, err := net.DialUDP("udp", nil, conn.LocalAddr().(*net.UDPAddr))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer client.Close()
+
+	client.Write(protocol.Encode(protocol.Envelope{Type: protocol.TypeRegister, From: "carol"}))
+	buffer := make([]byte, 64*1024)
+	client.SetReadDeadline(time.Now().Add(2 * time.Second))
+	n, err := client.Read(buffer)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if e := protocol.Decode(buffer[:n]); e.Type != protocol.TypeWelcome {
+		t.Fatalf("expected a welcome, got %+v", e)
+	}
+
+	sessions := srv.Hub.Sessions()
+	if len(sessions) != 1 || !strings.HasPrefix(sessions[0].Addr, "[::1]:") {
+		t.Errorf("sessions = %+v", sessions)
+	}
+}
+
+// TestListenAddrs checks the addresses shown in the banner of a server: only
+// its own for a single IPv6 address, both families for a dual-stack socket and
+// only IPv4 for "0.0.0.0".
+func TestListenAddrs(t *testing.T) {
+	families := func(addrs []netutils.InterfaceAddr) (v4, v6 bool) {
+		for _, a := range addrs {
+			if a.Addr.(*net.UDPAddr).IP.To4() != nil {
+				v4 = true
+			} else {
+				v6 = true
+			}
+		}
+		return v4, v6
+	}
+
+	addrs := netutils.ListenAddrs("udp", &net.UDPAddr{IP: net.IPv6loopback, Port: 4000})
+	if len(addrs) != 1 || addrs[0].Addr.String() != "[::1]:4000" {
+		t.Errorf("addresses for [::1]:4000 are %v", addrs)
+	}
+
+	if v4, v6 := families(netutils.ListenAddrs("udp", &net.UDPAddr{IP: net.IPv6unspecified, Port: 4001})); !v4 || !v6 {
+		t.Errorf("addresses for [::]:4001 include IPv4 %v and IPv6 %v, want both", v4, v6)
+	}
+	if _, v6 := families(netutils.ListenAddrs("udp", &net.UDPAddr{IP: net.IPv4zero, Port: 4002})); v6 {
+		t.Error("addresses for 0.0.0.0:4002 include IPv6 ones")
+	}
+}
+
+// TestWelcomeAddr checks that the welcome tells a client the address the
+// server sees it at.
+func TestWelcomeAddr(t *testing.T) {
+	listener := listenTCP(t, "[::1]:0")
+	testutil.Serve(t, listener, tcpserver.DefaultConfig())
+
+	conn, err := net.Dial("tcp", listener.Addr().String())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+	conn.Write(protocol.Encode(protocol.Envelope{Type: protocol.TypeRegister, From: "dave"}))
+	if e := testutil.Expect(t, conn, protocol.NewReader(conn), protocol.TypeWelcome); e.Addr != conn.LocalAddr().String() {
+		t.Errorf("welcome addr is %q, want %q", e.Addr, conn.LocalAddr())
+	}
+}
@@ -0,0 +1,113 @@
+package irc
+
+import (
+	"bufio"
+	"io"
+	"net"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/jennxsierra/dualnet-chat/internal/irc"
+	"github.com/jennxsierra/dualnet-chat/internal/protocol"
+	"github.com/jennxsierra/dualnet-chat/internal/tcp/server"
+	"github.com/jennxsierra/dualnet-chat/tests/testutil"
+)
+
+func TestMain(m *testing.M) {
+	testutil.Main(m)
+}
+
+// TestPrivmsgToTCPClient checks that an IRC user can send a direct message to
+// a TCP client by the nickname the gateway shows it under, which has "_" for
+// the "@" of its name.
+func TestPrivmsgToTCPClient(t *testing.T) {
+	srv, addr := testutil.StartTCP(t, server.DefaultConfig())
+
+	ircListener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { ircListener.Close() })
+	go irc.Serve(ircListener, srv.Hub)
+
+	// the TCP client, named after its address as the real one is
+	tcpConn, reader := testutil.Connect(t, "tcp", addr, "alice@127.0.0.1:51756")
+
+	ircConn, err := net.Dial("tcp", ircListener.Addr().String())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer ircConn.Close()
+	go io.Copy(io.Discard, bufio.NewReader(ircConn))
+	io.WriteString(ircConn, "NICK bob\r\nUSER bob 0 * :Bob\r\nPRIVMSG alice_127.0.0.1:51756 :hi alice\r\n")
+
+	tcpConn.SetReadDeadline(time.Now().Add(5 * time.Second))
+	for {
+		e, err := reader.Read()
+		if err != nil {
+			t.Fatalf("the direct message did not arrive: %v", err)
+		}
+		if e.Type == protocol.TypeError {
+			t.Fatalf("the message was refused: %s", e.Text)
+		}
+		if e.Type == protocol.TypeMessage && strings.Contains(e.Text, "hi alice") {
+			if e.From != "bob" || e.To != "alice@127.0.0.1:51756" {
+				t.Errorf("got %+v, want a direct message from bob to alice", e)
+			}
+			return
+		}
+	}
+}
+
+// TestNoLineInjection checks that a carriage return in a message from another
+// transport cannot start an IRC line of its own, e.g. one that looks like a
+// message from someone else.
+func TestNoLineInjection(t *testing.T) {
+	srv, addr := testutil.StartTCP(t, server.DefaultConfig())
+
+	ircListener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { ircListener.Close() })
+	go irc.Serve(ircListener, srv.Hub)
+
+	ircConn, err := net.Dial("tcp", ircListener.Addr().String())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer ircConn.Close()
+	io.WriteString(ircConn, "NICK bob\r\nUSER bob 0 * :Bob\r\n")
+	ircConn.SetReadDeadline(time.Now().Add(5 * time.Second))
+	lines := bufio.NewReader(ircConn)
+	for {
+		line, err := lines.ReadString('\n')
+		if err != nil {
+			t.Fatalf("bob was not welcomed: %v", err)
+		}
+		if strings.Contains(line, " 366 ") { // the end of the names of #general
+			break
+		}
+	}
+
+	tcpConn, _ := testutil.Connect(t, "tcp", addr, "alice")
+	tcpConn.Write(protocol.Encode(protocol.Envelope{Type: protocol.TypeMessage, Text: "hi\r:evil!x@host PRIVMSG #general :spoof\x00"}))
+	tcpConn.Write(protocol.Encode(protocol.Envelope{Type: protocol.TypeMessage, Text: "done"}))
+
+	for {
+		line, err := lines.ReadString('\n')
+		if err != nil {
+			t.Fatalf("alice's messages did not arrive: %v", err)
+		}
+		if !strings.HasSuffix(line, "\r\n") || strings.ContainsAny(strings.TrimSuffix(line, "\r\n"), "\r\n\x00") {
+			t.Errorf("line %q has stray line breaks or NUL bytes", line)
+		}
+		if strings.Contains(line, "PRIVMSG") && !strings.HasPrefix(line, ":alice!") {
+			t.Errorf("line %q is not from alice", line)
+		}
+		if strings.HasSuffix(line, " :done\r\n") {
+			return
+		}
+	}
+}
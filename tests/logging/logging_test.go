@@ -0,0 +1,199 @@
+package logging
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/jennxsierra/dualnet-chat/internal/logging"
+)
+
+// TestValidate checks which levels and formats are accepted, and that every
+// problem is reported at once.
+func TestValidate(t *testing.T) {
+	if err := logging.DefaultConfig().Validate(); err != nil {
+		t.Fatalf("the default configuration is invalid: %v", err)
+	}
+
+	for _, level := range []string{"debug", "info", "warn", "error", "WARN", " error "} {
+		c := logging.DefaultConfig()
+		c.Level = level
+		if err := c.Validate(); err != nil {
+			t.Errorf("level %q was refused: %v", level, err)
+		}
+	}
+	for _, format := range []string{"text", "json"} {
+		c := logging.DefaultConfig()
+		c.Format = format
+		if err := c.Validate(); err != nil {
+			t.Errorf("format %q was refused: %v", format, err)
+		}
+	}
+
+	c := logging.Config{Level: "verbose", Format: "xml", MaxSizeMB: -1}
+	err := c.Validate()
+	if err == nil {
+		t.Fatal("an invalid configuration was accepted")
+	}
+	for _, want := range []string{`log level "verbose"`, `log format "xml"`, "must not be negative"} {
+		if !strings.Contains(err.Error(), want) {
+			t.Errorf("%q does not mention %s", err, want)
+		}
+	}
+	if _, _, err := logging.New(c, io.Discard); err == nil {
+		t.Error("New accepted an invalid configuration")
+	}
+
+	for _, level := range []string{"", "loud"} {
+		c := logging.DefaultConfig()
+		c.Level = level
+		if err := c.Validate(); err == nil {
+			t.Errorf("level %q was accepted", level)
+		}
+	}
+}
+
+// TestLevelAndFormat checks that records below the level are dropped, and that
+// the rest are written in the configured format.
+func TestLevelAndFormat(t *testing.T) {
+	var out bytes.Buffer
+	logger, closer, err := logging.New(logging.Config{Level: "warn", Format: "json"}, &out)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer closer.Close()
+
+	logger.Info("not shown")
+	logger.Warn("shown", "client", "alice")
+	var record map[string]any
+	if err := json.Unmarshal(out.Bytes(), &record); err != nil {
+		t.Fatalf("%q is not one JSON record: %v", out.String(), err)
+	}
+	if record["level"] != "WARN" || record["msg"] != "shown" || record["client"] != "alice" {
+		t.Errorf("logged %v", record)
+	}
+
+	out.Reset()
+	logger, closer, err = logging.New(logging.Config{Level: "debug", Format: "text"}, &out)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer closer.Close()
+	logger.Debug("details", "client", "bob")
+	if line := out.String(); !strings.Contains(line, "level=DEBUG") || !strings.Contains(line, "msg=details client=bob") {
+		t.Errorf("logged %q", line)
+	}
+}
+
+// lines returns the numbers of the records in a log file written by
+// TestRotation, failing the test if a record is cut short.
+func lines(t *testing.T, path string) []int {
+	t.Helper()
+	file, err := os.Open(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer file.Close()
+
+	var numbers []int
+	scanner := bufio.NewScanner(file)
+	for scanner.Scan() {
+		var record struct{ N int }
+		if err := json.Unmarshal(scanner.Bytes(), &record); err != nil {
+			t.Fatalf("%s holds a broken record %q: %v", filepath.Base(path), scanner.Text(), err)
+		}
+		numbers = append(numbers, record.N)
+	}
+	if err := scanner.Err(); err != nil {
+		t.Fatal(err)
+	}
+	return numbers
+}
+
+// TestRotation checks that the log file is rotated before it grows past its
+// size limit, that only the configured number of backups is kept, newest
+// first, and that logging goes on in a fresh file.
+func TestRotation(t *testing.T) {
+	for _, backups := range []int{0, 2} {
+		path := filepath.Join(t.TempDir(), "chat.log")
+		logger, closer, err := logging.New(logging.Config{Level: "info", Format: "json", File: path, MaxSizeMB: 1, MaxBackups: backups}, io.Discard)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		// about 4 MB, enough to rotate three times
+		text := strings.Repeat("x", 1000)
+		const records = 4000
+		for n := range records {
+			logger.Info(text, "n", n)
+		}
+
+		names := []string{path}
+		for i := 1; i <= backups; i++ {
+			names = append(names, fmt.Sprintf("%s.%d", path, i))
+		}
+		if _, err := os.Stat(fmt.Sprintf("%s.%d", path, backups+1)); !os.IsNotExist(err) {
+			t.Errorf("%d backups: one too many was kept", backups)
+		}
+
+		// the backups hold the records just before those of the newer files
+		next := records
+		for _, name := range names {
+			info, err := os.Stat(name)
+			if err != nil {
+				t.Fatalf("%d backups: %v", backups, err)
+			}
+			if info.Size() > 1<<20 {
+				t.Errorf("%d backups: %s grew to %d bytes", backups, filepath.Base(name), info.Size())
+			}
+			numbers := lines(t, name)
+			if len(numbers) == 0 || numbers[len(numbers)-1] != next-1 {
+				t.Fatalf("%d backups: %s ends with the wrong record", backups, filepath.Base(name))
+			}
+			for i, n := range numbers {
+				if n != numbers[0]+i {
+					t.Fatalf("%d backups: %s skips from record %d to %d", backups, filepath.Base(name), numbers[0]+i-1, n)
+				}
+			}
+			next = numbers[0]
+		}
+
+		logger.Info("after rotating", "n", records)
+		if err := closer.Close(); err != nil {
+			t.Fatal(err)
+		}
+		if numbers := lines(t, path); numbers[len(numbers)-1] != records {
+			t.Errorf("%d backups: the last record went missing", backups)
+		}
+	}
+}
+
+// TestRotateExisting checks that a log file already near its limit is rotated
+// on the first write, keeping what it held as a backup.
+func TestRotateExisting(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "chat.log")
+	old := bytes.Repeat([]byte("old record\n"), (1<<20)/11)
+	if err := os.WriteFile(path, old, 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	logger, closer, err := logging.New(logging.Config{Level: "info", Format: "text", File: path, MaxSizeMB: 1, MaxBackups: 1}, io.Discard)
+	if err != nil {
+		t.Fatal(err)
+	}
+	logger.Info("new record")
+	closer.Close()
+
+	if backup, err := os.ReadFile(path + ".1"); err != nil || !bytes.Equal(backup, old) {
+		t.Errorf("the backup does not hold the old records: %v", err)
+	}
+	if current, err := os.ReadFile(path); err != nil || !strings.Contains(string(current), "new record") || strings.Contains(string(current), "old record") {
+		t.Errorf("the log file holds %q, %v; want the new record only", current, err)
+	}
+}
@@ -0,0 +1,87 @@
+package metrics
+
+import (
+	"io"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/jennxsierra/dualnet-chat/internal/metrics"
+)
+
+// scrape returns what the metrics handler serves.
+func scrape(t *testing.T) string {
+	t.Helper()
+	rec := httptest.NewRecorder()
+	metrics.Handler().ServeHTTP(rec, httptest.NewRequest("GET", "/metrics", nil))
+	if ct := rec.Header().Get("Content-Type"); !strings.HasPrefix(ct, "text/plain; version=0.0.4") {
+		t.Errorf("served as %q", ct)
+	}
+	body, _ := io.ReadAll(rec.Body)
+	return string(body)
+}
+
+// expectLines checks that the lines appear in the scrape, one after the other.
+func expectLines(t *testing.T, scraped string, lines ...string) {
+	t.Helper()
+	want := strings.Join(lines, "\n") + "\n"
+	if !strings.Contains(scraped, want) {
+		t.Errorf("the scrape lacks\n%s\nin\n%s", want, scraped)
+	}
+}
+
+// TestExposition checks the text format of every kind of metric.
+func TestExposition(t *testing.T) {
+	counter := metrics.NewCounter("test_events_total", "Events seen.")
+	counter.Inc()
+	counter.Inc()
+
+	counters := metrics.NewCounterVec("test_requests_total", `Requests, by "path" \ method.`+"\nSecond line.", "path")
+	counters.Inc("/b")
+	counters.Add("/a", 3)
+	counters.Inc(`say "hi" \ bye` + "\n\tagain")
+
+	gauges := metrics.NewGaugeVec("test_open_connections", "Connections open.", "transport")
+	gauges.Add("udp", 2)
+	gauges.Add("tcp", 5)
+	gauges.Add("tcp", -1)
+
+	histogram := metrics.NewHistogram("test_duration_seconds", "Time taken.", []float64{0.01, 0.1, 1})
+	for _, v := range []float64{0.005, 0.05, 0.05, 0.5, 5} {
+		histogram.Observe(v)
+	}
+
+	scraped := scrape(t)
+	expectLines(t, scraped,
+		"# HELP test_events_total Events seen.",
+		"# TYPE test_events_total counter",
+		"test_events_total 2",
+	)
+	expectLines(t, scraped,
+		`# HELP test_requests_total Requests, by "path" \\ method.\nSecond line.`,
+		"# TYPE test_requests_total counter",
+		`test_requests_total{path="/a"} 3`,
+		`test_requests_total{path="/b"} 1`,
+		`test_requests_total{path="say \"hi\" \\ bye\n`+"\t"+`again"} 1`,
+	)
+	expectLines(t, scraped,
+		"# HELP test_open_connections Connections open.",
+		"# TYPE test_open_connections gauge",
+		`test_open_connections{transport="tcp"} 4`,
+		`test_open_connections{transport="udp"} 2`,
+	)
+	expectLines(t, scraped,
+		"# HELP test_duration_seconds Time taken.",
+		"# TYPE test_duration_seconds histogram",
+		`test_duration_seconds_bucket{le="0.01"} 1`,
+		`test_duration_seconds_bucket{le="0.1"} 3`,
+		`test_duration_seconds_bucket{le="1"} 4`,
+		`test_duration_seconds_bucket{le="+Inf"} 5`,
+		"test_duration_seconds_sum 5.605",
+		"test_duration_seconds_count 5",
+	)
+
+	if counter.Value() != 2 || counters.Value("/a") != 3 || gauges.Value("tcp") != 4 || histogram.Count() != 5 {
+		t.Errorf("the values read back differ from the scrape")
+	}
+}
@@ -1,16 +1,18 @@
 package network
 
 import (
-	"io"
 	"log"
+	"log/slog"
 	"net"
 	"os"
 	"testing"
 	"time"
+
+	"github.com/jennxsierra/dualnet-chat/internal/logging"
 )
 
 // logger for printing to standard output and a log file
-var testLogger *log.Logger
+var testLogger *slog.Logger
 
 // log file path
 const logFilePath = "results/tcp_tests.log"
@@ -23,18 +25,15 @@ func init() {
 		log.Printf("Warning: Could not create log directory %s: %v", logDir, err)
 	}
 
-	var writers []io.Writer = []io.Writer{os.Stdout}
-
-	// open the log file for writing
-	file, err := os.OpenFile(logFilePath, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0644)
-	if err == nil {
-		writers = append(writers, file)
-	} else {
+	// log to standard output and the log file
+	cfg := logging.DefaultConfig()
+	cfg.File = logFilePath
+	logger, _, err := logging.New(cfg, os.Stdout)
+	if err != nil {
 		log.Printf("Warning: Could not log to file %s: %v", logFilePath, err)
+		logger, _, _ = logging.New(logging.DefaultConfig(), os.Stdout)
 	}
-
-	// initialize the logger with the writers
-	testLogger = log.New(io.MultiWriter(writers...), "", log.LstdFlags)
+	testLogger = logger.With("transport", "tcp")
 }
 
 // TestConnectionLatency tests for the roundtrip time of a packet sent to and from
@@ -54,7 +53,7 @@ func TestConnectionLatency(t *testing.T) {
 	latency := time.Since(start)
 	defer conn.Close()
 
-	testLogger.Printf("Measured TCP connection latency: %v\n", latency)
+	testLogger.Info("measured connection latency", "test", t.Name(), "latency", latency)
 }
 
 // TestThroughput measures how long to send a 5MB payload to the server in 4KB
@@ -93,5 +92,5 @@ func TestThroughput(t *testing.T) {
 	}
 	duration := time.Since(start)
 
-	testLogger.Printf("Sent %d bytes in %v (%.2f MB/s)\n", totalWritten, duration, float64(totalWritten)/(1024*1024)/duration.Seconds())
+	testLogger.Info("measured throughput", "test", t.Name(), "bytes", totalWritten, "duration", duration, "mb_per_sec", float64(totalWritten)/(1024*1024)/duration.Seconds())
 }
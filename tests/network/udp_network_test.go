@@ -1,16 +1,18 @@
 package network
 
 import (
-	"io"
 	"log"
+	"log/slog"
 	"net"
 	"os"
 	"testing"
 	"time"
+
+	"github.com/jennxsierra/dualnet-chat/internal/logging"
 )
 
 // logger for printing to standard output and a log file
-var udpTestLogger *log.Logger
+var udpTestLogger *slog.Logger
 
 // log file path
 const udpLogFilePath = "results/udp_tests.log"
@@ -23,18 +25,15 @@ func init() {
 		log.Printf("Warning: Could not create log directory %s: %v", logDir, err)
 	}
 
-	var writers []io.Writer = []io.Writer{os.Stdout}
-
-	// open the log file for writing
-	file, err := os.OpenFile(udpLogFilePath, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0644)
-	if err == nil {
-		writers = append(writers, file)
-	} else {
+	// log to standard output and the log file
+	cfg := logging.DefaultConfig()
+	cfg.File = udpLogFilePath
+	logger, _, err := logging.New(cfg, os.Stdout)
+	if err != nil {
 		log.Printf("Warning: Could not log to file %s: %v", udpLogFilePath, err)
+		logger, _, _ = logging.New(logging.DefaultConfig(), os.Stdout)
 	}
-
-	// initialize the logger with the writers
-	udpTestLogger = log.New(io.MultiWriter(writers...), "", log.LstdFlags)
+	udpTestLogger = logger.With("transport", "udp")
 }
 
 // TestUDPLatency measures round-trip time for UDP packets
@@ -71,7 +70,7 @@ func TestUDPLatency(t *testing.T) {
 	}
 
 	latency := time.Since(start)
-	udpTestLogger.Printf("Measured UDP round-trip latency: %v\n", latency)
+	udpTestLogger.Info("measured round-trip latency", "test", t.Name(), "latency", latency)
 }
 
 // TestUDPThroughput measures how long it takes to send a payload to the server
@@ -130,12 +129,11 @@ func TestUDPThroughput(t *testing.T) {
 	}
 	duration := time.Since(start)
 
-	udpTestLogger.Printf("Sent %d bytes in %v (%.2f MB/s)\n",
-		totalWritten, duration, float64(totalWritten)/1024/1024/duration.Seconds())
+	udpTestLogger.Info("measured throughput", "test", t.Name(), "bytes", totalWritten, "duration", duration,
+		"mb_per_sec", float64(totalWritten)/1024/1024/duration.Seconds())
 
 	// Log the actual vs intended payload size to monitor any potential issues
 	if totalWritten != payloadSize {
-		udpTestLogger.Printf("Warning: Intended to send %d bytes, actually sent %d bytes",
-			payloadSize, totalWritten)
+		udpTestLogger.Warn("payload not fully sent", "test", t.Name(), "intended_bytes", payloadSize, "sent_bytes", totalWritten)
 	}
 }
@@ -0,0 +1,79 @@
+package presence
+
+import (
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/jennxsierra/dualnet-chat/internal/chat"
+	"github.com/jennxsierra/dualnet-chat/internal/protocol"
+	"github.com/jennxsierra/dualnet-chat/tests/testutil"
+)
+
+func TestMain(m *testing.M) {
+	testutil.Main(m)
+}
+
+// startHub runs a hub with the idle policy and a short sweep interval until
+// the test ends.
+func startHub(t *testing.T, idle chat.IdlePolicy) *chat.Hub {
+	t.Helper()
+	cfg := chat.DefaultConfig()
+	cfg.SweepInterval = 5 * time.Millisecond
+	cfg.Idle = idle
+	return testutil.StartHub(t, cfg)
+}
+
+// join registers a client with the hub and waits for its welcome.
+func join(t *testing.T, hub *chat.Hub, name string) *testutil.FakeConn {
+	t.Helper()
+	conn := testutil.NewFakeConn(name + ":1")
+	conn.Register(t, hub, name)
+	return conn
+}
+
+// TestAwayAndBack checks that an idle client is announced away, listed as away
+// by /who, and announced back once it chats again.
+func TestAwayAndBack(t *testing.T) {
+	hub := startHub(t, chat.IdlePolicy{AwayAfter: 50 * time.Millisecond})
+	alice := join(t, hub, "alice")
+	bob := join(t, hub, "bob")
+
+	if e := bob.Expect(t, protocol.TypePresence); e.From != "alice" || e.Text != protocol.PresenceAway {
+		t.Fatalf("bob was told %+v, want alice away", e)
+	}
+
+	// asking counts as activity, so only alice is still away
+	hub.Receive(bob, protocol.Envelope{Type: protocol.TypeMessage, Text: "/who"})
+	who := bob.Expect(t, protocol.TypeNotice)
+	if !strings.Contains(who.Text, "alice (away)") || strings.Contains(who.Text, "bob (away)") {
+		t.Errorf("/who answered %q", who.Text)
+	}
+
+	hub.Receive(alice, protocol.Envelope{Type: protocol.TypeMessage, Text: "back now"})
+	for {
+		e := bob.Expect(t, protocol.TypePresence)
+		if e.From == "alice" && e.Text == protocol.PresenceBack {
+			break
+		}
+	}
+	for _, s := range hub.Sessions() {
+		if s.Name == "alice" && s.Away {
+			t.Error("alice is still away after chatting")
+		}
+	}
+}
+
+// TestIdleDisconnect checks that a client idle for too long is told why and
+// disconnected.
+func TestIdleDisconnect(t *testing.T) {
+	hub := startHub(t, chat.IdlePolicy{DisconnectAfter: 50 * time.Millisecond})
+	alice := join(t, hub, "alice")
+
+	if e := alice.Expect(t, protocol.TypeBye); !strings.Contains(e.Text, "inactivity") {
+		t.Errorf("alice was told %q", e.Text)
+	}
+	if sessions := hub.Sessions(); len(sessions) != 0 {
+		t.Errorf("%d sessions left, want none", len(sessions))
+	}
+}
@@ -0,0 +1,87 @@
+package reconnect
+
+import (
+	"net"
+	"testing"
+	"time"
+
+	"github.com/jennxsierra/dualnet-chat/internal/protocol"
+	"github.com/jennxsierra/dualnet-chat/internal/udp/server"
+)
+
+// TestUDPMigrate checks that a UDP client sending with its session token from
+// a new address, as after a NAT rebinding, keeps its one session there and that
+// its old address is forgotten.
+func TestUDPMigrate(t *testing.T) {
+	conn, err := net.ListenUDP("udp", &net.UDPAddr{IP: net.IPv4(127, 0, 0, 1)})
+	if err != nil {
+		t.Fatal(err)
+	}
+	serverAddr := conn.LocalAddr().(*net.UDPAddr)
+	srv := server.NewServer(serverAddr.String(), server.DefaultConfig())
+	go srv.Serve(conn)
+	t.Cleanup(srv.Close)
+
+	old := dialUDP(t, serverAddr)
+	old.Write(protocol.Encode(protocol.Envelope{Type: protocol.TypeRegister, From: "alice"}))
+	welcome := readUDP(t, old, protocol.TypeWelcome)
+
+	bob := dialUDP(t, serverAddr)
+	bob.Write(protocol.Encode(protocol.Envelope{Type: protocol.TypeRegister, From: "bob"}))
+	readUDP(t, bob, protocol.TypeWelcome)
+
+	moved := dialUDP(t, serverAddr)
+	moved.Write(protocol.Encode(protocol.Envelope{Type: protocol.TypeMessage, Room: protocol.DefaultRoom, Text: "new address", Session: welcome.Session}))
+	if e := readUDP(t, bob, protocol.TypeMessage); e.From != "alice" || e.Text != "new address" {
+		t.Errorf("bob got %+v, want alice's message", e)
+	}
+
+	var alices int
+	for _, s := range srv.Hub.Sessions() {
+		if s.Name != "alice" {
+			continue
+		}
+		alices++
+		if s.ID != welcome.Session {
+			t.Errorf("alice has session %s, want %s", s.ID, welcome.Session)
+		}
+		if s.Addr != moved.LocalAddr().String() {
+			t.Errorf("alice is at %s, want %s", s.Addr, moved.LocalAddr())
+		}
+	}
+	if alices != 1 {
+		t.Errorf("found %d sessions named alice, want 1", alices)
+	}
+
+	// without the token the old address is a stranger, asked to register again
+	old.Write(protocol.Encode(protocol.Envelope{Type: protocol.TypeMessage, Room: protocol.DefaultRoom, Text: "old address"}))
+	readUDP(t, old, protocol.TypeRegister)
+}
+
+// dialUDP opens a UDP socket to the server, closed when the test ends.
+func dialUDP(t *testing.T, addr *net.UDPAddr) *net.UDPConn {
+	t.Helper()
+	conn, err := net.DialUDP("udp", nil, addr)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { conn.Close() })
+	return conn
+}
+
+// readUDP reads datagrams until one of the given type arrives, failing the
+// test after five seconds.
+func readUDP(t *testing.T, conn *net.UDPConn, typ string) protocol.Envelope {
+	t.Helper()
+	conn.SetReadDeadline(time.Now().Add(5 * time.Second))
+	buffer := make([]byte, protocol.MaxLineSize)
+	for {
+		n, err := conn.Read(buffer)
+		if err != nil {
+			t.Fatalf("no %s envelope: %v", typ, err)
+		}
+		if e := protocol.Decode(buffer[:n]); e.Type == typ {
+			return e
+		}
+	}
+}
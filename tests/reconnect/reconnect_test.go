@@ -0,0 +1,128 @@
+package reconnect
+
+import (
+	"slices"
+	"testing"
+	"time"
+
+	"github.com/jennxsierra/dualnet-chat/internal/chat"
+	"github.com/jennxsierra/dualnet-chat/internal/netutils"
+	"github.com/jennxsierra/dualnet-chat/internal/protocol"
+	"github.com/jennxsierra/dualnet-chat/internal/tcp/server"
+	"github.com/jennxsierra/dualnet-chat/tests/testutil"
+)
+
+func TestMain(m *testing.M) {
+	testutil.Main(m)
+}
+
+// TestBackoff checks that the delays double up to the cap, and that each one
+// is at least half of its step and at most all of it.
+func TestBackoff(t *testing.T) {
+	steps := []time.Duration{100, 200, 400, 800, 1000, 1000}
+	for range 100 {
+		b := netutils.Backoff{Min: 100 * time.Millisecond, Max: time.Second}
+		for i, step := range steps {
+			step *= time.Millisecond
+			if d := b.Next(); d < step/2 || d > step {
+				t.Fatalf("delay %d is %v, want between %v and %v", i, d, step/2, step)
+			}
+		}
+
+		b.Reset()
+		if d := b.Next(); d < 50*time.Millisecond || d > 100*time.Millisecond {
+			t.Fatalf("the first delay after Reset is %v", d)
+		}
+	}
+
+	var b netutils.Backoff
+	if d := b.Next(); d < 250*time.Millisecond || d > 500*time.Millisecond {
+		t.Errorf("the first default delay is %v, want between 250ms and 500ms", d)
+	}
+	for range 20 {
+		if d := b.Next(); d > 30*time.Second {
+			t.Fatalf("a default delay is %v, above the 30s cap", d)
+		}
+	}
+}
+
+// TestHistorySince checks that the messages after an ID are replayed oldest
+// first, only from the given rooms, and only as long as the ring holds them.
+func TestHistorySince(t *testing.T) {
+	h := chat.NewHistory(4)
+	for _, room := range []string{"general", "dev", "general", "dev", "general", "dev"} {
+		h.Add(protocol.Envelope{Type: protocol.TypeMessage, Room: room, Text: room})
+	}
+	if id := h.LastID(); id != 6 {
+		t.Fatalf("LastID is %d, want 6", id)
+	}
+
+	ids := func(envelopes []protocol.Envelope) []uint64 {
+		var ids []uint64
+		for _, e := range envelopes {
+			ids = append(ids, e.ID)
+		}
+		return ids
+	}
+	for _, tc := range []struct {
+		since uint64
+		rooms []string
+		want  []uint64
+	}{
+		{0, []string{"general", "dev"}, []uint64{3, 4, 5, 6}}, // 1 and 2 fell out of the ring
+		{3, []string{"general", "dev"}, []uint64{4, 5, 6}},
+		{3, []string{"general"}, []uint64{5}},
+		{4, []string{"random"}, nil},
+		{6, []string{"general", "dev"}, nil},
+	} {
+		if got := ids(h.Since(tc.since, tc.rooms)); !slices.Equal(got, tc.want) {
+			t.Errorf("Since(%d, %v) = %v, want %v", tc.since, tc.rooms, got, tc.want)
+		}
+	}
+}
+
+// TestResume checks that a client coming back with its rooms and the ID of
+// the last message it saw is put back in those rooms and sent what it missed.
+func TestResume(t *testing.T) {
+	srv, addr := testutil.StartTCP(t, server.DefaultConfig())
+
+	alice, _, _ := testutil.Register(t, "tcp", addr, protocol.Envelope{Type: protocol.TypeRegister, From: "alice"})
+	alice.Write(protocol.Encode(protocol.Envelope{Type: protocol.TypeMessage, Text: "/join dev"}))
+	testutil.WaitFor(t, "alice to join dev", func() bool {
+		for _, s := range srv.Hub.Sessions() {
+			if s.Name == "alice" && slices.Contains(s.Rooms, "dev") {
+				return true
+			}
+		}
+		return false
+	})
+	alice.Write(protocol.Encode(protocol.Envelope{Type: protocol.TypeMessage, Room: "dev", Text: "brb"}))
+	testutil.WaitFor(t, "alice's message", func() bool { return srv.Hub.History.LastID() == 1 })
+	alice.Close()
+	testutil.WaitFor(t, "alice to leave", func() bool { return len(srv.Hub.Sessions()) == 0 })
+
+	bob, _, _ := testutil.Register(t, "tcp", addr, protocol.Envelope{Type: protocol.TypeRegister, From: "bob", Rooms: []string{"dev"}})
+	bob.Write(protocol.Encode(protocol.Envelope{Type: protocol.TypeMessage, Room: "dev", Text: "you missed this"}))
+	testutil.WaitFor(t, "bob's message", func() bool { return srv.Hub.History.LastID() == 2 })
+
+	alice, reader, again := testutil.Register(t, "tcp", addr, protocol.Envelope{
+		Type:  protocol.TypeRegister,
+		From:  "alice",
+		Rooms: []string{protocol.DefaultRoom, "dev"},
+		Since: 1, // the ID of the last message alice saw
+	})
+	if !slices.Equal(again.Rooms, []string{protocol.DefaultRoom, "dev"}) {
+		t.Errorf("alice came back in %v, want %v", again.Rooms, []string{protocol.DefaultRoom, "dev"})
+	}
+
+	alice.SetReadDeadline(time.Now().Add(5 * time.Second))
+	for {
+		e, err := reader.Read()
+		if err != nil {
+			t.Fatalf("alice was not sent the message she missed: %v", err)
+		}
+		if e.Type == protocol.TypeMessage && e.From == "bob" && e.Room == "dev" && e.Text == "you missed this" {
+			break
+		}
+	}
+}
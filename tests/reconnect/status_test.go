@@ -0,0 +1,178 @@
+package reconnect
+
+import (
+	"io"
+	"net"
+	"slices"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/jennxsierra/dualnet-chat/internal/netutils"
+	"github.com/jennxsierra/dualnet-chat/internal/protocol"
+	tcpclient "github.com/jennxsierra/dualnet-chat/internal/tcp/client"
+	"github.com/jennxsierra/dualnet-chat/internal/tcp/server"
+	udpclient "github.com/jennxsierra/dualnet-chat/internal/udp/client"
+	udpserver "github.com/jennxsierra/dualnet-chat/internal/udp/server"
+	"github.com/jennxsierra/dualnet-chat/internal/ui"
+	"github.com/jennxsierra/dualnet-chat/tests/testutil"
+)
+
+// statusUI records the connection states a client reports, and waits for the
+// user until it is closed.
+type statusUI struct {
+	mu       sync.Mutex
+	statuses []ui.Status
+	closed   chan struct{}
+	once     sync.Once
+}
+
+func newStatusUI() *statusUI { return &statusUI{closed: make(chan struct{})} }
+
+func (u *statusUI) ReadLine() (string, error) {
+	<-u.closed
+	return "", io.EOF
+}
+
+func (u *statusUI) SetStatus(s ui.Status) {
+	u.mu.Lock()
+	defer u.mu.Unlock()
+	u.statuses = append(u.statuses, s)
+}
+
+func (u *statusUI) Close() { u.once.Do(func() { close(u.closed) }) }
+
+func (u *statusUI) Show(protocol.Envelope)                 {}
+func (u *statusUI) ShowMention(protocol.Envelope)          {}
+func (u *statusUI) ShowSent(protocol.Envelope)             {}
+func (u *statusUI) Notify(ui.Notification, string, string) {}
+func (u *statusUI) Info(string)                            {}
+func (u *statusUI) Error(string)                           {}
+func (u *statusUI) Clear()                                 {}
+func (u *statusUI) SetCompleter(ui.Completer)              {}
+func (u *statusUI) SetTimeFormat(string)                   {}
+
+// reported returns the index of the first status after from that satisfies
+// match, or -1.
+func (u *statusUI) reported(from int, match func(ui.Status) bool) int {
+	u.mu.Lock()
+	defer u.mu.Unlock()
+	if from >= len(u.statuses) {
+		return -1
+	}
+	if i := slices.IndexFunc(u.statuses[from:], match); i >= 0 {
+		return from + i
+	}
+	return -1
+}
+
+// waitState waits for a status after from in the given state and returns its index.
+func (u *statusUI) waitState(t *testing.T, from int, state string) int {
+	t.Helper()
+	i := -1
+	testutil.WaitFor(t, "the "+state+" state", func() bool {
+		i = u.reported(from, func(s ui.Status) bool { return s.State == state })
+		return i >= 0
+	})
+	return i
+}
+
+// TestUDPLinkState checks that a UDP client measures the round trip of
+// acknowledged heartbeats, reports the link lost once the server stops, and
+// connected again once it is back.
+func TestUDPLinkState(t *testing.T) {
+	conn, err := net.ListenUDP("udp", &net.UDPAddr{IP: net.IPv4(127, 0, 0, 1)})
+	if err != nil {
+		t.Fatal(err)
+	}
+	addr := conn.LocalAddr().(*net.UDPAddr)
+	srv := udpserver.NewServer(addr.String(), udpserver.DefaultConfig())
+	served := make(chan error, 1)
+	go func() { served <- srv.Serve(conn) }()
+
+	client, err := udpclient.NewClient(addr.String(), "alice")
+	if err != nil {
+		t.Fatal(err)
+	}
+	client.HeartbeatInterval = 20 * time.Millisecond
+	client.MaxMissedHeartbeats = 2
+	status := newStatusUI()
+	client.UI = status
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		client.Start()
+	}()
+	t.Cleanup(func() {
+		status.Close()
+		<-done
+	})
+
+	testutil.WaitFor(t, "a measured round trip", func() bool {
+		return status.reported(0, func(s ui.Status) bool { return s.State == "connected" && s.RTT > 0 }) >= 0
+	})
+
+	srv.Close()
+	<-served
+	lost := status.waitState(t, 0, "lost")
+
+	// a new server on the same port welcomes the client back
+	conn, err = net.ListenUDP("udp", addr)
+	if err != nil {
+		t.Fatal(err)
+	}
+	srv = udpserver.NewServer(addr.String(), udpserver.DefaultConfig())
+	go srv.Serve(conn)
+	t.Cleanup(srv.Close)
+	status.waitState(t, lost, "connected")
+}
+
+// TestTCPLinkState checks that a TCP client reports reconnecting once the
+// server stops, and connected again once it is back.
+func TestTCPLinkState(t *testing.T) {
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	addr := listener.Addr().String()
+	srv := server.NewServer(addr, server.DefaultConfig())
+	served := make(chan error, 1)
+	go func() { served <- srv.Serve(listener) }()
+
+	serverAddr, err := netutils.ParseAddress(addr)
+	if err != nil {
+		t.Fatal(err)
+	}
+	client, err := tcpclient.NewClient(serverAddr, "alice", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	status := newStatusUI()
+	client.UI = status
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		client.Start()
+	}()
+	t.Cleanup(func() {
+		status.Close()
+		<-done
+	})
+
+	status.waitState(t, 0, "connected")
+	testutil.WaitFor(t, "alice to register", func() bool { return len(srv.Hub.Sessions()) == 1 })
+
+	srv.Close()
+	<-served
+	lost := status.waitState(t, 0, "reconnecting")
+
+	listener, err = net.Listen("tcp", addr)
+	if err != nil {
+		t.Fatal(err)
+	}
+	srv = server.NewServer(addr, server.DefaultConfig())
+	go srv.Serve(listener)
+	t.Cleanup(srv.Close)
+	status.waitState(t, lost, "connected")
+	testutil.WaitFor(t, "alice to register again", func() bool { return len(srv.Hub.Sessions()) == 1 })
+}
@@ -0,0 +1,163 @@
+package screen
+
+import (
+	"slices"
+	"testing"
+
+	"github.com/jennxsierra/dualnet-chat/internal/ui"
+)
+
+// TestLineEditor checks typing, moving the cursor and deleting in the input
+// line of the full-screen interface.
+func TestLineEditor(t *testing.T) {
+	var e ui.LineEditor
+	check := func(step, text string, cursor int) {
+		t.Helper()
+		if e.Text() != text || e.Cursor() != cursor {
+			t.Errorf("after %s: %q with the cursor at %d, want %q at %d", step, e.Text(), e.Cursor(), text, cursor)
+		}
+	}
+
+	e.Insert([]rune("hello wrld")...)
+	check("typing", "hello wrld", 10)
+	e.Left()
+	e.Left()
+	e.Left()
+	e.Insert('o')
+	check("fixing a typo", "hello world", 8)
+	e.Backspace()
+	e.Insert('o')
+	e.Delete()
+	check("retyping and deleting forward", "hello wold", 8)
+	e.Home()
+	e.Left()
+	e.Backspace()
+	check("going left past the start", "hello wold", 0)
+	e.End()
+	e.Right()
+	e.Delete()
+	check("going right past the end", "hello wold", 10)
+	e.Insert('\n')
+	e.Insert([]rune("bye  ")...)
+	check("a line break", "hello wold\nbye  ", 16)
+	e.KillWord()
+	check("Ctrl-W, which only stops at spaces", "hello ", 6)
+	e.Home()
+	e.Right()
+	e.KillEnd()
+	check("Ctrl-K", "h", 1)
+	e.Insert([]rune("i there")...)
+	e.Left()
+	e.KillLine()
+	check("Ctrl-U", "e", 0)
+	e.KillWord()
+	check("Ctrl-W at the start", "e", 0)
+}
+
+// TestHistory checks that entered lines are returned trimmed, that blank ones
+// are not kept, and that the arrow keys bring the others back.
+func TestHistory(t *testing.T) {
+	var e ui.LineEditor
+	e.Browse(true)
+	if !e.Empty() {
+		t.Fatalf("browsing an empty history typed %q", e.Text())
+	}
+
+	for _, line := range []string{"  /join dev ", "   ", "hi all"} {
+		e.Insert([]rune(line)...)
+		e.Enter()
+	}
+	e.Insert([]rune("draft")...)
+	if line := e.Enter(); line != "draft" || !e.Empty() {
+		t.Fatalf("entered %q leaving %q, want draft leaving nothing", line, e.Text())
+	}
+
+	for i, want := range []string{"draft", "hi all", "  /join dev ", "  /join dev "} {
+		e.Browse(true)
+		if e.Text() != want || e.Cursor() != len([]rune(want)) {
+			t.Errorf("up %d: %q with the cursor at %d, want %q at its end", i+1, e.Text(), e.Cursor(), want)
+		}
+	}
+	for i, want := range []string{"hi all", "draft", "", ""} {
+		e.Browse(false)
+		if e.Text() != want {
+			t.Errorf("down %d: %q, want %q", i+1, e.Text(), want)
+		}
+	}
+
+	e.Browse(true)
+	e.Browse(true)
+	if line := e.Enter(); line != "hi all" {
+		t.Errorf("entered %q from the history, want hi all", line)
+	}
+	e.Browse(true)
+	if e.Text() != "hi all" {
+		t.Errorf("up after entering a line from the history: %q, want it again", e.Text())
+	}
+}
+
+// TestWrap checks that lines are cut at spaces where they can be, that wide
+// characters and escape sequences are counted by the columns they take, and
+// that a style carries over to the next row.
+func TestWrap(t *testing.T) {
+	const (
+		red   = "\x1b[31m"
+		reset = "\x1b[0m"
+	)
+	for _, tc := range []struct {
+		line  string
+		width int
+		want  []string
+	}{
+		{"short", 10, []string{"short"}},
+		{"", 10, []string{""}},
+		{"the quick brown fox", 10, []string{"the quick", "brown fox"}},
+		{"abcdefghijkl", 5, []string{"abcde", "fghij", "kl"}},
+		{"日本語のテキスト", 6, []string{"日本語", "のテキ", "スト"}},
+		{red + "warning" + reset + " ok", 8, []string{red + "warning" + reset, "ok"}},
+		{red + "very long text", 9, []string{red + "very long", red + "text"}},
+		{"日本", 1, []string{"日本"}},
+	} {
+		if rows := ui.Wrap(tc.line, tc.width); !slices.Equal(rows, tc.want) {
+			t.Errorf("Wrap(%q, %d) = %q, want %q", tc.line, tc.width, rows, tc.want)
+		}
+	}
+
+	if text, width := ui.Fit("\x1b[1mbold\x1b[0m text", 6); text != "\x1b[1mbold\x1b[0m t" || width != 6 {
+		t.Errorf("Fit cut to %q taking %d columns", text, width)
+	}
+	if text, width := ui.Fit("日本語", 5); text != "日本" || width != 4 {
+		t.Errorf("Fit cut a wide character to %q taking %d columns", text, width)
+	}
+}
+
+// TestMembers checks that the member list stays sorted as people come and go,
+// and how the sidebar shows it.
+func TestMembers(t *testing.T) {
+	var m ui.Members
+	for _, name := range []string{"carol", "alice", "bob", "alice"} {
+		m = m.Add(name)
+	}
+	m = m.Remove("bob").Remove("mallory")
+	if want := (ui.Members{"alice", "carol"}); !slices.Equal(m, want) {
+		t.Fatalf("members %q, want %q", m, want)
+	}
+
+	m = m.Add("dave\x1b[2J\nx")
+	rows := m.Sidebar(map[string]bool{"carol": true}, 10, 8)
+	want := []string{
+		"\x1b[1m Members\x1b[0m",
+		" alice",
+		"\x1b[2m carol\x1b[0m",
+		" dave�[2",
+	}
+	if !slices.Equal(rows, want) {
+		t.Errorf("sidebar %q, want %q", rows, want)
+	}
+	if rows := m.Sidebar(nil, 2, 20); len(rows) != 2 || rows[0] != "\x1b[1m Members (3)\x1b[0m" || rows[1] != " alice" {
+		t.Errorf("sidebar two rows high %q, want the header and alice", rows)
+	}
+	if rows := m.Sidebar(nil, 0, 20); rows != nil {
+		t.Errorf("sidebar without room %q", rows)
+	}
+}
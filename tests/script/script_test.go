@@ -0,0 +1,159 @@
+package script
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"io"
+	"regexp"
+	"slices"
+	"testing"
+	"time"
+
+	"github.com/jennxsierra/dualnet-chat/internal/netutils"
+	"github.com/jennxsierra/dualnet-chat/internal/protocol"
+	tcpclient "github.com/jennxsierra/dualnet-chat/internal/tcp/client"
+	tcpserver "github.com/jennxsierra/dualnet-chat/internal/tcp/server"
+	"github.com/jennxsierra/dualnet-chat/internal/ui"
+	"github.com/jennxsierra/dualnet-chat/tests/testutil"
+)
+
+func TestMain(m *testing.M) {
+	testutil.Main(m)
+}
+
+// runScript starts a TCP client driven by script in the background, and
+// returns a channel closed once it quits.
+func runScript(t *testing.T, addr string, script *ui.Script) <-chan struct{} {
+	t.Helper()
+	serverAddr, err := netutils.ParseAddress(addr)
+	if err != nil {
+		t.Fatal(err)
+	}
+	c, err := tcpclient.NewClient(serverAddr, "ci", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	c.UI = script
+
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		c.Start()
+	}()
+	return done
+}
+
+// wait waits for a script to quit.
+func wait(t *testing.T, done <-chan struct{}) {
+	t.Helper()
+	select {
+	case <-done:
+	case <-time.After(5 * time.Second):
+		t.Fatal("the script did not quit")
+	}
+}
+
+// TestScriptSendsAndWaits sends a line from a script and waits for a reply
+// matching a regular expression, which is printed as a JSON line.
+func TestScriptSendsAndWaits(t *testing.T) {
+	_, addr := testutil.StartTCP(t, tcpserver.DefaultConfig())
+	watcher, watcherReader := testutil.Connect(t, "tcp", addr, "watcher")
+
+	var out bytes.Buffer
+	script := ui.NewScript(&out, io.Discard)
+	script.Lines = []string{"deploy started"}
+	script.Match = regexp.MustCompile(`^ack`)
+	script.Timeout = 2 * time.Second
+	done := runScript(t, addr, script)
+
+	if e := testutil.Expect(t, watcher, watcherReader, protocol.TypeMessage); e.Text != "deploy started" {
+		t.Fatalf("watcher received %+v", e)
+	}
+	watcher.Write(protocol.Encode(protocol.Envelope{Type: protocol.TypeMessage, Text: "busy"}))
+	watcher.Write(protocol.Encode(protocol.Envelope{Type: protocol.TypeMessage, Text: "ack deploy"}))
+	wait(t, done)
+
+	if err := script.Err(); err != nil {
+		t.Fatalf("Err() = %v", err)
+	}
+
+	// every line is an envelope, the last one the reply that matched
+	var last protocol.Envelope
+	decoder := json.NewDecoder(&out)
+	for decoder.More() {
+		if err := decoder.Decode(&last); err != nil {
+			t.Fatalf("output is not JSON lines: %v", err)
+		}
+	}
+	if last.Type != protocol.TypeMessage || last.Text != "ack deploy" {
+		t.Errorf("last envelope printed is %+v", last)
+	}
+}
+
+// TestScriptTimeout checks that a script gives up waiting for replies that
+// never come, and reports it.
+func TestScriptTimeout(t *testing.T) {
+	_, addr := testutil.StartTCP(t, tcpserver.DefaultConfig())
+
+	script := ui.NewScript(io.Discard, io.Discard)
+	script.Lines = []string{"anyone there?"}
+	script.Replies = 1
+	script.Timeout = 200 * time.Millisecond
+	wait(t, runScript(t, addr, script))
+
+	if err := script.Err(); !errors.Is(err, ui.ErrTimeout) {
+		t.Errorf("Err() = %v, want %v", err, ui.ErrTimeout)
+	}
+}
+
+// TestScriptOnlyCountsReplies checks that messages arriving before the last
+// line is sent do not count as its replies, even when they match.
+func TestScriptOnlyCountsReplies(t *testing.T) {
+	_, addr := testutil.StartTCP(t, tcpserver.DefaultConfig())
+	watcher, watcherReader := testutil.Connect(t, "tcp", addr, "watcher")
+
+	var out bytes.Buffer
+	script := ui.NewScript(&out, io.Discard)
+	script.Lines = []string{"deploy started", "deploy done"}
+	script.Match = regexp.MustCompile(`^ack`)
+	script.Delay = 300 * time.Millisecond
+	script.Timeout = 2 * time.Second
+	done := runScript(t, addr, script)
+
+	// answered while the script pauses between its lines
+	if e := testutil.Expect(t, watcher, watcherReader, protocol.TypeMessage); e.Text != "deploy started" {
+		t.Fatalf("watcher received %+v", e)
+	}
+	watcher.Write(protocol.Encode(protocol.Envelope{Type: protocol.TypeMessage, Text: "ack started"}))
+
+	if e := testutil.Expect(t, watcher, watcherReader, protocol.TypeMessage); e.Text != "deploy done" {
+		t.Fatalf("watcher received %+v", e)
+	}
+	// the script pauses after its last line too, before it waits for replies
+	select {
+	case <-done:
+		t.Fatal("the script took a message from before its last line as the reply")
+	case <-time.After(2 * script.Delay):
+	}
+	watcher.Write(protocol.Encode(protocol.Envelope{Type: protocol.TypeMessage, Text: "ack done"}))
+	wait(t, done)
+
+	if err := script.Err(); err != nil {
+		t.Fatalf("Err() = %v", err)
+	}
+	var texts []string
+	decoder := json.NewDecoder(&out)
+	for decoder.More() {
+		var e protocol.Envelope
+		if err := decoder.Decode(&e); err != nil {
+			t.Fatalf("output is not JSON lines: %v", err)
+		}
+		if e.Type == protocol.TypeMessage {
+			texts = append(texts, e.Text)
+		}
+	}
+	if want := []string{"ack started", "ack done"}; !slices.Equal(texts, want) {
+		t.Errorf("messages printed %q, want %q", texts, want)
+	}
+}
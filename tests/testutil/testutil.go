@@ -0,0 +1,210 @@
+// Package testutil holds what the tests of several packages share: quiet
+// logs, a fake connection to drive the hub with directly, and raw clients of
+// the TCP server and its Unix socket.
+package testutil
+
+import (
+	"io"
+	"log"
+	"log/slog"
+	"net"
+	"os"
+	"testing"
+	"time"
+
+	"github.com/jennxsierra/dualnet-chat/internal/chat"
+	"github.com/jennxsierra/dualnet-chat/internal/protocol"
+	"github.com/jennxsierra/dualnet-chat/internal/tcp/server"
+)
+
+// timeout is how long the helpers wait for anything before failing the test.
+const timeout = 5 * time.Second
+
+// Main runs a package's tests with both loggers silenced, as the servers log
+// every connect and disconnect. Call it from TestMain.
+func Main(m *testing.M) {
+	log.SetOutput(io.Discard)
+	slog.SetDefault(slog.New(slog.NewTextHandler(io.Discard, nil)))
+	os.Exit(m.Run())
+}
+
+// FakeConn is a [chat.Conn] that hands what the hub sends a client to the
+// test.
+type FakeConn struct {
+	addr     string
+	Received chan protocol.Envelope
+}
+
+// NewFakeConn returns a connection from the given address.
+func NewFakeConn(addr string) *FakeConn {
+	return &FakeConn{addr: addr, Received: make(chan protocol.Envelope, 100)}
+}
+
+func (c *FakeConn) Send(e protocol.Envelope) { c.Received <- e }
+func (c *FakeConn) Close()                   {}
+func (c *FakeConn) Transport() string        { return "fake" }
+func (c *FakeConn) Addr() string             { return c.addr }
+
+// Register registers the client with the hub under name, in the given rooms
+// or the default ones, and returns its welcome.
+func (c *FakeConn) Register(t *testing.T, hub *chat.Hub, name string, rooms ...string) protocol.Envelope {
+	t.Helper()
+	hub.Receive(c, protocol.Envelope{Type: protocol.TypeRegister, From: name, Rooms: rooms})
+	welcome := c.Next(t)
+	if welcome.Type != protocol.TypeWelcome {
+		t.Fatalf("%s: expected a welcome, got %+v", name, welcome)
+	}
+	return welcome
+}
+
+// Expect waits for an envelope of the given type, skipping others.
+func (c *FakeConn) Expect(t *testing.T, typ string) protocol.Envelope {
+	t.Helper()
+	deadline := time.After(timeout)
+	for {
+		select {
+		case e := <-c.Received:
+			if e.Type == typ {
+				return e
+			}
+		case <-deadline:
+			t.Fatalf("%s: no %s envelope", c.addr, typ)
+		}
+	}
+}
+
+// Next returns the next envelope sent to the client that is not about room
+// members, failing the test if none arrives.
+func (c *FakeConn) Next(t *testing.T) protocol.Envelope {
+	t.Helper()
+	deadline := time.After(timeout)
+	for {
+		select {
+		case e := <-c.Received:
+			if e.Type != protocol.TypeMembers && e.Type != protocol.TypeJoin {
+				return e
+			}
+		case <-deadline:
+			t.Fatalf("%s: nothing received", c.addr)
+		}
+	}
+}
+
+// Quiet checks that nothing but membership changes was sent to the client.
+func (c *FakeConn) Quiet(t *testing.T, hub *chat.Hub) {
+	t.Helper()
+	hub.Sessions() // everything sent before has been sent by now
+	for {
+		select {
+		case e := <-c.Received:
+			if e.Type != protocol.TypeMembers && e.Type != protocol.TypeJoin {
+				t.Errorf("%s unexpectedly received %+v", c.addr, e)
+			}
+		default:
+			return
+		}
+	}
+}
+
+// StartHub runs a hub with the given configuration until the test ends.
+func StartHub(t *testing.T, cfg chat.Config) *chat.Hub {
+	t.Helper()
+	hub := chat.NewHub(cfg)
+	hub.Start()
+	t.Cleanup(func() { hub.Stop("bye") })
+	return hub
+}
+
+// Serve serves a TCP chat server with the given configuration on the listener,
+// a TCP or Unix socket, until the test ends.
+func Serve(t *testing.T, listener net.Listener, cfg server.Config) *server.Server {
+	t.Helper()
+	srv := server.NewServer(listener.Addr().String(), cfg)
+	served := make(chan error, 1)
+	go func() { served <- srv.Serve(listener) }()
+	t.Cleanup(func() {
+		srv.Close()
+		<-served
+	})
+	return srv
+}
+
+// StartTCP serves a TCP chat server with the given configuration on a free
+// local port until the test ends, and returns it with its address.
+func StartTCP(t *testing.T, cfg server.Config) (*server.Server, string) {
+	t.Helper()
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	return Serve(t, listener, cfg), listener.Addr().String()
+}
+
+// Reply connects to the server at addr over network ("tcp" or "unix"), sends
+// reg and returns the connection, a reader for what follows and the server's
+// first reply, which is a welcome unless the client was turned away.
+func Reply(t *testing.T, network, addr string, reg protocol.Envelope) (net.Conn, *protocol.Reader, protocol.Envelope) {
+	t.Helper()
+	conn, err := net.Dial(network, addr)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { conn.Close() })
+	conn.Write(protocol.Encode(reg))
+
+	conn.SetReadDeadline(time.Now().Add(timeout))
+	reader := protocol.NewReader(conn)
+	reply, err := reader.Read()
+	if err != nil {
+		t.Fatalf("%s: no reply: %v", reg.From, err)
+	}
+	conn.SetReadDeadline(time.Time{})
+	return conn, reader, reply
+}
+
+// Register registers with reg like [Reply], failing the test unless the server
+// welcomes the client, and returns the welcome.
+func Register(t *testing.T, network, addr string, reg protocol.Envelope) (net.Conn, *protocol.Reader, protocol.Envelope) {
+	t.Helper()
+	conn, reader, welcome := Reply(t, network, addr, reg)
+	if welcome.Type != protocol.TypeWelcome {
+		t.Fatalf("%s: expected a welcome, got %+v", reg.From, welcome)
+	}
+	return conn, reader, welcome
+}
+
+// Connect registers under name like [Register].
+func Connect(t *testing.T, network, addr, name string) (net.Conn, *protocol.Reader) {
+	t.Helper()
+	conn, reader, _ := Register(t, network, addr, protocol.Envelope{Type: protocol.TypeRegister, From: name})
+	return conn, reader
+}
+
+// Expect reads envelopes from a raw client until one of the given type
+// arrives.
+func Expect(t *testing.T, conn net.Conn, reader *protocol.Reader, typ string) protocol.Envelope {
+	t.Helper()
+	conn.SetReadDeadline(time.Now().Add(timeout))
+	defer conn.SetReadDeadline(time.Time{})
+	for {
+		e, err := reader.Read()
+		if err != nil {
+			t.Fatalf("waiting for %s: %v", typ, err)
+		}
+		if e.Type == typ {
+			return e
+		}
+	}
+}
+
+// WaitFor polls cond until it holds, failing the test after a few seconds.
+func WaitFor(t *testing.T, what string, cond func() bool) {
+	t.Helper()
+	deadline := time.Now().Add(timeout)
+	for !cond() {
+		if time.Now().After(deadline) {
+			t.Fatalf("timed out waiting for %s", what)
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+}
@@ -0,0 +1,289 @@
+package transfer
+
+import (
+	"bytes"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"net"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/jennxsierra/dualnet-chat/internal/protocol"
+	"github.com/jennxsierra/dualnet-chat/internal/tcp/server"
+	"github.com/jennxsierra/dualnet-chat/internal/transfer"
+	"github.com/jennxsierra/dualnet-chat/tests/testutil"
+)
+
+func TestMain(m *testing.M) {
+	testutil.Main(m)
+}
+
+// output records what a manager tells its user.
+type output struct {
+	mu    sync.Mutex
+	lines []string
+}
+
+func (o *output) Info(text string)  { o.add(text) }
+func (o *output) Error(text string) { o.add("error: " + text) }
+func (o *output) Progress(string)   {}
+
+func (o *output) add(text string) {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+	o.lines = append(o.lines, text)
+}
+
+// has reports whether the user was told text, among other things.
+func (o *output) has(text string) bool {
+	return strings.Contains(o.String(), text)
+}
+
+func (o *output) String() string {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+	return strings.Join(o.lines, "\n")
+}
+
+// client is a connection to the server with a transfer manager on it.
+type client struct {
+	name  string
+	files *transfer.Manager
+	out   *output
+}
+
+// serve starts a TCP server with the given file limits, and stops it when the
+// test ends.
+func serve(t *testing.T, maxFileSize int64) string {
+	t.Helper()
+	cfg := server.DefaultConfig()
+	cfg.Limits.MaxFileSize = maxFileSize
+	_, addr := testutil.StartTCP(t, cfg)
+	return addr
+}
+
+// connect registers a client that saves files in dir.
+func connect(t *testing.T, addr, name, dir string) *client {
+	t.Helper()
+	conn, err := net.Dial("tcp", addr)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { conn.Close() })
+	conn.Write(protocol.Encode(protocol.Envelope{Type: protocol.TypeRegister, From: name}))
+
+	reader := protocol.NewReader(conn)
+	if welcome, err := reader.Read(); err != nil || welcome.Type != protocol.TypeWelcome {
+		t.Fatalf("%s: expected a welcome, got %+v (%v)", name, welcome, err)
+	}
+
+	var mu sync.Mutex
+	send := func(e protocol.Envelope) error {
+		mu.Lock()
+		defer mu.Unlock()
+		_, err := conn.Write(protocol.Encode(e))
+		return err
+	}
+	c := &client{name: name, out: &output{}}
+	c.files = transfer.NewManager(dir, send, c.out)
+	t.Cleanup(c.files.Close)
+
+	go func() {
+		for {
+			e, err := reader.Read()
+			if err != nil {
+				return
+			}
+			c.files.Handle(e)
+		}
+	}()
+	return c
+}
+
+// waitFor polls until what the client was told contains text.
+func waitFor(t *testing.T, c *client, text string) {
+	t.Helper()
+	deadline := time.Now().Add(5 * time.Second)
+	for !c.out.has(text) {
+		if time.Now().After(deadline) {
+			t.Fatalf("%s was not told %q, only:\n%s", c.name, text, c.out)
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+}
+
+// randomFile writes size random bytes to a file in dir.
+func randomFile(t *testing.T, dir, name string, size int) (string, []byte) {
+	t.Helper()
+	data := make([]byte, size)
+	rand.Read(data)
+	path := filepath.Join(dir, name)
+	if err := os.WriteFile(path, data, 0o600); err != nil {
+		t.Fatal(err)
+	}
+	return path, data
+}
+
+// partPath returns where a download of data is kept until it is complete.
+func partPath(dir, name string, data []byte) string {
+	sum := sha256.Sum256(data)
+	return filepath.Join(dir, name+"."+hex.EncodeToString(sum[:])[:12]+".part")
+}
+
+// TestTransfer sends a file of many chunks, half of which the recipient kept
+// from an interrupted download, and checks it arrives whole.
+func TestTransfer(t *testing.T) {
+	addr := serve(t, 0)
+	sent, saved := t.TempDir(), t.TempDir()
+	alice := connect(t, addr, "alice", sent)
+	bob := connect(t, addr, "bob", saved)
+
+	path, data := randomFile(t, sent, "notes.bin", 20*protocol.FileChunkSize+123)
+	half := len(data) / 2
+	if err := os.WriteFile(partPath(saved, "notes.bin", data), data[:half], 0o600); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := alice.files.Offer("bob", path); err != nil {
+		t.Fatal(err)
+	}
+	waitFor(t, bob, "alice offers you notes.bin")
+	if err := bob.files.Accept(""); err != nil {
+		t.Fatal(err)
+	}
+	waitFor(t, bob, "Resuming notes.bin")
+	waitFor(t, bob, "Saved notes.bin from alice")
+	waitFor(t, alice, "bob received notes.bin")
+
+	got, err := os.ReadFile(filepath.Join(saved, "notes.bin"))
+	if err != nil || !bytes.Equal(got, data) {
+		t.Fatalf("saved %d bytes (%v), want the %d sent", len(got), err, len(data))
+	}
+	if _, err := os.Stat(partPath(saved, "notes.bin", data)); !os.IsNotExist(err) {
+		t.Errorf("the partial file is still there: %v", err)
+	}
+}
+
+// TestNothingToSend checks that transfers with no chunks left to send, of an
+// empty file or of one the recipient has all of already, still end on both
+// sides.
+func TestNothingToSend(t *testing.T) {
+	addr := serve(t, 0)
+	sent, saved := t.TempDir(), t.TempDir()
+	alice := connect(t, addr, "alice", sent)
+	bob := connect(t, addr, "bob", saved)
+
+	empty, _ := randomFile(t, sent, "empty.txt", 0)
+	full, data := randomFile(t, sent, "full.bin", 2*protocol.FileChunkSize)
+	if err := os.WriteFile(partPath(saved, "full.bin", data), data, 0o600); err != nil {
+		t.Fatal(err)
+	}
+
+	for _, path := range []string{empty, full} {
+		name := filepath.Base(path)
+		if err := alice.files.Offer("bob", path); err != nil {
+			t.Fatal(err)
+		}
+		waitFor(t, bob, "alice offers you "+name)
+		if err := bob.files.Accept(""); err != nil {
+			t.Fatal(err)
+		}
+		waitFor(t, bob, "Saved "+name+" from alice")
+		waitFor(t, alice, "bob received "+name)
+	}
+
+	got, err := os.ReadFile(filepath.Join(saved, "full.bin"))
+	if err != nil || !bytes.Equal(got, data) {
+		t.Fatalf("saved %d bytes (%v), want the %d sent", len(got), err, len(data))
+	}
+	if info, err := os.Stat(filepath.Join(saved, "empty.txt")); err != nil || info.Size() != 0 {
+		t.Errorf("empty.txt was not saved empty: %v", err)
+	}
+}
+
+// TestDamaged checks that a file that does not match the sender's digest is
+// deleted rather than saved.
+func TestDamaged(t *testing.T) {
+	addr := serve(t, 0)
+	sent, saved := t.TempDir(), t.TempDir()
+	alice := connect(t, addr, "alice", sent)
+	bob := connect(t, addr, "bob", saved)
+
+	path, data := randomFile(t, sent, "photo.jpg", 3*protocol.FileChunkSize)
+	if err := os.WriteFile(partPath(saved, "photo.jpg", data), make([]byte, protocol.FileChunkSize), 0o600); err != nil {
+		t.Fatal(err)
+	}
+
+	alice.files.Offer("bob", path)
+	waitFor(t, bob, "alice offers you photo.jpg")
+	bob.files.Accept("")
+	waitFor(t, bob, "arrived damaged")
+	waitFor(t, alice, "The transfer of photo.jpg stopped: The file arrived damaged.")
+
+	if entries, _ := os.ReadDir(saved); len(entries) != 0 {
+		t.Errorf("left %v behind", entries)
+	}
+}
+
+// TestDuplicateOffer checks that an offer with the ID of a transfer already
+// known is ignored rather than taking its place.
+func TestDuplicateOffer(t *testing.T) {
+	var mu sync.Mutex
+	var sent []protocol.Envelope
+	out := &output{}
+	files := transfer.NewManager(t.TempDir(), func(e protocol.Envelope) error {
+		mu.Lock()
+		defer mu.Unlock()
+		sent = append(sent, e)
+		return nil
+	}, out)
+	t.Cleanup(files.Close)
+
+	offer := func(name string, data []byte) {
+		sum := sha256.Sum256(data)
+		files.Handle(protocol.Envelope{Type: protocol.TypeFileOffer, From: "alice", File: &protocol.File{
+			ID: "abc", Name: name, Size: int64(len(data)), SHA256: hex.EncodeToString(sum[:]),
+		}})
+	}
+	offer("notes.txt", []byte("notes"))
+	offer("evil.sh", []byte("rm -rf"))
+	if !out.has("alice offers you notes.txt") || !out.has("error: Ignored alice's offer of evil.sh") {
+		t.Fatalf("the second offer was not ignored:\n%s", out)
+	}
+	if len(sent) != 0 {
+		t.Errorf("answered the second offer with %+v", sent)
+	}
+
+	if err := files.Accept("abc"); err != nil {
+		t.Fatal(err)
+	}
+	mu.Lock()
+	accepted := len(sent) == 1 && sent[0].Type == protocol.TypeFileAccept && sent[0].File.ID == "abc"
+	mu.Unlock()
+	if !accepted {
+		t.Fatalf("accepting sent %+v", sent)
+	}
+
+	files.Handle(protocol.Envelope{Type: protocol.TypeFileChunk, From: "alice", File: &protocol.File{ID: "abc", Data: []byte("notes")}})
+	waitFor(t, &client{name: "bob", out: out}, "Saved notes.txt from alice")
+}
+
+// TestMaxFileSize checks that the server refuses files larger than it allows.
+func TestMaxFileSize(t *testing.T) {
+	addr := serve(t, 1000)
+	sent := t.TempDir()
+	alice := connect(t, addr, "alice", sent)
+	bob := connect(t, addr, "bob", t.TempDir())
+
+	path, _ := randomFile(t, sent, "big.iso", 1001)
+	alice.files.Offer("bob", path)
+	waitFor(t, alice, "The file is too large (at most 1000 bytes).")
+	if bob.out.has("big.iso") {
+		t.Errorf("bob was offered the file:\n%s", bob.out)
+	}
+}
@@ -0,0 +1,94 @@
+package unix
+
+import (
+	"net"
+	"os/user"
+	"path/filepath"
+	"runtime"
+	"testing"
+
+	"github.com/jennxsierra/dualnet-chat/internal/protocol"
+	"github.com/jennxsierra/dualnet-chat/internal/tcp/server"
+	"github.com/jennxsierra/dualnet-chat/tests/testutil"
+)
+
+func TestMain(m *testing.M) {
+	testutil.Main(m)
+}
+
+// serve starts a server listening on a Unix socket in a temporary directory.
+func serve(t *testing.T) (*server.Server, string) {
+	t.Helper()
+	path := filepath.Join(t.TempDir(), "chat.sock")
+	listener, err := net.Listen("unix", path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return testutil.Serve(t, listener, server.DefaultConfig()), path
+}
+
+// username returns the name the server knows the test's user by, skipping the
+// test where the kernel does not report who is at the other end of a socket.
+func username(t *testing.T) string {
+	t.Helper()
+	if runtime.GOOS != "linux" {
+		t.Skip("peer credentials are only read on Linux")
+	}
+	current, err := user.Current()
+	if err != nil {
+		t.Skip(err)
+	}
+	return current.Username
+}
+
+// TestSameProcess checks that two clients connected to the Unix socket from
+// the same process keep sessions of their own, and that one leaving does not
+// take the other with it.
+func TestSameProcess(t *testing.T) {
+	srv, path := serve(t)
+	me := username(t)
+	first, second := me+"@first", me+"@second"
+
+	conn, _ := testutil.Connect(t, "unix", path, first)
+	testutil.Connect(t, "unix", path, second)
+	if sessions := srv.Hub.Sessions(); len(sessions) != 2 || sessions[0].Addr == sessions[1].Addr {
+		t.Fatalf("sessions %+v, want two at different addresses", sessions)
+	}
+
+	conn.Write(protocol.Encode(protocol.Envelope{Type: protocol.TypeBye}))
+	testutil.WaitFor(t, second+"'s session alone", func() bool {
+		sessions := srv.Hub.Sessions()
+		return len(sessions) == 1 && sessions[0].Name == second
+	})
+}
+
+// TestOtherName checks that a local client may not register under the name of
+// another user, and that one giving no name is named after its user.
+func TestOtherName(t *testing.T) {
+	srv, path := serve(t)
+	me := username(t)
+
+	if _, _, bye := testutil.Reply(t, "unix", path, protocol.Envelope{Type: protocol.TypeRegister, From: "not-" + me}); bye.Type != protocol.TypeBye {
+		t.Fatalf("expected a bye for another user's name, got %+v", bye)
+	}
+	if sessions := srv.Hub.Sessions(); len(sessions) != 0 {
+		t.Fatalf("sessions %+v, want none", sessions)
+	}
+
+	testutil.Register(t, "unix", path, protocol.Envelope{Type: protocol.TypeRegister})
+	if sessions := srv.Hub.Sessions(); len(sessions) != 1 || sessions[0].Name != me {
+		t.Fatalf("sessions %+v, want one named %s", sessions, me)
+	}
+}
+
+// TestRenameToOtherName checks that a local client registering again under
+// another user's name is turned away and its earlier session removed.
+func TestRenameToOtherName(t *testing.T) {
+	srv, path := serve(t)
+	me := username(t)
+
+	conn, reader := testutil.Connect(t, "unix", path, me)
+	conn.Write(protocol.Encode(protocol.Envelope{Type: protocol.TypeRegister, From: "not-" + me}))
+	testutil.Expect(t, conn, reader, protocol.TypeBye)
+	testutil.WaitFor(t, "the session to be removed", func() bool { return len(srv.Hub.Sessions()) == 0 })
+}
@@ -0,0 +1,348 @@
+package web
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/binary"
+	"io"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/jennxsierra/dualnet-chat/internal/chat"
+	"github.com/jennxsierra/dualnet-chat/internal/protocol"
+	"github.com/jennxsierra/dualnet-chat/internal/web"
+	"github.com/jennxsierra/dualnet-chat/tests/testutil"
+)
+
+func TestMain(m *testing.M) {
+	testutil.Main(m)
+}
+
+// frame opcodes (RFC 6455, section 5.2)
+const (
+	opContinuation = 0x0
+	opText         = 0x1
+	opClose        = 0x8
+	opPing         = 0x9
+	opPong         = 0xA
+)
+
+// sampleKey and sampleAccept are the handshake example of RFC 6455, section 1.3.
+const (
+	sampleKey    = "dGhlIHNhbXBsZSBub25jZQ=="
+	sampleAccept = "s3pPLMBiTxaQ9kYGzzhZRbK+xOo="
+)
+
+// startGateway serves the gateway for a new hub until the test ends, and
+// returns its host and port.
+func startGateway(t *testing.T) string {
+	t.Helper()
+	hub := chat.NewHub(chat.DefaultConfig())
+	hub.Start()
+	server := httptest.NewServer(web.Handler(hub))
+	t.Cleanup(func() {
+		server.Close()
+		hub.Stop("bye")
+	})
+	return server.Listener.Addr().String()
+}
+
+// client is the browser side of a WebSocket connection.
+type client struct {
+	conn   net.Conn
+	reader *bufio.Reader
+}
+
+// handshake sends an upgrade request to the gateway at host with the given
+// Origin header, if any, and returns the response.
+func handshake(t *testing.T, host, origin string) (*client, *http.Response) {
+	t.Helper()
+	conn, err := net.Dial("tcp", host)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { conn.Close() })
+	conn.SetDeadline(time.Now().Add(5 * time.Second))
+
+	request := "GET /ws HTTP/1.1\r\n" +
+		"Host: " + host + "\r\n" +
+		"Connection: keep-alive, Upgrade\r\n" +
+		"Upgrade: websocket\r\n" +
+		"Sec-WebSocket-Version: 13\r\n" +
+		"Sec-WebSocket-Key: " + sampleKey + "\r\n"
+	if origin != "" {
+		request += "Origin: " + origin + "\r\n"
+	}
+	io.WriteString(conn, request+"\r\n")
+
+	c := &client{conn: conn, reader: bufio.NewReader(conn)}
+	resp, err := http.ReadResponse(c.reader, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return c, resp
+}
+
+// dial opens a WebSocket connection to the gateway at host.
+func dial(t *testing.T, host string) *client {
+	t.Helper()
+	c, resp := handshake(t, host, "http://"+host)
+	if resp.StatusCode != http.StatusSwitchingProtocols {
+		t.Fatalf("handshake answered %s", resp.Status)
+	}
+	return c
+}
+
+// writeFrame sends one masked frame, as browsers do.
+func (c *client) writeFrame(fin bool, opcode byte, payload []byte) {
+	first := opcode
+	if fin {
+		first |= 0x80
+	}
+	frame := []byte{first}
+	switch n := len(payload); {
+	case n < 126:
+		frame = append(frame, 0x80|byte(n))
+	case n <= 0xFFFF:
+		frame = binary.BigEndian.AppendUint16(append(frame, 0x80|126), uint16(n))
+	default:
+		frame = binary.BigEndian.AppendUint64(append(frame, 0x80|127), uint64(n))
+	}
+	mask := []byte{0x12, 0x34, 0x56, 0x78}
+	frame = append(frame, mask...)
+	for i, b := range payload {
+		frame = append(frame, b^mask[i%4])
+	}
+	c.conn.Write(frame)
+}
+
+// send sends an envelope as a text message.
+func (c *client) send(e protocol.Envelope) {
+	c.writeFrame(true, opText, bytes.TrimSuffix(protocol.Encode(e), []byte("\n")))
+}
+
+// readFrame reads one frame from the gateway, which must not be masked.
+func (c *client) readFrame(t *testing.T) (opcode byte, payload []byte) {
+	t.Helper()
+	var header [2]byte
+	if _, err := io.ReadFull(c.reader, header[:]); err != nil {
+		t.Fatalf("reading a frame: %v", err)
+	}
+	if header[0]&0x80 == 0 {
+		t.Fatal("the gateway split a message into several frames")
+	}
+	if header[1]&0x80 != 0 {
+		t.Fatal("the gateway masked a frame")
+	}
+	length := uint64(header[1] & 0x7F)
+	switch length {
+	case 126:
+		var ext [2]byte
+		io.ReadFull(c.reader, ext[:])
+		length = uint64(binary.BigEndian.Uint16(ext[:]))
+	case 127:
+		var ext [8]byte
+		io.ReadFull(c.reader, ext[:])
+		length = binary.BigEndian.Uint64(ext[:])
+	}
+	payload = make([]byte, length)
+	if _, err := io.ReadFull(c.reader, payload); err != nil {
+		t.Fatalf("reading a frame: %v", err)
+	}
+	return header[0] & 0x0F, payload
+}
+
+// expect reads text messages until an envelope of the given type arrives.
+func (c *client) expect(t *testing.T, typ string) protocol.Envelope {
+	t.Helper()
+	for {
+		opcode, payload := c.readFrame(t)
+		if opcode != opText {
+			t.Fatalf("expected a text frame, got opcode %#x", opcode)
+		}
+		if e := protocol.Decode(payload); e.Type == typ {
+			return e
+		}
+	}
+}
+
+// expectClose reads frames until a close frame arrives and returns its status code.
+func (c *client) expectClose(t *testing.T) uint16 {
+	t.Helper()
+	for {
+		opcode, payload := c.readFrame(t)
+		if opcode == opClose {
+			if len(payload) < 2 {
+				return 0
+			}
+			return binary.BigEndian.Uint16(payload)
+		}
+	}
+}
+
+// TestHandshake checks the Sec-WebSocket-Accept value and which origins may
+// connect.
+func TestHandshake(t *testing.T) {
+	host := startGateway(t)
+
+	for _, tc := range []struct {
+		origin string
+		want   int
+	}{
+		{"", http.StatusSwitchingProtocols}, // not a browser
+		{"http://" + host, http.StatusSwitchingProtocols},
+		{"http://evil.example", http.StatusForbidden},
+		{"http://" + host + ".evil.example", http.StatusForbidden},
+	} {
+		_, resp := handshake(t, host, tc.origin)
+		if resp.StatusCode != tc.want {
+			t.Errorf("origin %q: handshake answered %s, want %d", tc.origin, resp.Status, tc.want)
+			continue
+		}
+		if tc.want == http.StatusSwitchingProtocols {
+			if accept := resp.Header.Get("Sec-WebSocket-Accept"); accept != sampleAccept {
+				t.Errorf("Sec-WebSocket-Accept is %q, want %q", accept, sampleAccept)
+			}
+		}
+	}
+
+	// a plain request to the endpoint is not upgraded
+	resp, err := http.Get("http://" + host + "/ws")
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusBadRequest {
+		t.Errorf("a plain GET answered %s, want 400", resp.Status)
+	}
+}
+
+// TestRoundTrip registers two browsers, one of them with a message split into
+// fragments, and checks that their messages reach each other, pings are
+// answered and a close is echoed.
+func TestRoundTrip(t *testing.T) {
+	host := startGateway(t)
+
+	alice := dial(t, host)
+	reg := protocol.Encode(protocol.Envelope{Type: protocol.TypeRegister, From: "alice"})
+	reg = bytes.TrimSuffix(reg, []byte("\n"))
+	alice.writeFrame(false, opText, reg[:5])
+	alice.writeFrame(false, opContinuation, reg[5:10])
+	alice.writeFrame(true, opContinuation, reg[10:])
+	alice.expect(t, protocol.TypeWelcome)
+
+	bob := dial(t, host)
+	bob.send(protocol.Envelope{Type: protocol.TypeRegister, From: "bob"})
+	bob.expect(t, protocol.TypeWelcome)
+	alice.expect(t, protocol.TypeJoin)
+
+	long := strings.Repeat("x", 1000) // needs a 16-bit length
+	alice.send(protocol.Envelope{Type: protocol.TypeMessage, Text: long})
+	if e := bob.expect(t, protocol.TypeMessage); e.From != "alice" || e.Text != long {
+		t.Errorf("bob received %+v", e)
+	}
+
+	// a ping in the middle of a fragmented message is answered right away
+	msg := bytes.TrimSuffix(protocol.Encode(protocol.Envelope{Type: protocol.TypeMessage, Text: "hi"}), []byte("\n"))
+	bob.writeFrame(false, opText, msg[:4])
+	bob.writeFrame(true, opPing, []byte("are you there"))
+	bob.writeFrame(true, opContinuation, msg[4:])
+	if opcode, payload := bob.readFrame(t); opcode != opPong || string(payload) != "are you there" {
+		t.Errorf("ping answered with opcode %#x and %q", opcode, payload)
+	}
+	if e := alice.expect(t, protocol.TypeMessage); e.From != "bob" || e.Text != "hi" {
+		t.Errorf("alice received %+v", e)
+	}
+
+	bob.writeFrame(true, opClose, binary.BigEndian.AppendUint16(nil, 1000))
+	if code := bob.expectClose(t); code != 1000 {
+		t.Errorf("close echoed with %d, want 1000", code)
+	}
+	if e := alice.expect(t, protocol.TypeLeave); e.From != "bob" {
+		t.Errorf("alice was told %+v, want bob leaving", e)
+	}
+}
+
+// TestRejectedFrames checks that oversize messages, unmasked frames and stray
+// continuations end the connection.
+func TestRejectedFrames(t *testing.T) {
+	host := startGateway(t)
+
+	big := dial(t, host)
+	big.writeFrame(true, opText, make([]byte, protocol.MaxLineSize+1))
+	if code := big.expectClose(t); code != 1009 {
+		t.Errorf("oversize frame closed with %d, want 1009", code)
+	}
+
+	// a message over the limit in fragments that are each small enough
+	fragments := dial(t, host)
+	half := make([]byte, protocol.MaxLineSize/2+1)
+	fragments.writeFrame(false, opText, half)
+	fragments.writeFrame(true, opContinuation, half)
+	if code := fragments.expectClose(t); code != 1009 {
+		t.Errorf("oversize fragmented message closed with %d, want 1009", code)
+	}
+
+	for name, frame := range map[string][]byte{
+		"unmasked":     {0x80 | opText, 2, '{', '}'},
+		"continuation": {0x80 | opContinuation, 0x80, 0, 0, 0, 0},
+	} {
+		c := dial(t, host)
+		c.conn.Write(frame)
+		if _, err := io.ReadAll(c.reader); err != nil {
+			t.Errorf("%s frame: the connection was not closed: %v", name, err)
+		}
+	}
+}
+
+// TestIdleBrowser checks that a browser answering pings stays connected however
+// long it says nothing, and that one that stops answering is dropped.
+func TestIdleBrowser(t *testing.T) {
+	defer func(interval time.Duration) { web.PingInterval = interval }(web.PingInterval)
+	web.PingInterval = 50 * time.Millisecond
+	host := startGateway(t)
+
+	alice := dial(t, host)
+	alice.send(protocol.Envelope{Type: protocol.TypeRegister, From: "alice"})
+	alice.expect(t, protocol.TypeWelcome)
+	silent := dial(t, host)
+	silent.send(protocol.Envelope{Type: protocol.TypeRegister, From: "silent"})
+	silent.expect(t, protocol.TypeWelcome)
+
+	// stay idle for several times what a single read may take, answering pings
+	pings := 0
+	for idle := time.Now().Add(6 * web.PingInterval); time.Now().Before(idle); {
+		if opcode, payload := alice.readFrame(t); opcode == opPing {
+			pings++
+			alice.writeFrame(true, opPong, payload)
+		}
+	}
+	if pings < 3 {
+		t.Errorf("pinged %d times while idle, want at least 3", pings)
+	}
+
+	alice.send(protocol.Envelope{Type: protocol.TypeHeartbeat, Seq: 7})
+	for {
+		opcode, payload := alice.readFrame(t)
+		if opcode != opText {
+			continue
+		}
+		e := protocol.Decode(payload)
+		if e.Type == protocol.TypeLeave && e.From == "alice" {
+			t.Fatal("alice was dropped while answering pings")
+		}
+		if e.Type == protocol.TypeHeartbeatAck && e.Seq == 7 {
+			break
+		}
+	}
+
+	// the silent browser was dropped in the meantime
+	silent.conn.SetReadDeadline(time.Now().Add(time.Second))
+	if _, err := io.ReadAll(silent.reader); err != nil {
+		t.Errorf("a browser ignoring pings was not dropped: %v", err)
+	}
+}